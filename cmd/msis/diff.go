@@ -0,0 +1,134 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/manifest"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// diffFiles compares two builds at the install-model level. Each side is
+// either an .msis file or a manifest saved with /MANIFEST or /SAVEBASELINE.
+func diffFiles(oldFile, newFile string, args *cliArgs) error {
+	old, err := loadManifest(oldFile, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", oldFile, err)
+	}
+	cur, err := loadManifest(newFile, args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", newFile, err)
+	}
+
+	d := manifest.Compare(old, cur)
+	if args.json {
+		data, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Comparing %s -> %s\n", cli.Filename(oldFile), cli.Filename(newFile))
+	if d.Empty() {
+		fmt.Printf("  %s\n", cli.Success("No install-model changes"))
+		return nil
+	}
+	printChanges("Properties", d.Properties)
+	printChanges("Features", d.Features)
+	printChanges("Files", d.Files)
+	printChanges("Registry", d.Registry)
+	printChanges("Services", d.Services)
+	printChanges("Shortcuts", d.Shortcuts)
+	printChanges("Prerequisites", d.Prerequisites)
+	fmt.Println()
+	fmt.Printf("Upgrade: %s\n", d.Upgrade)
+	return nil
+}
+
+// printChanges writes one section of a diff as "+", "-", "~" and ">" lines.
+func printChanges(title string, changes []manifest.Change) {
+	if len(changes) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(cli.Bold(title))
+	for _, c := range changes {
+		line := c.Item
+		switch {
+		case c.From != "" && c.To != "":
+			line += ": " + c.From + " -> " + c.To
+		case c.To != "":
+			line += ": " + c.To
+		}
+		if c.Detail != "" {
+			line += " (" + c.Detail + ")"
+		}
+		switch c.Kind {
+		case manifest.Added:
+			fmt.Printf("  %s %s\n", cli.Success("+"), line)
+		case manifest.Removed:
+			fmt.Printf("  %s %s\n", cli.Error("-"), line)
+		case manifest.Moved:
+			fmt.Printf("  %s %s\n", cli.Info(">"), line)
+		default:
+			fmt.Printf("  %s %s\n", cli.Warning("~"), line)
+		}
+	}
+}
+
+// loadManifest reads a saved manifest or builds one from an .msis file.
+func loadManifest(filename string, args *cliArgs) (*manifest.Manifest, error) {
+	// A .msis.json file is a setup in JSON syntax, not a saved manifest
+	if strings.EqualFold(filepath.Ext(filename), ".json") && parser.SyntaxOf(filename) != parser.JSON {
+		return manifest.Load(filename)
+	}
+	ctx, err := generateContext(filename, args)
+	if err != nil {
+		return nil, err
+	}
+	return manifest.Build(ctx), nil
+}
+
+// generateContext runs an .msis file through parser, variable resolution and
+// generator without writing anything. /SET: overrides apply.
+func generateContext(filename string, args *cliArgs) (*generator.Context, error) {
+	ctx, _, err := generateModel(filename, args)
+	return ctx, err
+}
+
+// generateModel is generateContext that also returns the generated fragments.
+func generateModel(filename string, args *cliArgs) (*generator.Context, *generator.GeneratedOutput, error) {
+	setup, err := parser.Parse(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing: %w", err)
+	}
+	if setup.IsSetupBundle() {
+		return nil, nil, fmt.Errorf("bundles have no install model; use the .msis of the MSI package")
+	}
+
+	vars := variables.New()
+	vars.LoadFromSetup(setup)
+	for name, value := range args.setOverrides {
+		vars.Set(name, value)
+	}
+	if err := vars.ResolveAll(); err != nil {
+		return nil, nil, fmt.Errorf("resolving variables: %w", err)
+	}
+
+	ctx := generator.NewContext(setup, vars, filepath.Dir(filename))
+	output, err := ctx.Generate()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generating WXS: %w", err)
+	}
+	return ctx, output, nil
+}
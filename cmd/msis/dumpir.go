@@ -0,0 +1,25 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/gersonkurz/msis/internal/parser"
+)
+
+// dumpFile prints the parsed setup of an .msis file as a .msis.json
+// document, which shows how any of the three syntaxes was understood.
+func dumpFile(filename string, args *cliArgs) error {
+	setup, err := parser.Parse(filename)
+	if err != nil {
+		return fmt.Errorf("parsing: %w", err)
+	}
+	data, err := parser.DumpJSON(setup)
+	if err != nil {
+		return fmt.Errorf("encoding JSON: %w", err)
+	}
+	fmt.Print(string(data))
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/parser"
+)
+
+// formatFiles rewrites .msis files in canonical form, applying /SET
+// overrides to their <set> elements. With /CHECK nothing is written; the
+// files that would change are listed and an error is returned.
+func formatFiles(filenames []string, args *cliArgs) error {
+	var unformatted []string
+	for _, filename := range filenames {
+		if parser.SyntaxOf(filename) != parser.XML {
+			return fmt.Errorf("%s: /FORMAT only rewrites .msis XML files", filename)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", filename, err)
+		}
+		formatted, err := formatSource(data, args.setOverrides)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if bytes.Equal(data, formatted) {
+			continue
+		}
+		if args.check {
+			fmt.Println(filename)
+			unformatted = append(unformatted, filename)
+			continue
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, formatted, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+		fmt.Printf("Formatted %s\n", cli.Filename(filename))
+	}
+	if len(unformatted) > 0 {
+		return fmt.Errorf("%d file(s) not formatted; run msis /FORMAT to fix", len(unformatted))
+	}
+	return nil
+}
+
+// formatSource returns the canonical form of an .msis source. CRLF line
+// endings are kept.
+func formatSource(data []byte, overrides map[string]string) ([]byte, error) {
+	setup, err := parser.ParseBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		setup.SetVariable(name, overrides[name])
+	}
+	return writeSource(setup, data)
+}
+
+// writeSource writes a setup in canonical form, with the line endings of
+// the source it was parsed from.
+func writeSource(setup *ir.Setup, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	if err := parser.Write(&b, setup); err != nil {
+		return nil, err
+	}
+	formatted := b.Bytes()
+	if bytes.Contains(data, []byte("\r\n")) {
+		formatted = bytes.ReplaceAll(formatted, []byte("\n"), []byte("\r\n"))
+	}
+	return formatted, nil
+}
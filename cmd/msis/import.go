@@ -0,0 +1,71 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/wxsimport"
+)
+
+// importFile translates a WiX .wxs file into an .msis file next to it,
+// together with the .reg files of its registry values and a report of the
+// constructs that were not translated. Existing files are not overwritten.
+func importFile(filename string, args *cliArgs) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	res, err := wxsimport.Import(data, filepath.Base(base))
+	if err != nil {
+		return err
+	}
+
+	msisFile := base + ".msis"
+	reportFile := base + ".import.txt"
+	source := filepath.Base(filename)
+	res.Setup.Comments = []string{fmt.Sprintf(" Imported from %s by msis /IMPORT; see %s ", source, filepath.Base(reportFile))}
+	var b bytes.Buffer
+	if err := parser.Write(&b, res.Setup); err != nil {
+		return err
+	}
+
+	type output struct {
+		name string
+		data []byte
+	}
+	outputs := []output{{msisFile, b.Bytes()}}
+	for _, reg := range res.RegFiles {
+		outputs = append(outputs, output{filepath.Join(filepath.Dir(filename), reg.Name), reg.Data})
+	}
+	outputs = append(outputs, output{reportFile, []byte(res.Report(source))})
+	for _, out := range outputs {
+		if _, err := os.Stat(out.name); err == nil {
+			return fmt.Errorf("%s already exists; remove it to import again", out.name)
+		}
+	}
+	for _, out := range outputs {
+		if err := os.WriteFile(out.name, out.data, 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", out.name, err)
+		}
+		fmt.Printf("Wrote %s\n", cli.Filename(out.name))
+	}
+
+	if len(res.Findings) == 0 {
+		fmt.Println(cli.Success("Everything was translated."))
+		return nil
+	}
+	fmt.Println(cli.Warning(fmt.Sprintf("%d construct(s) were not translated or only in part:", len(res.Findings))))
+	for _, f := range res.Findings {
+		fmt.Printf("  %s\n", f)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/msi"
+)
+
+// maxCellWidth truncates long values (custom action scripts, conditions) in text output.
+const maxCellWidth = 60
+
+// inspectFile dumps the standard tables and cabinet contents of an MSI file.
+func inspectFile(filename string, args *cliArgs) error {
+	inspection, err := msi.Inspect(filename)
+	if err != nil {
+		return err
+	}
+
+	if args.json {
+		data, err := json.MarshalIndent(inspection, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Inspecting %s (codepage %d)\n", cli.Filename(filename), inspection.Codepage)
+	for _, table := range inspection.Tables {
+		fmt.Println()
+		fmt.Printf("%s (%s rows)\n", cli.Bold(table.Name), cli.Number(fmt.Sprintf("%d", len(table.Rows))))
+		printTable(table)
+	}
+
+	for _, cab := range inspection.Cabinets {
+		fmt.Println()
+		if !cab.Embedded {
+			fmt.Printf("%s %s (external, not inspected)\n", cli.Bold("Cabinet"), cli.Filename(cab.Name))
+			continue
+		}
+		fmt.Printf("%s %s (%s files)\n", cli.Bold("Cabinet"), cli.Filename(cab.Name), cli.Number(fmt.Sprintf("%d", len(cab.Files))))
+		for _, file := range cab.Files {
+			fmt.Printf("  %-16s %10d  %s  %s\n", file.Name, file.Size, file.Modified.Format("2006-01-02 15:04"), file.FileName)
+		}
+	}
+	return nil
+}
+
+// printTable writes a table as aligned text columns.
+func printTable(table *msi.Table) {
+	cells := make([][]string, len(table.Rows)+1)
+	widths := make([]int, len(table.Columns))
+	for c, col := range table.Columns {
+		cells[0] = append(cells[0], col.Name)
+		widths[c] = len(col.Name)
+	}
+	for r, row := range table.Rows {
+		for c, value := range row {
+			text := formatCell(value)
+			cells[r+1] = append(cells[r+1], text)
+			widths[c] = max(widths[c], len(text))
+		}
+	}
+
+	for r, row := range cells {
+		var sb strings.Builder
+		for c, text := range row {
+			if c < len(row)-1 {
+				fmt.Fprintf(&sb, "%-*s  ", widths[c], text)
+			} else {
+				sb.WriteString(text)
+			}
+		}
+		line := "  " + sb.String()
+		if r == 0 {
+			line = cli.Info(line)
+		}
+		fmt.Println(line)
+	}
+}
+
+func formatCell(value any) string {
+	if value == nil {
+		return ""
+	}
+	text := fmt.Sprint(value)
+	text = strings.NewReplacer("\r", "", "\n", " ").Replace(text)
+	if len(text) > maxCellWidth {
+		text = text[:maxCellWidth-3] + "..."
+	}
+	return text
+}
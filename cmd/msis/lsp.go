@@ -0,0 +1,16 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"os"
+
+	"github.com/gersonkurz/msis/internal/lsp"
+)
+
+// runLanguageServer serves .msis editing support to an editor over stdio.
+// Nothing else may write to stdout while it runs.
+func runLanguageServer() error {
+	return lsp.NewServer(os.Stdin, os.Stdout).Run()
+}
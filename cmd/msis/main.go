@@ -4,22 +4,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"maps"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 
-	"github.com/gersonkurz/msis/internal/bundle"
 	"github.com/gersonkurz/msis/internal/cli"
-	"github.com/gersonkurz/msis/internal/generator"
-	"github.com/gersonkurz/msis/internal/ir"
-	"github.com/gersonkurz/msis/internal/parser"
 	"github.com/gersonkurz/msis/internal/prereqcache"
-	"github.com/gersonkurz/msis/internal/template"
 	"github.com/gersonkurz/msis/internal/variables"
 	"github.com/gersonkurz/msis/internal/wix"
+	"github.com/gersonkurz/msis/pkg/msis"
 )
 
 // Version and BuildTime are set via ldflags at build time
@@ -37,6 +37,25 @@ type cliArgs struct {
 	standalone      bool              // Skip auto-bundling, use launch conditions only
 	noColor         bool              // Disable colored output
 	setOverrides    map[string]string // /SET:NAME=VALUE overrides
+	baseline        string            // /BASELINE:FILE manifest from the previous release
+	saveBaseline    string            // /SAVEBASELINE:FILE writes the component manifest
+	manifest        bool              // /MANIFEST writes a build manifest and SBOM next to the MSI
+	inspect         bool              // /INSPECT dumps the tables of existing .msi files
+	diff            bool              // /DIFF compares two .msis files or manifests
+	json            bool              // /JSON selects JSON output for /INSPECT and /DIFF
+	snapshot        bool              // /SNAPSHOT checks the install model against <file>.snap
+	snapshotWxs     bool              // /SNAPSHOTWXS includes the rendered WXS in the snapshot
+	update          bool              // /UPDATE (or -update) rewrites snapshots instead of checking
+	validate        bool              // /VALIDATE runs ICE checks on the component model
+	plan            bool              // /PLAN prints the install plan of .msis files
+	markdown        bool              // /MARKDOWN selects Markdown output for /PLAN
+	lsp             bool              // /LSP serves the language server protocol on stdio
+	schema          bool              // /SCHEMA prints the XSD of .msis files
+	format          bool              // /FORMAT rewrites .msis files in canonical form
+	check           bool              // /CHECK (or --check) lists unformatted files instead of rewriting them
+	dumpIR          bool              // /DUMP-IR prints the parsed setup as a .msis.json document
+	importWxs       bool              // /IMPORT translates WiX .wxs files into .msis
+	migrate         bool              // /MIGRATE rewrites msis-2.x files in the msis-3.x style
 	files           []string
 }
 
@@ -53,13 +72,64 @@ func main() {
 		os.Exit(0)
 	}
 
+	if args.schema {
+		if err := writeSchema(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", cli.Error("Error:"), err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args.lsp {
+		if err := runLanguageServer(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", cli.Error("Error:"), err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if len(args.files) == 0 {
 		printUsage()
 		os.Exit(10)
 	}
 
+	if args.format {
+		if err := formatFiles(args.files, args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", cli.Error("Error:"), err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if args.diff {
+		if len(args.files) != 2 {
+			fmt.Fprintf(os.Stderr, "%s /DIFF needs exactly two files (old and new)\n", cli.Error("Error:"))
+			os.Exit(2)
+		}
+		if err := diffFiles(args.files[0], args.files[1], args); err != nil {
+			fmt.Fprintf(os.Stderr, "%s %v\n", cli.Error("Error comparing"), err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	for _, filename := range args.files {
-		if err := processFile(filename, args); err != nil {
+		process := processFile
+		switch {
+		case args.inspect:
+			process = inspectFile
+		case args.plan:
+			process = planFile
+		case args.dumpIR:
+			process = dumpFile
+		case args.importWxs:
+			process = importFile
+		case args.migrate:
+			process = migrateFile
+		case args.snapshot:
+			process = snapshotFile
+		}
+		if err := process(filename, args); err != nil {
 			fmt.Fprintf(os.Stderr, "%s %s: %v\n", cli.Error("Error processing"), cli.Filename(filename), err)
 			os.Exit(1)
 		}
@@ -69,396 +139,156 @@ func main() {
 func processFile(filename string, args *cliArgs) error {
 	fmt.Printf("Processing %s...\n", cli.Filename(filename))
 
-	// Milestone 3.1 - Parse .msis into IR
-	setup, err := parser.Parse(filename)
+	// Ctrl+C cancels a running WiX build or prerequisite download
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	project, err := msis.Parse(ctx, filename, args.options())
 	if err != nil {
-		return fmt.Errorf("parsing: %w", err)
+		return err
 	}
 
 	fmt.Printf("  Parsed: %s sets, %s features, %s top-level items\n",
-		cli.Number(fmt.Sprintf("%d", len(setup.Sets))),
-		cli.Number(fmt.Sprintf("%d", len(setup.Features))),
-		cli.Number(fmt.Sprintf("%d", len(setup.Items))))
-
-	// Check if this is a bundle
-	isBundle := setup.IsSetupBundle()
-	if isBundle {
+		cli.Number(fmt.Sprintf("%d", project.Sets)),
+		cli.Number(fmt.Sprintf("%d", project.Features)),
+		cli.Number(fmt.Sprintf("%d", project.Items)))
+	if project.Bundle {
 		fmt.Printf("  Type: %s\n", cli.Info("Bundle (bootstrapper)"))
+	} else if name, ok := outputTypeNames[project.OutputType]; ok {
+		fmt.Printf("  Type: %s\n", cli.Info(name))
 	}
-
-	// Milestone 3.2 - Variable resolution
-	vars := variables.New()
-	vars.LoadFromSetup(setup)
-
-	// Apply /SET: command-line overrides
-	for name, value := range args.setOverrides {
-		vars.Set(name, value)
-		fmt.Printf("  Override: %s=%s\n", cli.Info(name), cli.Filename(value))
-	}
-
-	if err := vars.ResolveAll(); err != nil {
-		return fmt.Errorf("resolving variables: %w", err)
+	for _, name := range slices.Sorted(maps.Keys(args.setOverrides)) {
+		fmt.Printf("  Override: %s=%s\n", cli.Info(name), cli.Filename(args.setOverrides[name]))
 	}
-
 	fmt.Printf("  Product: %s v%s (%s)\n",
-		cli.Bold(vars.ProductName()), vars.ProductVersion(), vars.Platform())
-
-	// Check for deprecated variables
-	deprecatedWarnings := vars.CheckDeprecated()
-	if len(deprecatedWarnings) > 0 {
-		for _, warning := range deprecatedWarnings {
-			fmt.Printf("  %s\n", cli.Warning("Warning: "+warning))
-		}
+		cli.Bold(project.ProductName), project.ProductVersion, project.Platform)
+	if len(project.Languages) > 1 {
+		fmt.Printf("  Languages: %s\n", cli.Info(strings.Join(project.Languages, ", ")))
 	}
-
-	workDir := filepath.Dir(filename)
-
-	// Warn when VC++ runtime files appear to be bundled without <requires>.
-	if len(setup.Requires) == 0 && len(deprecatedWarnings) == 0 {
-		if hasVCRedistSources(setup) || hasVCRedistFolder(workDir) {
-			fmt.Printf("  %s\n", cli.Warning("Warning: VC++ runtime files detected but no <requires> element. msis-3.x no longer bundles VC runtimes implicitly (msis-2.x did). Add <requires type=\"vcredist\" version=\"2022\"/> or provide prerequisites."))
-		}
+	for _, warning := range project.Warnings {
+		fmt.Printf("  %s\n", cli.Warning("Warning: "+warning))
 	}
 
-	// Determine template folder
-	templateFolder := args.templateFolder
-	if templateFolder == "" {
-		templateFolder = getDefaultTemplateFolder()
-	}
-
-	// Determine custom templates folder
-	customTemplates := args.customTemplates
-	if customTemplates == "" {
-		customTemplates = getDefaultCustomTemplates()
-	}
-
-	// Branch based on bundle vs MSI
-	if isBundle {
-		return processBundleFile(setup, vars, workDir, templateFolder, customTemplates, args)
+	if project.Requirements > 0 && !project.Bundle {
+		if args.standalone || project.OutputType != variables.OutputMSI {
+			fmt.Printf("  Requirements: %s (standalone mode, using launch conditions)\n", cli.Number(fmt.Sprintf("%d", project.Requirements)))
+		} else {
+			fmt.Printf("  Requirements: %s (will auto-bundle)\n", cli.Number(fmt.Sprintf("%d", project.Requirements)))
+		}
 	}
-	return processMSIFile(setup, vars, workDir, templateFolder, customTemplates, filename, args)
-}
-
-// processMSIFile generates a standard MSI package.
-func processMSIFile(setup *ir.Setup, vars variables.Dictionary, workDir, templateFolder, customTemplates, filename string, args *cliArgs) error {
-	// Determine if auto-bundling is needed
-	needsAutoBundle := len(setup.Requires) > 0 && !args.standalone
 
-	if needsAutoBundle {
-		fmt.Printf("  Requirements: %s (will auto-bundle)\n", cli.Number(fmt.Sprintf("%d", len(setup.Requires))))
-	} else if len(setup.Requires) > 0 {
-		fmt.Printf("  Requirements: %s (standalone mode, using launch conditions)\n", cli.Number(fmt.Sprintf("%d", len(setup.Requires))))
+	generated, err := msis.Generate(ctx, project)
+	if generated != nil {
+		printGenerated(generated, args)
 	}
-
-	// Milestone 3.3 - WXS generation
-	ctx := generator.NewContext(setup, vars, workDir)
-	output, err := ctx.Generate()
 	if err != nil {
-		return fmt.Errorf("generating WXS: %w", err)
-	}
-
-	// Count components generated
-	componentCount := 0
-	for _, compIDs := range ctx.FeatureComponents {
-		componentCount += len(compIDs)
+		return err
 	}
-	fmt.Printf("  Generated: %s directories, %s components\n",
-		cli.Number(fmt.Sprintf("%d", len(ctx.DirectoryTrees))),
-		cli.Number(fmt.Sprintf("%d", componentCount)))
 
 	if args.dryRun {
 		fmt.Printf("  %s\n", cli.Info("[dry-run] Parse and validate complete"))
 		return nil
 	}
 
-	// Milestone 3.4 - Template rendering
-	renderer := template.NewRenderer(vars, templateFolder, customTemplates, output)
-
-	// Support custom template override via --template flag
-	if args.template != "" {
-		renderer.SetCustomTemplate(args.template)
-	}
-
-	// Select silent or regular template based on setup.Silent
-	var wxsContent string
-	if setup.Silent {
-		// Try silent template first
-		wxsContent, err = renderer.RenderSilent()
-		if err != nil {
-			return fmt.Errorf("rendering silent template: %w", err)
-		}
-		if wxsContent == "" {
-			// No silent template available, fall back to regular
-			wxsContent, err = renderer.Render()
-			if err != nil {
-				return fmt.Errorf("rendering template: %w", err)
-			}
-		}
-	} else {
-		wxsContent, err = renderer.Render()
-		if err != nil {
-			return fmt.Errorf("rendering template: %w", err)
-		}
-	}
-
-	// Determine output filename
-	wxsFile := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".wxs"
-	if vars.BuildTarget() != "" {
-		wxsFile = strings.TrimSuffix(vars.BuildTarget(), filepath.Ext(vars.BuildTarget())) + ".wxs"
-	}
-
-	// Write WXS file
-	if err := os.WriteFile(wxsFile, []byte(wxsContent), 0644); err != nil {
-		return fmt.Errorf("writing WXS file: %w", err)
+	rendered, err := msis.Render(ctx, generated)
+	if err != nil {
+		return err
 	}
-	fmt.Printf("  Written: %s\n", cli.Filename(wxsFile))
-
-	// Milestone 3.5 - WiX CLI integration
 	if args.build {
-		if !wix.IsWixAvailable() {
-			return fmt.Errorf("wix CLI not found in PATH; install WiX Toolset 6")
-		}
-
-		builder := wix.NewBuilder(vars, wxsFile, templateFolder, customTemplates, workDir, args.retainWxs)
-		if err := builder.Build(); err != nil {
-			return fmt.Errorf("building MSI: %w", err)
-		}
-
-		// Compute actual MSI output path (same logic as wix.NewBuilder)
-		msiPath := vars.BuildTarget()
-		if msiPath == "" {
-			msiPath = strings.TrimSuffix(wxsFile, filepath.Ext(wxsFile)) + ".msi"
+		built, err := msis.Build(ctx, rendered)
+		if err != nil {
+			return err
 		}
-		fmt.Printf("  %s %s\n", cli.Success("Built:"), cli.Filename(msiPath))
-
-		// Milestone 6.2 - Auto-bundle if requirements present
-		if needsAutoBundle {
-			return processAutoBundle(setup, vars, workDir, templateFolder, customTemplates, msiPath, args)
+		for _, t := range built.Transforms {
+			fmt.Printf("  Install %s: %s\n", cli.Info(t.Name), t.Command)
 		}
 	}
-
 	return nil
 }
 
-// processAutoBundle generates a bundle wrapper for an MSI with prerequisites.
-func processAutoBundle(setup *ir.Setup, vars variables.Dictionary, workDir, templateFolder, customTemplates, msiPath string, args *cliArgs) error {
-	fmt.Printf("  %s\n", cli.Info("Generating auto-bundle wrapper..."))
-
-	// Convert and validate requirements
-	prereqs, err := bundle.RequirementsToPrerequisites(setup.Requires)
-	if err != nil {
-		return fmt.Errorf("invalid requirement: %w", err)
-	}
-
-	// Generate bundle chain
-	gen := bundle.NewAutoBundleGenerator(vars, workDir, msiPath, prereqs)
-
-	// Enable caching - download prerequisites if needed
-	cache, err := prereqcache.NewCache()
-	if err != nil {
-		fmt.Printf("  %s: could not initialize prerequisite cache: %v\n", cli.Warning("Warning"), err)
-		fmt.Printf("  %s\n", cli.Info("Prerequisites will be expected in local 'prerequisites' folder"))
-	} else {
-		gen.SetCache(cache)
-
-		// Ensure all prerequisites are cached (download if needed)
-		fmt.Printf("  %s\n", cli.Info("Checking prerequisites..."))
-		progress := func(msg string) {
-			fmt.Printf("    %s\n", cli.Info(msg))
-		}
-		if err := gen.EnsurePrerequisites(progress); err != nil {
-			return fmt.Errorf("ensuring prerequisites: %w", err)
-		}
-	}
-
-	bundleOutput, err := gen.Generate()
-	if err != nil {
-		return fmt.Errorf("generating auto-bundle: %w", err)
-	}
-
-	fmt.Printf("  Auto-bundle: %s prerequisites + MSI\n", cli.Number(fmt.Sprintf("%d", len(prereqs))))
-
-	// Render bundle template
-	wxsContent, err := renderBundleTemplate(vars, templateFolder, customTemplates, bundleOutput, setup.Silent)
-	if err != nil {
-		return fmt.Errorf("rendering bundle template: %w", err)
-	}
-
-	// Determine output filename (bundle produces .exe)
-	baseName := strings.TrimSuffix(msiPath, filepath.Ext(msiPath))
-	wxsFile := baseName + "-bundle.wxs"
-
-	// Write WXS file
-	if err := os.WriteFile(wxsFile, []byte(wxsContent), 0644); err != nil {
-		return fmt.Errorf("writing bundle WXS file: %w", err)
-	}
-	fmt.Printf("  Written: %s\n", cli.Filename(wxsFile))
-
-	// Build bundle
-	bundleBuilder := wix.NewBundleBuilder(vars, wxsFile, templateFolder, customTemplates, args.retainWxs)
-	if err := bundleBuilder.Build(); err != nil {
-		return fmt.Errorf("building bundle: %w", err)
-	}
-
-	fmt.Printf("  %s %s\n", cli.Success("Built:"), cli.Filename(baseName+".exe"))
-
-	return nil
+// outputTypeNames describes the OUTPUT_TYPE values other than msi.
+var outputTypeNames = map[string]string{
+	"msm":    "Merge module (.msm)",
+	"wixlib": "WiX library (.wixlib)",
 }
 
-func hasVCRedistSources(setup *ir.Setup) bool {
-	if scanItemsForVCRedist(setup.Items) {
-		return true
+// options translates the command line into build options.
+func (args *cliArgs) options() msis.Options {
+	return msis.Options{
+		TemplateFolder:  args.templateFolder,
+		CustomTemplates: args.customTemplates,
+		Template:        args.template,
+		Variables:       args.setOverrides,
+		Standalone:      args.standalone,
+		RetainWxs:       args.retainWxs,
+		Validate:        args.validate,
+		Baseline:        args.baseline,
+		SaveBaseline:    args.saveBaseline,
+		Manifest:        args.manifest,
+		Progress:        printProgress,
+		Output:          os.Stdout,
 	}
-	return scanFeaturesForVCRedist(setup.Features)
 }
 
-func scanFeaturesForVCRedist(features []ir.Feature) bool {
-	for _, feature := range features {
-		if scanItemsForVCRedist(feature.Items) {
-			return true
-		}
-		if scanFeaturesForVCRedist(feature.SubFeatures) {
-			return true
-		}
-	}
-	return false
-}
-
-func scanItemsForVCRedist(items []ir.Item) bool {
-	for _, item := range items {
-		files, ok := item.(ir.Files)
-		if !ok {
-			continue
-		}
-		source := strings.ToLower(files.Source)
-		if strings.Contains(source, "vc_redist") || strings.Contains(source, "vcredist") {
-			return true
-		}
+// printProgress prints the progress of a build.
+func printProgress(e msis.Event) {
+	switch e.Kind {
+	case msis.Step:
+		fmt.Printf("  %s\n", cli.Info(e.Message))
+	case msis.Detail:
+		fmt.Printf("    %s\n", cli.Info(e.Message))
+	case msis.Warning:
+		fmt.Printf("  %s\n", cli.Warning("Warning: "+e.Message))
+	case msis.Written:
+		fmt.Printf("  Written: %s\n", cli.Filename(e.Path))
+	case msis.Command:
+		fmt.Printf("  Running: %s\n", e.Message)
+	case msis.Built:
+		fmt.Printf("  %s %s\n", cli.Success("Built:"), cli.Filename(e.Path))
 	}
-	return false
 }
 
-func hasVCRedistFolder(workDir string) bool {
-	candidates := []string{
-		filepath.Join(workDir, "Setup", "Tools", "vc_redist"),
+// printGenerated prints the size of the generated model and the results of
+// the baseline and ICE checks.
+func printGenerated(g *msis.Generated, args *cliArgs) {
+	if g.Project.Bundle {
+		fmt.Printf("  Generated: %s prerequisites, %s exe packages\n",
+			cli.Number(fmt.Sprintf("%d", g.Prerequisites)),
+			cli.Number(fmt.Sprintf("%d", g.ExePackages)))
+		return
 	}
-	for _, candidate := range candidates {
-		info, err := os.Stat(candidate)
-		if err == nil && info.IsDir() {
-			return true
-		}
-	}
-	return false
-}
-
-// processBundleFile generates a WiX Bundle (bootstrapper).
-func processBundleFile(setup *ir.Setup, vars variables.Dictionary, workDir, templateFolder, customTemplates string, args *cliArgs) error {
-	// Generate bundle chain
-	gen := bundle.NewGenerator(setup, vars, workDir)
-
-	// Enable caching if building (download prerequisites if needed)
-	if args.build && len(setup.Bundle.Prerequisites) > 0 {
-		cache, err := prereqcache.NewCache()
-		if err != nil {
-			fmt.Printf("  %s: could not initialize prerequisite cache: %v\n", cli.Warning("Warning"), err)
-			fmt.Printf("  %s\n", cli.Info("Prerequisites will be expected in local 'prerequisites' folder"))
-		} else {
-			gen.SetCache(cache)
-
-			// Ensure all prerequisites are cached (download if needed)
-			fmt.Printf("  %s\n", cli.Info("Checking prerequisites..."))
-			progress := func(msg string) {
-				fmt.Printf("    %s\n", cli.Info(msg))
-			}
-			if err := gen.EnsurePrerequisites(progress); err != nil {
-				return fmt.Errorf("ensuring prerequisites: %w", err)
+	fmt.Printf("  Generated: %s directories, %s components\n",
+		cli.Number(fmt.Sprintf("%d", g.Directories)),
+		cli.Number(fmt.Sprintf("%d", g.Components)))
+
+	if b := g.Baseline; b != nil {
+		fmt.Printf("  Baseline: %s (v%s)\n", cli.Filename(args.baseline), b.Version)
+		for _, finding := range b.Findings {
+			switch finding.Severity {
+			case "unsafe":
+				fmt.Printf("    %s %s\n", cli.Error("[unsafe]"), finding.Message)
+			case "major":
+				fmt.Printf("    %s %s\n", cli.Warning("[major]"), finding.Message)
+			default:
+				fmt.Printf("    %s %s\n", cli.Info("[info]"), finding.Message)
 			}
 		}
-	}
-
-	bundleOutput, err := gen.Generate()
-	if err != nil {
-		return fmt.Errorf("generating bundle: %w", err)
-	}
-
-	prereqCount := len(setup.Bundle.Prerequisites)
-	exeCount := len(setup.Bundle.ExePackages)
-	fmt.Printf("  Generated: %s prerequisites, %s exe packages\n",
-		cli.Number(fmt.Sprintf("%d", prereqCount)),
-		cli.Number(fmt.Sprintf("%d", exeCount)))
-
-	if args.dryRun {
-		fmt.Printf("  %s\n", cli.Info("[dry-run] Parse and validate complete"))
-		return nil
-	}
-
-	// Render bundle template
-	wxsContent, err := renderBundleTemplate(vars, templateFolder, customTemplates, bundleOutput, setup.Silent)
-	if err != nil {
-		return fmt.Errorf("rendering bundle template: %w", err)
-	}
-
-	// Determine output filename (bundle produces .exe)
-	baseName := vars.BuildTarget()
-	if baseName == "" {
-		baseName = vars.ProductName() + "-" + vars.ProductVersion()
-	}
-	baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
-	wxsFile := baseName + "-bundle.wxs"
-
-	// Write WXS file
-	if err := os.WriteFile(wxsFile, []byte(wxsContent), 0644); err != nil {
-		return fmt.Errorf("writing bundle WXS file: %w", err)
-	}
-	fmt.Printf("  Written: %s\n", cli.Filename(wxsFile))
-
-	// Build bundle
-	if args.build {
-		if !wix.IsWixAvailable() {
-			return fmt.Errorf("wix CLI not found in PATH; install WiX Toolset 6")
+		switch b.Severity {
+		case "major":
+			fmt.Printf("  Upgrade: %s\n", cli.Warning(b.Verdict))
+		case "info":
+			fmt.Printf("  Upgrade: %s\n", cli.Success(b.Verdict))
 		}
-
-		builder := wix.NewBundleBuilder(vars, wxsFile, templateFolder, customTemplates, args.retainWxs)
-		if err := builder.Build(); err != nil {
-			return fmt.Errorf("building bundle: %w", err)
-		}
-
-		fmt.Printf("  %s %s\n", cli.Success("Built:"), cli.Filename(baseName+".exe"))
 	}
-
-	return nil
-}
-
-// renderBundleTemplate renders the bundle WXS template.
-func renderBundleTemplate(vars variables.Dictionary, templateFolder, customTemplates string, bundleOutput *bundle.GeneratedBundle, silent bool) (string, error) {
-	// Read bundle template
-	templateName := "bundle.wxs"
-	if silent {
-		templateName = "bundle-silent.wxs"
-	}
-
-	templatePath := filepath.Join(templateFolder, templateName)
-	if customTemplates != "" {
-		customPath := filepath.Join(customTemplates, templateName)
-		if _, err := os.Stat(customPath); err == nil {
-			templatePath = customPath
-		}
+	if g.Baseline != nil && g.Baseline.Severity == "unsafe" {
+		return // The build fails with the verdict
 	}
-
-	tmplContent, err := os.ReadFile(templatePath)
-	if err != nil {
-		return "", fmt.Errorf("reading bundle template: %w", err)
+	if args.saveBaseline != "" {
+		fmt.Printf("  Written: %s\n", cli.Filename(args.saveBaseline))
 	}
-
-	// Build context for template
-	ctx := make(map[string]interface{})
-	for k, v := range vars {
-		ctx[k] = v
+	if args.validate {
+		printFindings(g.Findings, g.Project.File)
 	}
-	ctx["CHAIN"] = bundleOutput.ChainXML
-
-	// Render using raymond (same as MSI templates)
-	return template.RenderString(string(tmplContent), ctx)
 }
 
 func parseArgs() *cliArgs {
@@ -529,6 +359,25 @@ func parseArgs() *cliArgs {
 	fs.BoolVar(&args.status, "status", false, "")
 	fs.BoolVar(&args.standalone, "standalone", false, "")
 	fs.BoolVar(&args.noColor, "no-color", false, "")
+	fs.StringVar(&args.baseline, "baseline", "", "")
+	fs.StringVar(&args.saveBaseline, "savebaseline", "", "")
+	fs.BoolVar(&args.manifest, "manifest", false, "")
+	fs.BoolVar(&args.inspect, "inspect", false, "")
+	fs.BoolVar(&args.diff, "diff", false, "")
+	fs.BoolVar(&args.json, "json", false, "")
+	fs.BoolVar(&args.snapshot, "snapshot", false, "")
+	fs.BoolVar(&args.snapshotWxs, "snapshotwxs", false, "")
+	fs.BoolVar(&args.update, "update", false, "")
+	fs.BoolVar(&args.validate, "validate", false, "")
+	fs.BoolVar(&args.plan, "plan", false, "")
+	fs.BoolVar(&args.markdown, "markdown", false, "")
+	fs.BoolVar(&args.lsp, "lsp", false, "")
+	fs.BoolVar(&args.schema, "schema", false, "")
+	fs.BoolVar(&args.format, "format", false, "")
+	fs.BoolVar(&args.check, "check", false, "")
+	fs.BoolVar(&args.dumpIR, "dump-ir", false, "")
+	fs.BoolVar(&args.importWxs, "import", false, "")
+	fs.BoolVar(&args.migrate, "migrate", false, "")
 
 	// Help flags
 	var showHelp bool
@@ -559,6 +408,14 @@ func parseArgs() *cliArgs {
 	}
 
 	if showHelp {
+		if fs.NArg() > 0 {
+			if err := printElementHelp(fs.Args()); err != nil {
+				fmt.Fprintf(os.Stderr, "%s %v\n\n", cli.Error("Error:"), err)
+				printElements()
+				os.Exit(2)
+			}
+			os.Exit(0)
+		}
 		printUsage()
 		os.Exit(0)
 	}
@@ -575,44 +432,6 @@ func (d *discardWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-// getDefaultTemplateFolder returns the default template folder path.
-// Search order:
-// 1. %LOCALAPPDATA%\msis\templates (installed location)
-// 2. Executable directory\templates (portable/dev)
-// 3. Current directory\templates (fallback)
-func getDefaultTemplateFolder() string {
-	// 1. Check installed location: %LOCALAPPDATA%\msis\templates
-	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-		installedPath := filepath.Join(localAppData, "msis", "templates")
-		if _, err := os.Stat(installedPath); err == nil {
-			return installedPath
-		}
-	}
-
-	// 2. Check executable directory
-	if exePath, err := os.Executable(); err == nil {
-		exeDir := filepath.Dir(exePath)
-		exeTemplates := filepath.Join(exeDir, "templates")
-		if _, err := os.Stat(exeTemplates); err == nil {
-			return exeTemplates
-		}
-	}
-
-	// 3. Fallback to relative path
-	return "templates"
-}
-
-// getDefaultCustomTemplates returns the default custom templates folder path.
-func getDefaultCustomTemplates() string {
-	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
-		customPath := filepath.Join(localAppData, "msis", "custom")
-		if _, err := os.Stat(customPath); err == nil {
-			return customPath
-		}
-	}
-	return ""
-}
-
 func printUsage() {
 	fmt.Printf("MSIS - Version %s\n", cli.Bold(Version))
 	fmt.Printf("MSI-Simplified installer generator [%s/%s]\n", runtime.GOOS, runtime.GOARCH)
@@ -630,9 +449,30 @@ func printUsage() {
 	fmt.Printf("  %s            Parse and validate only, no output\n", cli.Info("/DRY-RUN"))
 	fmt.Printf("  %s         Skip auto-bundling, use launch conditions only\n", cli.Info("/STANDALONE"))
 	fmt.Printf("  %s           Disable colored output\n", cli.Info("/NO-COLOR"))
+	fmt.Printf("  %s      Check component rules against a previous release\n", cli.Info("/BASELINE:FILE"))
+	fmt.Printf("  %s  Save the component set as baseline for the next release\n", cli.Info("/SAVEBASELINE:FILE"))
+	fmt.Printf("  %s           Write build manifest and CycloneDX SBOM next to the MSI\n", cli.Info("/MANIFEST"))
+	fmt.Printf("  %s            Show tables and cabinet contents of existing .msi files\n", cli.Info("/INSPECT"))
+	fmt.Printf("  %s               Compare two .msis files or saved manifests (old new)\n", cli.Info("/DIFF"))
+	fmt.Printf("  %s               Use JSON output (with /INSPECT, /DIFF, /PLAN)\n", cli.Info("/JSON"))
+	fmt.Printf("  %s           Check the install model against the golden .snap file\n", cli.Info("/SNAPSHOT"))
+	fmt.Printf("  %s        Include the rendered WXS in the snapshot\n", cli.Info("/SNAPSHOTWXS"))
+	fmt.Printf("  %s             Rewrite snapshots instead of checking them (also -update)\n", cli.Info("/UPDATE"))
+	fmt.Printf("  %s           Run ICE checks (ICE03, 08, 30, 38, 43, 57, 64, 69, 91)\n", cli.Info("/VALIDATE"))
+	fmt.Printf("  %s               Show target tree, actions and sizes per feature\n", cli.Info("/PLAN"))
+	fmt.Printf("  %s           Use Markdown output (with /PLAN)\n", cli.Info("/MARKDOWN"))
+	fmt.Printf("  %s                Run the language server for editors on stdin/stdout\n", cli.Info("/LSP"))
+	fmt.Printf("  %s             Print the XML schema (XSD) of .msis files\n", cli.Info("/SCHEMA"))
+	fmt.Printf("  %s             Rewrite .msis files in canonical form, applying /SET\n", cli.Info("/FORMAT"))
+	fmt.Printf("  %s              List unformatted files instead (with /FORMAT, also --check)\n", cli.Info("/CHECK"))
+	fmt.Printf("  %s            Print the parsed setup as JSON (any input syntax)\n", cli.Info("/DUMP-IR"))
+	fmt.Printf("  %s             Translate WiX .wxs files into .msis, with a report\n", cli.Info("/IMPORT"))
+	fmt.Printf("  %s            Rewrite msis-2.x files in place and list manual follow-ups\n", cli.Info("/MIGRATE"))
 	fmt.Printf("  %s             Show configuration status\n", cli.Info("/STATUS"))
 	fmt.Printf("  %s           Show this help message\n", cli.Info("/?, /HELP"))
 	fmt.Println()
+	printElements()
+	fmt.Println()
 	fmt.Println(cli.Bold("Template folder search order:"))
 	fmt.Println("  1. %LOCALAPPDATA%\\msis\\templates (installed)")
 	fmt.Println("  2. <executable-dir>\\templates (portable)")
@@ -645,6 +485,18 @@ func printUsage() {
 	fmt.Printf("  %s       Build MSI only (no auto-bundle)\n", cli.Filename("msis /BUILD /STANDALONE setup.msis"))
 	fmt.Printf("  %s\n", cli.Filename("msis /SET:PRODUCT_VERSION=2.0.0 /BUILD setup.msis"))
 	fmt.Printf("  %s                 Validate only\n", cli.Filename("msis /DRY-RUN setup.msis"))
+	fmt.Printf("  %s       Report ICE errors without Windows\n", cli.Filename("msis /VALIDATE /DRY-RUN setup.msis"))
+	fmt.Printf("  %s\n", cli.Filename("msis /BUILD /BASELINE:1.0.json /SAVEBASELINE:1.1.json setup.msis"))
+	fmt.Printf("  %s            Dump MSI tables as JSON\n", cli.Filename("msis /INSPECT /JSON setup.msi"))
+	fmt.Printf("  %s  Show install-model changes\n", cli.Filename("msis /DIFF 1.0.manifest.json setup.msis"))
+	fmt.Printf("  %s            Accept changed snapshots\n", cli.Filename("msis /SNAPSHOT -update *.msis"))
+	fmt.Printf("  %s          Install plan for a review\n", cli.Filename("msis /PLAN /MARKDOWN setup.msis"))
+	fmt.Printf("  %s                         Attributes of <files>\n", cli.Filename("msis /HELP files"))
+	fmt.Printf("  %s\n", cli.Filename("msis /FORMAT /SET:PRODUCT_VERSION=3.1.0 setup.msis"))
+	fmt.Printf("  %s              Fail CI on unformatted files\n", cli.Filename("msis /FORMAT --check *.msis"))
+	fmt.Printf("  %s\n", cli.Filename("msis /DUMP-IR setup.msis > setup.msis.json"))
+	fmt.Printf("  %s                 Move a WiX project onto msis\n", cli.Filename("msis /IMPORT product.wxs"))
+	fmt.Printf("  %s                   Update an msis-2.x setup\n", cli.Filename("msis /MIGRATE old.msis"))
 }
 
 func printStatus(args *cliArgs) {
@@ -701,7 +553,7 @@ func printStatus(args *cliArgs) {
 	// Determine effective template folder
 	templateFolder := args.templateFolder
 	if templateFolder == "" {
-		templateFolder = getDefaultTemplateFolder()
+		templateFolder = msis.DefaultTemplateFolder()
 	}
 	if _, err := os.Stat(templateFolder); err != nil {
 		fmt.Printf("  Base templates: %s %s\n", cli.Filename(templateFolder), cli.Warning("(not found)"))
@@ -712,7 +564,7 @@ func printStatus(args *cliArgs) {
 	// Custom templates
 	customTemplates := args.customTemplates
 	if customTemplates == "" {
-		customTemplates = getDefaultCustomTemplates()
+		customTemplates = msis.DefaultCustomTemplates()
 	}
 	if customTemplates != "" {
 		if _, err := os.Stat(customTemplates); err != nil {
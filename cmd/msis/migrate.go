@@ -0,0 +1,78 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/migrate"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/textdiff"
+)
+
+// migrateFile rewrites an msis-2.x file in place in the msis-3.x style. The
+// file is written in canonical form; as that is a step of its own, the diff
+// starts from the formatted file and shows the migration only. The changes
+// and the manual follow-ups are printed.
+func migrateFile(filename string, args *cliArgs) error {
+	if parser.SyntaxOf(filename) != parser.XML {
+		return fmt.Errorf("/MIGRATE only rewrites .msis XML files")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("reading file: %w", err)
+	}
+	setup, err := parser.ParseBytes(data)
+	if err != nil {
+		return fmt.Errorf("parsing: %w", err)
+	}
+
+	res := migrate.Setup(setup)
+	if migrate.HasVCRuntimeFolder(filepath.Dir(filename)) {
+		res.FollowUps = append(res.FollowUps, `Setup\Tools\vc_redist is no longer used by msis-3.x; delete it once the <requires> element is in place.`)
+	}
+
+	fmt.Printf("Migrating %s...\n", cli.Filename(filename))
+	if len(res.Changes) == 0 {
+		fmt.Printf("  %s\n", cli.Success("Nothing to migrate"))
+	} else {
+		formatted, err := formatSource(data, nil)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(formatted, data) {
+			fmt.Printf("  %s rewritten in canonical form, as /FORMAT does\n", cli.Success("Formatted:"))
+		}
+		migrated, err := writeSource(setup, data)
+		if err != nil {
+			return err
+		}
+		normalize := func(b []byte) string { return strings.ReplaceAll(string(b), "\r\n", "\n") }
+		if diff := textdiff.Unified(filename+" (formatted)", filename+" (migrated)", normalize(formatted), normalize(migrated), 3); diff != "" {
+			printDiff(diff)
+		}
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, migrated, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("writing %s: %w", filename, err)
+		}
+		for _, change := range res.Changes {
+			fmt.Printf("  %s %s\n", cli.Success("Migrated:"), change)
+		}
+	}
+	if len(res.FollowUps) > 0 {
+		fmt.Printf("  %s\n", cli.Warning(fmt.Sprintf("%d manual follow-up(s):", len(res.FollowUps))))
+		for _, followUp := range res.FollowUps {
+			fmt.Printf("    - %s\n", followUp)
+		}
+	}
+	return nil
+}
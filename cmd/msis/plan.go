@@ -0,0 +1,38 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gersonkurz/msis/internal/plan"
+)
+
+// planFile prints the install plan of an .msis file as a tree, or as JSON
+// or Markdown. Nothing is written to disk.
+func planFile(filename string, args *cliArgs) error {
+	ctx, err := generateContext(filename, args)
+	if err != nil {
+		return err
+	}
+	p, err := plan.Build(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case args.json:
+		data, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding JSON: %w", err)
+		}
+		fmt.Println(string(data))
+	case args.markdown:
+		fmt.Print(plan.RenderMarkdown(p))
+	default:
+		fmt.Print(plan.RenderTree(p))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/parser"
+)
+
+// writeSchema prints the XML schema of .msis files.
+func writeSchema() error {
+	_, err := os.Stdout.Write(parser.XSD())
+	return err
+}
+
+// printElements lists the .msis elements in the usage text.
+func printElements() {
+	fmt.Println(cli.Bold("Elements:") + " (msis /HELP ELEMENT shows the attributes)")
+	line := " "
+	for _, e := range parser.Elements {
+		if len(line)+len(e.Name)+1 > 78 {
+			fmt.Println(line)
+			line = " "
+		}
+		line += " " + e.Name
+	}
+	fmt.Println(line)
+}
+
+// printElementHelp prints the reference of the named elements.
+func printElementHelp(names []string) error {
+	for i, name := range names {
+		e, ok := parser.LookupElement(strings.Trim(strings.ToLower(name), "<>/"))
+		if !ok {
+			return fmt.Errorf("unknown element %q", name)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s  %s\n", cli.Bold("<"+e.Name+">"), e.Doc)
+		for _, a := range e.Attributes {
+			required := ""
+			if a.Required {
+				required = " (required)"
+			}
+			fmt.Printf("  %s%s  %s\n", cli.Info(a.Name), required, a.Doc)
+			if choices := a.Choices(); len(choices) > 0 {
+				fmt.Printf("      Values: %s\n", strings.Join(choices, ", "))
+			}
+		}
+		if len(e.Children) > 0 {
+			fmt.Printf("  Contains: %s\n", strings.Join(e.Children, ", "))
+		}
+	}
+	return nil
+}
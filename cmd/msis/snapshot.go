@@ -0,0 +1,118 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/snapshot"
+	"github.com/gersonkurz/msis/internal/template"
+	"github.com/gersonkurz/msis/pkg/msis"
+)
+
+// snapshotFile checks the install model of an .msis file against
+// <file>.snap, after the ICE checks with /VALIDATE.
+func snapshotFile(filename string, args *cliArgs) error {
+	fmt.Printf("Processing %s...\n", cli.Filename(filename))
+	ctx, output, err := generateModel(filename, args)
+	if err != nil {
+		return err
+	}
+	if args.validate {
+		if err := runValidation(ctx, filename); err != nil {
+			return err
+		}
+	}
+	return checkSnapshot(ctx, output, filename, args)
+}
+
+// checkSnapshot compares the generated install model with <file>.snap.
+// A missing snapshot is written; with /UPDATE an existing one is replaced.
+func checkSnapshot(ctx *generator.Context, output *generator.GeneratedOutput, filename string, args *cliArgs) error {
+	opts := snapshot.Options{Paths: map[string]string{}}
+	if absWorkDir, err := filepath.Abs(ctx.WorkDir); err == nil {
+		opts.Paths[absWorkDir] = "{workdir}"
+	}
+	if args.snapshotWxs {
+		templateFolder := args.templateFolder
+		if templateFolder == "" {
+			templateFolder = msis.DefaultTemplateFolder()
+		}
+		customTemplates := args.customTemplates
+		if customTemplates == "" {
+			customTemplates = msis.DefaultCustomTemplates()
+		}
+		renderer := template.NewRenderer(ctx.Variables, templateFolder, customTemplates, output)
+		if args.template != "" {
+			renderer.SetCustomTemplate(args.template)
+		}
+		wxs, err := renderer.RenderSetup(ctx.Setup.Silent)
+		if err != nil {
+			return err
+		}
+		opts.WXS = wxs
+		if abs, err := filepath.Abs(templateFolder); err == nil {
+			opts.Paths[abs] = "{templates}"
+		}
+		if customTemplates != "" {
+			if abs, err := filepath.Abs(customTemplates); err == nil {
+				opts.Paths[abs] = "{customtemplates}"
+			}
+		}
+	}
+
+	snapFile := parser.TrimExt(filename) + ".snap"
+	content := snapshot.Render(ctx, output, opts)
+
+	if args.update {
+		if err := snapshot.Write(snapFile, content); err != nil {
+			return err
+		}
+		fmt.Printf("  Updated: %s\n", cli.Filename(snapFile))
+		return nil
+	}
+
+	diff, err := snapshot.Check(snapFile, content)
+	if errors.Is(err, os.ErrNotExist) {
+		if err := snapshot.Write(snapFile, content); err != nil {
+			return err
+		}
+		fmt.Printf("  Written: %s (new snapshot)\n", cli.Filename(snapFile))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		printDiff(diff)
+		return fmt.Errorf("snapshot %s does not match (run with /UPDATE to accept the change)", snapFile)
+	}
+	fmt.Printf("  %s %s\n", cli.Success("Snapshot matches:"), cli.Filename(snapFile))
+	return nil
+}
+
+// printDiff prints a unified diff, indented and colored.
+func printDiff(diff string) {
+	for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Printf("  %s\n", cli.Bold(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Printf("  %s\n", cli.Success(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Printf("  %s\n", cli.Error(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Printf("  %s\n", cli.Info(line))
+		default:
+			fmt.Printf("  %s\n", line)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2013-2026, Gerson Kurz, NG Branch Technology GmbH
+// MIT License
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/gersonkurz/msis/internal/cli"
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ice"
+	"github.com/gersonkurz/msis/pkg/msis"
+)
+
+// runValidation runs the ICE checks on the generated component model and
+// prints the findings. Error findings fail the file.
+func runValidation(ctx *generator.Context, filename string) error {
+	var findings []msis.Finding
+	for _, f := range ice.Validate(ctx) {
+		findings = append(findings, msis.Finding{
+			ICE:      f.ICE,
+			Severity: string(f.Severity),
+			Message:  f.Message,
+			Line:     f.Pos.Line,
+			Column:   f.Pos.Column,
+		})
+	}
+	if errors := printFindings(findings, filename); errors > 0 {
+		return fmt.Errorf("validation failed with %d ICE errors", errors)
+	}
+	return nil
+}
+
+// printFindings prints ICE findings as file:line:col and returns the number
+// of errors.
+func printFindings(findings []msis.Finding, filename string) int {
+	errors, warnings := 0, 0
+	for _, f := range findings {
+		location := filename
+		if f.Line > 0 {
+			location += fmt.Sprintf(":%d:%d", f.Line, f.Column)
+		}
+		label := fmt.Sprintf("%s %s", f.ICE, f.Severity)
+		if f.Severity == string(ice.Error) {
+			errors++
+			label = cli.Error(label)
+		} else {
+			warnings++
+			label = cli.Warning(label)
+		}
+		fmt.Printf("  %s: %s: %s\n", cli.Filename(location), label, f.Message)
+	}
+	fmt.Printf("  Validation: %s errors, %s warnings\n",
+		cli.Number(fmt.Sprintf("%d", errors)),
+		cli.Number(fmt.Sprintf("%d", warnings)))
+	return errors
+}
@@ -6,10 +6,10 @@ require (
 	github.com/aymerick/raymond v2.0.2+incompatible
 	github.com/gersonkurz/go-regis3 v0.0.0-20260204141052-9cc701fe149b
 	golang.org/x/term v0.39.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	golang.org/x/sys v0.40.0 // indirect
 	golang.org/x/text v0.20.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -1,6 +1,7 @@
 package bundle
 
 import (
+	"context"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -67,8 +68,9 @@ func (g *Generator) SetCache(cache *prereqcache.Cache) {
 }
 
 // EnsurePrerequisites downloads/caches all prerequisites needed by the bundle.
-// The progress callback receives status messages for UI display.
-func (g *Generator) EnsurePrerequisites(progress func(msg string)) error {
+// The progress callback receives status messages for UI display; cancelling
+// ctx aborts a download.
+func (g *Generator) EnsurePrerequisites(ctx context.Context, progress func(msg string)) error {
 	if g.Setup.Bundle == nil {
 		return nil
 	}
@@ -80,7 +82,7 @@ func (g *Generator) EnsurePrerequisites(progress func(msg string)) error {
 	}
 
 	for _, prereq := range g.Setup.Bundle.Prerequisites {
-		if err := g.ensurePrerequisite(prereq, platform, progress); err != nil {
+		if err := g.ensurePrerequisite(ctx, prereq, platform, progress); err != nil {
 			return err
 		}
 	}
@@ -89,7 +91,7 @@ func (g *Generator) EnsurePrerequisites(progress func(msg string)) error {
 }
 
 // ensurePrerequisite ensures a single prerequisite is available.
-func (g *Generator) ensurePrerequisite(prereq ir.Prerequisite, platform string, progress func(msg string)) error {
+func (g *Generator) ensurePrerequisite(ctx context.Context, prereq ir.Prerequisite, platform string, progress func(msg string)) error {
 	// Custom source - no caching needed
 	if prereq.Source != "" {
 		return nil
@@ -111,7 +113,7 @@ func (g *Generator) ensurePrerequisite(prereq ir.Prerequisite, platform string,
 
 		// Ensure x64 version
 		if includeX64 {
-			path, err = g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "x64", "", progress)
+			path, err = g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "x64", "", progress)
 			if err != nil {
 				return fmt.Errorf("ensuring %s %s x64: %w", prereq.Type, prereq.Version, err)
 			}
@@ -120,7 +122,7 @@ func (g *Generator) ensurePrerequisite(prereq ir.Prerequisite, platform string,
 
 		// Ensure x86 version
 		if includeX86 {
-			path, err := g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "x86", "", progress)
+			path, err := g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "x86", "", progress)
 			if err != nil {
 				return fmt.Errorf("ensuring %s %s x86: %w", prereq.Type, prereq.Version, err)
 			}
@@ -130,7 +132,7 @@ func (g *Generator) ensurePrerequisite(prereq ir.Prerequisite, platform string,
 		// Ensure ARM64 version if available (VC++ 2022 has ARM64 support)
 		// Try to cache ARM64 - if it fails (no URL available), that's OK for older versions
 		if includeArm64 && prereqcache.LookupDownloadURL(prereq.Type, prereq.Version, "arm64") != nil {
-			path, err = g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "arm64", "", progress)
+			path, err = g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "arm64", "", progress)
 			if err != nil {
 				return fmt.Errorf("ensuring %s %s arm64: %w", prereq.Type, prereq.Version, err)
 			}
@@ -138,7 +140,7 @@ func (g *Generator) ensurePrerequisite(prereq ir.Prerequisite, platform string,
 		}
 	} else {
 		// netfx and others - architecture-neutral
-		path, err := g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "", "", progress)
+		path, err := g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "", "", progress)
 		if err != nil {
 			return fmt.Errorf("ensuring %s %s: %w", prereq.Type, prereq.Version, err)
 		}
@@ -490,8 +492,9 @@ func (g *AutoBundleGenerator) SetCache(cache *prereqcache.Cache) {
 }
 
 // EnsurePrerequisites downloads/caches all prerequisites needed for auto-bundling.
-// The progress callback receives status messages for UI display.
-func (g *AutoBundleGenerator) EnsurePrerequisites(progress func(msg string)) error {
+// The progress callback receives status messages for UI display; cancelling
+// ctx aborts a download.
+func (g *AutoBundleGenerator) EnsurePrerequisites(ctx context.Context, progress func(msg string)) error {
 	// Determine platform for prerequisite resolution
 	platform := g.Variables["PLATFORM"]
 	if platform == "" {
@@ -499,7 +502,7 @@ func (g *AutoBundleGenerator) EnsurePrerequisites(progress func(msg string)) err
 	}
 
 	for _, prereq := range g.Requirements {
-		if err := g.ensurePrerequisite(prereq, platform, progress); err != nil {
+		if err := g.ensurePrerequisite(ctx, prereq, platform, progress); err != nil {
 			return err
 		}
 	}
@@ -508,7 +511,7 @@ func (g *AutoBundleGenerator) EnsurePrerequisites(progress func(msg string)) err
 }
 
 // ensurePrerequisite ensures a single prerequisite is available for auto-bundling.
-func (g *AutoBundleGenerator) ensurePrerequisite(prereq ir.Prerequisite, platform string, progress func(msg string)) error {
+func (g *AutoBundleGenerator) ensurePrerequisite(ctx context.Context, prereq ir.Prerequisite, platform string, progress func(msg string)) error {
 	// Custom source - no caching needed
 	if prereq.Source != "" {
 		return nil
@@ -531,7 +534,7 @@ func (g *AutoBundleGenerator) ensurePrerequisite(prereq ir.Prerequisite, platfor
 
 		// Ensure x64 version
 		if includeX64 {
-			path, err = g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "x64", "", progress)
+			path, err = g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "x64", "", progress)
 			if err != nil {
 				return fmt.Errorf("ensuring %s %s x64: %w", prereq.Type, prereq.Version, err)
 			}
@@ -540,7 +543,7 @@ func (g *AutoBundleGenerator) ensurePrerequisite(prereq ir.Prerequisite, platfor
 
 		// Ensure x86 version
 		if includeX86 {
-			path, err = g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "x86", "", progress)
+			path, err = g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "x86", "", progress)
 			if err != nil {
 				return fmt.Errorf("ensuring %s %s x86: %w", prereq.Type, prereq.Version, err)
 			}
@@ -550,7 +553,7 @@ func (g *AutoBundleGenerator) ensurePrerequisite(prereq ir.Prerequisite, platfor
 		// Ensure ARM64 version if available (VC++ 2022 has ARM64 support)
 		// Try to cache ARM64 - if it fails (no URL available), that's OK for older versions
 		if includeArm64 && prereqcache.LookupDownloadURL(prereq.Type, prereq.Version, "arm64") != nil {
-			path, err = g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "arm64", "", progress)
+			path, err = g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "arm64", "", progress)
 			if err != nil {
 				return fmt.Errorf("ensuring %s %s arm64: %w", prereq.Type, prereq.Version, err)
 			}
@@ -558,7 +561,7 @@ func (g *AutoBundleGenerator) ensurePrerequisite(prereq ir.Prerequisite, platfor
 		}
 	} else {
 		// netfx and others - architecture-neutral
-		path, err := g.Cache.EnsurePrerequisite(prereq.Type, prereq.Version, "", "", progress)
+		path, err := g.Cache.EnsurePrerequisite(ctx, prereq.Type, prereq.Version, "", "", progress)
 		if err != nil {
 			return fmt.Errorf("ensuring %s %s: %w", prereq.Type, prereq.Version, err)
 		}
@@ -8,12 +8,14 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gersonkurz/msis/internal/ir"
 	"github.com/gersonkurz/msis/internal/registry"
 	"github.com/gersonkurz/msis/internal/requirements"
 	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wxs"
 )
 
 // Context holds state during WXS generation.
@@ -43,6 +45,14 @@ type Context struct {
 	// Index path is built using feature position in parent (e.g., "0/1/0")
 	featureIDs map[string]string
 
+	// Feature display paths by generated ID (e.g., FEATURE_00001 -> "Main/Tools")
+	featureNames map[string]string
+	// Feature IDs in declaration order
+	featureOrder []string
+	// Features and the IDs of their parents, by feature ID
+	features       map[string]*ir.Feature
+	featureParents map[string]string
+
 	// Feature component references (keyed by unique feature ID, not name)
 	FeatureComponents map[string][]string // feature ID -> component IDs
 
@@ -73,6 +83,48 @@ type Context struct {
 	// Remove on uninstall items
 	RemoveOnUninstallItems []*RemoveOnUninstallItem
 	nextRemoveID           int
+
+	// Permission components emitted during directory XML generation
+	permissionComponents []*permissionComponent
+
+	// .msis items that produced each component, so findings can point at the source.
+	// Components and directories created while processing an item belong to currentItem.
+	componentItems map[string]ir.Item
+	currentItem    ir.Item
+
+	// WiX XML added to template slots by item handlers
+	slotXML         map[Slot][]string
+	featureChildren map[string][]any // feature ID -> further children of its <Feature>
+
+	// .wxs and .wixlib files to build with the setup, from <wix-reference>
+	sources     []string
+	nextMergeID map[string]int
+
+	// Directories declared by <directory>, by ID
+	declaredDirs map[string]*Directory
+	// Standard WiX folders used as roots, in order of first use
+	standardRoots []string
+	// ConfigurableDirectory of features, by feature ID
+	configurableDirs map[string]string
+
+	// Setup types from <setup-type>, with their features resolved
+	setupTypes []setupType
+
+	// Instances from <instances>, starting with the default instance; nil
+	// for single-instance packages
+	instanceIDs      []string
+	instanceProperty string
+
+	// Transforms from <transform>, with their properties rendered
+	transforms []Transform
+}
+
+// permissionComponent records a CreateFolder permission component so it can be
+// reported in the component inventory after generation.
+type permissionComponent struct {
+	ID   string
+	GUID string
+	Dir  *Directory
 }
 
 // RemoveOnUninstallItem represents an item to remove during uninstall.
@@ -108,6 +160,9 @@ func NewContext(setup *ir.Setup, vars variables.Dictionary, workDir string) *Con
 		DirectoryTrees:         make(map[string]*Directory),
 		ExcludedFolders:        make(map[string]bool),
 		featureIDs:             make(map[string]string),
+		featureNames:           make(map[string]string),
+		features:               make(map[string]*ir.Feature),
+		featureParents:         make(map[string]string),
 		FeatureComponents:      make(map[string][]string),
 		targetFileSeen:         make(map[string]int),
 		fileSourcePaths:        make(map[string]string),
@@ -118,6 +173,12 @@ func NewContext(setup *ir.Setup, vars variables.Dictionary, workDir string) *Con
 		StartMenuShortcuts:     make([]*ShortcutComponent, 0),
 		CustomActions:          make([]*CustomAction, 0),
 		RemoveOnUninstallItems: make([]*RemoveOnUninstallItem, 0),
+		componentItems:         make(map[string]ir.Item),
+		slotXML:                make(map[Slot][]string),
+		featureChildren:        make(map[string][]any),
+		nextMergeID:            make(map[string]int),
+		declaredDirs:           make(map[string]*Directory),
+		configurableDirs:       make(map[string]string),
 	}
 }
 
@@ -126,11 +187,20 @@ type Directory struct {
 	ID             string
 	Name           string
 	CustomID       string // e.g., "INSTALLDIR"
+	StandardID     string // Standard WiX folder of an unnamed root, e.g. "FontsFolder"
 	Parent         *Directory
 	Children       map[string]*Directory // key is lowercase name
 	Components     []*Component
 	DoNotOverwrite bool
 	FeatureIDs     map[string]bool // Features that use this directory (for permission component refs)
+	Source         ir.Item         // .msis item that created the directory; nil for roots created by variables
+	Merges         []*MergeModule  // Merge modules installed to the directory
+}
+
+// MergeModule is a merge module merged into a directory.
+type MergeModule struct {
+	ID         string
+	SourcePath string
 }
 
 // Component represents a WiX component containing files or other resources.
@@ -141,6 +211,7 @@ type Component struct {
 	Environment  *Environment
 	Service      *Service
 	CreateFolder bool
+	Content      []any // Further wxs elements, e.g. from item handlers
 }
 
 // File represents a file to be installed.
@@ -213,6 +284,9 @@ func (c *Context) NextComponentID(path string) string {
 		id = fmt.Sprintf("%s_%d", baseID, counter)
 	}
 	c.componentIDs[id] = true
+	if c.currentItem != nil {
+		c.componentItems[id] = c.currentItem
+	}
 	return id
 }
 
@@ -333,10 +407,58 @@ func sanitizePath(path string) string {
 	return result
 }
 
-// GetOrCreateDirectory finds or creates a directory in the tree.
+// GetOrCreateDirectory finds or creates a directory in the tree. rootKey
+// is an msis root like INSTALLDIR, a directory declared by <directory> or a
+// standard WiX folder like FontsFolder.
 func (c *Context) GetOrCreateDirectory(rootKey string, subPath string, doNotOverwrite bool) *Directory {
-	// Get or create root
+	// Navigate/create path from the root's directory
+	current := c.rootDirectory(rootKey)
+	parts := strings.Split(subPath, "\\")
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		key := strings.ToLower(part)
+		child, ok := current.Children[key]
+		if !ok {
+			child = &Directory{
+				ID:             c.NextDirectoryID(),
+				Name:           part,
+				Parent:         current,
+				Children:       make(map[string]*Directory),
+				DoNotOverwrite: doNotOverwrite,
+				FeatureIDs:     make(map[string]bool),
+				Source:         c.currentItem,
+			}
+			current.Children[key] = child
+		}
+		current = child
+	}
+	return current
+}
+
+// rootDirectory returns the directory of a root key, creating its tree on
+// first use. For nested roots like INSTALLDIR="NGBT\chimera", that is the
+// directory with the custom ID (chimera), not the tree root (NGBT).
+func (c *Context) rootDirectory(rootKey string) *Directory {
+	if dir, ok := c.declaredDirs[rootKey]; ok {
+		return dir
+	}
 	root, ok := c.DirectoryTrees[rootKey]
+	if !ok && isStandardFolder(rootKey) {
+		// An unnamed container, written as <StandardDirectory>
+		root = &Directory{
+			StandardID: rootKey,
+			Children:   make(map[string]*Directory),
+			FeatureIDs: make(map[string]bool),
+		}
+		c.DirectoryTrees[rootKey] = root
+		c.standardRoots = append(c.standardRoots, rootKey)
+		return root
+	}
+	if root != nil && root.StandardID != "" {
+		return root
+	}
 	if !ok {
 		// Get the directory name from variables (e.g., INSTALLDIR -> "MyApp" or "Company\MyApp")
 		// Also check INSTALL_FOLDER as an alias for INSTALLDIR
@@ -368,6 +490,7 @@ func (c *Context) GetOrCreateDirectory(rootKey string, subPath string, doNotOver
 				Name:       parts[0],
 				Children:   make(map[string]*Directory),
 				FeatureIDs: make(map[string]bool),
+				Source:     c.currentItem,
 			}
 			c.DirectoryTrees[rootKey] = root
 
@@ -381,6 +504,7 @@ func (c *Context) GetOrCreateDirectory(rootKey string, subPath string, doNotOver
 					Parent:     current,
 					Children:   make(map[string]*Directory),
 					FeatureIDs: make(map[string]bool),
+					Source:     c.currentItem,
 				}
 				if isLast {
 					child.CustomID = rootKey // Put INSTALLDIR on the final directory
@@ -395,42 +519,12 @@ func (c *Context) GetOrCreateDirectory(rootKey string, subPath string, doNotOver
 				CustomID:   rootKey,
 				Children:   make(map[string]*Directory),
 				FeatureIDs: make(map[string]bool),
+				Source:     c.currentItem,
 			}
 			c.DirectoryTrees[rootKey] = root
 		}
 	}
-
-	if subPath == "" {
-		// For nested INSTALLDIR paths, find the directory with the custom ID
-		return c.findDirectoryWithCustomID(root, rootKey)
-	}
-
-	// Navigate/create path from the CustomID directory (not the tree root).
-	// For nested roots like "NGBT\chimera", the tree root is NGBT but the
-	// CustomID (e.g., APPDATADIR) is on the child "chimera". Subpaths must
-	// be created under the CustomID directory, not as siblings of it.
-	current := c.findDirectoryWithCustomID(root, rootKey)
-	parts := strings.Split(subPath, "\\")
-	for _, part := range parts {
-		if part == "" {
-			continue
-		}
-		key := strings.ToLower(part)
-		child, ok := current.Children[key]
-		if !ok {
-			child = &Directory{
-				ID:             c.NextDirectoryID(),
-				Name:           part,
-				Parent:         current,
-				Children:       make(map[string]*Directory),
-				DoNotOverwrite: doNotOverwrite,
-				FeatureIDs:     make(map[string]bool),
-			}
-			current.Children[key] = child
-		}
-		current = child
-	}
-	return current
+	return c.findDirectoryWithCustomID(root, rootKey)
 }
 
 // findDirectoryWithCustomID recursively finds a directory with the given custom ID.
@@ -448,6 +542,10 @@ func (c *Context) findDirectoryWithCustomID(dir *Directory, customID string) *Di
 	return dir
 }
 
+// rootKeys are the msis roots, each with a slot in the template.
+var rootKeys = []string{"INSTALLDIR", "APPDATADIR", "COMMONFILESDIR", "WINDOWSDIR",
+	"SYSTEMDIR", "ROAMINGAPPDATADIR", "LOCALAPPDATADIR"}
+
 // ParseTarget parses a target like "[INSTALLDIR]subfolder" into rootKey and subPath.
 // Handles bracketed form: [INSTALLDIR]path -> rootKey=INSTALLDIR, subPath=path
 // Handles bare root keys: INSTALLDIR, APPDATADIR -> rootKey=<name>, subPath=""
@@ -469,9 +567,6 @@ func ParseTarget(target string) (rootKey, subPath string) {
 	target = strings.ReplaceAll(target, "/", "\\")
 
 	// Check for root keys (with optional path suffix)
-	rootKeys := []string{"INSTALLDIR", "APPDATADIR", "COMMONFILESDIR", "WINDOWSDIR",
-		"SYSTEMDIR", "ROAMINGAPPDATADIR", "LOCALAPPDATADIR"}
-
 	for _, rk := range rootKeys {
 		if strings.HasPrefix(strings.ToUpper(target), rk) {
 			if len(target) == len(rk) {
@@ -499,7 +594,38 @@ func (c *Context) Generate() (*GeneratedOutput, error) {
 
 	// Second pass: pre-assign feature IDs (ensures consistency between processing and generation)
 	for i := range c.Setup.Features {
-		c.assignFeatureIDs(&c.Setup.Features[i], "", i)
+		if err := c.assignFeatureIDs(&c.Setup.Features[i], "", i); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate all items before generating anything
+	switch c.Variables.OutputType() {
+	case variables.OutputMSI, variables.OutputMSM, variables.OutputWixlib:
+	default:
+		return nil, fmt.Errorf("OUTPUT_TYPE must be msi, msm or wixlib, not %q", c.Variables.Get("OUTPUT_TYPE"))
+	}
+	if err := c.resolveSetupTypes(); err != nil {
+		return nil, err
+	}
+	if err := c.resolveInstances(); err != nil {
+		return nil, err
+	}
+	if err := c.resolveTransforms(); err != nil {
+		return nil, err
+	}
+	if err := c.validateItems(); err != nil {
+		return nil, err
+	}
+
+	// Declare <directory> folders, so that any item can target them
+	if err := c.declareDirectories(c.Setup.Items, ""); err != nil {
+		return nil, err
+	}
+	for i := range c.Setup.Features {
+		if err := c.declareFeatureDirectories(&c.Setup.Features[i], "", i); err != nil {
+			return nil, err
+		}
 	}
 
 	// Third pass: process features and items
@@ -529,6 +655,16 @@ func (c *Context) Generate() (*GeneratedOutput, error) {
 	// Generate remove-on-uninstall XML first, as it registers components with features
 	removeOnUninstallXML := c.generateRemoveOnUninstallXML()
 
+	// Generate trees below standard WiX folders before the features, as
+	// their permission components are added to the features
+	standardDirectoriesXML := c.generateStandardDirectoriesXML()
+	setupTypesPackageXML, setupTypesUIXML := c.generateSetupTypesXML()
+	instancesXML := c.generateInstancesXML()
+	featuresDialog := "CustomizeDlg"
+	if len(c.setupTypes) > 0 {
+		featuresDialog = setupTypesDialog
+	}
+
 	// Build preserved IDs for registry components (needed by both preservation and registry XML)
 	preservedIDs := c.registryProcessor.BuildAllPreservedIDs(c.RegistryComponents)
 
@@ -546,11 +682,16 @@ func (c *Context) Generate() (*GeneratedOutput, error) {
 		DesktopXML:                c.generateShortcutsXML(c.DesktopShortcuts),
 		StartMenuXML:              c.generateShortcutsXML(c.StartMenuShortcuts),
 		CustomActionsXML:          c.generateCustomActionsXML(),
-		InstallExecuteSequence:    c.generateInstallExecuteSequence(),
+		InstallExecuteSequence:    joinXML(c.generateInstallExecuteSequence(), c.slotOutput(SlotInstallExecuteSequence)),
 		RemoveOnUninstallXML:      removeOnUninstallXML,
 		LaunchConditionSearchXML:  launchSearchXML,
 		LaunchConditionsXML:       launchCondXML,
 		PreservationPropertiesXML: c.registryProcessor.GeneratePreservationXML(c.RegistryComponents, preservedIDs),
+		PackageXML:                joinXML(standardDirectoriesXML, setupTypesPackageXML, instancesXML, c.slotOutput(SlotPackage)),
+		UIXML:                     joinXML(setupTypesUIXML, c.slotOutput(SlotUI)),
+		FeaturesDialog:            featuresDialog,
+		Sources:                   c.sources,
+		Transforms:                c.transforms,
 	}
 
 	return output, nil
@@ -592,9 +733,45 @@ type GeneratedOutput struct {
 	CustomActionsXML          string
 	InstallExecuteSequence    string
 	RemoveOnUninstallXML      string
-	LaunchConditionSearchXML  string // Registry searches for launch conditions
-	LaunchConditionsXML       string // Launch condition elements
-	PreservationPropertiesXML string // Property+RegistrySearch elements for preserve="yes"
+	LaunchConditionSearchXML  string      // Registry searches for launch conditions
+	LaunchConditionsXML       string      // Launch condition elements
+	PreservationPropertiesXML string      // Property+RegistrySearch elements for preserve="yes"
+	PackageXML                string      // Further children of <Package>: trees below standard WiX folders, XML of item handlers
+	UIXML                     string      // Children of a further <UI>: the setup type dialog, XML of item handlers
+	FeaturesDialog            string      // Dialog where the user picks features: CustomizeDlg or the setup type dialog
+	Sources                   []string    // .wxs and .wixlib files to build with the setup, relative to the .msis file
+	Transforms                []Transform // Configuration presets, built into .mst transforms of the MSI
+}
+
+// OutputSection is a named fragment of GeneratedOutput.
+type OutputSection struct {
+	Name string
+	XML  string
+}
+
+// Sections returns all fragments in declaration order, including empty ones.
+func (o *GeneratedOutput) Sections() []OutputSection {
+	return []OutputSection{
+		{"DirectoryXML", o.DirectoryXML},
+		{"AppDataDirXML", o.AppDataDirXML},
+		{"RoamingAppDataDirXML", o.RoamingAppDataDirXML},
+		{"LocalAppDataDirXML", o.LocalAppDataDirXML},
+		{"CommonFilesDirXML", o.CommonFilesDirXML},
+		{"WindowsDirXML", o.WindowsDirXML},
+		{"SystemDirXML", o.SystemDirXML},
+		{"FeatureXML", o.FeatureXML},
+		{"RegistryXML", o.RegistryXML},
+		{"DesktopXML", o.DesktopXML},
+		{"StartMenuXML", o.StartMenuXML},
+		{"CustomActionsXML", o.CustomActionsXML},
+		{"InstallExecuteSequence", o.InstallExecuteSequence},
+		{"RemoveOnUninstallXML", o.RemoveOnUninstallXML},
+		{"LaunchConditionSearchXML", o.LaunchConditionSearchXML},
+		{"LaunchConditionsXML", o.LaunchConditionsXML},
+		{"PreservationPropertiesXML", o.PreservationPropertiesXML},
+		{"PackageXML", o.PackageXML},
+		{"UIXML", o.UIXML},
+	}
 }
 
 func (c *Context) collectExcludes(items []ir.Item) {
@@ -624,21 +801,97 @@ func (c *Context) collectExcludesFromFeature(feature *ir.Feature) {
 
 // assignFeatureIDs pre-assigns unique IDs to features using index-based paths.
 // This ensures the same IDs are used during both item processing and XML generation.
-func (c *Context) assignFeatureIDs(feature *ir.Feature, parentIndexPath string, index int) {
+func (c *Context) assignFeatureIDs(feature *ir.Feature, parentIndexPath string, index int) error {
 	// Build index path using position (not name) to avoid collisions
 	indexPath := fmt.Sprintf("%d", index)
 	if parentIndexPath != "" {
 		indexPath = parentIndexPath + "/" + indexPath
 	}
+	if err := validateFeature(feature); err != nil {
+		return featureError(feature, err)
+	}
 
-	// Generate and store unique ID for this feature
+	// Generate and store unique ID for this feature. A feature with an id of
+	// its own still takes a number, so that setting an id keeps the IDs of
+	// the other features, by which upgrades migrate feature states.
 	featureID := c.NextFeatureID()
+	if feature.ID != "" {
+		featureID = feature.ID
+	}
+	if other, ok := c.featureNames[featureID]; ok {
+		return featureError(feature, fmt.Errorf("ID %s is already the ID of feature %s", featureID, other))
+	}
 	c.featureIDs[indexPath] = featureID
 
+	// Remember the feature's name path for reporting
+	name := feature.Name
+	if parentIndexPath != "" {
+		name = c.featureNames[c.featureIDs[parentIndexPath]] + "/" + name
+		c.featureParents[featureID] = c.featureIDs[parentIndexPath]
+	}
+	c.featureNames[featureID] = name
+	c.featureOrder = append(c.featureOrder, featureID)
+	c.features[featureID] = feature
+
 	// Process sub-features
 	for i := range feature.SubFeatures {
-		c.assignFeatureIDs(&feature.SubFeatures[i], indexPath, i)
+		if err := c.assignFeatureIDs(&feature.SubFeatures[i], indexPath, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateFeature checks the attributes of a feature. Like its name, they
+// are used as written, without variables.
+func validateFeature(feature *ir.Feature) error {
+	if feature.ID != "" {
+		switch {
+		case !wixID.MatchString(feature.ID):
+			return fmt.Errorf("id %q is not a valid WiX identifier", feature.ID)
+		case len(feature.ID) > 38:
+			return fmt.Errorf("id %s is longer than the 38 characters of a feature ID", feature.ID)
+		case generatedFeatureID.MatchString(feature.ID):
+			return fmt.Errorf("id %s is reserved for the generated feature IDs", feature.ID)
+		}
+	}
+	switch feature.Display {
+	case "", "expand", "collapse", "hidden":
+	default:
+		return fmt.Errorf("display must be expand, collapse or hidden, not %q", feature.Display)
+	}
+	if feature.Level != "" {
+		if level, err := strconv.Atoi(feature.Level); err != nil || level < 0 || level > 32767 {
+			return fmt.Errorf("level must be a number from 0 to 32767, not %q", feature.Level)
+		}
+	}
+	switch feature.Advertise {
+	case "", "no", "allow", "prefer":
+	default:
+		return fmt.Errorf("advertise must be no, allow or prefer, not %q", feature.Advertise)
+	}
+	switch feature.InstallDefault {
+	case "", "local", "source", "follow-parent":
+	default:
+		return fmt.Errorf("install-default must be local, source or follow-parent, not %q", feature.InstallDefault)
+	}
+	switch {
+	case feature.TypicalDefault != "" && feature.TypicalDefault != "install" && feature.TypicalDefault != "advertise":
+		return fmt.Errorf("typical-default must be install or advertise, not %q", feature.TypicalDefault)
+	case feature.TypicalDefault == "advertise" && feature.Advertise == "no":
+		return fmt.Errorf("typical-default advertise needs a feature that may be advertised, not advertise=\"no\"")
+	case feature.TypicalDefault == "install" && feature.Advertise == "prefer":
+		return fmt.Errorf("advertise=\"prefer\" advertises the feature by default, which typical-default install contradicts")
+	}
+	return nil
+}
+
+// featureError prefixes an error with the position of the feature.
+func featureError(feature *ir.Feature, err error) error {
+	if feature.Pos.IsValid() {
+		return fmt.Errorf("<feature> at %s: %w", feature.Pos, err)
 	}
+	return err
 }
 
 // isExcluded checks if a path should be excluded, matching against both absolute
@@ -696,26 +949,15 @@ func (c *Context) processFeature(feature *ir.Feature, parentIndexPath string, in
 }
 
 func (c *Context) processItem(item ir.Item, featureID string) error {
-	switch it := item.(type) {
-	case ir.Files:
-		return c.processFiles(it, featureID)
-	case ir.SetEnv:
-		return c.processSetEnv(it, featureID)
-	case ir.Service:
-		return c.processService(it, featureID)
-	case ir.Shortcut:
-		return c.processShortcut(it, featureID)
-	case ir.Execute:
-		return c.processExecute(it, featureID)
-	case ir.Exclude:
-		// Already processed in first pass
-		return nil
-	case ir.Registry:
-		return c.processRegistry(it, featureID)
-	case ir.CreateFolder:
-		return c.processCreateFolder(it, featureID)
-	case ir.RemoveOnUninstall:
-		return c.processRemoveOnUninstall(it, featureID)
+	c.currentItem = item
+	defer func() { c.currentItem = nil }()
+
+	h, ok := handlers[item.ItemType()]
+	if !ok {
+		return fmt.Errorf("no handler for <%s>", item.ItemType())
+	}
+	if err := h.Process(c, item, featureID); err != nil {
+		return itemError(item, err)
 	}
 	return nil
 }
@@ -828,6 +1070,7 @@ func (c *Context) addDirectoryContents(dir *Directory, relBasePath, absCurrentPa
 					Children:       make(map[string]*Directory),
 					DoNotOverwrite: doNotOverwrite,
 					FeatureIDs:     make(map[string]bool),
+					Source:         c.currentItem,
 				}
 				dir.Children[key] = subDir
 			}
@@ -1159,10 +1402,14 @@ func (c *Context) processRegistry(reg ir.Registry, featureID string) error {
 	}
 
 	// Add components to the list
+	for _, comp := range components {
+		comp.MultiInstance = c.instanceIDs != nil
+	}
 	c.RegistryComponents = append(c.RegistryComponents, components...)
 
 	// Track component IDs for feature association
 	for _, comp := range components {
+		c.componentItems[comp.ID] = reg
 		if featureID != "" {
 			c.FeatureComponents[featureID] = append(c.FeatureComponents[featureID], comp.ID)
 		}
@@ -1171,12 +1418,15 @@ func (c *Context) processRegistry(reg ir.Registry, featureID string) error {
 	return nil
 }
 
-func (c *Context) processExecute(exec ir.Execute, featureID string) error {
-	// Validate the when value
-	if _, ok := customActionTimings[exec.When]; !ok {
+// validateExecute checks the when value of an execute item.
+func validateExecute(exec ir.Execute) error {
+	if _, ok := CustomActionTimings[exec.When]; !ok {
 		return fmt.Errorf("invalid execute when value %q: must be one of before-install, after-install, after-install-not-patch, before-upgrade, before-uninstall", exec.When)
 	}
+	return nil
+}
 
+func (c *Context) processExecute(exec ir.Execute, featureID string) error {
 	// Generate unique action ID
 	actionID := fmt.Sprintf("CUSTOMACTION_%05d", c.nextActionID)
 	c.nextActionID++
@@ -1204,18 +1454,21 @@ func (c *Context) shouldSetFilePermissions() bool {
 	return !c.Variables.GetBool("DISABLE_FILE_PERMISSIONS")
 }
 
-// getPermissionAttributes returns the permission attributes based on RESTRICT_FILE_PERMISSIONS.
-func (c *Context) getPermissionAttributes() string {
+// permission returns the folder permission based on RESTRICT_FILE_PERMISSIONS.
+func (c *Context) permission() wxs.UtilPermissionEx {
+	perm := wxs.UtilPermissionEx{User: "Users", Domain: "[MachineName]"}
 	if c.Variables.GetBool("RESTRICT_FILE_PERMISSIONS") {
-		return "GenericRead='yes' Read='yes' GenericExecute='yes'"
+		perm.GenericRead = "yes"
+		perm.Read = "yes"
+		perm.GenericExecute = "yes"
+	} else {
+		perm.GenericAll = "yes"
 	}
-	return "GenericAll='yes'"
+	return perm
 }
 
-// generatePermissionComponent generates a CreateFolder component with permissions.
-func (c *Context) generatePermissionComponent(dir *Directory, sb *strings.Builder, depth int) {
-	indent := strings.Repeat("    ", depth)
-
+// permissionComponent creates a CreateFolder component with permissions.
+func (c *Context) permissionComponent(dir *Directory) *wxs.Component {
 	// Generate a unique component ID for this directory's permission
 	dirID := dir.ID
 	if dir.CustomID != "" {
@@ -1223,18 +1476,20 @@ func (c *Context) generatePermissionComponent(dir *Directory, sb *strings.Builde
 	}
 	compID := c.NextComponentID(c.productScopedID("perm_" + dirID))
 	guid := GenerateGUID(compID)
-	permissions := c.getPermissionAttributes()
 
-	sb.WriteString(fmt.Sprintf("%s<Component Id='%s' Guid='%s'>\n", indent, compID, guid))
-	sb.WriteString(fmt.Sprintf("%s    <CreateFolder>\n", indent))
-	sb.WriteString(fmt.Sprintf("%s        <util:PermissionEx User='Users' Domain='[MachineName]' %s/>\n", indent, permissions))
-	sb.WriteString(fmt.Sprintf("%s    </CreateFolder>\n", indent))
-	sb.WriteString(fmt.Sprintf("%s</Component>\n", indent))
+	c.permissionComponents = append(c.permissionComponents, &permissionComponent{ID: compID, GUID: guid, Dir: dir})
+	if dir.Source != nil {
+		c.componentItems[compID] = dir.Source
+	}
 
 	// Add permission component to all features that own this directory
 	for featureID := range dir.FeatureIDs {
 		c.FeatureComponents[featureID] = append(c.FeatureComponents[featureID], compID)
 	}
+
+	return &wxs.Component{ID: compID, GUID: guid, MultiInstance: c.multiInstance(), Content: []any{
+		&wxs.CreateFolder{Permissions: []wxs.UtilPermissionEx{c.permission()}},
+	}}
 }
 
 // addPathEnvironment adds INSTALLDIR to the system PATH environment variable.
@@ -1263,42 +1518,43 @@ func (c *Context) addPathEnvironment(featureID string) {
 }
 
 // generateDirectoryXMLForRoot generates XML for a specific root key (INSTALLDIR, APPDATADIR, etc.)
+// generateStandardDirectoriesXML returns a <StandardDirectory> for each
+// standard WiX folder used as a root.
+func (c *Context) generateStandardDirectoriesXML() string {
+	var elements []any
+	for _, key := range c.standardRoots {
+		elements = append(elements, &wxs.StandardDirectory{ID: key, Children: c.directoryElements(c.DirectoryTrees[key])})
+	}
+	return wxs.MustRender(2, elements...)
+}
+
 func (c *Context) generateDirectoryXMLForRoot(rootKey string) string {
 	tree, ok := c.DirectoryTrees[rootKey]
 	if !ok {
 		return ""
 	}
-
-	var sb strings.Builder
-	c.generateDirectoryXML(tree, &sb, 2)
-	return sb.String()
+	return wxs.MustRender(2, c.directoryElements(tree)...)
 }
 
-func (c *Context) generateDirectoryXML(dir *Directory, sb *strings.Builder, depth int) {
-	indent := strings.Repeat("    ", depth)
+// directoryElements returns the elements for dir: a single Directory element,
+// or just its contents for the unnamed root container.
+func (c *Context) directoryElements(dir *Directory) []any {
+	named := dir.Name != "" || dir.CustomID != ""
 
-	// Open directory tag
-	if dir.CustomID != "" {
-		// Root directory with custom ID (e.g., INSTALLDIR)
-		if dir.Name != "" {
-			sb.WriteString(fmt.Sprintf("%s<Directory Id='%s' Name='%s'>\n", indent, dir.CustomID, dir.Name))
-		} else {
-			sb.WriteString(fmt.Sprintf("%s<Directory Id='%s'>\n", indent, dir.CustomID))
-		}
-	} else if dir.Name != "" {
-		// Regular subdirectory
-		sb.WriteString(fmt.Sprintf("%s<Directory Id='%s' Name='%s'>\n", indent, dir.ID, dir.Name))
-	}
+	var children []any
 
 	// Generate CreateFolder with permissions if enabled
 	// Only for directories that have a name (not the unnamed root container)
-	if (dir.Name != "" || dir.CustomID != "") && c.shouldSetFilePermissions() {
-		c.generatePermissionComponent(dir, sb, depth+1)
+	if named && c.shouldSetFilePermissions() {
+		children = append(children, c.permissionComponent(dir))
 	}
 
-	// Generate components
 	for _, comp := range dir.Components {
-		c.generateComponentXML(comp, sb, depth+1)
+		children = append(children, c.componentElement(comp))
+	}
+
+	for _, m := range dir.Merges {
+		children = append(children, &wxs.Merge{ID: m.ID, SourceFile: m.SourcePath, DiskID: "1", Language: "0"})
 	}
 
 	// Sort and generate children
@@ -1309,33 +1565,32 @@ func (c *Context) generateDirectoryXML(dir *Directory, sb *strings.Builder, dept
 	sort.Strings(childKeys)
 
 	for _, key := range childKeys {
-		child := dir.Children[key]
-		c.generateDirectoryXML(child, sb, depth+1)
+		children = append(children, c.directoryElements(dir.Children[key])...)
 	}
 
-	// Close directory tag
-	if dir.Name != "" || dir.CustomID != "" {
-		sb.WriteString(fmt.Sprintf("%s</Directory>\n", indent))
+	if !named {
+		return children
+	}
+	// Root directories use their custom ID (e.g., INSTALLDIR)
+	id := dir.ID
+	if dir.CustomID != "" {
+		id = dir.CustomID
 	}
+	return []any{&wxs.Directory{ID: id, Name: dir.Name, Children: children}}
 }
 
-func (c *Context) generateComponentXML(comp *Component, sb *strings.Builder, depth int) {
-	indent := strings.Repeat("    ", depth)
-
-	sb.WriteString(fmt.Sprintf("%s<Component Id='%s' Guid='%s'>\n", indent, comp.ID, comp.GUID))
+func (c *Context) componentElement(comp *Component) *wxs.Component {
+	element := &wxs.Component{ID: comp.ID, GUID: comp.GUID, MultiInstance: c.multiInstance()}
 
 	// Files
 	for _, file := range comp.Files {
-		keyPath := ""
-		if file.KeyPath {
-			keyPath = " KeyPath='yes'"
-		}
-		shortName := ""
-		if file.ShortName != "" {
-			shortName = fmt.Sprintf(" ShortName='%s'", file.ShortName)
-		}
-		sb.WriteString(fmt.Sprintf("%s    <File Id='%s' Name='%s'%s Source='%s'%s/>\n",
-			indent, file.ID, file.Name, shortName, file.SourcePath, keyPath))
+		element.Content = append(element.Content, &wxs.File{
+			ID:        file.ID,
+			Name:      file.Name,
+			ShortName: file.ShortName,
+			Source:    file.SourcePath,
+			KeyPath:   wxs.Yes(file.KeyPath),
+		})
 	}
 
 	// Environment
@@ -1345,12 +1600,15 @@ func (c *Context) generateComponentXML(comp *Component, sb *strings.Builder, dep
 		if part == "" {
 			part = "all"
 		}
-		permanent := "no"
-		if env.Permanent {
-			permanent = "yes"
-		}
-		sb.WriteString(fmt.Sprintf("%s    <Environment Id='%s' Name='%s' Value='%s' Permanent='%s' Part='%s' Action='set' System='yes'/>\n",
-			indent, env.ID, env.Name, env.Value, permanent, part))
+		element.Content = append(element.Content, &wxs.Environment{
+			ID:        env.ID,
+			Name:      env.Name,
+			Value:     env.Value,
+			Permanent: wxs.YesNo(env.Permanent),
+			Part:      part,
+			Action:    "set",
+			System:    "yes",
+		})
 	}
 
 	// Service
@@ -1366,37 +1624,47 @@ func (c *Context) generateComponentXML(comp *Component, sb *strings.Builder, dep
 			startType = "disabled"
 		}
 
-		sb.WriteString(fmt.Sprintf("%s    <ServiceInstall Id='%s' Name='%s' DisplayName='%s' Start='%s' Type='ownProcess' ErrorControl='normal'>\n",
-			indent, svc.ID, svc.Name, svc.DisplayName, startType))
-		if svc.Description != "" {
-			sb.WriteString(fmt.Sprintf("%s        <Description>%s</Description>\n", indent, svc.Description))
+		control := &wxs.ServiceControl{
+			ID:     svc.ID + "_ctrl",
+			Name:   c.instanceServiceName(svc.Name, "%s_%s"),
+			Stop:   "both",
+			Remove: "uninstall",
+			Wait:   "yes",
 		}
-		sb.WriteString(fmt.Sprintf("%s    </ServiceInstall>\n", indent))
 		if svc.StartAfterInstall {
-			sb.WriteString(fmt.Sprintf("%s    <ServiceControl Id='%s_ctrl' Name='%s' Start='install' Stop='both' Remove='uninstall' Wait='yes'/>\n",
-				indent, svc.ID, svc.Name))
-		} else {
-			sb.WriteString(fmt.Sprintf("%s    <ServiceControl Id='%s_ctrl' Name='%s' Stop='both' Remove='uninstall' Wait='yes'/>\n",
-				indent, svc.ID, svc.Name))
+			control.Start = "install"
 		}
+		element.Content = append(element.Content, &wxs.ServiceInstall{
+			ID:           svc.ID,
+			Name:         c.instanceServiceName(svc.Name, "%s_%s"),
+			DisplayName:  c.instanceServiceName(svc.DisplayName, "%s (%s)"),
+			Start:        startType,
+			Type:         "ownProcess",
+			ErrorControl: "normal",
+			Description:  svc.Description,
+		}, control)
 	}
 
 	// CreateFolder for empty directories
 	if comp.CreateFolder {
-		sb.WriteString(fmt.Sprintf("%s    <CreateFolder/>\n", indent))
+		element.Content = append(element.Content, &wxs.CreateFolder{})
 	}
 
-	sb.WriteString(fmt.Sprintf("%s</Component>\n", indent))
+	element.Content = append(element.Content, comp.Content...)
+
+	return element
 }
 
 func (c *Context) generateAllFeatureXML() string {
-	var sb strings.Builder
-
+	var features []any
 	for i := range c.Setup.Features {
-		c.generateFeatureXML(&c.Setup.Features[i], &sb, 2, "", i)
+		if c.Variables.OutputType() == variables.OutputMSI {
+			features = append(features, c.featureElement(&c.Setup.Features[i], "", i))
+		} else {
+			features = append(features, c.componentGroupElements(&c.Setup.Features[i], "", i)...)
+		}
 	}
-
-	return sb.String()
+	return wxs.MustRender(2, features...)
 }
 
 func (c *Context) generateAllRegistryXML(preservedIDs []map[string]int) string {
@@ -1412,9 +1680,7 @@ func (c *Context) generateAllRegistryXML(preservedIDs []map[string]int) string {
 	return c.registryProcessor.GenerateXMLWithPreservedIDs(c.RegistryComponents, setPermissions, preservedIDs)
 }
 
-func (c *Context) generateFeatureXML(feature *ir.Feature, sb *strings.Builder, depth int, parentIndexPath string, index int) {
-	indent := strings.Repeat("    ", depth)
-
+func (c *Context) featureElement(feature *ir.Feature, parentIndexPath string, index int) *wxs.Feature {
 	// Build index path (matches assignFeatureIDs and processFeature)
 	indexPath := fmt.Sprintf("%d", index)
 	if parentIndexPath != "" {
@@ -1424,40 +1690,94 @@ func (c *Context) generateFeatureXML(feature *ir.Feature, sb *strings.Builder, d
 	// Get the pre-assigned feature ID (same one used for FeatureComponents)
 	featureID := c.featureIDs[indexPath]
 
-	// Level: 1 for enabled, 32767 for disabled (msis-2.x compatible)
+	// Level: 1 for enabled, 32767 for disabled (msis-2.x compatible),
+	// unless the feature sets its own
 	level := "1"
-	if !feature.Enabled {
+	if feature.Level != "" {
+		level = feature.Level
+	} else if !feature.Enabled {
 		level = "32767"
 	}
 
-	allowAbsent := "yes"
-	if !feature.Allowed {
-		allowAbsent = "no"
+	element := &wxs.Feature{
+		ID:          featureID,
+		Title:       feature.Name,
+		Description: feature.Description,
+		Level:       level,
+		Display:     feature.Display,
+		AllowAbsent: wxs.YesNo(feature.Allowed),
+	}
+	switch feature.Advertise {
+	case "no":
+		element.AllowAdvertise = "no"
+	case "allow":
+		element.AllowAdvertise = "yes"
+	case "prefer":
+		element.AllowAdvertise = "yes"
+		element.TypicalDefault = "advertise"
+	}
+	switch feature.InstallDefault {
+	case "local", "source":
+		element.InstallDefault = feature.InstallDefault
+	case "follow-parent":
+		element.InstallDefault = "followParent"
+	}
+	if feature.TypicalDefault != "" {
+		element.TypicalDefault = feature.TypicalDefault
 	}
 
 	// Root feature gets ConfigurableDirectory so CustomizeDlg's Browse button
-	// is enabled. Sub-features inherit INSTALLDIR and must not override.
-	configurable := ""
-	if parentIndexPath == "" {
-		configurable = " ConfigurableDirectory='INSTALLDIR'"
+	// is enabled. Sub-features inherit INSTALLDIR and must not override,
+	// unless they declare a configurable directory of their own.
+	if dir, ok := c.configurableDirs[featureID]; ok {
+		element.ConfigurableDirectory = dir
+	} else if parentIndexPath == "" {
+		element.ConfigurableDirectory = "INSTALLDIR"
 	}
 
-	sb.WriteString(fmt.Sprintf("%s<Feature Id='%s' Title='%s' Level='%s' AllowAbsent='%s'%s>\n",
-		indent, featureID, feature.Name, level, allowAbsent, configurable))
+	// Levels by setup type
+	element.Children = append(element.Children, c.setupTypeLevels(featureID, level)...)
 
 	// Component refs (keyed by unique feature ID)
-	if compIDs, ok := c.FeatureComponents[featureID]; ok {
-		for _, compID := range compIDs {
-			sb.WriteString(fmt.Sprintf("%s    <ComponentRef Id='%s'/>\n", indent, compID))
-		}
+	for _, compID := range c.FeatureComponents[featureID] {
+		element.Children = append(element.Children, &wxs.ComponentRef{ID: compID})
 	}
 
+	// Merge module, component group and verbatim children
+	element.Children = append(element.Children, c.featureChildren[featureID]...)
+
 	// Sub-features
 	for i := range feature.SubFeatures {
-		c.generateFeatureXML(&feature.SubFeatures[i], sb, depth+1, indexPath, i)
+		element.Children = append(element.Children, c.featureElement(&feature.SubFeatures[i], indexPath, i))
 	}
 
-	sb.WriteString(fmt.Sprintf("%s</Feature>\n", indent))
+	return element
+}
+
+// componentGroupElements returns the <ComponentGroup> of a feature of a
+// merge module or library, followed by those of its sub-features. A group
+// references the groups of its sub-features, so consumers reference a whole
+// feature tree by the ID of its root.
+func (c *Context) componentGroupElements(feature *ir.Feature, parentIndexPath string, index int) []any {
+	indexPath := fmt.Sprintf("%d", index)
+	if parentIndexPath != "" {
+		indexPath = parentIndexPath + "/" + indexPath
+	}
+	featureID := c.featureIDs[indexPath]
+
+	group := &wxs.ComponentGroup{ID: featureID}
+	for _, compID := range c.FeatureComponents[featureID] {
+		group.Children = append(group.Children, &wxs.ComponentRef{ID: compID})
+	}
+	group.Children = append(group.Children, c.featureChildren[featureID]...)
+
+	var subGroups []any
+	for i := range feature.SubFeatures {
+		groups := c.componentGroupElements(&feature.SubFeatures[i], indexPath, i)
+		group.Children = append(group.Children, &wxs.ComponentGroupRef{ID: groups[0].(*wxs.ComponentGroup).ID})
+		subGroups = append(subGroups, groups...)
+	}
+	return append([]any{group}, subGroups...)
 }
 
 // generateShortcutsXML generates WiX XML for shortcut components.
@@ -1466,49 +1786,39 @@ func (c *Context) generateShortcutsXML(shortcuts []*ShortcutComponent) string {
 		return ""
 	}
 
-	var sb strings.Builder
 	productName := c.Variables["PRODUCT_NAME"]
 
+	var components []any
 	for _, sc := range shortcuts {
-		sb.WriteString(fmt.Sprintf("            <Component Id='%s' Guid='%s'>\n", sc.ID, sc.GUID))
-
-		// Generate Shortcut element
 		shortcut := sc.Shortcut
+		element := &wxs.Shortcut{
+			ID:               shortcut.ID,
+			Name:             shortcut.Name,
+			Description:      shortcut.Description,
+			Target:           shortcut.Target,
+			WorkingDirectory: shortcut.WorkingDir,
+		}
 		if shortcut.Icon != "" {
-			// Shortcut with icon
-			sb.WriteString(fmt.Sprintf("                <Shortcut Id='%s' Name='%s' Description='%s' Target='%s' WorkingDirectory='%s'>\n",
-				shortcut.ID, escapeXMLAttr(shortcut.Name), escapeXMLAttr(shortcut.Description),
-				escapeXMLAttr(shortcut.Target), shortcut.WorkingDir))
-			sb.WriteString(fmt.Sprintf("                    <Icon Id='Icon_%s' SourceFile='%s'/>\n",
-				shortcut.ID, escapeXMLAttr(shortcut.Icon)))
-			sb.WriteString("                </Shortcut>\n")
-		} else {
-			// Shortcut without icon
-			sb.WriteString(fmt.Sprintf("                <Shortcut Id='%s' Name='%s' Description='%s' Target='%s' WorkingDirectory='%s'/>\n",
-				shortcut.ID, escapeXMLAttr(shortcut.Name), escapeXMLAttr(shortcut.Description),
-				escapeXMLAttr(shortcut.Target), shortcut.WorkingDir))
+			element.Icon = &wxs.Icon{ID: "Icon_" + shortcut.ID, SourceFile: shortcut.Icon}
 		}
 
 		// Registry value for KeyPath (shortcuts cannot be keypaths)
 		// Use component ID as registry value name to avoid collisions when same shortcut name
 		// is used for both Desktop and StartMenu
-		sb.WriteString(fmt.Sprintf("                <RegistryValue Root='HKCU' Key='Software\\%s\\Shortcuts' Name='%s' Type='integer' Value='1' KeyPath='yes'/>\n",
-			escapeXMLAttr(productName), sc.ID))
-
-		sb.WriteString("            </Component>\n")
+		components = append(components, &wxs.Component{ID: sc.ID, GUID: sc.GUID, MultiInstance: c.multiInstance(), Content: []any{
+			element,
+			&wxs.RegistryValue{
+				Root:    "HKCU",
+				Key:     "Software\\" + productName + "\\Shortcuts",
+				Name:    sc.ID,
+				Value:   wxs.String("1"),
+				Type:    "integer",
+				KeyPath: "yes",
+			},
+		}})
 	}
 
-	return sb.String()
-}
-
-// escapeXMLAttr escapes special characters for XML attribute values.
-func escapeXMLAttr(s string) string {
-	s = strings.ReplaceAll(s, "&", "&amp;")
-	s = strings.ReplaceAll(s, "<", "&lt;")
-	s = strings.ReplaceAll(s, ">", "&gt;")
-	s = strings.ReplaceAll(s, "\"", "&quot;")
-	s = strings.ReplaceAll(s, "'", "&apos;")
-	return s
+	return wxs.MustRender(3, components...)
 }
 
 // generateCustomActionsXML generates WiX CustomAction elements.
@@ -1517,27 +1827,36 @@ func (c *Context) generateCustomActionsXML() string {
 		return ""
 	}
 
-	var sb strings.Builder
+	var actions []any
 	for _, ca := range c.CustomActions {
+		action := &wxs.CustomAction{
+			ID:         ca.ID,
+			Directory:  ca.Directory,
+			ExeCommand: ca.Command,
+			Return:     "ignore",
+		}
 		// Determine execution type based on timing
 		// before-install runs immediate, others run deferred with elevated privileges
 		if ca.When == "before-install" {
-			sb.WriteString(fmt.Sprintf("        <CustomAction Id='%s' Directory='%s' ExeCommand='%s' Execute='immediate' Return='ignore'/>\n",
-				ca.ID, ca.Directory, escapeXMLAttr(ca.Command)))
+			action.Execute = "immediate"
 		} else {
-			sb.WriteString(fmt.Sprintf("        <CustomAction Id='%s' Directory='%s' ExeCommand='%s' Execute='deferred' Return='ignore' Impersonate='no'/>\n",
-				ca.ID, ca.Directory, escapeXMLAttr(ca.Command)))
+			action.Execute = "deferred"
+			action.Impersonate = "no"
 		}
+		actions = append(actions, action)
 	}
-	return sb.String()
+	return wxs.MustRender(2, actions...)
+}
+
+// CustomActionTiming places a custom action in InstallExecuteSequence.
+type CustomActionTiming struct {
+	Position  string // After or Before
+	Reference string // Reference action
+	Condition string // Optional condition
 }
 
-// customActionTimings maps when values to Custom element templates.
-var customActionTimings = map[string]struct {
-	position  string // After or Before
-	reference string // Reference action
-	condition string // Optional condition
-}{
+// CustomActionTimings maps when values to Custom element templates.
+var CustomActionTimings = map[string]CustomActionTiming{
 	"after-install":           {"Before", "InstallFinalize", "(NOT REMOVE = \"ALL\")"},
 	"after-install-not-patch": {"Before", "InstallFinalize", "NOT WIX_UPGRADE_DETECTED"},
 	"before-install":          {"After", "CostFinalize", ""},
@@ -1551,23 +1870,23 @@ func (c *Context) generateInstallExecuteSequence() string {
 		return ""
 	}
 
-	var sb strings.Builder
+	var customs []any
 	for _, ca := range c.CustomActions {
-		timing, ok := customActionTimings[ca.When]
+		timing, ok := CustomActionTimings[ca.When]
 		if !ok {
 			// Unknown timing - skip with warning (could also return error)
 			continue
 		}
 
-		if timing.condition != "" {
-			sb.WriteString(fmt.Sprintf("            <Custom Action='%s' %s='%s' Condition='%s'/>\n",
-				ca.ID, timing.position, timing.reference, timing.condition))
+		custom := &wxs.Custom{Action: ca.ID, Condition: timing.Condition}
+		if timing.Position == "Before" {
+			custom.Before = timing.Reference
 		} else {
-			sb.WriteString(fmt.Sprintf("            <Custom Action='%s' %s='%s'/>\n",
-				ca.ID, timing.position, timing.reference))
+			custom.After = timing.Reference
 		}
+		customs = append(customs, custom)
 	}
-	return sb.String()
+	return wxs.MustRender(3, customs...)
 }
 
 // processRemoveOnUninstall handles a remove-on-uninstall item.
@@ -1581,6 +1900,7 @@ func (c *Context) processRemoveOnUninstall(item ir.RemoveOnUninstall, featureID
 		Folder:    item.Folder,
 		FeatureID: featureID,
 	})
+	c.componentItems["C_"+id] = item
 	return nil
 }
 
@@ -1592,8 +1912,19 @@ func (c *Context) generateRemoveOnUninstallXML() string {
 		return ""
 	}
 
-	var sb strings.Builder
+	// Every component needs a keypath - use a registry value
+	keyPath := func(name string) *wxs.RegistryValue {
+		return &wxs.RegistryValue{
+			Root:    "HKCU",
+			Key:     "Software\\" + c.Variables["MANUFACTURER"] + "\\" + c.Variables["PRODUCT_NAME"],
+			Name:    name,
+			Value:   wxs.String("1"),
+			Type:    "integer",
+			KeyPath: "yes",
+		}
+	}
 
+	var elements []any
 	for _, item := range c.RemoveOnUninstallItems {
 		if item.Registry != "" {
 			// Parse registry path: HKLM\Software\MyApp -> root=HKLM, key=Software\MyApp
@@ -1601,13 +1932,10 @@ func (c *Context) generateRemoveOnUninstallXML() string {
 			if root != "" && key != "" {
 				// RemoveRegistryKey needs to be in a Component
 				compID := fmt.Sprintf("C_%s", item.ID)
-				sb.WriteString(fmt.Sprintf("        <Component Id='%s' Guid='*' Directory='INSTALLDIR'>\n", compID))
-				sb.WriteString(fmt.Sprintf("            <RemoveRegistryKey Id='%s' Root='%s' Key='%s' Action='removeOnUninstall'/>\n",
-					item.ID, root, key))
-				// Need a keypath - use a registry value
-				sb.WriteString(fmt.Sprintf("            <RegistryValue Root='HKCU' Key='Software\\%s\\%s' Name='RemoveOnUninstall_%s' Type='integer' Value='1' KeyPath='yes'/>\n",
-					c.Variables["MANUFACTURER"], c.Variables["PRODUCT_NAME"], item.ID))
-				sb.WriteString("        </Component>\n")
+				elements = append(elements, &wxs.Component{ID: compID, GUID: "*", Directory: "INSTALLDIR", MultiInstance: c.multiInstance(), Content: []any{
+					&wxs.RemoveRegistryKey{ID: item.ID, Root: root, Key: key, Action: "removeOnUninstall"},
+					keyPath("RemoveOnUninstall_" + item.ID),
+				}})
 
 				// Track component for feature
 				if item.FeatureID != "" {
@@ -1622,17 +1950,14 @@ func (c *Context) generateRemoveOnUninstallXML() string {
 			propID := fmt.Sprintf("REMOVE_FOLDER_%s", item.ID)
 			compID := fmt.Sprintf("C_%s", item.ID)
 
-			// SetProperty to define the folder path
-			sb.WriteString(fmt.Sprintf("        <SetProperty Id='%s' Value='%s' Before='CostFinalize' Sequence='first'/>\n",
-				propID, item.Folder))
-
-			// Component with RemoveFolderEx
-			sb.WriteString(fmt.Sprintf("        <Component Id='%s' Guid='*' Directory='INSTALLDIR'>\n", compID))
-			sb.WriteString(fmt.Sprintf("            <util:RemoveFolderEx On='uninstall' Property='%s'/>\n", propID))
-			// Need a keypath - use a registry value
-			sb.WriteString(fmt.Sprintf("            <RegistryValue Root='HKCU' Key='Software\\%s\\%s' Name='RemoveFolder_%s' Type='integer' Value='1' KeyPath='yes'/>\n",
-				c.Variables["MANUFACTURER"], c.Variables["PRODUCT_NAME"], item.ID))
-			sb.WriteString("        </Component>\n")
+			elements = append(elements,
+				// SetProperty to define the folder path
+				&wxs.SetProperty{ID: propID, Value: item.Folder, Before: "CostFinalize", Sequence: "first"},
+				// Component with RemoveFolderEx
+				&wxs.Component{ID: compID, GUID: "*", Directory: "INSTALLDIR", MultiInstance: c.multiInstance(), Content: []any{
+					&wxs.UtilRemoveFolderEx{On: "uninstall", Property: propID},
+					keyPath("RemoveFolder_" + item.ID),
+				}})
 
 			// Track component for feature
 			if item.FeatureID != "" {
@@ -1641,7 +1966,7 @@ func (c *Context) generateRemoveOnUninstallXML() string {
 		}
 	}
 
-	return sb.String()
+	return wxs.MustRender(2, elements...)
 }
 
 // parseRegistryPath splits a registry path like "HKLM\Software\MyApp" into root and key.
@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -632,6 +633,91 @@ func TestFeatureIDsAreUnique(t *testing.T) {
 	}
 }
 
+func TestFeaturePresentation(t *testing.T) {
+	setup := &ir.Setup{
+		Features: []ir.Feature{
+			{
+				Name:        "Client",
+				Enabled:     true,
+				Allowed:     true,
+				Description: "Desktop client",
+				Display:     "expand",
+				SubFeatures: []ir.Feature{
+					{Name: "Help", Enabled: true, Allowed: true, Advertise: "prefer"},
+				},
+			},
+			{Name: "Server", ID: "Server", Enabled: false, Allowed: true, Level: "3", Advertise: "no"},
+			{Name: "Tools", Enabled: true, Allowed: true, Display: "hidden", InstallDefault: "source", SubFeatures: []ir.Feature{
+				{Name: "Samples", Enabled: true, Allowed: true, InstallDefault: "follow-parent", TypicalDefault: "advertise"},
+			}},
+		},
+	}
+	output, err := NewContext(setup, variables.New(), ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	features := parseFragment(t, output.FeatureXML)
+	tests := []struct {
+		id    string
+		attrs map[string]string
+	}{
+		{"FEATURE_00000", map[string]string{"Title": "Client", "Description": "Desktop client", "Level": "1", "Display": "expand",
+			"AllowAbsent": "yes", "ConfigurableDirectory": "INSTALLDIR"}},
+		{"FEATURE_00001", map[string]string{"Title": "Help", "Level": "1", "AllowAdvertise": "yes", "TypicalDefault": "advertise",
+			"AllowAbsent": "yes"}},
+		// The level overrides enabled; a custom ID keeps the numbers of the others
+		{"Server", map[string]string{"Title": "Server", "Level": "3", "AllowAdvertise": "no", "AllowAbsent": "yes",
+			"ConfigurableDirectory": "INSTALLDIR"}},
+		{"FEATURE_00003", map[string]string{"Title": "Tools", "Level": "1", "Display": "hidden", "InstallDefault": "source",
+			"AllowAbsent": "yes", "ConfigurableDirectory": "INSTALLDIR"}},
+		{"FEATURE_00004", map[string]string{"Title": "Samples", "Level": "1", "InstallDefault": "followParent",
+			"TypicalDefault": "advertise", "AllowAbsent": "yes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			feature := features.find("Feature", tt.id)
+			if feature == nil {
+				t.Fatalf("feature %s not found:\n%s", tt.id, output.FeatureXML)
+			}
+			attrs := maps.Clone(feature.Attrs)
+			delete(attrs, "Id")
+			if !maps.Equal(attrs, tt.attrs) {
+				t.Errorf("attributes %v, want %v", attrs, tt.attrs)
+			}
+		})
+	}
+}
+
+func TestFeatureErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		features []ir.Feature
+		want     string
+	}{
+		{"invalid id", []ir.Feature{{Name: "A", ID: "My Feature"}}, "not a valid WiX identifier"},
+		{"long id", []ir.Feature{{Name: "A", ID: strings.Repeat("F", 39)}}, "longer than the 38 characters"},
+		{"duplicate id", []ir.Feature{{Name: "A", ID: "Server"}, {Name: "B", ID: "Server"}}, "already the ID of feature A"},
+		{"generated id", []ir.Feature{{Name: "A", ID: "FEATURE_00003"}, {Name: "B"}, {Name: "C"}, {Name: "D"}}, "id FEATURE_00003 is reserved for the generated feature IDs"},
+		{"display", []ir.Feature{{Name: "A", Display: "open"}}, "display must be expand, collapse or hidden"},
+		{"level", []ir.Feature{{Name: "A", Level: "40000"}}, "level must be a number from 0 to 32767"},
+		{"advertise", []ir.Feature{{Name: "A", Advertise: "yes"}}, "advertise must be no, allow or prefer"},
+		{"install default", []ir.Feature{{Name: "A", InstallDefault: "network"}}, "install-default must be local, source or follow-parent"},
+		{"typical default", []ir.Feature{{Name: "A", TypicalDefault: "local"}}, "typical-default must be install or advertise"},
+		{"typical default advertise", []ir.Feature{{Name: "A", Advertise: "no", TypicalDefault: "advertise"}}, "needs a feature that may be advertised"},
+		{"typical default install", []ir.Feature{{Name: "A", Advertise: "prefer", TypicalDefault: "install"}}, "typical-default install contradicts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := &ir.Setup{Features: tt.features}
+			_, err := NewContext(setup, variables.New(), ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
 func TestDuplicateFeatureNamesGetSeparateComponents(t *testing.T) {
 	// Create temp directory with test files
 	tmpDir, err := os.MkdirTemp("", "msis-test-*")
@@ -2196,3 +2282,65 @@ func TestProductScopedComponentGUIDs(t *testing.T) {
 		t.Errorf("Without UPGRADE_CODE, productScopedID should not change the input: got %s vs %s", id5, id6)
 	}
 }
+
+func TestSpecialCharactersEscaped(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "Tom & Jerry's.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	setup := &ir.Setup{
+		Features: []ir.Feature{
+			{
+				Name:    "Joe's <Tools> & More",
+				Enabled: true,
+				Allowed: true,
+				Items: []ir.Item{
+					ir.Files{Source: tmpDir, Target: "[INSTALLDIR]"},
+					ir.SetEnv{Name: "GREETING", Value: "salt & 'pepper'"},
+					ir.Service{
+						FileName:           "svc.exe",
+						ServiceName:        "Svc",
+						ServiceDisplayName: "R&D Service",
+						Description:        "Runs <fast> & 'safe'",
+					},
+				},
+			},
+		},
+	}
+	ctx := NewContext(setup, variables.New(), tmpDir)
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	// The values survive a round trip through an XML parser only if they
+	// were escaped
+	wix := parseFragment(t, output.FeatureXML+output.DirectoryXML)
+	tests := []struct {
+		element string
+		id      string
+		attr    string // empty for the element text
+		want    string
+	}{
+		{"File", "FILE_ID00000", "Name", "Tom & Jerry's.txt"},
+		{"Environment", "ENV_ID0000", "Value", "salt & 'pepper'"},
+		{"ServiceInstall", "SVC_ID0000", "DisplayName", "R&D Service"},
+		{"Description", "", "", "Runs <fast> & 'safe'"},
+		{"Feature", "FEATURE_00000", "Title", "Joe's <Tools> & More"},
+	}
+	for _, tt := range tests {
+		elem := wix.find(tt.element, tt.id)
+		if elem == nil {
+			t.Errorf("%s %s not found:\n%s\n%s", tt.element, tt.id, output.FeatureXML, output.DirectoryXML)
+			continue
+		}
+		got := elem.Text
+		if tt.attr != "" {
+			got = elem.Attrs[tt.attr]
+		}
+		if got != tt.want {
+			t.Errorf("%s %s = %q, want %q", tt.element, tt.attr, got, tt.want)
+		}
+	}
+}
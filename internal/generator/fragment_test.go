@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// xmlElement is a generated WiX element, parsed for assertions.
+type xmlElement struct {
+	Name     string
+	Attrs    map[string]string
+	Text     string
+	Children []*xmlElement
+}
+
+// parseFragment parses generated WiX XML, which has no root element of its
+// own, into an element that holds the top-level elements as children.
+func parseFragment(t *testing.T, fragment string) *xmlElement {
+	t.Helper()
+	root := &xmlElement{}
+	stack := []*xmlElement{root}
+	d := xml.NewDecoder(strings.NewReader(fragment))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("parsing generated XML: %v\n%s", err, fragment)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			elem := &xmlElement{Name: tok.Name.Local, Attrs: make(map[string]string)}
+			for _, attr := range tok.Attr {
+				elem.Attrs[attr.Name.Local] = attr.Value
+			}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, elem)
+			stack = append(stack, elem)
+		case xml.CharData:
+			stack[len(stack)-1].Text += strings.TrimSpace(string(tok))
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return root
+}
+
+// children returns the direct children with the given name.
+func (e *xmlElement) children(name string) []*xmlElement {
+	var result []*xmlElement
+	for _, child := range e.Children {
+		if child.Name == name {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// all returns the descendants with the given name in document order.
+func (e *xmlElement) all(name string) []*xmlElement {
+	var result []*xmlElement
+	for _, child := range e.Children {
+		if child.Name == name {
+			result = append(result, child)
+		}
+		result = append(result, child.all(name)...)
+	}
+	return result
+}
+
+// find returns the descendant with the given name and Id, or nil.
+func (e *xmlElement) find(name, id string) *xmlElement {
+	for _, elem := range e.all(name) {
+		if elem.Attrs["Id"] == id {
+			return elem
+		}
+	}
+	return nil
+}
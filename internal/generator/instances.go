@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wxs"
+)
+
+// defaultInstanceProperty holds the instance name unless <instances> names
+// another property.
+const defaultInstanceProperty = "INSTANCE_NAME"
+
+// defaultInstallDirProperty is set while INSTALLDIR is not given on the
+// command line, which is when instances get a folder of their own.
+const defaultInstallDirProperty = "MSIS_DEFAULT_INSTALLDIR"
+
+// resolveInstances checks the <instances> declaration and names the
+// instances.
+func (c *Context) resolveInstances() error {
+	inst := c.Setup.Instances
+	if inst == nil {
+		return nil
+	}
+	if err := c.resolveInstancesOf(inst); err != nil {
+		if inst.Pos.IsValid() {
+			return fmt.Errorf("<instances> at %s: %w", inst.Pos, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Context) resolveInstancesOf(inst *ir.Instances) error {
+	if c.Variables.OutputType() != variables.OutputMSI {
+		return fmt.Errorf("<instances> needs OUTPUT_TYPE msi; merge modules and libraries are installed with their package")
+	}
+	resolved, err := c.Variables.Resolve(inst.Count)
+	if err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(resolved))
+	if err != nil || count < 1 {
+		return fmt.Errorf("count %q is not a positive number", resolved)
+	}
+	c.instanceProperty = defaultInstanceProperty
+	if inst.Property != "" {
+		if !publicProperty(inst.Property) {
+			return fmt.Errorf("property %s is not a public property, which has an upper case ID", inst.Property)
+		}
+		c.instanceProperty = inst.Property
+	}
+	for i := 0; i <= count; i++ {
+		c.instanceIDs = append(c.instanceIDs, instanceID(i, count))
+	}
+	return nil
+}
+
+// instanceID names an instance: I00 for the default instance, then I01 and
+// so on, with as many digits as the last one needs.
+func instanceID(i, count int) string {
+	return fmt.Sprintf("I%0*d", max(2, len(strconv.Itoa(count))), i)
+}
+
+// multiInstance is the MultiInstance attribute of components: each instance
+// transform gives them new GUIDs, so that instances do not share them.
+func (c *Context) multiInstance() string {
+	return wxs.Yes(c.instanceIDs != nil)
+}
+
+// instanceServiceName suffixes a service name with the instance, as every
+// instance installs its own service.
+func (c *Context) instanceServiceName(name, format string) string {
+	if c.instanceIDs == nil || name == "" {
+		return name
+	}
+	return fmt.Sprintf(format, name, "["+c.instanceProperty+"]")
+}
+
+// generateInstancesXML returns the instance property, the instance
+// transforms and the per-instance INSTALLDIR. Each instance has its own
+// product and upgrade code, so that installing or upgrading one leaves the
+// others alone. The default instance keeps INSTALLDIR, as does an instance
+// installed to a folder given on the command line.
+func (c *Context) generateInstancesXML() string {
+	if c.instanceIDs == nil {
+		return ""
+	}
+	productName := c.Variables.ProductName()
+	upgradeCode := c.Variables.UpgradeCode()
+	transforms := &wxs.InstanceTransforms{Property: c.instanceProperty}
+	for _, id := range c.instanceIDs[1:] {
+		transforms.Instances = append(transforms.Instances, &wxs.Instance{
+			ID:          id,
+			ProductCode: "*",
+			ProductName: fmt.Sprintf("%s (%s)", productName, id),
+			UpgradeCode: GenerateGUID(upgradeCode + ":" + id),
+		})
+	}
+	return wxs.MustRender(2,
+		&wxs.Property{ID: c.instanceProperty, Value: c.instanceIDs[0]},
+		transforms,
+		// Before AppSearch, the command line is the only source of
+		// INSTALLDIR
+		&wxs.SetProperty{ID: defaultInstallDirProperty, Value: "1", Before: "AppSearch", Sequence: "first", Condition: "NOT INSTALLDIR"},
+		// Once, before the UI shows the folder, so that a folder the user
+		// picks does not get a second suffix
+		&wxs.SetDirectory{
+			ID:        "INSTALLDIR",
+			Value:     `[INSTALLDIR][` + c.instanceProperty + `]\`,
+			Sequence:  "first",
+			Condition: fmt.Sprintf(`NOT Installed AND %s AND %s <> "%s"`, defaultInstallDirProperty, c.instanceProperty, c.instanceIDs[0]),
+		},
+	)
+}
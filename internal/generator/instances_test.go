@@ -0,0 +1,161 @@
+package generator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func TestInstances(t *testing.T) {
+	setup := &ir.Setup{
+		Instances: &ir.Instances{Count: "10"},
+		Features: []ir.Feature{
+			{Name: "Core", Enabled: true, Allowed: true, Items: []ir.Item{
+				ir.Service{FileName: "[INSTALLDIR]app.exe", ServiceName: "AppSvc", ServiceDisplayName: "App Service"},
+			}},
+		},
+	}
+	vars := variables.New()
+	vars["PRODUCT_NAME"] = "App"
+	vars["UPGRADE_CODE"] = "{11111111-2222-3333-4444-555555555555}"
+	output, err := NewContext(setup, vars, ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	wix := parseFragment(t, output.PackageXML+output.DirectoryXML)
+	tests := []struct {
+		element string
+		id      string
+		attr    string
+		want    string
+	}{
+		{"Property", "INSTANCE_NAME", "Value", "I00"},
+		{"Instance", "I01", "ProductCode", "*"},
+		{"Instance", "I01", "ProductName", "App (I01)"},
+		{"Instance", "I01", "UpgradeCode", GenerateGUID("{11111111-2222-3333-4444-555555555555}:I01")},
+		{"Instance", "I10", "ProductName", "App (I10)"},
+		{"SetProperty", "MSIS_DEFAULT_INSTALLDIR", "Before", "AppSearch"},
+		{"SetProperty", "MSIS_DEFAULT_INSTALLDIR", "Condition", "NOT INSTALLDIR"},
+		{"SetDirectory", "INSTALLDIR", "Value", `[INSTALLDIR][INSTANCE_NAME]\`},
+		// Neither the default instance nor a folder from the command line
+		// gets a suffix
+		{"SetDirectory", "INSTALLDIR", "Condition", `NOT Installed AND MSIS_DEFAULT_INSTALLDIR AND INSTANCE_NAME <> "I00"`},
+		{"ServiceInstall", "SVC_ID0000", "Name", "AppSvc_[INSTANCE_NAME]"},
+		{"ServiceInstall", "SVC_ID0000", "DisplayName", "App Service ([INSTANCE_NAME])"},
+		{"ServiceControl", "SVC_ID0000_ctrl", "Name", "AppSvc_[INSTANCE_NAME]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.element+" "+tt.id+" "+tt.attr, func(t *testing.T) {
+			elem := wix.find(tt.element, tt.id)
+			if elem == nil {
+				t.Fatalf("%s %s not found:\n%s\n%s", tt.element, tt.id, output.PackageXML, output.DirectoryXML)
+			}
+			if got := elem.Attrs[tt.attr]; got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.attr, got, tt.want)
+			}
+		})
+	}
+
+	var ids []string
+	for _, instance := range wix.all("Instance") {
+		ids = append(ids, instance.Attrs["Id"])
+	}
+	if want := []string{"I01", "I02", "I03", "I04", "I05", "I06", "I07", "I08", "I09", "I10"}; !slices.Equal(ids, want) {
+		t.Errorf("instances %v, want %v", ids, want)
+	}
+	for _, comp := range wix.all("Component") {
+		if comp.Attrs["MultiInstance"] != "yes" {
+			t.Errorf("expected component %s to be multi-instance", comp.Attrs["Id"])
+		}
+	}
+}
+
+func TestInstanceIDs(t *testing.T) {
+	tests := []struct {
+		count string
+		want  []string
+	}{
+		{"1", []string{"I00", "I01"}},
+		{"3", []string{"I00", "I01", "I02", "I03"}},
+		{"{{TENANTS}}", []string{"I000", "I001"}},
+	}
+	for _, tt := range tests {
+		setup := &ir.Setup{
+			Instances: &ir.Instances{Count: tt.count, Property: "TENANT"},
+			Features:  []ir.Feature{{Name: "Core", Enabled: true, Allowed: true}},
+		}
+		vars := variables.New()
+		vars["TENANTS"] = "120"
+		c := NewContext(setup, vars, ".")
+		if _, err := c.Generate(); err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if !strings.HasPrefix(strings.Join(c.instanceIDs, ","), strings.Join(tt.want, ",")) {
+			t.Errorf("count %s: instances %v, want %v first", tt.count, c.instanceIDs, tt.want)
+		}
+		if c.instanceProperty != "TENANT" {
+			t.Errorf("instance property = %s, want TENANT", c.instanceProperty)
+		}
+	}
+}
+
+func TestWithoutInstances(t *testing.T) {
+	setup := &ir.Setup{
+		Features: []ir.Feature{
+			{Name: "Core", Enabled: true, Allowed: true, Items: []ir.Item{
+				ir.Service{FileName: "[INSTALLDIR]app.exe", ServiceName: "AppSvc"},
+			}},
+		},
+	}
+	output, err := NewContext(setup, variables.New(), ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	wix := parseFragment(t, output.PackageXML+output.DirectoryXML)
+	if len(wix.all("InstanceTransforms")) != 0 || len(wix.all("SetDirectory")) != 0 {
+		t.Errorf("unexpected instance output:\n%s", output.PackageXML)
+	}
+	for _, comp := range wix.all("Component") {
+		if _, ok := comp.Attrs["MultiInstance"]; ok {
+			t.Errorf("unexpected multi-instance component %s", comp.Attrs["Id"])
+		}
+	}
+	if svc := wix.find("ServiceInstall", "SVC_ID0000"); svc == nil || svc.Attrs["Name"] != "AppSvc" {
+		t.Errorf("expected the service name without instance:\n%s", output.DirectoryXML)
+	}
+}
+
+func TestInstancesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		instances ir.Instances
+		vars      map[string]string
+		want      string
+	}{
+		{"zero", ir.Instances{Count: "0"}, nil, `count "0" is not a positive number`},
+		{"not a number", ir.Instances{Count: "ten"}, nil, `count "ten" is not a positive number`},
+		{"private property", ir.Instances{Count: "2", Property: "Tenant"}, nil, "property Tenant is not a public property"},
+		{"merge module", ir.Instances{Count: "2"}, map[string]string{"OUTPUT_TYPE": "msm"}, "needs OUTPUT_TYPE msi"},
+		{"position", ir.Instances{Count: "", Pos: ir.Pos{Line: 4, Column: 3}}, nil, "<instances> at 4:3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := variables.New()
+			for k, v := range tt.vars {
+				vars[k] = v
+			}
+			setup := &ir.Setup{
+				Instances: &tt.instances,
+				Features:  []ir.Feature{{Name: "Core", Enabled: true, Allowed: true}},
+			}
+			_, err := NewContext(setup, vars, ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
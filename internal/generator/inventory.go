@@ -0,0 +1,376 @@
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// ComponentInfo describes a generated component in a form that is independent
+// of generated Directory/File IDs. It is used for build manifests and for
+// comparing the component set against a previous release.
+type ComponentInfo struct {
+	ID        string
+	GUID      string
+	Kind      string   // file, environment, service, create-folder, permission, registry, shortcut, remove-on-uninstall
+	Root      string   // msis root of the directory tree (INSTALLDIR, APPDATADIR, ...); empty outside the trees
+	Directory string   // Target directory, e.g. "[INSTALLDIR]bin"
+	KeyPath   string   // File path, registry path or directory that acts as the KeyPath
+	Features  []string // Owning feature name paths, e.g. "Main/Tools"
+}
+
+// FeatureName returns the name path ("Parent/Child") for a generated feature ID.
+func (c *Context) FeatureName(featureID string) string {
+	return c.featureNames[featureID]
+}
+
+// FeatureNames returns the name paths of all features in declaration order.
+func (c *Context) FeatureNames() []string {
+	names := make([]string, 0, len(c.featureOrder))
+	for _, id := range c.featureOrder {
+		names = append(names, c.featureNames[id])
+	}
+	return names
+}
+
+// Components returns the inventory of all components produced by Generate.
+// Must be called after Generate, since permission and remove-on-uninstall
+// components are only created while emitting XML.
+func (c *Context) Components() []ComponentInfo {
+	owners := c.ComponentOwners()
+
+	var result []ComponentInfo
+	c.walkComponents(func(dir *Directory, comp *Component) {
+		dirPath := dir.TargetPath()
+		info := ComponentInfo{
+			ID:        comp.ID,
+			GUID:      comp.GUID,
+			Root:      c.rootKey(dir),
+			Directory: dirPath,
+			KeyPath:   dirPath,
+			Features:  owners[comp.ID],
+		}
+		switch {
+		case comp.Service != nil:
+			info.Kind = "service"
+		case len(comp.Files) > 0:
+			info.Kind = "file"
+		case comp.Environment != nil:
+			info.Kind = "environment"
+		default:
+			info.Kind = "create-folder"
+		}
+		for _, file := range comp.Files {
+			if file.KeyPath {
+				info.KeyPath = joinTargetPath(dirPath, file.Name)
+			}
+		}
+		result = append(result, info)
+	})
+
+	for _, perm := range c.permissionComponents {
+		dirPath := perm.Dir.TargetPath()
+		result = append(result, ComponentInfo{
+			ID:        perm.ID,
+			GUID:      perm.GUID,
+			Kind:      "permission",
+			Root:      c.rootKey(perm.Dir),
+			Directory: dirPath,
+			KeyPath:   dirPath,
+			Features:  owners[perm.ID],
+		})
+	}
+
+	for _, comp := range c.RegistryComponents {
+		result = append(result, ComponentInfo{
+			ID:       comp.ID,
+			GUID:     comp.GUID,
+			Kind:     "registry",
+			KeyPath:  comp.KeyPath(),
+			Features: owners[comp.ID],
+		})
+	}
+
+	productName := c.Variables["PRODUCT_NAME"]
+	addShortcuts := func(shortcuts []*ShortcutComponent, folder string) {
+		for _, sc := range shortcuts {
+			result = append(result, ComponentInfo{
+				ID:        sc.ID,
+				GUID:      sc.GUID,
+				Kind:      "shortcut",
+				Directory: "[" + folder + "]",
+				KeyPath:   "HKCU\\Software\\" + productName + "\\Shortcuts\\" + sc.ID,
+				Features:  owners[sc.ID],
+			})
+		}
+	}
+	addShortcuts(c.DesktopShortcuts, "DesktopFolder")
+	addShortcuts(c.StartMenuShortcuts, "ProgramMenuFolder")
+
+	// Remove-on-uninstall components use Guid='*', so WiX derives the GUID from the keypath
+	for _, item := range c.RemoveOnUninstallItems {
+		compID := "C_" + item.ID
+		result = append(result, ComponentInfo{
+			ID:        compID,
+			GUID:      "*",
+			Kind:      "remove-on-uninstall",
+			Directory: "[INSTALLDIR]",
+			KeyPath:   "HKCU\\Software\\" + c.Variables["MANUFACTURER"] + "\\" + productName + "\\" + compID,
+			Features:  owners[compID],
+		})
+	}
+
+	return result
+}
+
+// ComponentItem returns the .msis item that produced a component, or nil for
+// components msis adds on its own (ADD_TO_PATH). Folder permission components
+// belong to the item that created the folder.
+func (c *Context) ComponentItem(componentID string) ir.Item {
+	return c.componentItems[componentID]
+}
+
+// DirectoryInfo describes a directory of the install tree.
+type DirectoryInfo struct {
+	ID     string
+	Root   string // msis root key, e.g. "ROAMINGAPPDATADIR"
+	Target string // e.g. "[ROAMINGAPPDATADIR]logs"
+	Source ir.Item
+}
+
+// Directories returns all named directories in sorted root and child order.
+func (c *Context) Directories() []DirectoryInfo {
+	var result []DirectoryInfo
+	c.walkDirectories(func(rootKey string, dir *Directory) {
+		if dir.Name == "" && dir.CustomID == "" {
+			return
+		}
+		id := dir.ID
+		if dir.CustomID != "" {
+			id = dir.CustomID
+		}
+		result = append(result, DirectoryInfo{ID: id, Root: rootKey, Target: dir.TargetPath(), Source: dir.Source})
+	})
+	return result
+}
+
+// rootKey returns the msis root key of the tree that contains dir.
+func (c *Context) rootKey(dir *Directory) string {
+	for dir.Parent != nil {
+		dir = dir.Parent
+	}
+	for key, root := range c.DirectoryTrees {
+		if root == dir {
+			return key
+		}
+	}
+	return ""
+}
+
+// TargetPath returns the directory's install location relative to its msis root,
+// declared directory or standard folder, e.g. "[INSTALLDIR]bin\plugins".
+// Directories above the root's custom ID (the "NGBT" part of
+// INSTALLDIR="NGBT\chimera") are reported by name.
+func (dir *Directory) TargetPath() string {
+	var parts []string
+	for d := dir; d != nil; d = d.Parent {
+		if d.CustomID != "" {
+			return "[" + d.CustomID + "]" + strings.Join(parts, "\\")
+		}
+		if d.StandardID != "" {
+			return "[" + d.StandardID + "]" + strings.Join(parts, "\\")
+		}
+		parts = append([]string{d.Name}, parts...)
+	}
+	return strings.Join(parts, "\\")
+}
+
+// joinTargetPath appends a file name to a target directory path.
+func joinTargetPath(dirPath, name string) string {
+	if strings.HasSuffix(dirPath, "]") || dirPath == "" {
+		return dirPath + name
+	}
+	return dirPath + "\\" + name
+}
+
+// FileInfo describes an installed file and the component that owns it.
+type FileInfo struct {
+	ComponentID   string
+	ComponentGUID string
+	SourcePath    string // As written to the WXS Source attribute (relative to the .msis file)
+	Target        string // Target path, e.g. "[INSTALLDIR]bin\app.exe"
+	Root          string // msis root key or standard folder of the directory tree
+	Features      []string
+}
+
+// ServiceInfo describes a Windows service installed by a component.
+type ServiceInfo struct {
+	ComponentID string
+	Service     *Service
+	Features    []string
+}
+
+// EnvironmentInfo describes an environment variable set by a component.
+type EnvironmentInfo struct {
+	ComponentID string
+	Environment *Environment
+	Features    []string
+}
+
+// Files returns all installed files in directory tree order.
+func (c *Context) Files() []FileInfo {
+	owners := c.ComponentOwners()
+	var result []FileInfo
+	c.walkComponents(func(dir *Directory, comp *Component) {
+		for _, file := range comp.Files {
+			result = append(result, FileInfo{
+				ComponentID:   comp.ID,
+				ComponentGUID: comp.GUID,
+				SourcePath:    file.SourcePath,
+				Target:        joinTargetPath(dir.TargetPath(), file.Name),
+				Root:          c.rootKey(dir),
+				Features:      owners[comp.ID],
+			})
+		}
+	})
+	return result
+}
+
+// Services returns all services in directory tree order.
+func (c *Context) Services() []ServiceInfo {
+	owners := c.ComponentOwners()
+	var result []ServiceInfo
+	c.walkComponents(func(dir *Directory, comp *Component) {
+		if comp.Service != nil {
+			result = append(result, ServiceInfo{ComponentID: comp.ID, Service: comp.Service, Features: owners[comp.ID]})
+		}
+	})
+	return result
+}
+
+// Environments returns all environment variable changes in directory tree order.
+func (c *Context) Environments() []EnvironmentInfo {
+	owners := c.ComponentOwners()
+	var result []EnvironmentInfo
+	c.walkComponents(func(dir *Directory, comp *Component) {
+		if comp.Environment != nil {
+			result = append(result, EnvironmentInfo{ComponentID: comp.ID, Environment: comp.Environment, Features: owners[comp.ID]})
+		}
+	})
+	return result
+}
+
+// ComponentFeatures returns the feature name paths that reference a component.
+// It rebuilds the owner map on every call; use ComponentOwners for many lookups.
+func (c *Context) ComponentFeatures(componentID string) []string {
+	return c.ComponentOwners()[componentID]
+}
+
+// ComponentOwners reverses the feature -> components mapping into
+// component ID -> sorted feature name paths.
+func (c *Context) ComponentOwners() map[string][]string {
+	owners := make(map[string][]string)
+	for featureID, compIDs := range c.FeatureComponents {
+		for _, compID := range compIDs {
+			owners[compID] = append(owners[compID], c.featureNames[featureID])
+		}
+	}
+	for _, names := range owners {
+		sort.Strings(names)
+	}
+	return owners
+}
+
+// walkComponents visits every directory component in sorted root and child order.
+func (c *Context) walkComponents(visit func(dir *Directory, comp *Component)) {
+	c.walkDirectories(func(rootKey string, dir *Directory) {
+		for _, comp := range dir.Components {
+			visit(dir, comp)
+		}
+	})
+}
+
+// walkDirectories visits every directory in sorted root and child order.
+func (c *Context) walkDirectories(visit func(rootKey string, dir *Directory)) {
+	rootKeys := make([]string, 0, len(c.DirectoryTrees))
+	for rootKey := range c.DirectoryTrees {
+		rootKeys = append(rootKeys, rootKey)
+	}
+	sort.Strings(rootKeys)
+
+	var walk func(rootKey string, dir *Directory)
+	walk = func(rootKey string, dir *Directory) {
+		visit(rootKey, dir)
+		childKeys := make([]string, 0, len(dir.Children))
+		for k := range dir.Children {
+			childKeys = append(childKeys, k)
+		}
+		sort.Strings(childKeys)
+		for _, key := range childKeys {
+			walk(rootKey, dir.Children[key])
+		}
+	}
+	for _, rootKey := range rootKeys {
+		walk(rootKey, c.DirectoryTrees[rootKey])
+	}
+}
+
+// StableNames maps generated directory, file, component and feature IDs to
+// names derived from what they install, e.g. DIR_ID00003 -> "dir:[INSTALLDIR]bin"
+// and its file components -> "component:[INSTALLDIR]bin\app.exe".
+// Generated IDs are counters that shift whenever an item is added; the stable
+// names do not. Must be called after Generate.
+func (c *Context) StableNames() map[string]string {
+	names := make(map[string]string)
+
+	var walk func(dir *Directory)
+	walk = func(dir *Directory) {
+		if dir.ID != "" && dir.ID != dir.CustomID {
+			names[dir.ID] = "dir:" + dir.TargetPath()
+		}
+		for _, comp := range dir.Components {
+			for _, file := range comp.Files {
+				names[file.ID] = "file:" + joinTargetPath(dir.TargetPath(), file.Name)
+			}
+		}
+		for _, child := range dir.Children {
+			walk(child)
+		}
+	}
+	for _, root := range c.DirectoryTrees {
+		walk(root)
+	}
+
+	used := make(map[string]int)
+	for _, info := range c.Components() {
+		if info.GUID == "*" || info.Kind == "shortcut" {
+			continue
+		}
+		// Several environment components can share a directory keypath
+		name := info.Kind + ":" + info.KeyPath
+		if info.Kind == "file" {
+			name = "component:" + info.KeyPath
+		}
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s#%d", name, used[name])
+		}
+		names[info.ID] = name
+	}
+	// Shortcut keypaths contain the component ID, so name them by location instead
+	addShortcuts := func(shortcuts []*ShortcutComponent, folder string) {
+		for _, sc := range shortcuts {
+			names[sc.ID] = "shortcut:[" + folder + "]" + sc.Shortcut.Name
+			names[sc.Shortcut.ID] = "link:[" + folder + "]" + sc.Shortcut.Name
+		}
+	}
+	addShortcuts(c.DesktopShortcuts, "DesktopFolder")
+	addShortcuts(c.StartMenuShortcuts, "ProgramMenuFolder")
+
+	for id, name := range c.featureNames {
+		names[id] = "feature:" + name
+	}
+	return names
+}
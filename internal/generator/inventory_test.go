@@ -0,0 +1,208 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func TestComponentsInventory(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bin"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "bin", "app.exe"), []byte("exe"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	setup := &ir.Setup{
+		Features: []ir.Feature{
+			{
+				Name:    "Main",
+				Enabled: true,
+				Items: []ir.Item{
+					ir.Files{Source: "bin", Target: "[INSTALLDIR]"},
+				},
+				SubFeatures: []ir.Feature{
+					{
+						Name:    "Tools",
+						Enabled: true,
+						Items: []ir.Item{
+							ir.SetEnv{Name: "MYAPP_HOME", Value: "[INSTALLDIR]"},
+							ir.Shortcut{Name: "App", Target: "DESKTOP", File: "[INSTALLDIR]app.exe"},
+						},
+					},
+				},
+			},
+		},
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = "MyApp"
+	vars["PRODUCT_NAME"] = "MyApp"
+	ctx := NewContext(setup, vars, tmpDir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	byKind := make(map[string][]ComponentInfo)
+	for _, info := range ctx.Components() {
+		byKind[info.Kind] = append(byKind[info.Kind], info)
+	}
+
+	files := byKind["file"]
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file component, got %d", len(files))
+	}
+	if files[0].KeyPath != "[INSTALLDIR]app.exe" {
+		t.Errorf("file KeyPath = %q, want %q", files[0].KeyPath, "[INSTALLDIR]app.exe")
+	}
+	if len(files[0].Features) != 1 || files[0].Features[0] != "Main" {
+		t.Errorf("file Features = %v, want [Main]", files[0].Features)
+	}
+
+	envs := byKind["environment"]
+	if len(envs) != 1 || envs[0].Features[0] != "Main/Tools" {
+		t.Errorf("expected environment component in Main/Tools, got %+v", envs)
+	}
+
+	if len(byKind["shortcut"]) != 1 {
+		t.Errorf("expected 1 shortcut component, got %d", len(byKind["shortcut"]))
+	}
+	if len(byKind["permission"]) == 0 {
+		t.Error("expected permission components to be reported")
+	}
+}
+
+func TestDirectoryTargetPath(t *testing.T) {
+	vars := variables.New()
+	vars["INSTALLDIR"] = "Company\\MyApp"
+	ctx := NewContext(&ir.Setup{}, vars, ".")
+
+	dir := ctx.GetOrCreateDirectory("INSTALLDIR", "bin\\plugins", false)
+	if got := dir.TargetPath(); got != "[INSTALLDIR]bin\\plugins" {
+		t.Errorf("TargetPath() = %q, want %q", got, "[INSTALLDIR]bin\\plugins")
+	}
+
+	root := ctx.GetOrCreateDirectory("INSTALLDIR", "", false)
+	if got := root.TargetPath(); got != "[INSTALLDIR]" {
+		t.Errorf("TargetPath() = %q, want %q", got, "[INSTALLDIR]")
+	}
+}
+
+func TestFeatureNames(t *testing.T) {
+	setup := &ir.Setup{
+		Features: []ir.Feature{
+			{Name: "Main", ID: "Main", SubFeatures: []ir.Feature{{Name: "Docs"}}},
+			{Name: "Extras"},
+			{Name: "Addons", ID: "Addons"},
+		},
+	}
+	ctx := NewContext(setup, variables.New(), ".")
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	// Custom IDs do not change the order
+	names := ctx.FeatureNames()
+	want := []string{"Main", "Main/Docs", "Extras", "Addons"}
+	if len(names) != len(want) {
+		t.Fatalf("FeatureNames() = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("FeatureNames()[%d] = %q, want %q", i, names[i], want[i])
+		}
+	}
+}
+
+func TestStableNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bin", "sub"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "bin", "sub", "app.exe"), []byte("exe"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	setup := &ir.Setup{
+		Features: []ir.Feature{{
+			Name:    "Main",
+			Enabled: true,
+			Items:   []ir.Item{ir.Files{Source: "bin", Target: "[INSTALLDIR]"}},
+		}},
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = "MyApp"
+	ctx := NewContext(setup, vars, tmpDir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	names := ctx.StableNames()
+	want := map[string]bool{
+		"dir:[INSTALLDIR]sub":                false,
+		"file:[INSTALLDIR]sub\\app.exe":      false,
+		"component:[INSTALLDIR]sub\\app.exe": false,
+		"feature:Main":                       false,
+	}
+	for _, name := range names {
+		if _, ok := want[name]; ok {
+			want[name] = true
+		}
+	}
+	for name, found := range want {
+		if !found {
+			t.Errorf("StableNames() missing %q, got %v", name, names)
+		}
+	}
+}
+
+func TestComponentItemAndDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bin"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "bin", "app.exe"), []byte("exe"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	files := ir.Files{Source: "bin", Target: "[INSTALLDIR]bin", Pos: ir.Pos{Line: 4, Column: 5}}
+	shortcut := ir.Shortcut{Name: "App", Target: "DESKTOP", File: "[INSTALLDIR]bin\\app.exe", Pos: ir.Pos{Line: 5, Column: 5}}
+	setup := &ir.Setup{
+		Features: []ir.Feature{{Name: "Main", Enabled: true, Items: []ir.Item{files, shortcut}}},
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = "MyApp"
+	vars["PRODUCT_NAME"] = "MyApp"
+
+	ctx := NewContext(setup, vars, tmpDir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	for _, comp := range ctx.Components() {
+		item := ctx.ComponentItem(comp.ID)
+		if item == nil {
+			t.Errorf("component %s (%s) has no item", comp.ID, comp.Kind)
+			continue
+		}
+		want := files.Pos
+		if comp.Kind == "shortcut" {
+			want = shortcut.Pos
+		}
+		if item.Position() != want {
+			t.Errorf("component %s (%s): got item at %s, want %s", comp.ID, comp.Kind, item.Position(), want)
+		}
+	}
+
+	dirs := ctx.Directories()
+	if len(dirs) != 2 {
+		t.Fatalf("expected INSTALLDIR and bin, got %+v", dirs)
+	}
+	if dirs[1].Target != "[INSTALLDIR]bin" || dirs[1].Root != "INSTALLDIR" || dirs[1].Source == nil {
+		t.Errorf("unexpected directory %+v", dirs[1])
+	}
+}
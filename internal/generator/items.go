@@ -0,0 +1,517 @@
+package generator
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wxs"
+)
+
+// ItemHandler implements an item element from parsing to WiX output. The
+// embedded parser.ItemType reads and writes the element; Validate checks a
+// parsed item before any item is processed, so that errors are reported
+// before output is generated; Process adds the item to the install model,
+// e.g. with AddComponent and AddXML. featureID is empty for items directly
+// in <setup>.
+type ItemHandler interface {
+	parser.ItemType
+	Validate(c *Context, item ir.Item) error
+	Process(c *Context, item ir.Item, featureID string) error
+}
+
+// handlers are the item handlers by element name.
+var handlers = map[string]ItemHandler{}
+
+// RegisterItem adds an item element to the parser and its handler to the
+// generator. Like parser.RegisterItem, it is not safe for concurrent use.
+func RegisterItem(h ItemHandler) error {
+	if err := parser.RegisterItem(h); err != nil {
+		return err
+	}
+	handlers[h.Element().Name] = h
+	return nil
+}
+
+// Slot is a place in the MSI template that items can add WiX XML to.
+type Slot string
+
+const (
+	SlotPackage                Slot = "package"                  // Children of <Package>
+	SlotUI                     Slot = "ui"                       // Children of a <UI> element
+	SlotInstallExecuteSequence Slot = "install-execute-sequence" // Children of <InstallExecuteSequence>
+)
+
+// featureSlotPrefix starts the slot of a feature's children.
+const featureSlotPrefix = "feature:"
+
+// FeatureSlot returns the slot for children of a <Feature>, such as
+// MergeRef. name is the feature name, or its name path like "Main/Tools"
+// if the name is not unique.
+func FeatureSlot(name string) Slot {
+	return Slot(featureSlotPrefix + name)
+}
+
+// AddXML adds WiX XML to a template slot. The XML is inserted verbatim, in
+// the order it was added.
+func (c *Context) AddXML(slot Slot, xml string) error {
+	featureID, err := c.checkSlot(slot)
+	if err != nil {
+		return err
+	}
+	xml = strings.TrimSpace(xml)
+	if featureID != "" {
+		c.featureChildren[featureID] = append(c.featureChildren[featureID], &wxs.Raw{XML: xml})
+		return nil
+	}
+	c.slotXML[slot] = append(c.slotXML[slot], xml)
+	return nil
+}
+
+// checkSlot checks that a slot exists and returns the ID of the feature of a
+// feature slot.
+func (c *Context) checkSlot(slot Slot) (featureID string, err error) {
+	switch slot {
+	case SlotPackage, SlotUI, SlotInstallExecuteSequence:
+		return "", nil
+	}
+	if name, ok := strings.CutPrefix(string(slot), featureSlotPrefix); ok {
+		return c.lookupFeature(name)
+	}
+	return "", fmt.Errorf("unknown template slot %q: must be package, ui, install-execute-sequence or feature:Name", slot)
+}
+
+// lookupFeature returns the ID of a feature by its name path, by its name if
+// that is unique, or by its ID.
+func (c *Context) lookupFeature(name string) (string, error) {
+	ids := slices.Sorted(maps.Keys(c.featureNames))
+	var matches []string
+	for _, id := range ids {
+		path := c.featureNames[id]
+		if path == name {
+			return id, nil
+		}
+		if path[strings.LastIndex(path, "/")+1:] == name {
+			matches = append(matches, id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		if _, ok := c.featureNames[name]; ok {
+			return name, nil
+		}
+		return "", fmt.Errorf("no feature %q", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("feature name %q is ambiguous, use its path like %q", name, c.featureNames[matches[0]])
+}
+
+// slotOutput returns the XML added to a slot, one fragment per line.
+func (c *Context) slotOutput(slot Slot) string {
+	return strings.Join(c.slotXML[slot], "\n")
+}
+
+// joinXML joins the non-empty XML fragments, one per line.
+func joinXML(fragments ...string) string {
+	var parts []string
+	for _, f := range fragments {
+		if f != "" {
+			parts = append(parts, f)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// AddComponent adds an empty component to the directory of an install
+// target such as "[INSTALLDIR]conf", and references it from a feature.
+// key makes the component ID and GUID stable; it must be unique among the
+// components of the same kind. The caller fills in Content.
+func (c *Context) AddComponent(target, key, featureID string) *Component {
+	rootKey, subPath := ParseTarget(target)
+	dir := c.GetOrCreateDirectory(rootKey, subPath, false)
+	if featureID != "" {
+		c.markDirectoryFeature(dir, featureID)
+	}
+
+	compID := c.NextComponentID(c.productScopedID(key))
+	comp := &Component{ID: compID, GUID: GenerateGUID(compID)}
+	dir.Components = append(dir.Components, comp)
+	if featureID != "" {
+		c.FeatureComponents[featureID] = append(c.FeatureComponents[featureID], compID)
+	}
+	return comp
+}
+
+// validateItems validates the items of the setup and its features, in
+// source order.
+func (c *Context) validateItems() error {
+	if err := c.validateItemList(c.Setup.Items); err != nil {
+		return err
+	}
+	var validateFeatures func(features []ir.Feature) error
+	validateFeatures = func(features []ir.Feature) error {
+		for i := range features {
+			if err := c.validateItemList(features[i].Items); err != nil {
+				return err
+			}
+			if err := validateFeatures(features[i].SubFeatures); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return validateFeatures(c.Setup.Features)
+}
+
+func (c *Context) validateItemList(items []ir.Item) error {
+	for _, item := range items {
+		h, ok := handlers[item.ItemType()]
+		if !ok {
+			return fmt.Errorf("no handler for <%s>", item.ItemType())
+		}
+		if err := h.Validate(c, item); err != nil {
+			return itemError(item, err)
+		}
+	}
+	return nil
+}
+
+// wixSlot returns the slot of a <wix> block.
+func wixSlot(w ir.Wix) Slot {
+	if w.Slot == "" {
+		return SlotPackage
+	}
+	return Slot(w.Slot)
+}
+
+// processWix adds a <wix> block to its slot. Components defined in a block
+// inside a feature are referenced by the feature, unless the block goes into
+// a feature itself, where WiX references them.
+func (c *Context) processWix(w ir.Wix, featureID string) error {
+	content, err := c.Variables.Resolve(w.XML)
+	if err != nil {
+		return fmt.Errorf("<wix>: %w", err)
+	}
+	slot := wixSlot(w)
+	if featureID != "" && !strings.HasPrefix(string(slot), featureSlotPrefix) {
+		ids, err := componentIDs(content)
+		if err != nil {
+			return err
+		}
+		c.FeatureComponents[featureID] = append(c.FeatureComponents[featureID], ids...)
+	}
+	return c.AddXML(slot, content)
+}
+
+// componentIDs returns the IDs of the <Component> elements in WiX XML.
+func componentIDs(content string) ([]string, error) {
+	var ids []string
+	d := xml.NewDecoder(strings.NewReader("<wix>" + content + "</wix>"))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return ids, nil // Well-formedness was checked by the parser
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Component" {
+			continue
+		}
+		id := ""
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "Id" {
+				id = attr.Value
+			}
+		}
+		if id == "" {
+			return nil, fmt.Errorf("<wix>: a <Component> in a feature needs an Id to be referenced")
+		}
+		ids = append(ids, id)
+	}
+}
+
+// processMergeModule merges a merge module into its target directory and
+// references it from the feature.
+func (c *Context) processMergeModule(m ir.MergeModule, featureID string) error {
+	if featureID == "" {
+		return fmt.Errorf("<merge-module> must be inside a <feature>")
+	}
+	if c.Variables.OutputType() != variables.OutputMSI {
+		return fmt.Errorf("<merge-module> needs OUTPUT_TYPE msi; merge modules and libraries cannot contain merge modules")
+	}
+	source, err := c.Variables.Resolve(m.Source)
+	if err != nil {
+		return err
+	}
+	target := m.Target
+	if target == "" {
+		target = "[INSTALLDIR]"
+	}
+	rootKey, subPath := ParseTarget(target)
+	dir := c.GetOrCreateDirectory(rootKey, subPath, false)
+	c.markDirectoryFeature(dir, featureID)
+
+	id := c.mergeID(source)
+	dir.Merges = append(dir.Merges, &MergeModule{ID: id, SourcePath: source})
+	c.featureChildren[featureID] = append(c.featureChildren[featureID], &wxs.MergeRef{ID: id})
+	return nil
+}
+
+// mergeID returns a unique Merge ID derived from the module's file name,
+// e.g. MSM_vendor_crt for vendor-crt.msm.
+func (c *Context) mergeID(source string) string {
+	name := source[strings.LastIndexAny(source, `/\`)+1:]
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	base := "MSM_" + invalidIDChars.ReplaceAllString(name, "_")
+	c.nextMergeID[base]++
+	if n := c.nextMergeID[base]; n > 1 {
+		return fmt.Sprintf("%s_%d", base, n)
+	}
+	return base
+}
+
+// invalidIDChars matches characters not allowed in WiX identifiers.
+var invalidIDChars = regexp.MustCompile(`[^A-Za-z0-9_.]`)
+
+// processWixReference adds a .wixlib or .wxs file to the build and
+// references its component group from the feature.
+func (c *Context) processWixReference(ref ir.WixReference, featureID string) error {
+	if featureID == "" {
+		return fmt.Errorf("<wix-reference> must be inside a <feature>")
+	}
+	source, err := c.Variables.Resolve(ref.Source)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".wixlib", ".wxs":
+	default:
+		return fmt.Errorf("<wix-reference> source %q must be a .wixlib or .wxs file", source)
+	}
+	if !slices.Contains(c.sources, source) {
+		c.sources = append(c.sources, source)
+	}
+	if ref.ComponentGroup != "" {
+		c.featureChildren[featureID] = append(c.featureChildren[featureID], &wxs.ComponentGroupRef{ID: ref.ComponentGroup})
+	}
+	return nil
+}
+
+// standardFolders are the predefined folders of Windows Installer that
+// can be used as roots, e.g. [FontsFolder] or <directory root="FontsFolder">.
+var standardFolders = []string{
+	"AdminToolsFolder", "AppDataFolder", "CommonAppDataFolder", "CommonFiles64Folder",
+	"CommonFiles6432Folder", "CommonFilesFolder", "DesktopFolder", "FavoritesFolder",
+	"FontsFolder", "LocalAppDataFolder", "MyPicturesFolder", "NetHoodFolder",
+	"PersonalFolder", "PrintHoodFolder", "ProgramFiles64Folder", "ProgramFiles6432Folder",
+	"ProgramFilesFolder", "ProgramMenuFolder", "RecentFolder", "SendToFolder",
+	"StartMenuFolder", "StartupFolder", "System16Folder", "System64Folder",
+	"SystemFolder", "TempFolder", "TemplateFolder", "WindowsFolder", "WindowsVolume",
+}
+
+func isStandardFolder(name string) bool {
+	return slices.Contains(standardFolders, name)
+}
+
+// wixID matches a WiX identifier.
+var wixID = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// generatedFeatureID matches the IDs NextFeatureID generates.
+var generatedFeatureID = regexp.MustCompile(`^FEATURE_\d+$`)
+
+// validateDirectory checks the attributes of a <directory> that do not
+// depend on other declarations.
+func validateDirectory(d ir.Directory) error {
+	switch {
+	case !wixID.MatchString(d.ID):
+		return fmt.Errorf("id %q is not a valid WiX identifier", d.ID)
+	case slices.Contains(rootKeys, d.ID) || isStandardFolder(d.ID):
+		return fmt.Errorf("id %s is already a root", d.ID)
+	case d.Configurable && strings.ToUpper(d.ID) != d.ID:
+		return fmt.Errorf("id %s of a configurable directory must be upper case, as it is a public property", d.ID)
+	}
+	return nil
+}
+
+// declareFeatureDirectories declares the directories of a feature and its
+// sub-features.
+func (c *Context) declareFeatureDirectories(feature *ir.Feature, parentIndexPath string, index int) error {
+	indexPath := fmt.Sprintf("%d", index)
+	if parentIndexPath != "" {
+		indexPath = parentIndexPath + "/" + indexPath
+	}
+	if err := c.declareDirectories(feature.Items, c.featureIDs[indexPath]); err != nil {
+		return err
+	}
+	for i := range feature.SubFeatures {
+		if err := c.declareFeatureDirectories(&feature.SubFeatures[i], indexPath, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareDirectories creates the folders of the <directory> items, before
+// any other item is processed. A root must be declared before the
+// directories below it.
+func (c *Context) declareDirectories(items []ir.Item, featureID string) error {
+	for _, item := range items {
+		d, ok := item.(ir.Directory)
+		if !ok {
+			continue
+		}
+		c.currentItem = item
+		err := c.declareDirectory(d, featureID)
+		c.currentItem = nil
+		if err != nil {
+			return itemError(item, err)
+		}
+	}
+	return nil
+}
+
+func (c *Context) declareDirectory(d ir.Directory, featureID string) error {
+	if _, ok := c.declaredDirs[d.ID]; ok {
+		return fmt.Errorf("directory %s is declared twice", d.ID)
+	}
+	root := d.Root
+	if root == "" {
+		root = "INSTALLDIR"
+	}
+	_, declared := c.declaredDirs[root]
+	if !declared && !slices.Contains(rootKeys, root) && !isStandardFolder(root) {
+		return fmt.Errorf("unknown root %q: must be an msis root like INSTALLDIR, a directory declared before, or a standard WiX folder like FontsFolder", root)
+	}
+	path, err := c.Variables.Resolve(d.Path)
+	if err != nil {
+		return err
+	}
+	path = strings.Trim(strings.ReplaceAll(path, "/", "\\"), "\\")
+	if path == "" {
+		return fmt.Errorf("path must name a folder below %s", root)
+	}
+
+	dir := c.GetOrCreateDirectory(root, path, false)
+	if dir.CustomID != "" {
+		return fmt.Errorf("folder %s\\%s already has the ID %s", root, path, dir.CustomID)
+	}
+	dir.CustomID = d.ID
+	c.declaredDirs[d.ID] = dir
+	if featureID != "" {
+		c.markDirectoryFeature(dir, featureID)
+	}
+
+	if d.Configurable {
+		if featureID == "" {
+			return fmt.Errorf("a configurable directory must be inside a <feature>")
+		}
+		if other, ok := c.configurableDirs[featureID]; ok {
+			return fmt.Errorf("feature %s already has the configurable directory %s", c.featureNames[featureID], other)
+		}
+		c.configurableDirs[featureID] = d.ID
+	}
+	return nil
+}
+
+// itemError adds the position of an item to its error, if it is known.
+func itemError(item ir.Item, err error) error {
+	if pos := item.Position(); pos.IsValid() {
+		return fmt.Errorf("<%s> at %s: %w", item.ItemType(), pos, err)
+	}
+	return err
+}
+
+// builtinHandler is the handler of an item of msis itself.
+type builtinHandler struct {
+	parser.ItemType
+	validate func(c *Context, item ir.Item) error
+	process  func(c *Context, item ir.Item, featureID string) error
+}
+
+func (b builtinHandler) Validate(c *Context, item ir.Item) error {
+	if b.validate == nil {
+		return nil
+	}
+	return b.validate(c, item)
+}
+
+func (b builtinHandler) Process(c *Context, item ir.Item, featureID string) error {
+	return b.process(c, item, featureID)
+}
+
+func init() {
+	builtin := map[string]builtinHandler{
+		"files": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processFiles(item.(ir.Files), featureID)
+		}},
+		"registry": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processRegistry(item.(ir.Registry), featureID)
+		}},
+		"set-env": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processSetEnv(item.(ir.SetEnv), featureID)
+		}},
+		"shortcut": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processShortcut(item.(ir.Shortcut), featureID)
+		}},
+		"service": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processService(item.(ir.Service), featureID)
+		}},
+		"exclude": {process: func(c *Context, item ir.Item, featureID string) error {
+			// Already collected before processing
+			return nil
+		}},
+		"create-folder": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processCreateFolder(item.(ir.CreateFolder), featureID)
+		}},
+		"execute": {
+			validate: func(c *Context, item ir.Item) error {
+				return validateExecute(item.(ir.Execute))
+			},
+			process: func(c *Context, item ir.Item, featureID string) error {
+				return c.processExecute(item.(ir.Execute), featureID)
+			},
+		},
+		"remove-on-uninstall": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processRemoveOnUninstall(item.(ir.RemoveOnUninstall), featureID)
+		}},
+		"merge-module": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processMergeModule(item.(ir.MergeModule), featureID)
+		}},
+		"directory": {
+			validate: func(c *Context, item ir.Item) error {
+				return validateDirectory(item.(ir.Directory))
+			},
+			process: func(c *Context, item ir.Item, featureID string) error {
+				// Already declared before processing
+				return nil
+			},
+		},
+		"wix-reference": {process: func(c *Context, item ir.Item, featureID string) error {
+			return c.processWixReference(item.(ir.WixReference), featureID)
+		}},
+		"wix": {
+			validate: func(c *Context, item ir.Item) error {
+				_, err := c.checkSlot(wixSlot(item.(ir.Wix)))
+				return err
+			},
+			process: func(c *Context, item ir.Item, featureID string) error {
+				return c.processWix(item.(ir.Wix), featureID)
+			},
+		},
+	}
+	for name, h := range builtin {
+		t, ok := parser.LookupItem(name)
+		if !ok {
+			panic("generator: no parser item type for <" + name + ">")
+		}
+		h.ItemType = t
+		handlers[name] = h
+	}
+}
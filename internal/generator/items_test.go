@@ -0,0 +1,454 @@
+package generator
+
+import (
+	"encoding/xml"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// productKey is a custom item that stores a key in the registry and adds a
+// property for it.
+type productKey struct {
+	Value string
+	Pos   ir.Pos
+}
+
+func (k productKey) ItemType() string { return "product-key" }
+func (k productKey) Position() ir.Pos { return k.Pos }
+
+type productKeyValue struct {
+	XMLName xml.Name `xml:"RegistryValue"`
+	Root    string   `xml:"Root,attr"`
+	Key     string   `xml:"Key,attr"`
+	Value   string   `xml:"Value,attr"`
+}
+
+type productKeyHandler struct{}
+
+func (productKeyHandler) Element() parser.Element {
+	return parser.Element{
+		Name:       "product-key",
+		Attributes: []parser.Attribute{{Name: "value", Type: parser.String, Required: true}},
+	}
+}
+
+func (productKeyHandler) Parse(src parser.ItemSource) (ir.Item, error) {
+	return productKey{Value: src.Attrs["value"], Pos: src.Pos}, nil
+}
+
+func (productKeyHandler) Write(item ir.Item) parser.ItemSource {
+	return parser.ItemSource{Attrs: map[string]string{"value": item.(productKey).Value}}
+}
+
+func (productKeyHandler) Validate(c *Context, item ir.Item) error {
+	if item.(productKey).Value == "" {
+		return errors.New("product key must not be empty")
+	}
+	return nil
+}
+
+func (productKeyHandler) Process(c *Context, item ir.Item, featureID string) error {
+	comp := c.AddComponent("[INSTALLDIR]", "product-key", featureID)
+	comp.Content = append(comp.Content, &productKeyValue{Root: "HKLM", Key: "Software\\App", Value: item.(productKey).Value})
+	if err := c.AddXML(SlotPackage, `<Property Id="PRODUCT_KEY" Secure="yes" />`); err != nil {
+		return err
+	}
+	return c.AddXML(SlotInstallExecuteSequence, `<Custom Action="CheckKey" After="CostFinalize" />`)
+}
+
+func init() {
+	if err := RegisterItem(productKeyHandler{}); err != nil {
+		panic(err)
+	}
+}
+
+func TestCustomItemHandler(t *testing.T) {
+	setup, err := parser.ParseBytes([]byte(`<setup>
+  <feature name="Main">
+    <product-key value="ABC-123"/>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := variables.New()
+	vars["DISABLE_FILE_PERMISSIONS"] = "True"
+	ctx := NewContext(setup, vars, ".")
+
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.DirectoryXML, `<RegistryValue Root='HKLM' Key='Software\App' Value='ABC-123'/>`) {
+		t.Errorf("component content missing:\n%s", output.DirectoryXML)
+	}
+	if len(ctx.FeatureComponents["FEATURE_00000"]) != 1 {
+		t.Errorf("expected the component in the feature, got %v", ctx.FeatureComponents)
+	}
+	if output.PackageXML != `<Property Id="PRODUCT_KEY" Secure="yes" />` {
+		t.Errorf("PackageXML = %q", output.PackageXML)
+	}
+	if !strings.Contains(output.InstallExecuteSequence, `<Custom Action="CheckKey"`) {
+		t.Errorf("InstallExecuteSequence = %q", output.InstallExecuteSequence)
+	}
+}
+
+func TestCustomItemValidation(t *testing.T) {
+	setup, err := parser.ParseBytes([]byte(`<setup>
+  <feature name="Main">
+    <product-key value=""/>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewContext(setup, variables.New(), ".").Generate()
+	if err == nil || err.Error() != "<product-key> at 3:5: product key must not be empty" {
+		t.Errorf("expected a positioned validation error, got %v", err)
+	}
+}
+
+func TestAddXMLUnknownSlot(t *testing.T) {
+	ctx := NewContext(&ir.Setup{}, variables.New(), ".")
+	if err := ctx.AddXML("dialog", "<UIRef Id='X'/>"); err == nil {
+		t.Error("expected an error for an unknown slot")
+	}
+}
+
+func TestWixSlots(t *testing.T) {
+	setup, err := parser.ParseBytes([]byte(`<setup>
+  <wix slot="ui"><Publish Dialog="ExitDialog" Control="Finish" Event="EndDialog" Value="Return"/></wix>
+  <wix slot="install-execute-sequence"><Custom Action="Hook" After="InstallFiles"/></wix>
+  <feature name="Main">
+    <wix>
+      <DirectoryRef Id="INSTALLDIR">
+        <Component Id="ExtraComponent" Guid="*"><File Source="{{PRODUCT_NAME}}.txt"/></Component>
+      </DirectoryRef>
+    </wix>
+    <feature name="Tools">
+      <wix slot="feature:Tools"><MergeRef Id="CRT"/></wix>
+    </feature>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := variables.New()
+	vars["PRODUCT_NAME"] = "App"
+	vars["DISABLE_FILE_PERMISSIONS"] = "True"
+	ctx := NewContext(setup, vars, ".")
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.UIXML, `<Publish Dialog="ExitDialog"`) {
+		t.Errorf("UIXML = %q", output.UIXML)
+	}
+	if !strings.Contains(output.InstallExecuteSequence, `<Custom Action="Hook" After="InstallFiles"/>`) {
+		t.Errorf("InstallExecuteSequence = %q", output.InstallExecuteSequence)
+	}
+	if !strings.Contains(output.PackageXML, `<File Source="App.txt"/>`) {
+		t.Errorf("variables not resolved in PackageXML = %q", output.PackageXML)
+	}
+	if !strings.Contains(output.FeatureXML, "<ComponentRef Id='ExtraComponent'/>") {
+		t.Errorf("component of the block not referenced by Main:\n%s", output.FeatureXML)
+	}
+	if !strings.Contains(output.FeatureXML, `<MergeRef Id="CRT"/>`) {
+		t.Errorf("feature slot missing:\n%s", output.FeatureXML)
+	}
+}
+
+func TestWixSlotErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{"unknown slot", `<wix slot="dialog"><X/></wix>`, "<wix> at 1:8: unknown template slot"},
+		{"unknown feature", `<wix slot="feature:Other"><X/></wix>`, `no feature "Other"`},
+		{"component without id", `<feature name="Main"><wix><Component/></wix></feature>`, "needs an Id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup, err := parser.ParseBytes([]byte("<setup>" + tt.xml + "</setup>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewContext(setup, variables.New(), ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestMergeModulesAndWixReferences(t *testing.T) {
+	setup, err := parser.ParseBytes([]byte(`<setup>
+  <feature name="Main">
+    <merge-module source="vendor\crt-1.0.msm"/>
+    <merge-module source="other/crt-1.0.msm" target="[INSTALLDIR]vendor"/>
+    <wix-reference source="lib/sdk.wixlib" component-group="SdkFiles"/>
+    <wix-reference source="lib/sdk.wixlib"/>
+    <wix-reference source="fragments/hooks.wxs"/>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := variables.New()
+	vars["DISABLE_FILE_PERMISSIONS"] = "True"
+	ctx := NewContext(setup, vars, ".")
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directories := parseFragment(t, output.DirectoryXML)
+	tests := []struct {
+		id        string
+		directory string
+		source    string
+	}{
+		{"MSM_crt_1.0", "INSTALLDIR", `vendor\crt-1.0.msm`},
+		{"MSM_crt_1.0_2", "DIR_ID00001", "other/crt-1.0.msm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			dir := directories.find("Directory", tt.directory)
+			if dir == nil {
+				t.Fatalf("directory %s not found:\n%s", tt.directory, output.DirectoryXML)
+			}
+			merges := dir.children("Merge")
+			if len(merges) != 1 || merges[0].Attrs["Id"] != tt.id || merges[0].Attrs["SourceFile"] != tt.source {
+				t.Errorf("expected merge module %s from %s in %s:\n%s", tt.id, tt.source, tt.directory, output.DirectoryXML)
+			}
+		})
+	}
+	if vendor := directories.find("Directory", "DIR_ID00001"); vendor == nil || vendor.Attrs["Name"] != "vendor" {
+		t.Errorf("expected the target directory vendor:\n%s", output.DirectoryXML)
+	}
+
+	main := parseFragment(t, output.FeatureXML).find("Feature", "FEATURE_00000")
+	if main == nil {
+		t.Fatalf("feature Main not found:\n%s", output.FeatureXML)
+	}
+	var refs []string
+	for _, ref := range main.Children {
+		refs = append(refs, ref.Name+" "+ref.Attrs["Id"])
+	}
+	if want := []string{"MergeRef MSM_crt_1.0", "MergeRef MSM_crt_1.0_2", "ComponentGroupRef SdkFiles"}; !slices.Equal(refs, want) {
+		t.Errorf("feature references %q, want %q", refs, want)
+	}
+	if got := strings.Join(output.Sources, ","); got != "lib/sdk.wixlib,fragments/hooks.wxs" {
+		t.Errorf("Sources = %s", got)
+	}
+}
+
+func TestMergeModuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{"outside feature", `<merge-module source="a.msm"/>`, "<merge-module> at 1:8: <merge-module> must be inside a <feature>"},
+		{"reference outside feature", `<wix-reference source="a.wixlib"/>`, "must be inside a <feature>"},
+		{"wrong extension", `<feature name="A"><wix-reference source="a.dll"/></feature>`, "must be a .wixlib or .wxs file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup, err := parser.ParseBytes([]byte("<setup>" + tt.xml + "</setup>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewContext(setup, variables.New(), ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestComponentGroupsForLibraries(t *testing.T) {
+	setup, err := parser.ParseBytes([]byte(`<setup>
+  <feature name="Main">
+    <create-folder target="[INSTALLDIR]logs"/>
+    <wix-reference source="lib/sdk.wixlib" component-group="SdkFiles"/>
+    <feature name="Tools">
+      <create-folder target="[INSTALLDIR]tools"/>
+    </feature>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := variables.New()
+	vars["OUTPUT_TYPE"] = "wixlib"
+	vars["DISABLE_FILE_PERMISSIONS"] = "True"
+	ctx := NewContext(setup, vars, ".")
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(output.FeatureXML, "<Feature") {
+		t.Errorf("library has <Feature> elements:\n%s", output.FeatureXML)
+	}
+	main := ctx.FeatureComponents["FEATURE_00000"][0]
+	tools := ctx.FeatureComponents["FEATURE_00001"][0]
+	want := "<ComponentGroup Id='FEATURE_00000'>\n" +
+		"            <ComponentRef Id='" + main + "'/>\n" +
+		"            <ComponentGroupRef Id='SdkFiles'/>\n" +
+		"            <ComponentGroupRef Id='FEATURE_00001'/>\n" +
+		"        </ComponentGroup>\n" +
+		"        <ComponentGroup Id='FEATURE_00001'>\n" +
+		"            <ComponentRef Id='" + tools + "'/>\n" +
+		"        </ComponentGroup>"
+	if !strings.Contains(output.FeatureXML, want) {
+		t.Errorf("FeatureXML = \n%s\nwant\n%s", output.FeatureXML, want)
+	}
+}
+
+func TestOutputTypeErrors(t *testing.T) {
+	tests := []struct {
+		outputType string
+		xml        string
+		want       string
+	}{
+		{"exe", ``, `OUTPUT_TYPE must be msi, msm or wixlib, not "exe"`},
+		{"msm", `<feature name="A"><merge-module source="a.msm"/></feature>`, "<merge-module> needs OUTPUT_TYPE msi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.outputType, func(t *testing.T) {
+			setup, err := parser.ParseBytes([]byte("<setup>" + tt.xml + "</setup>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			vars := variables.New()
+			vars["OUTPUT_TYPE"] = tt.outputType
+			_, err = NewContext(setup, vars, ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDirectoryDeclarations(t *testing.T) {
+	setup, err := parser.ParseBytes([]byte(`<setup>
+  <directory id="PLUGINDIR" root="ProgramFilesFolder" path="Vendor/Plugins"/>
+  <feature name="Main">
+    <create-folder target="[PLUGINDIR]cache"/>
+    <feature name="Data">
+      <create-folder target="[DATADIR]samples"/>
+      <directory id="DATADIR" root="APPDATADIR" path="Company\Data" configurable="yes"/>
+    </feature>
+    <feature name="Fonts">
+      <create-folder target="[FontsFolder]"/>
+    </feature>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = "App"
+	vars["DISABLE_FILE_PERMISSIONS"] = "True"
+	ctx := NewContext(setup, vars, ".")
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]string)
+	for _, dir := range ctx.Directories() {
+		ids[dir.Target] = dir.ID
+	}
+	// Items may target a directory declared after them
+	tests := []struct {
+		id     string
+		xml    string
+		name   string
+		subdir string
+	}{
+		{"DATADIR", output.AppDataDirXML, "Data", "samples"},
+		{"PLUGINDIR", output.PackageXML, "Plugins", "cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			dir := parseFragment(t, tt.xml).find("Directory", tt.id)
+			if dir == nil || dir.Attrs["Name"] != tt.name {
+				t.Fatalf("expected directory %s named %s:\n%s", tt.id, tt.name, tt.xml)
+			}
+			subdirs := dir.children("Directory")
+			if len(subdirs) != 1 || subdirs[0].Attrs["Name"] != tt.subdir {
+				t.Errorf("expected subdirectory %s in %s:\n%s", tt.subdir, tt.id, tt.xml)
+			}
+			target := "[" + tt.id + "]"
+			if _, ok := ids[target+tt.subdir]; ids[target] != tt.id || !ok {
+				t.Errorf("Directories() lacks %s or %s%s: %v", target, target, tt.subdir, ids)
+			}
+		})
+	}
+
+	wix := parseFragment(t, output.PackageXML)
+	if programFiles := wix.find("StandardDirectory", "ProgramFilesFolder"); programFiles == nil || programFiles.find("Directory", "PLUGINDIR") == nil {
+		t.Errorf("expected PLUGINDIR below ProgramFilesFolder:\n%s", output.PackageXML)
+	}
+	if wix.find("StandardDirectory", "FontsFolder") == nil {
+		t.Errorf("expected FontsFolder:\n%s", output.PackageXML)
+	}
+
+	features := parseFragment(t, output.FeatureXML)
+	featureTests := []struct {
+		id           string
+		configurable string
+	}{
+		{"FEATURE_00000", "INSTALLDIR"},
+		{"FEATURE_00001", "DATADIR"},
+		{"FEATURE_00002", ""},
+	}
+	for _, tt := range featureTests {
+		feature := features.find("Feature", tt.id)
+		if feature == nil || feature.Attrs["ConfigurableDirectory"] != tt.configurable {
+			t.Errorf("expected feature %s with configurable directory %q:\n%s", tt.id, tt.configurable, output.FeatureXML)
+		}
+	}
+}
+
+func TestDirectoryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{"invalid id", `<directory id="my dir" path="x"/>`, "<directory> at 1:8: id \"my dir\" is not a valid WiX identifier"},
+		{"root id", `<directory id="APPDATADIR" path="x"/>`, "already a root"},
+		{"lower case configurable", `<feature name="A"><directory id="DataDir" path="x" configurable="yes"/></feature>`, "must be upper case"},
+		{"unknown root", `<directory id="X" root="NOWHERE" path="x"/>`, `unknown root "NOWHERE"`},
+		{"root declared later", `<directory id="A" root="B" path="x"/><directory id="B" path="y"/>`, `unknown root "B"`},
+		{"declared twice", `<directory id="A" path="x"/><directory id="A" path="y"/>`, "declared twice"},
+		{"same folder", `<directory id="A" path="x"/><directory id="B" path="X"/>`, "already has the ID A"},
+		{"empty path", `<directory id="A" path="/"/>`, "path must name a folder"},
+		{"configurable outside feature", `<directory id="A" path="x" configurable="yes"/>`, "must be inside a <feature>"},
+		{"two configurable", `<feature name="F"><directory id="A" path="x" configurable="yes"/><directory id="B" path="y" configurable="yes"/></feature>`, "already has the configurable directory A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup, err := parser.ParseBytes([]byte("<setup>" + tt.xml + "</setup>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewContext(setup, variables.New(), ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
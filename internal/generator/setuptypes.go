@@ -0,0 +1,242 @@
+package generator
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wxs"
+)
+
+// setupTypesDialog is the ID of the setup type dialog. It differs from the
+// SetupTypeDlg of WixUI_Mondo, which has fixed Typical, Custom and Complete
+// buttons.
+const setupTypesDialog = "SetupTypesDlg"
+
+// maxSetupTypes is the number of setup types the dialog has room for.
+const maxSetupTypes = 4
+
+// setupType is a <setup-type> with its features resolved to IDs.
+type setupType struct {
+	name        string
+	description string
+	features    []string // Listed feature IDs; nil for the custom setup type
+}
+
+// resolveSetupTypes checks the <setup-type> declarations and resolves their
+// features, which must have their IDs assigned.
+func (c *Context) resolveSetupTypes() error {
+	if len(c.Setup.SetupTypes) == 0 {
+		return nil
+	}
+	if c.Variables.OutputType() != variables.OutputMSI {
+		return fmt.Errorf("<setup-type> needs OUTPUT_TYPE msi; merge modules and libraries have no features")
+	}
+	if len(c.Setup.SetupTypes) > maxSetupTypes {
+		return fmt.Errorf("the setup type dialog has room for %d setup types, not %d", maxSetupTypes, len(c.Setup.SetupTypes))
+	}
+	for _, st := range c.Setup.SetupTypes {
+		t, err := c.resolveSetupType(st)
+		if err != nil {
+			return setupTypeError(st, err)
+		}
+		c.setupTypes = append(c.setupTypes, t)
+	}
+	return nil
+}
+
+func (c *Context) resolveSetupType(st ir.SetupType) (setupType, error) {
+	t := setupType{name: strings.TrimSpace(st.Name), description: st.Description}
+	switch {
+	case t.name == "":
+		return t, fmt.Errorf("name is empty")
+	case strings.Contains(t.name, `"`):
+		return t, fmt.Errorf("name %s must not contain quotes, as it is compared in conditions", t.name)
+	}
+	for _, other := range c.setupTypes {
+		switch {
+		case strings.EqualFold(other.name, t.name):
+			return t, fmt.Errorf("setup type %s is declared twice", t.name)
+		case other.features == nil && strings.TrimSpace(st.Features) == "":
+			return t, fmt.Errorf("setup type %s already lets the user pick the features", other.name)
+		}
+	}
+	if strings.TrimSpace(st.Features) == "" {
+		return t, nil
+	}
+	t.features = []string{}
+	for name := range strings.SplitSeq(st.Features, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, err := c.lookupFeature(name)
+		if err != nil {
+			return t, err
+		}
+		if c.neverInstalled(id) {
+			return t, fmt.Errorf("feature %s has level 0 and is never installed", name)
+		}
+		t.features = append(t.features, id)
+	}
+	return t, nil
+}
+
+// setupTypeError prefixes an error with the position of the setup type.
+func setupTypeError(st ir.SetupType, err error) error {
+	if st.Pos.IsValid() {
+		return fmt.Errorf("<setup-type> at %s: %w", st.Pos, err)
+	}
+	return err
+}
+
+// installs reports whether a setup type installs a feature: its listed
+// features with their sub-features, the parents they need, and the features
+// the user may not deselect. Features of level 0 are never installed.
+func (c *Context) installs(t setupType, featureID string) bool {
+	if c.neverInstalled(featureID) {
+		return false
+	}
+	if !c.features[featureID].Allowed {
+		return true
+	}
+	for _, id := range t.features {
+		if c.featureWithin(featureID, id) || c.featureWithin(id, featureID) {
+			return true
+		}
+	}
+	return false
+}
+
+// neverInstalled reports whether a feature has level 0, which no setup
+// type changes.
+func (c *Context) neverInstalled(featureID string) bool {
+	level := c.features[featureID].Level
+	return level != "" && strings.Trim(level, "0") == ""
+}
+
+// featureWithin reports whether a feature is another one or one of its
+// sub-features.
+func (c *Context) featureWithin(featureID, otherID string) bool {
+	for id := featureID; id != ""; id = c.featureParents[id] {
+		if id == otherID {
+			return true
+		}
+	}
+	return false
+}
+
+// setupTypeCondition is the condition under which a setup type is chosen.
+// SETUPTYPE=typical works on the command line, too.
+func setupTypeCondition(name string) string {
+	return fmt.Sprintf(`SETUPTYPE ~= "%s"`, name)
+}
+
+// setupTypeLevels returns the <Level> elements by which the setup types
+// install a feature or leave it out, where that differs from the feature's
+// own level. The custom setup type keeps the feature's own level.
+func (c *Context) setupTypeLevels(featureID, level string) []any {
+	if c.neverInstalled(featureID) {
+		return nil
+	}
+	var levels []any
+	for _, t := range c.setupTypes {
+		if t.features == nil {
+			continue
+		}
+		value := "32767"
+		if c.installs(t, featureID) {
+			value = "1"
+		}
+		if value != level {
+			levels = append(levels, &wxs.Level{Value: value, Condition: setupTypeCondition(t.name)})
+		}
+	}
+	return levels
+}
+
+// generateSetupTypesXML returns the SETUPTYPE property, which defaults to
+// the first setup type, and the setup type dialog with its place in the UI
+// flow. The template leads to the dialog through {{FEATURES_DIALOG}}; silent
+// setups have no dialogs.
+func (c *Context) generateSetupTypesXML() (packageXML, uiXML string) {
+	if len(c.setupTypes) == 0 {
+		return "", ""
+	}
+	packageXML = wxs.MustRender(2, &wxs.Property{ID: "SETUPTYPE", Value: c.setupTypes[0].name, Secure: "yes"})
+	if c.Setup.Silent {
+		return packageXML, ""
+	}
+
+	dialog := &wxs.Dialog{
+		ID:     setupTypesDialog,
+		Width:  370,
+		Height: 270,
+		Title:  "!(loc.SetupTypeDlg_Title)",
+		Children: []any{
+			&wxs.Control{ID: "BannerBitmap", Type: "Bitmap", Width: 370, Height: 44, Text: "!(loc.SetupTypeDlgBannerBitmap)"},
+			&wxs.Control{ID: "BannerLine", Type: "Line", Y: 44, Width: 370},
+			&wxs.Control{ID: "Title", Type: "Text", X: 15, Y: 6, Width: 200, Height: 15, Transparent: "yes", NoPrefix: "yes", Text: "!(loc.SetupTypeDlgTitle)"},
+			&wxs.Control{ID: "Description", Type: "Text", X: 25, Y: 23, Width: 280, Height: 15, Transparent: "yes", NoPrefix: "yes", Text: "!(loc.SetupTypeDlgDescription)"},
+		},
+	}
+	// One button per setup type, with its description below
+	for i, t := range c.setupTypes {
+		y := 55 + 45*i
+		dialog.Children = append(dialog.Children, &wxs.Control{
+			ID: fmt.Sprintf("SetupType%d", i), Type: "PushButton", X: 40, Y: y, Width: 80, Height: 17, Text: t.name,
+			Children: c.setupTypePublishes(t),
+		})
+		if t.description != "" {
+			dialog.Children = append(dialog.Children, &wxs.Control{
+				ID: fmt.Sprintf("SetupType%dText", i), Type: "Text", X: 60, Y: y + 20, Width: 280, Height: 20, NoPrefix: "yes", Text: t.description,
+			})
+		}
+	}
+	dialog.Children = append(dialog.Children,
+		&wxs.Control{ID: "BottomLine", Type: "Line", Y: 234, Width: 370},
+		&wxs.Control{ID: "Back", Type: "PushButton", X: 180, Y: 243, Width: 56, Height: 17, Text: "!(loc.WixUIBack)"},
+		&wxs.Control{ID: "Next", Type: "PushButton", X: 236, Y: 243, Width: 56, Height: 17, Default: "yes", Disabled: "yes", Text: "!(loc.WixUINext)"},
+		&wxs.Control{ID: "Cancel", Type: "PushButton", X: 304, Y: 243, Width: 56, Height: 17, Cancel: "yes", Text: "!(loc.WixUICancel)",
+			Children: []any{&wxs.Publish{Event: "SpawnDialog", Value: "CancelDlg"}}},
+	)
+
+	uiXML = wxs.MustRender(3,
+		dialog,
+		// On new installs, Back of the template's CustomizeDlg and
+		// VerifyReadyDlg returns to this dialog
+		&wxs.Publish{Dialog: "CustomizeDlg", Control: "Back", Event: "NewDialog", Value: setupTypesDialog, Order: 2, Condition: "NOT Installed"},
+		&wxs.Publish{Dialog: "VerifyReadyDlg", Control: "Back", Event: "NewDialog", Value: setupTypesDialog, Order: 4, Condition: `NOT Installed AND WixUI_InstallMode = "InstallPreset"`},
+	)
+	return packageXML, uiXML
+}
+
+// setupTypePublishes returns the events of the button of a setup type. The
+// custom setup type opens the feature tree; the others select their features
+// and go on to VerifyReadyDlg.
+func (c *Context) setupTypePublishes(t setupType) []any {
+	var publishes []any
+	add := func(p *wxs.Publish) {
+		p.Order = len(publishes) + 1
+		publishes = append(publishes, p)
+	}
+	add(&wxs.Publish{Property: "SETUPTYPE", Value: t.name})
+	if t.features == nil {
+		add(&wxs.Publish{Property: "WixUI_InstallMode", Value: "InstallCustom"})
+		add(&wxs.Publish{Event: "NewDialog", Value: "CustomizeDlg"})
+		return publishes
+	}
+	add(&wxs.Publish{Property: "WixUI_InstallMode", Value: "InstallPreset"})
+	add(&wxs.Publish{Event: "Remove", Value: "ALL"})
+	// Index paths sort parents before their sub-features
+	for _, indexPath := range slices.Sorted(maps.Keys(c.featureIDs)) {
+		if id := c.featureIDs[indexPath]; c.installs(t, id) {
+			add(&wxs.Publish{Event: "AddLocal", Value: id})
+		}
+	}
+	add(&wxs.Publish{Event: "NewDialog", Value: "VerifyReadyDlg"})
+	return publishes
+}
@@ -0,0 +1,215 @@
+package generator
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func TestSetupTypes(t *testing.T) {
+	setup := &ir.Setup{
+		SetupTypes: []ir.SetupType{
+			{Name: "Typical", Features: "Docs/Samples", Description: "Core and samples"},
+			{Name: "Complete", Features: "Docs, Tools"},
+			{Name: "Custom"},
+		},
+		Features: []ir.Feature{
+			{Name: "Core", Enabled: true, Allowed: false},
+			{Name: "Docs", Enabled: true, Allowed: true, SubFeatures: []ir.Feature{
+				{Name: "Samples", Enabled: false, Allowed: true},
+			}},
+			{Name: "Tools", ID: "Tools", Enabled: true, Allowed: true},
+		},
+	}
+	output, err := NewContext(setup, variables.New(), ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	// Levels only where a setup type differs from the feature's own level;
+	// the required core and Docs, which all setup types install, need none
+	features := parseFragment(t, output.FeatureXML)
+	levelTests := []struct {
+		id     string
+		level  string
+		levels []string
+	}{
+		{"FEATURE_00000", "1", nil},
+		{"FEATURE_00001", "1", nil},
+		{"FEATURE_00002", "32767", []string{`1 if SETUPTYPE ~= "Typical"`, `1 if SETUPTYPE ~= "Complete"`}},
+		{"Tools", "1", []string{`32767 if SETUPTYPE ~= "Typical"`}},
+	}
+	for _, tt := range levelTests {
+		t.Run(tt.id, func(t *testing.T) {
+			feature := features.find("Feature", tt.id)
+			if feature == nil {
+				t.Fatalf("feature %s not found:\n%s", tt.id, output.FeatureXML)
+			}
+			var levels []string
+			for _, level := range feature.children("Level") {
+				levels = append(levels, level.Attrs["Value"]+" if "+level.Attrs["Condition"])
+			}
+			if feature.Attrs["Level"] != tt.level || !slices.Equal(levels, tt.levels) {
+				t.Errorf("level %s %q, want %s %q", feature.Attrs["Level"], levels, tt.level, tt.levels)
+			}
+		})
+	}
+
+	property := parseFragment(t, output.PackageXML).find("Property", "SETUPTYPE")
+	if property == nil || property.Attrs["Value"] != "Typical" || property.Attrs["Secure"] != "yes" {
+		t.Errorf("expected the SETUPTYPE property to default to Typical:\n%s", output.PackageXML)
+	}
+	if output.FeaturesDialog != "SetupTypesDlg" {
+		t.Errorf("FeaturesDialog = %q, want SetupTypesDlg", output.FeaturesDialog)
+	}
+
+	// Typical installs Samples with the parent it needs, and the required core
+	ui := parseFragment(t, output.UIXML)
+	buttonTests := []struct {
+		id      string
+		text    string
+		y       string
+		publish []string
+	}{
+		{"SetupType0", "Typical", "55", []string{"SETUPTYPE=Typical", "WixUI_InstallMode=InstallPreset", "Remove=ALL",
+			"AddLocal=FEATURE_00000", "AddLocal=FEATURE_00001", "AddLocal=FEATURE_00002", "NewDialog=VerifyReadyDlg"}},
+		{"SetupType1", "Complete", "100", []string{"SETUPTYPE=Complete", "WixUI_InstallMode=InstallPreset", "Remove=ALL",
+			"AddLocal=FEATURE_00000", "AddLocal=FEATURE_00001", "AddLocal=FEATURE_00002", "AddLocal=Tools", "NewDialog=VerifyReadyDlg"}},
+		{"SetupType2", "Custom", "145", []string{"SETUPTYPE=Custom", "WixUI_InstallMode=InstallCustom", "NewDialog=CustomizeDlg"}},
+	}
+	for _, tt := range buttonTests {
+		t.Run(tt.id, func(t *testing.T) {
+			button := ui.find("Control", tt.id)
+			if button == nil {
+				t.Fatalf("button %s not found:\n%s", tt.id, output.UIXML)
+			}
+			if button.Attrs["Type"] != "PushButton" || button.Attrs["Text"] != tt.text || button.Attrs["Y"] != tt.y {
+				t.Errorf("button %v, want %s at Y %s", button.Attrs, tt.text, tt.y)
+			}
+			var publish []string
+			for i, p := range button.children("Publish") {
+				if p.Attrs["Order"] != strconv.Itoa(i+1) {
+					t.Errorf("publish %v out of order", p.Attrs)
+				}
+				name := p.Attrs["Property"]
+				if name == "" {
+					name = p.Attrs["Event"]
+				}
+				publish = append(publish, name+"="+p.Attrs["Value"])
+			}
+			if !slices.Equal(publish, tt.publish) {
+				t.Errorf("publish %q, want %q", publish, tt.publish)
+			}
+		})
+	}
+
+	if text := ui.find("Control", "SetupType0Text"); text == nil || text.Attrs["Text"] != "Core and samples" {
+		t.Errorf("expected the description below Typical:\n%s", output.UIXML)
+	}
+	back := false
+	for _, p := range ui.children("Publish") {
+		if p.Attrs["Dialog"] == "CustomizeDlg" && p.Attrs["Control"] == "Back" {
+			back = p.Attrs["Value"] == "SetupTypesDlg" && p.Attrs["Condition"] == "NOT Installed"
+		}
+	}
+	if !back {
+		t.Errorf("expected CustomizeDlg to go back to SetupTypesDlg:\n%s", output.UIXML)
+	}
+}
+
+func TestSetupTypesSilent(t *testing.T) {
+	setup := &ir.Setup{
+		Silent:     true,
+		SetupTypes: []ir.SetupType{{Name: "Typical", Features: "Core"}},
+		Features:   []ir.Feature{{Name: "Core", Enabled: true, Allowed: true}},
+	}
+	output, err := NewContext(setup, variables.New(), ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if output.UIXML != "" {
+		t.Errorf("a silent setup has no setup type dialog:\n%s", output.UIXML)
+	}
+	if parseFragment(t, output.PackageXML).find("Property", "SETUPTYPE") == nil {
+		t.Errorf("silent setups choose a setup type with SETUPTYPE:\n%s", output.PackageXML)
+	}
+}
+
+func TestWithoutSetupTypes(t *testing.T) {
+	setup := &ir.Setup{
+		Features: []ir.Feature{{Name: "Core", Enabled: true, Allowed: true}},
+	}
+	output, err := NewContext(setup, variables.New(), ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if output.FeaturesDialog != "CustomizeDlg" || len(parseFragment(t, output.FeatureXML).all("Level")) != 0 {
+		t.Errorf("unexpected setup type output %q:\n%s", output.FeaturesDialog, output.FeatureXML)
+	}
+}
+
+func TestSetupTypesNeverInstalled(t *testing.T) {
+	setup := &ir.Setup{
+		SetupTypes: []ir.SetupType{{Name: "Complete", Features: "Docs"}},
+		Features: []ir.Feature{
+			{Name: "Docs", Enabled: true, Allowed: true, SubFeatures: []ir.Feature{
+				{Name: "Samples", Enabled: true, Allowed: true, Level: "0"},
+			}},
+		},
+	}
+	output, err := NewContext(setup, variables.New(), ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	samples := parseFragment(t, output.FeatureXML).find("Feature", "FEATURE_00001")
+	if samples == nil || samples.Attrs["Level"] != "0" || len(samples.children("Level")) != 0 {
+		t.Errorf("a feature of level 0 must stay uninstalled:\n%s", output.FeatureXML)
+	}
+	for _, p := range parseFragment(t, output.UIXML).all("Publish") {
+		if p.Attrs["Event"] == "AddLocal" && p.Attrs["Value"] == "FEATURE_00001" {
+			t.Errorf("a setup type must not install a feature of level 0:\n%s", output.UIXML)
+		}
+	}
+}
+
+func TestSetupTypeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []ir.SetupType
+		vars  map[string]string
+		want  string
+	}{
+		{"empty name", []ir.SetupType{{Name: " "}}, nil, "name is empty"},
+		{"quotes", []ir.SetupType{{Name: `"All"`, Features: "Core"}}, nil, "must not contain quotes"},
+		{"duplicate", []ir.SetupType{{Name: "Typical", Features: "Core"}, {Name: "typical", Features: "Tools"}}, nil, "declared twice"},
+		{"two custom", []ir.SetupType{{Name: "Custom"}, {Name: "Advanced"}}, nil, "Custom already lets the user pick the features"},
+		{"unknown feature", []ir.SetupType{{Name: "Typical", Features: "Core,Extras"}}, nil, `no feature "Extras"`},
+		{"never installed", []ir.SetupType{{Name: "Typical", Features: "Samples"}}, nil, "feature Samples has level 0"},
+		{"too many", []ir.SetupType{{Name: "A"}, {Name: "B", Features: "Core"}, {Name: "C", Features: "Core"}, {Name: "D", Features: "Core"}, {Name: "E", Features: "Core"}}, nil, "room for 4 setup types, not 5"},
+		{"merge module", []ir.SetupType{{Name: "Typical", Features: "Core"}}, map[string]string{"OUTPUT_TYPE": "msm"}, "needs OUTPUT_TYPE msi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := variables.New()
+			for k, v := range tt.vars {
+				vars[k] = v
+			}
+			setup := &ir.Setup{
+				SetupTypes: tt.types,
+				Features: []ir.Feature{
+					{Name: "Core", Enabled: true, Allowed: false},
+					{Name: "Tools", Enabled: true, Allowed: true},
+					{Name: "Samples", Enabled: true, Allowed: true, Level: "0"},
+				},
+			}
+			_, err := NewContext(setup, vars, ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
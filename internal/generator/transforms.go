@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wxs"
+)
+
+// Transform is a <transform> with the WiX XML of its property defaults.
+// The MSI built with that XML added to the <Package> differs from the
+// standard MSI by the transform.
+type Transform struct {
+	Name       string
+	Properties []string // IDs of the properties the transform sets
+	PackageXML string
+}
+
+// transformName matches the names of transforms, which are part of file
+// names.
+var transformName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// resolveTransforms checks the <transform> declarations and renders their
+// properties. The properties msis sets itself cannot be changed by a
+// transform, so it must run after the setup types and instances are resolved;
+// those of the template are checked once the WiX source is rendered.
+func (c *Context) resolveTransforms() error {
+	if len(c.Setup.Transforms) == 0 {
+		return nil
+	}
+	if c.Variables.OutputType() != variables.OutputMSI {
+		return fmt.Errorf("<transform> needs OUTPUT_TYPE msi; merge modules and libraries take the properties of their package")
+	}
+	for _, t := range c.Setup.Transforms {
+		transform, err := c.resolveTransform(t)
+		if err != nil {
+			if t.Pos.IsValid() {
+				return fmt.Errorf("<transform> at %s: %w", t.Pos, err)
+			}
+			return err
+		}
+		c.transforms = append(c.transforms, transform)
+	}
+	return nil
+}
+
+func (c *Context) resolveTransform(t ir.Transform) (Transform, error) {
+	transform := Transform{Name: t.Name}
+	switch {
+	case !transformName.MatchString(t.Name):
+		return transform, fmt.Errorf("name %q must start with a letter or digit and hold only letters, digits, '-', '_' and '.', as it is part of the .mst file name", t.Name)
+	case len(t.Properties) == 0:
+		return transform, fmt.Errorf("transform %s sets no properties", t.Name)
+	}
+	for _, other := range c.transforms {
+		if strings.EqualFold(other.Name, t.Name) {
+			return transform, fmt.Errorf("transform %s is declared twice", t.Name)
+		}
+	}
+
+	reserved := map[string]string{}
+	if len(c.setupTypes) > 0 {
+		reserved["SETUPTYPE"] = "<setup-type>"
+	}
+	if c.instanceIDs != nil {
+		reserved[c.instanceProperty] = "<instances>"
+		reserved[defaultInstallDirProperty] = "<instances>"
+	}
+	seen := make(map[string]bool)
+	var properties []any
+	for _, p := range t.Properties {
+		switch {
+		case !publicProperty(p.Name):
+			return transform, fmt.Errorf("property %s is not a public property, which has an upper case ID", p.Name)
+		case seen[p.Name]:
+			return transform, fmt.Errorf("property %s is set twice", p.Name)
+		case reserved[p.Name] != "":
+			return transform, fmt.Errorf("property %s is set by %s", p.Name, reserved[p.Name])
+		}
+		seen[p.Name] = true
+		value, err := c.Variables.Resolve(p.Value)
+		if err != nil {
+			return transform, fmt.Errorf("property %s: %w", p.Name, err)
+		}
+		if value == "" {
+			return transform, fmt.Errorf("property %s has no value; Windows Installer has no empty properties", p.Name)
+		}
+		properties = append(properties, &wxs.Property{ID: p.Name, Value: value})
+		transform.Properties = append(transform.Properties, p.Name)
+	}
+	transform.PackageXML = wxs.MustRender(2, properties...)
+	return transform, nil
+}
+
+// publicProperty reports whether a property can be set on the command line
+// and by transforms: its ID has no lower case letters.
+func publicProperty(name string) bool {
+	return wixID.MatchString(name) && strings.ToUpper(name) == name
+}
@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func TestTransforms(t *testing.T) {
+	vars := variables.New()
+	vars["DOMAIN"] = "example.com"
+	setup := &ir.Setup{
+		Transforms: []ir.Transform{
+			{Name: "site-berlin", Properties: []ir.Property{{Name: "SERVER", Value: "berlin01.{{DOMAIN}}"}, {Name: "PORT", Value: "8080"}}},
+			{Name: "site-paris", Properties: []ir.Property{{Name: "SERVER", Value: "paris01.{{DOMAIN}}"}}},
+		},
+		Features: []ir.Feature{{Name: "Core", Enabled: true, Allowed: true}},
+	}
+	output, err := NewContext(setup, vars, ".").Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(output.Transforms) != 2 {
+		t.Fatalf("expected 2 transforms, got %+v", output.Transforms)
+	}
+
+	tests := []struct {
+		name       string
+		properties []string
+	}{
+		{"site-berlin", []string{"SERVER=berlin01.example.com", "PORT=8080"}},
+		{"site-paris", []string{"SERVER=paris01.example.com"}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform := output.Transforms[i]
+			var properties []string
+			for _, property := range parseFragment(t, transform.PackageXML).all("Property") {
+				properties = append(properties, property.Attrs["Id"]+"="+property.Attrs["Value"])
+			}
+			if transform.Name != tt.name || !slices.Equal(properties, tt.properties) {
+				t.Errorf("transform %s sets %q, want %s setting %q", transform.Name, properties, tt.name, tt.properties)
+			}
+		})
+	}
+
+	// The standard MSI does not have the properties of the transforms
+	if parseFragment(t, output.PackageXML).find("Property", "SERVER") != nil {
+		t.Errorf("unexpected transform properties in PackageXML:\n%s", output.PackageXML)
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	server := []ir.Property{{Name: "SERVER", Value: "a"}}
+	tests := []struct {
+		name       string
+		transforms []ir.Transform
+		setup      func(*ir.Setup)
+		vars       map[string]string
+		want       string
+	}{
+		{"file name", []ir.Transform{{Name: "site berlin", Properties: server}}, nil, nil, `name "site berlin" must start with a letter or digit`},
+		{"no properties", []ir.Transform{{Name: "a"}}, nil, nil, "transform a sets no properties"},
+		{"duplicate", []ir.Transform{{Name: "a", Properties: server}, {Name: "A", Properties: server}}, nil, nil, "transform A is declared twice"},
+		{"private property", []ir.Transform{{Name: "a", Properties: []ir.Property{{Name: "Server", Value: "a"}}}}, nil, nil, "property Server is not a public property"},
+		{"property twice", []ir.Transform{{Name: "a", Properties: []ir.Property{{Name: "SERVER", Value: "a"}, {Name: "SERVER", Value: "b"}}}}, nil, nil, "property SERVER is set twice"},
+		{"empty value", []ir.Transform{{Name: "a", Properties: []ir.Property{{Name: "SERVER", Value: "{{EMPTY}}"}}}}, nil, map[string]string{"EMPTY": ""}, "property SERVER has no value"},
+		{"setup type", []ir.Transform{{Name: "a", Properties: []ir.Property{{Name: "SETUPTYPE", Value: "Complete"}}}}, func(s *ir.Setup) {
+			s.SetupTypes = []ir.SetupType{{Name: "Typical", Features: "Core"}}
+		}, nil, "property SETUPTYPE is set by <setup-type>"},
+		{"instance", []ir.Transform{{Name: "a", Properties: []ir.Property{{Name: "INSTANCE_NAME", Value: "I01"}}}}, func(s *ir.Setup) {
+			s.Instances = &ir.Instances{Count: "2"}
+		}, nil, "property INSTANCE_NAME is set by <instances>"},
+		{"merge module", []ir.Transform{{Name: "a", Properties: server}}, nil, map[string]string{"OUTPUT_TYPE": "msm"}, "needs OUTPUT_TYPE msi"},
+		{"position", []ir.Transform{{Name: "a", Pos: ir.Pos{Line: 7, Column: 3}}}, nil, nil, "<transform> at 7:3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := variables.New()
+			for k, v := range tt.vars {
+				vars[k] = v
+			}
+			setup := &ir.Setup{
+				Transforms: tt.transforms,
+				Features:   []ir.Feature{{Name: "Core", Enabled: true, Allowed: true}},
+			}
+			if tt.setup != nil {
+				tt.setup(setup)
+			}
+			_, err := NewContext(setup, vars, ".").Generate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+// Package ice runs a Go-native subset of the Windows Installer ICE
+// (Internal Consistency Evaluator) checks on the generated component model.
+// The checks need neither Windows nor a built MSI, so packaging mistakes
+// surface on every platform, with a link back to the .msis element that
+// caused them.
+package ice
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// Severity of a finding. Errors fail validation, warnings do not.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Finding is a single ICE violation.
+type Finding struct {
+	ICE       string   `json:"ice"` // e.g. "ICE30"
+	Severity  Severity `json:"severity"`
+	Message   string   `json:"message"`
+	Component string   `json:"component,omitempty"`
+	Element   string   `json:"element,omitempty"` // .msis element, e.g. "files"
+	Pos       ir.Pos   `json:"pos"`
+}
+
+// String formats the finding as "line:col: ICE30 error: message".
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s %s: %s", f.Pos, f.ICE, f.Severity, f.Message)
+}
+
+// perUserRoots are the msis roots and standard folders in the user profile.
+var perUserRoots = map[string]string{
+	"ROAMINGAPPDATADIR":  "AppDataFolder",
+	"LOCALAPPDATADIR":    "LocalAppDataFolder",
+	"AppDataFolder":      "AppDataFolder",
+	"LocalAppDataFolder": "LocalAppDataFolder",
+}
+
+// Validate runs all checks on a generated context. Findings are sorted by
+// source position; findings without a position come last.
+func Validate(ctx *generator.Context) []Finding {
+	v := &validator{ctx: ctx, components: ctx.Components()}
+	v.checkICE03()
+	v.checkICE08()
+	v.checkICE30()
+	v.checkICE38()
+	v.checkICE43()
+	v.checkICE57()
+	v.checkICE64()
+	v.checkICE69()
+	v.checkICE91()
+
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		a, b := v.findings[i], v.findings[j]
+		if a.Pos.IsValid() != b.Pos.IsValid() {
+			return a.Pos.IsValid()
+		}
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line < b.Pos.Line
+		}
+		if a.Pos.Column != b.Pos.Column {
+			return a.Pos.Column < b.Pos.Column
+		}
+		return a.ICE < b.ICE
+	})
+	return v.findings
+}
+
+// HasErrors reports whether any finding has error severity.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+type validator struct {
+	ctx        *generator.Context
+	components []generator.ComponentInfo
+	findings   []Finding
+}
+
+// report adds a finding for a component, linked to the item that produced it.
+func (v *validator) report(ice string, severity Severity, componentID string, item ir.Item, format string, args ...any) {
+	f := Finding{
+		ICE:       ice,
+		Severity:  severity,
+		Message:   fmt.Sprintf(format, args...),
+		Component: componentID,
+	}
+	if item == nil && componentID != "" {
+		item = v.ctx.ComponentItem(componentID)
+	}
+	if item != nil {
+		f.Element = item.ItemType()
+		f.Pos = item.Position()
+	}
+	v.findings = append(v.findings, f)
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	guidPattern       = regexp.MustCompile(`^\{?[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}\}?$`)
+)
+
+// maxIdentifierLength is the longest identifier the MSI database accepts.
+const maxIdentifierLength = 72
+
+// invalidNameChars cannot appear in long file and directory names.
+const invalidNameChars = `\?|><:/*"`
+
+// checkICE03 checks data types: component identifiers, GUID syntax and
+// file names that are legal on the build machine but not on Windows.
+func (v *validator) checkICE03() {
+	for _, comp := range v.components {
+		if !identifierPattern.MatchString(comp.ID) || len(comp.ID) > maxIdentifierLength {
+			v.report("ICE03", Error, comp.ID, nil, "component ID %q is not a valid identifier", comp.ID)
+		}
+		if comp.GUID != "*" && !guidPattern.MatchString(comp.GUID) {
+			v.report("ICE03", Error, comp.ID, nil, "component %s has malformed GUID %q", comp.ID, comp.GUID)
+		}
+	}
+	for _, file := range v.ctx.Files() {
+		name := file.Target[strings.LastIndexAny(file.Target, `\]`)+1:]
+		if strings.ContainsAny(name, invalidNameChars) {
+			v.report("ICE03", Error, file.ComponentID, nil, "file name %q contains characters that are invalid on Windows (%s)", name, invalidNameChars)
+		}
+	}
+}
+
+// checkICE08 reports components that share a GUID.
+func (v *validator) checkICE08() {
+	seen := make(map[string]string)
+	for _, comp := range v.components {
+		if comp.GUID == "*" {
+			continue
+		}
+		guid := strings.ToUpper(strings.Trim(comp.GUID, "{}"))
+		if first, ok := seen[guid]; ok {
+			v.report("ICE08", Error, comp.ID, nil, "component %s has the same GUID %s as component %s", comp.ID, comp.GUID, first)
+			continue
+		}
+		seen[guid] = comp.ID
+	}
+}
+
+// checkICE30 reports target files installed by more than one component.
+// msis allows the same target in different features as an override, which
+// is only valid when those features are never installed together.
+func (v *validator) checkICE30() {
+	seen := make(map[string]generator.FileInfo)
+	for _, file := range v.ctx.Files() {
+		key := strings.ToLower(file.Target)
+		first, ok := seen[key]
+		if !ok {
+			seen[key] = file
+			continue
+		}
+		where := ""
+		if item := v.ctx.ComponentItem(first.ComponentID); item != nil && item.Position().IsValid() {
+			where = fmt.Sprintf(" (<%s> at %s)", item.ItemType(), item.Position())
+		}
+		if featuresOverlap(first.Features, file.Features) {
+			v.report("ICE30", Error, file.ComponentID, nil, "target file %s is also installed by component %s%s", file.Target, first.ComponentID, where)
+		} else {
+			v.report("ICE30", Warning, file.ComponentID, nil, "target file %s is also installed by component %s%s; features %s and %s must be mutually exclusive",
+				file.Target, first.ComponentID, where, strings.Join(first.Features, ", "), strings.Join(file.Features, ", "))
+		}
+	}
+}
+
+// checkICE38 reports components that install into the user profile without
+// an HKCU keypath. msis generates such components for the per-user appdata
+// roots, so this is a warning.
+func (v *validator) checkICE38() {
+	for _, comp := range v.components {
+		folder, ok := perUserRoots[comp.Root]
+		if !ok || isHKCU(comp.KeyPath) {
+			continue
+		}
+		v.report("ICE38", Warning, comp.ID, nil, "component %s installs to the user profile (%s) but its keypath %s is not a HKCU registry value", comp.ID, folder, comp.KeyPath)
+	}
+}
+
+// checkICE43 requires an HKCU keypath for shortcut components.
+func (v *validator) checkICE43() {
+	for _, comp := range v.components {
+		if comp.Kind == "shortcut" && !isHKCU(comp.KeyPath) {
+			v.report("ICE43", Error, comp.ID, nil, "shortcut component %s must use a HKCU registry value as keypath, not %s", comp.ID, comp.KeyPath)
+		}
+	}
+}
+
+// checkICE57 reports components that mix per-user and per-machine data.
+func (v *validator) checkICE57() {
+	for _, comp := range v.ctx.RegistryComponents {
+		var user, machine string
+		for _, val := range comp.AllValues() {
+			switch strings.ToUpper(val.Root) {
+			case "HKCU":
+				user = val.Root + `\` + val.Key
+			case "HKLM", "HKCR":
+				machine = val.Root + `\` + val.Key
+			}
+		}
+		if user != "" && machine != "" {
+			v.report("ICE57", Error, comp.ID, nil, "component %s mixes per-user data (%s) with per-machine data (%s); split it into separate <registry> items", comp.ID, user, machine)
+		}
+	}
+}
+
+// checkICE64 reports user profile directories without a RemoveFolder entry.
+// msis does not emit RemoveFolder, so such directories stay behind for
+// every user who ran the application after uninstall. As msis generates
+// them for the per-user appdata roots, this is a warning.
+func (v *validator) checkICE64() {
+	for _, dir := range v.ctx.Directories() {
+		if _, ok := perUserRoots[dir.Root]; !ok {
+			continue
+		}
+		v.report("ICE64", Warning, "", dir.Source, "directory %s is in the user profile and is not removed by RemoveFolder on uninstall", dir.Target)
+	}
+}
+
+// checkICE69 reports shortcuts whose target is installed by a component that
+// is not always installed together with the shortcut.
+func (v *validator) checkICE69() {
+	files := make(map[string][]generator.FileInfo)
+	for _, file := range v.ctx.Files() {
+		key := strings.ToLower(file.Target)
+		files[key] = append(files[key], file)
+	}
+	check := func(shortcuts []*generator.ShortcutComponent) {
+		for _, sc := range shortcuts {
+			target := sc.Shortcut.Target
+			installers, ok := files[strings.ToLower(target)]
+			if !ok {
+				if isPackageTarget(target) {
+					v.report("ICE69", Warning, sc.ID, nil, "shortcut %q points to %s, which is not installed by this package", sc.Shortcut.Name, target)
+				}
+				continue
+			}
+			features := v.ctx.ComponentFeatures(sc.ID)
+			covered := false
+			for _, file := range installers {
+				if featuresCover(file.Features, features) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				v.report("ICE69", Error, sc.ID, nil, "shortcut %q in feature %s points to %s, which is installed by component %s in feature %s",
+					sc.Shortcut.Name, strings.Join(features, ", "), target, installers[0].ComponentID, strings.Join(installers[0].Features, ", "))
+			}
+		}
+	}
+	check(v.ctx.DesktopShortcuts)
+	check(v.ctx.StartMenuShortcuts)
+}
+
+// checkICE91 warns about files installed into the user profile by a
+// per-machine package: they are only installed for the installing user.
+func (v *validator) checkICE91() {
+	for _, file := range v.ctx.Files() {
+		if folder, ok := perUserRoots[file.Root]; ok {
+			v.report("ICE91", Warning, file.ComponentID, nil, "%s is installed into %s of a per-machine package and is only available to the installing user", file.Target, folder)
+		}
+	}
+}
+
+func isHKCU(keyPath string) bool {
+	return strings.HasPrefix(strings.ToUpper(keyPath), `HKCU\`)
+}
+
+// isPackageTarget reports whether a path lies in one of the msis roots.
+func isPackageTarget(path string) bool {
+	if !strings.HasPrefix(path, "[") {
+		return false
+	}
+	end := strings.Index(path, "]")
+	if end < 0 {
+		return false
+	}
+	rootKey, _ := generator.ParseTarget(path[1:end])
+	return rootKey == path[1:end]
+}
+
+// includes reports whether installing feature implies installing other,
+// i.e. other is the feature itself or one of its parents.
+func includes(feature, other string) bool {
+	return feature == other || strings.HasPrefix(feature, other+"/")
+}
+
+// featuresOverlap reports whether two components can be installed together.
+// Components outside of any feature are always installed.
+func featuresOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, fa := range a {
+		for _, fb := range b {
+			if includes(fa, fb) || includes(fb, fa) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// featuresCover reports whether a component in providers is installed
+// whenever one of the features in required is.
+func featuresCover(providers, required []string) bool {
+	if len(providers) == 0 {
+		return true
+	}
+	for _, r := range required {
+		found := false
+		for _, p := range providers {
+			if includes(r, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+package ice
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// writeFiles creates files (slash-separated paths) below dir.
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func validate(t *testing.T, dir string, setup *ir.Setup) []Finding {
+	t.Helper()
+	vars := variables.New()
+	vars["INSTALLDIR"] = "MyApp"
+	vars["PRODUCT_NAME"] = "MyApp"
+	vars["UPGRADE_CODE"] = "{11111111-2222-3333-4444-555555555555}"
+
+	ctx := generator.NewContext(setup, vars, dir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	return Validate(ctx)
+}
+
+// only returns the findings of one ICE.
+func only(findings []Finding, ice string) []Finding {
+	var result []Finding
+	for _, f := range findings {
+		if f.ICE == ice {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func TestCleanSetupHasNoFindings(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "bin/app.exe")
+	setup := &ir.Setup{Features: []ir.Feature{{
+		Name:    "Main",
+		Enabled: true,
+		Allowed: true,
+		Items: []ir.Item{
+			ir.Files{Source: "bin", Target: "[INSTALLDIR]", Pos: ir.Pos{Line: 3, Column: 5}},
+			ir.Shortcut{Name: "App", Target: "DESKTOP", File: "[INSTALLDIR]app.exe", Pos: ir.Pos{Line: 4, Column: 5}},
+		},
+	}}}
+	if findings := validate(t, dir, setup); len(findings) != 0 {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+}
+
+func TestICE30DuplicateTargetFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a/app.exe", "b/app.exe")
+
+	t.Run("same feature", func(t *testing.T) {
+		setup := &ir.Setup{Features: []ir.Feature{{
+			Name:    "Main",
+			Enabled: true,
+			Items: []ir.Item{
+				ir.Files{Source: "a", Target: "[INSTALLDIR]", Pos: ir.Pos{Line: 3, Column: 5}},
+				ir.Files{Source: "b", Target: "[INSTALLDIR]", Pos: ir.Pos{Line: 4, Column: 5}},
+			},
+		}}}
+		findings := only(validate(t, dir, setup), "ICE30")
+		if len(findings) != 1 {
+			t.Fatalf("expected one ICE30 finding, got %v", findings)
+		}
+		f := findings[0]
+		if f.Severity != Error || f.Element != "files" || f.Pos != (ir.Pos{Line: 4, Column: 5}) {
+			t.Errorf("unexpected finding %+v", f)
+		}
+		if !strings.Contains(f.Message, "<files> at 3:5") {
+			t.Errorf("message should point to the first element: %s", f.Message)
+		}
+	})
+
+	t.Run("sibling features", func(t *testing.T) {
+		setup := &ir.Setup{Features: []ir.Feature{
+			{Name: "Standard", Enabled: true, Items: []ir.Item{ir.Files{Source: "a", Target: "[INSTALLDIR]"}}},
+			{Name: "Custom", Enabled: true, Items: []ir.Item{ir.Files{Source: "b", Target: "[INSTALLDIR]"}}},
+		}}
+		findings := only(validate(t, dir, setup), "ICE30")
+		if len(findings) != 1 || findings[0].Severity != Warning {
+			t.Errorf("expected one ICE30 warning, got %v", findings)
+		}
+	})
+
+	t.Run("parent and sub-feature", func(t *testing.T) {
+		setup := &ir.Setup{Features: []ir.Feature{{
+			Name:    "Main",
+			Enabled: true,
+			Items:   []ir.Item{ir.Files{Source: "a", Target: "[INSTALLDIR]"}},
+			SubFeatures: []ir.Feature{{
+				Name:    "Extra",
+				Enabled: true,
+				Items:   []ir.Item{ir.Files{Source: "b", Target: "[INSTALLDIR]"}},
+			}},
+		}}}
+		findings := only(validate(t, dir, setup), "ICE30")
+		if len(findings) != 1 || findings[0].Severity != Error {
+			t.Errorf("expected one ICE30 error, got %v", findings)
+		}
+	})
+}
+
+func TestICE38AndICE64PerUserDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "data/settings.ini")
+	setup := &ir.Setup{Features: []ir.Feature{{
+		Name:    "Main",
+		Enabled: true,
+		Items: []ir.Item{
+			ir.Files{Source: "data", Target: "[ROAMINGAPPDATADIR]", Pos: ir.Pos{Line: 7, Column: 5}},
+		},
+	}}}
+	findings := validate(t, dir, setup)
+
+	// Both the file component and the folder permission component
+	ice38 := only(findings, "ICE38")
+	if len(ice38) != 2 {
+		t.Fatalf("expected two ICE38 warnings, got %v", ice38)
+	}
+	for _, f := range ice38 {
+		if f.Pos.Line != 7 || f.Severity != Warning || !strings.Contains(f.Message, "AppDataFolder") {
+			t.Errorf("unexpected ICE38 finding %+v", f)
+		}
+	}
+	ice64 := only(findings, "ICE64")
+	if len(ice64) != 1 || ice64[0].Severity != Warning || ice64[0].Element != "files" || !strings.Contains(ice64[0].Message, "[ROAMINGAPPDATADIR]") {
+		t.Errorf("expected one ICE64 warning for the root directory, got %v", ice64)
+	}
+	ice91 := only(findings, "ICE91")
+	if len(ice91) != 1 || ice91[0].Severity != Warning {
+		t.Errorf("expected one ICE91 warning, got %v", ice91)
+	}
+	// msis generates these components itself, so they do not fail validation
+	if HasErrors(findings) {
+		t.Errorf("expected warnings only, got %v", findings)
+	}
+}
+
+func TestICE91DeclaredDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "data/settings.ini")
+	setup := &ir.Setup{Features: []ir.Feature{{
+		Name:    "Main",
+		Enabled: true,
+		Items: []ir.Item{
+			ir.Directory{ID: "LOGDIR", Root: "LOCALAPPDATADIR", Path: "Logs"},
+			ir.Files{Source: "data", Target: "[LOGDIR]"},
+			ir.Files{Source: "data", Target: "[AppDataFolder]App"},
+		},
+	}}}
+	ice91 := only(validate(t, dir, setup), "ICE91")
+	if len(ice91) != 2 {
+		t.Errorf("expected an ICE91 warning for each per-user file, got %v", ice91)
+	}
+}
+
+func TestICE57MixedRegistryRoots(t *testing.T) {
+	dir := t.TempDir()
+	reg := "Windows Registry Editor Version 5.00\r\n\r\n" +
+		"[HKEY_CURRENT_USER\\Software\\MyApp]\r\n\"User\"=\"1\"\r\n\r\n" +
+		"[HKEY_LOCAL_MACHINE\\Software\\MyApp]\r\n\"Machine\"=\"1\"\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "settings.reg"), []byte(reg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setup := &ir.Setup{Features: []ir.Feature{{
+		Name:    "Main",
+		Enabled: true,
+		Items:   []ir.Item{ir.Registry{File: "settings.reg", Pos: ir.Pos{Line: 5, Column: 5}}},
+	}}}
+	findings := only(validate(t, dir, setup), "ICE57")
+	if len(findings) != 1 || findings[0].Element != "registry" || findings[0].Pos.Line != 5 {
+		t.Errorf("expected one ICE57 error for the registry item, got %v", findings)
+	}
+}
+
+func TestICE69ShortcutTargetFeature(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "tools/tool.exe")
+
+	t.Run("target in sibling feature", func(t *testing.T) {
+		setup := &ir.Setup{Features: []ir.Feature{
+			{Name: "Tools", Enabled: true, Items: []ir.Item{ir.Files{Source: "tools", Target: "[INSTALLDIR]"}}},
+			{Name: "Shortcuts", Enabled: true, Items: []ir.Item{
+				ir.Shortcut{Name: "Tool", Target: "STARTMENU", File: "[INSTALLDIR]tool.exe", Pos: ir.Pos{Line: 9, Column: 9}},
+			}},
+		}}
+		findings := only(validate(t, dir, setup), "ICE69")
+		if len(findings) != 1 || findings[0].Severity != Error || findings[0].Element != "shortcut" || findings[0].Pos.Line != 9 {
+			t.Errorf("expected one ICE69 error for the shortcut, got %v", findings)
+		}
+	})
+
+	t.Run("target in parent feature", func(t *testing.T) {
+		setup := &ir.Setup{Features: []ir.Feature{{
+			Name:    "Tools",
+			Enabled: true,
+			Items:   []ir.Item{ir.Files{Source: "tools", Target: "[INSTALLDIR]"}},
+			SubFeatures: []ir.Feature{{Name: "Shortcuts", Enabled: true, Items: []ir.Item{
+				ir.Shortcut{Name: "Tool", Target: "DESKTOP", File: "[INSTALLDIR]tool.exe"},
+			}}},
+		}}}
+		if findings := only(validate(t, dir, setup), "ICE69"); len(findings) != 0 {
+			t.Errorf("expected no ICE69 findings, got %v", findings)
+		}
+	})
+
+	t.Run("target not installed", func(t *testing.T) {
+		setup := &ir.Setup{Features: []ir.Feature{{Name: "Main", Enabled: true, Items: []ir.Item{
+			ir.Files{Source: "tools", Target: "[INSTALLDIR]"},
+			ir.Shortcut{Name: "Missing", Target: "DESKTOP", File: "[INSTALLDIR]missing.exe"},
+		}}}}
+		findings := only(validate(t, dir, setup), "ICE69")
+		if len(findings) != 1 || findings[0].Severity != Warning {
+			t.Errorf("expected one ICE69 warning, got %v", findings)
+		}
+	})
+}
+
+func TestICE03InvalidFileName(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "bin/what?.txt")
+	setup := &ir.Setup{Features: []ir.Feature{{Name: "Main", Enabled: true, Items: []ir.Item{
+		ir.Files{Source: "bin", Target: "[INSTALLDIR]"},
+	}}}}
+	findings := only(validate(t, dir, setup), "ICE03")
+	if len(findings) != 1 || !strings.Contains(findings[0].Message, "what?.txt") {
+		t.Errorf("expected one ICE03 error, got %v", findings)
+	}
+}
+
+func TestFindingsSortedByPosition(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a/app.exe", "b/app.exe", "data/x.ini")
+	setup := &ir.Setup{Features: []ir.Feature{{Name: "Main", Enabled: true, Items: []ir.Item{
+		ir.Files{Source: "data", Target: "[LOCALAPPDATADIR]", Pos: ir.Pos{Line: 8, Column: 5}},
+		ir.Files{Source: "a", Target: "[INSTALLDIR]", Pos: ir.Pos{Line: 2, Column: 5}},
+		ir.Files{Source: "b", Target: "[INSTALLDIR]", Pos: ir.Pos{Line: 3, Column: 5}},
+	}}}}
+	findings := validate(t, dir, setup)
+	for i := 1; i < len(findings); i++ {
+		if findings[i].Pos.Line < findings[i-1].Pos.Line {
+			t.Fatalf("findings not sorted: %v", findings)
+		}
+	}
+	if len(findings) == 0 || findings[0].ICE != "ICE30" {
+		t.Errorf("expected ICE30 first, got %v", findings)
+	}
+	if got := findings[0].String(); !strings.HasPrefix(got, "3:5: ICE30 error: ") {
+		t.Errorf("unexpected format %q", got)
+	}
+}
@@ -2,43 +2,125 @@
 // These types mirror the msis.xsd schema structure.
 package ir
 
+import "fmt"
+
+// Pos is the position of an element in the .msis source. Lines and columns
+// are 1-based; the zero Pos means the element was not read from a file.
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is known.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns "line:column", or "-" for an unknown position.
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
 // Setup is the root element of an .msis file.
 type Setup struct {
-	Silent   bool
-	Sets     []Set
-	Requires []Requirement // Top-level runtime requirements
-	Features []Feature
-	Items    []Item // Top-level items outside features
-	Bundle   *Bundle
+	Silent     bool
+	Sets       []Set
+	Requires   []Requirement // Top-level runtime requirements
+	SetupTypes []SetupType
+	Instances  *Instances
+	Transforms []Transform
+	Features   []Feature
+	Items      []Item // Top-level items outside features
+	Bundle     *Bundle
+
+	Comments         []string // Comments before <setup>, verbatim
+	TrailingComments []string // Comments before </setup>
+	FinalComments    []string // Comments after </setup>
 }
 
 // Requirement represents a runtime dependency declaration.
 // Example: <requires type="vcredist" version="2022"/>
 type Requirement struct {
-	Type    string // vcredist, netfx
-	Version string // 2022, 4.8, etc.
-	Source  string // optional override path for offline/custom scenarios
+	Type     string   // vcredist, netfx
+	Version  string   // 2022, 4.8, etc.
+	Source   string   // optional override path for offline/custom scenarios
+	Comments []string // Comments before the element, verbatim
+}
+
+// SetupType is a preset of features the user picks in the setup type dialog,
+// or with SETUPTYPE on the command line.
+// Example: <setup-type name="Typical" features="Core,Docs"/>
+type SetupType struct {
+	Name        string
+	Features    string // Comma-separated features; empty for the custom setup type
+	Description string
+	Pos         Pos
+	Comments    []string // Comments before the element, verbatim
+}
+
+// Instances makes the package installable several times side by side, each
+// instance chosen by an instance transform.
+// Example: <instances count="10" property="INSTANCE_NAME"/>
+type Instances struct {
+	Count    string // Number of instances, checked once variables are resolved
+	Property string // Property that holds the instance name; empty for INSTANCE_NAME
+	Pos      Pos
+	Comments []string // Comments before the element, verbatim
+}
+
+// Transform is a configuration preset, e.g. for a site, built into an .mst
+// transform of the MSI that sets property defaults.
+// Example: <transform name="site-berlin"><property name="SERVER" value="berlin01"/></transform>
+type Transform struct {
+	Name             string
+	Properties       []Property
+	Pos              Pos
+	Comments         []string // Comments before the element, verbatim
+	TrailingComments []string // Comments before </transform>
+}
+
+// Property is a property default set by a transform.
+type Property struct {
+	Name     string
+	Value    string
+	Comments []string // Comments before the element, verbatim
 }
 
 // Set represents a variable definition: <set name="..." value="..."/>
 type Set struct {
-	Name  string
-	Value string
+	Name     string
+	Value    string
+	Comments []string // Comments before the element, verbatim
 }
 
 // Feature represents a feature grouping with nested items.
 type Feature struct {
-	Name        string
-	Enabled     bool // default true
-	Condition   string
-	Allowed     bool // default true
-	Items       []Item
-	SubFeatures []Feature
+	Name           string
+	ID             string // Feature ID; empty for a generated FEATURE_00000 style ID
+	Enabled        bool   // default true
+	Condition      string
+	Allowed        bool // default true
+	Description    string
+	Display        string // expand, collapse or hidden
+	Level          string // Install level 0-32767; overrides Enabled
+	Advertise      string // no, allow or prefer
+	InstallDefault string // local, source or follow-parent
+	TypicalDefault string // install or advertise
+	Items          []Item
+	SubFeatures    []Feature
+	Pos            Pos
+
+	Comments         []string // Comments before <feature>, verbatim
+	TrailingComments []string // Comments before </feature>
 }
 
 // Item is an interface for all setup items that can appear in a feature.
 type Item interface {
 	ItemType() string
+	Position() Pos
 }
 
 // Files represents: <files source="..." target="..." do-not-overwrite="..."/>
@@ -46,9 +128,12 @@ type Files struct {
 	Source         string
 	Target         string
 	DoNotOverwrite bool
+	Pos            Pos
+	Comments       []string // Comments before the element, verbatim
 }
 
 func (f Files) ItemType() string { return "files" }
+func (f Files) Position() Pos    { return f.Pos }
 
 // Registry represents: <registry file="..." sddl="..." preserve="..." permanent="..." condition="..."/>
 type Registry struct {
@@ -57,18 +142,24 @@ type Registry struct {
 	Preserve  bool
 	Permanent bool
 	Condition string
+	Pos       Pos
+	Comments  []string // Comments before the element, verbatim
 }
 
 func (r Registry) ItemType() string { return "registry" }
+func (r Registry) Position() Pos    { return r.Pos }
 
 // SetEnv represents: <set-env name="..." value="..." permanent="..."/>
 type SetEnv struct {
 	Name      string
 	Value     string
 	Permanent bool // if true, env var survives uninstall (default: false)
+	Pos       Pos
+	Comments  []string // Comments before the element, verbatim
 }
 
 func (s SetEnv) ItemType() string { return "set-env" }
+func (s SetEnv) Position() Pos    { return s.Pos }
 
 // Shortcut represents: <shortcut name="..." target="..." file="..." description="..." icon="..."/>
 type Shortcut struct {
@@ -77,9 +168,12 @@ type Shortcut struct {
 	File        string
 	Description string
 	Icon        string
+	Pos         Pos
+	Comments    []string // Comments before the element, verbatim
 }
 
 func (s Shortcut) ItemType() string { return "shortcut" }
+func (s Shortcut) Position() Pos    { return s.Pos }
 
 // Service represents: <service file-name="..." service-name="..." .../>
 type Service struct {
@@ -92,25 +186,34 @@ type Service struct {
 	ErrorControl       string // ignore, normal, critical
 	Restart            string
 	StartAfterInstall  string // yes (default), no
+	Pos                Pos
+	Comments           []string // Comments before the element, verbatim
 }
 
 func (s Service) ItemType() string { return "service" }
+func (s Service) Position() Pos    { return s.Pos }
 
 // Exclude represents: <exclude folder="..."/>
 type Exclude struct {
-	Folder string
+	Folder   string
+	Pos      Pos
+	Comments []string // Comments before the element, verbatim
 }
 
 func (e Exclude) ItemType() string { return "exclude" }
+func (e Exclude) Position() Pos    { return e.Pos }
 
 // Execute represents: <execute cmd="..." when="..." directory="..."/>
 type Execute struct {
 	Cmd       string
 	When      string // before-install, after-install, before-uninstall, after-uninstall
 	Directory string
+	Pos       Pos
+	Comments  []string // Comments before the element, verbatim
 }
 
 func (e Execute) ItemType() string { return "execute" }
+func (e Execute) Position() Pos    { return e.Pos }
 
 // Bundle represents a bootstrapper bundle configuration.
 // Supports both legacy shorthand and new nested syntax:
@@ -127,6 +230,9 @@ type Bundle struct {
 	Prerequisites []Prerequisite
 	MSI           *BundleMSI
 	ExePackages   []ExePackage
+
+	Comments         []string // Comments before <bundle>, verbatim
+	TrailingComments []string // Comments before </bundle>
 }
 
 func (b Bundle) ItemType() string { return "bundle" }
@@ -134,18 +240,20 @@ func (b Bundle) ItemType() string { return "bundle" }
 // Prerequisite represents a well-known prerequisite like VC++ or .NET Framework.
 // Example: <prerequisite type="vcredist" version="2022"/>
 type Prerequisite struct {
-	Type    string // vcredist, netfx
-	Version string // 2022, 4.8, etc.
-	Source  string // optional override path
+	Type     string   // vcredist, netfx
+	Version  string   // 2022, 4.8, etc.
+	Source   string   // optional override path
+	Comments []string // Comments before the element, verbatim
 }
 
 // BundleMSI represents the main MSI package(s) in a bundle.
 // Example: <msi source_64bit="app-x64.msi" source_32bit="app-x86.msi" source_arm64="app-arm64.msi"/>
 type BundleMSI struct {
-	Source      string // single MSI (platform-neutral)
-	Source64bit string // x64 MSI
-	Source32bit string // x86 MSI
-	SourceArm64 string // ARM64 MSI
+	Source      string   // single MSI (platform-neutral)
+	Source64bit string   // x64 MSI
+	Source32bit string   // x86 MSI
+	SourceArm64 string   // ARM64 MSI
+	Comments    []string // Comments before the element, verbatim
 }
 
 // ExePackage represents a custom executable package in the bundle chain.
@@ -155,15 +263,19 @@ type ExePackage struct {
 	Source          string
 	DetectCondition string
 	InstallArgs     string
+	Comments        []string // Comments before the element, verbatim
 }
 
 // CreateFolder represents: <create-folder target="[APPDATADIR]MyApp\Logs"/>
 // Creates an empty directory at install time.
 type CreateFolder struct {
-	Target string
+	Target   string
+	Pos      Pos
+	Comments []string // Comments before the element, verbatim
 }
 
 func (c CreateFolder) ItemType() string { return "create-folder" }
+func (c CreateFolder) Position() Pos    { return c.Pos }
 
 // RemoveOnUninstall represents items to remove during uninstall.
 // Can specify either a registry key or a folder path (not both).
@@ -172,9 +284,72 @@ func (c CreateFolder) ItemType() string { return "create-folder" }
 type RemoveOnUninstall struct {
 	Registry string // Registry path like "HKLM\Software\MyCompany\MyApp"
 	Folder   string // Folder path like "[COMMONAPPDATA]MyCompany\MyApp"
+	Pos      Pos
+	Comments []string // Comments before the element, verbatim
 }
 
 func (r RemoveOnUninstall) ItemType() string { return "remove-on-uninstall" }
+func (r RemoveOnUninstall) Position() Pos    { return r.Pos }
+
+// Wix is a block of verbatim WiX XML for a slot of the template.
+// Example: <wix slot="ui"><Publish Dialog="ExitDialog" .../></wix>
+type Wix struct {
+	Slot     string // package, ui, install-execute-sequence or feature:Name; empty for package
+	XML      string // Content of the block, verbatim
+	Pos      Pos
+	Comments []string // Comments before the element, verbatim
+}
+
+func (w Wix) ItemType() string { return "wix" }
+func (w Wix) Position() Pos    { return w.Pos }
+
+// MergeModule represents: <merge-module source="vendor.msm" target="[INSTALLDIR]"/>
+type MergeModule struct {
+	Source   string
+	Target   string // Default: [INSTALLDIR]
+	Pos      Pos
+	Comments []string // Comments before the element, verbatim
+}
+
+func (m MergeModule) ItemType() string { return "merge-module" }
+func (m MergeModule) Position() Pos    { return m.Pos }
+
+// WixReference represents: <wix-reference source="lib.wixlib" component-group="X"/>
+type WixReference struct {
+	Source         string // .wixlib or .wxs
+	ComponentGroup string
+	Pos            Pos
+	Comments       []string // Comments before the element, verbatim
+}
+
+func (w WixReference) ItemType() string { return "wix-reference" }
+func (w WixReference) Position() Pos    { return w.Pos }
+
+// Directory represents: <directory id="DATADIR" root="APPDATADIR" path="Company\Data" configurable="yes"/>
+type Directory struct {
+	ID           string
+	Root         string // msis root, declared directory or standard WiX folder; default INSTALLDIR
+	Path         string
+	Configurable bool // ConfigurableDirectory of the feature that declares it
+	Pos          Pos
+	Comments     []string // Comments before the element, verbatim
+}
+
+func (d Directory) ItemType() string { return "directory" }
+func (d Directory) Position() Pos    { return d.Pos }
+
+// SetVariable changes the value of a <set> variable. If the variable is set
+// more than once, the last <set> wins, as in variable resolution; if it is
+// not set at all, a new <set> is appended.
+func (s *Setup) SetVariable(name, value string) {
+	for i := len(s.Sets) - 1; i >= 0; i-- {
+		if s.Sets[i].Name == name {
+			s.Sets[i].Value = value
+			return
+		}
+	}
+	s.Sets = append(s.Sets, Set{Name: name, Value: value})
+}
 
 // IsSetupBundle returns true if this setup is a bundle (multi-MSI installer).
 func (s *Setup) IsSetupBundle() bool {
@@ -0,0 +1,300 @@
+package lsp
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// Cursor context kinds.
+const (
+	inText = iota
+	inElementName
+	inClosingTag
+	inAttributeName
+	inAttributeValue
+)
+
+// cursorContext describes the markup around the cursor.
+type cursorContext struct {
+	kind      int
+	element   string   // Element whose start tag contains the cursor
+	parent    string   // Enclosing element
+	attribute string   // Attribute whose value contains the cursor
+	prefix    string   // What has been typed of the name or value
+	present   []string // Attributes already in the start tag
+}
+
+// analyze determines the cursor context at a byte offset.
+func analyze(text string, offset int) cursorContext {
+	before := text[:offset]
+	if strings.LastIndex(before, "<!--") > strings.LastIndex(before, "-->") {
+		return cursorContext{kind: inText, parent: enclosingElement(before[:strings.LastIndex(before, "<!--")])}
+	}
+	lt := strings.LastIndexByte(before, '<')
+	gt := strings.LastIndexByte(before, '>')
+	if lt <= gt {
+		return cursorContext{kind: inText, parent: enclosingElement(before), prefix: lineTail(before)}
+	}
+
+	ctx := cursorContext{parent: enclosingElement(before[:lt])}
+	tag := before[lt+1:]
+	if strings.HasPrefix(tag, "!") || strings.HasPrefix(tag, "?") {
+		// Comment or processing instruction
+		return cursorContext{kind: inText, parent: ctx.parent}
+	}
+	if strings.HasPrefix(tag, "/") {
+		ctx.kind, ctx.prefix = inClosingTag, tag[1:]
+		return ctx
+	}
+	nameEnd := strings.IndexAny(tag, " \t\r\n")
+	if nameEnd < 0 {
+		ctx.kind, ctx.prefix = inElementName, tag
+		return ctx
+	}
+	ctx.element = tag[:nameEnd]
+
+	// Walk the attributes: name, '=', quoted value
+	const space = " \t\r\n"
+	rest := tag[nameEnd:]
+	for {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			// Typing an attribute name
+			fields := strings.Fields(rest)
+			if len(fields) > 0 && !strings.ContainsAny(rest[len(rest)-1:], space) {
+				ctx.prefix = fields[len(fields)-1]
+				fields = fields[:len(fields)-1]
+			}
+			ctx.kind = inAttributeName
+			ctx.present = append(ctx.present, fields...)
+			return ctx
+		}
+		fields := strings.Fields(rest[:eq])
+		if len(fields) == 0 {
+			ctx.kind = inAttributeName
+			return ctx
+		}
+		name := fields[len(fields)-1]
+		ctx.present = append(ctx.present, fields[:len(fields)-1]...)
+
+		value := strings.TrimLeft(rest[eq+1:], space)
+		if value == "" {
+			ctx.kind, ctx.attribute = inAttributeValue, name
+			return ctx
+		}
+		quote := value[0]
+		if quote != '"' && quote != '\'' {
+			ctx.kind = inAttributeName
+			return ctx
+		}
+		end := strings.IndexByte(value[1:], quote)
+		if end < 0 {
+			ctx.kind, ctx.attribute, ctx.prefix = inAttributeValue, name, value[1:]
+			return ctx
+		}
+		ctx.present = append(ctx.present, name)
+		rest = value[end+2:]
+	}
+}
+
+// enclosingElement returns the innermost open element at the end of text.
+func enclosingElement(text string) string {
+	d := xml.NewDecoder(strings.NewReader(text))
+	d.Strict = false
+	var stack []string
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if len(stack) == 0 {
+		return ""
+	}
+	return stack[len(stack)-1]
+}
+
+// lineTail returns the text of the current line up to the cursor.
+func lineTail(before string) string {
+	return before[strings.LastIndexByte(before, '\n')+1:]
+}
+
+// openReference reports whether s ends inside an unclosed {{.
+func openReference(s string) bool {
+	open := strings.LastIndex(s, "{{")
+	return open >= 0 && !strings.Contains(s[open:], "}}")
+}
+
+// complete returns the completion items at a byte offset.
+func (s *Server) complete(doc *document, offset int) []CompletionItem {
+	ctx := analyze(doc.text, offset)
+	closed := strings.HasPrefix(doc.text[offset:], "}}")
+
+	switch ctx.kind {
+	case inText:
+		if openReference(ctx.prefix) {
+			return variableCompletions(doc, closed)
+		}
+	case inElementName:
+		return elementCompletions(ctx.parent)
+	case inClosingTag:
+		if ctx.parent != "" {
+			return []CompletionItem{{Label: ctx.parent, Kind: kindKeyword, InsertText: ctx.parent + ">"}}
+		}
+	case inAttributeName:
+		return attributeCompletions(ctx.element, ctx.present)
+	case inAttributeValue:
+		if openReference(ctx.prefix) {
+			return variableCompletions(doc, closed)
+		}
+		attr, ok := lookupAttribute(ctx.element, ctx.attribute)
+		if !ok {
+			return nil
+		}
+		if attr.Type == parser.Path {
+			return pathCompletions(doc.dir(), ctx.prefix)
+		}
+		var items []CompletionItem
+		for _, v := range attr.Choices() {
+			items = append(items, CompletionItem{Label: v, Kind: kindValue})
+		}
+		return items
+	}
+	return nil
+}
+
+func elementCompletions(parent string) []CompletionItem {
+	names := []string{"setup"}
+	if parent != "" {
+		e, ok := parser.LookupElement(parent)
+		if !ok {
+			return nil
+		}
+		names = e.Children
+	}
+	var items []CompletionItem
+	for _, name := range names {
+		item := CompletionItem{Label: name, Kind: kindKeyword}
+		if e, ok := parser.LookupElement(name); ok {
+			item.Documentation = e.Doc
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func attributeCompletions(elementName string, present []string) []CompletionItem {
+	e, ok := parser.LookupElement(elementName)
+	if !ok {
+		return nil
+	}
+	var items []CompletionItem
+	for _, attr := range e.Attributes {
+		if contains(present, attr.Name) {
+			continue
+		}
+		detail := "optional"
+		if attr.Required {
+			detail = "required"
+		}
+		items = append(items, CompletionItem{
+			Label:         attr.Name,
+			Kind:          kindProperty,
+			Detail:        detail,
+			Documentation: attr.Doc,
+			InsertText:    attr.Name + `="`,
+		})
+	}
+	return items
+}
+
+func variableCompletions(doc *document, closed bool) []CompletionItem {
+	suffix := "}}"
+	if closed {
+		suffix = ""
+	}
+	seen := make(map[string]bool)
+	var items []CompletionItem
+	for _, def := range doc.definitions() {
+		if seen[def.name] {
+			continue
+		}
+		seen[def.name] = true
+		item := CompletionItem{Label: def.name, Kind: kindVariable, Detail: "<set>", InsertText: def.name + suffix}
+		if known, ok := variables.LookupKnown(def.name); ok {
+			item.Documentation = known.Doc
+		}
+		items = append(items, item)
+	}
+	for _, known := range variables.KnownVariables {
+		if seen[known.Name] {
+			continue
+		}
+		items = append(items, CompletionItem{Label: known.Name, Kind: kindVariable, Documentation: known.Doc, InsertText: known.Name + suffix})
+	}
+	return items
+}
+
+// pathCompletions lists the entries of the folder a partial path points to.
+func pathCompletions(baseDir, prefix string) []CompletionItem {
+	if baseDir == "" || strings.Contains(prefix, "{{") {
+		return nil
+	}
+	dirPart, namePart := "", prefix
+	if i := strings.LastIndexAny(prefix, `/\`); i >= 0 {
+		dirPart, namePart = prefix[:i+1], prefix[i+1:]
+	}
+	dir := filepath.FromSlash(strings.ReplaceAll(dirPart, `\`, "/"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(baseDir, dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var items []CompletionItem
+	for _, entry := range entries {
+		if !strings.HasPrefix(strings.ToLower(entry.Name()), strings.ToLower(namePart)) {
+			continue
+		}
+		kind := kindFile
+		if entry.IsDir() {
+			kind = kindFolder
+		}
+		items = append(items, CompletionItem{Label: entry.Name(), Kind: kind})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// lookupAttribute returns the schema of an attribute of an element.
+func lookupAttribute(elementName, name string) (*parser.Attribute, bool) {
+	e, ok := parser.LookupElement(elementName)
+	if !ok {
+		return nil, false
+	}
+	return e.Attribute(name)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
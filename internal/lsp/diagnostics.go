@@ -0,0 +1,110 @@
+package lsp
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ice"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// publishDiagnostics checks a document and sends the result to the client.
+func (s *Server) publishDiagnostics(doc *document, full bool) error {
+	return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{
+		URI:         doc.uri,
+		Diagnostics: diagnose(doc, full),
+	})
+}
+
+// diagnose parses a document and checks its variable references. With full,
+// the package is also generated and run through the ICE checks; that reads
+// the payload folders, so it only runs on open and save, not per keystroke.
+func diagnose(doc *document, full bool) []Diagnostic {
+	diags := []Diagnostic{}
+
+	setup, err := parser.ParseBytes([]byte(doc.text))
+	if err != nil {
+		return append(diags, parseDiagnostic(doc, err))
+	}
+
+	vars := variables.New()
+	vars.LoadFromSetup(setup)
+	for _, ref := range doc.references() {
+		if vars.Has(ref.name) {
+			continue
+		}
+		if _, ok := variables.LookupKnown(ref.name); ok {
+			continue
+		}
+		diags = append(diags, Diagnostic{
+			Range:    Range{Start: doc.position(ref.start), End: doc.position(ref.end)},
+			Severity: severityWarning,
+			Source:   "msis",
+			Message:  fmt.Sprintf("variable %s is not defined by a <set>", ref.name),
+		})
+	}
+	for _, def := range doc.definitions() {
+		for _, dep := range variables.DeprecatedVariables {
+			if def.name == dep.Name && vars.GetBool(dep.Name) {
+				diags = append(diags, Diagnostic{
+					Range:    Range{Start: doc.position(def.start), End: doc.position(def.end)},
+					Severity: severityWarning,
+					Source:   "msis",
+					Message:  dep.Message,
+				})
+			}
+		}
+	}
+
+	if !full || setup.IsSetupBundle() || doc.path == "" {
+		return diags
+	}
+	if err := vars.ResolveAll(); err != nil {
+		return append(diags, Diagnostic{Range: doc.lineRange(1, 1), Severity: severityError, Source: "msis", Message: err.Error()})
+	}
+	ctx := generator.NewContext(setup, vars, doc.dir())
+	if _, err := ctx.Generate(); err != nil {
+		return append(diags, Diagnostic{Range: doc.lineRange(1, 1), Severity: severityError, Source: "msis", Message: err.Error()})
+	}
+	for _, f := range ice.Validate(ctx) {
+		severity := severityWarning
+		if f.Severity == ice.Error {
+			severity = severityError
+		}
+		diags = append(diags, Diagnostic{
+			Range:    doc.lineRange(f.Pos.Line, f.Pos.Column),
+			Severity: severity,
+			Code:     f.ICE,
+			Source:   "msis",
+			Message:  f.Message,
+		})
+	}
+	return diags
+}
+
+// parseDiagnostic places a parser error at the element it refers to.
+func parseDiagnostic(doc *document, err error) Diagnostic {
+	line, column := 1, 1
+	var perr *parser.Error
+	var serr *xml.SyntaxError
+	switch {
+	case errors.As(err, &perr):
+		line, column = perr.Pos.Line, perr.Pos.Column
+	case errors.As(err, &serr):
+		line = serr.Line
+	}
+	message := err.Error()
+	if perr != nil {
+		message = perr.Err.Error()
+	}
+	return Diagnostic{
+		Range:    doc.lineRange(line, column),
+		Severity: severityError,
+		Source:   "msis",
+		Message:  strings.TrimPrefix(message, "parsing XML: "),
+	}
+}
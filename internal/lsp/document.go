@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// document is an open .msis file.
+type document struct {
+	uri  string
+	path string // Local file path; empty for non-file URIs
+	text string
+}
+
+func newDocument(uri, text string) *document {
+	return &document{uri: uri, path: uriToPath(uri), text: text}
+}
+
+// dir returns the folder of the document, which relative paths start from.
+func (d *document) dir() string {
+	if d.path == "" {
+		return ""
+	}
+	return filepath.Dir(d.path)
+}
+
+// uriToPath converts a file:// URI to a local path.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	path := u.Path
+	// file:///C:/x has the path /C:/x
+	if runtime.GOOS == "windows" && len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path)
+}
+
+// offset converts an LSP position to a byte offset, clamped to the text.
+func (d *document) offset(pos Position) int {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(d.text[offset:], '\n')
+		if next < 0 {
+			return len(d.text)
+		}
+		offset += next + 1
+	}
+	units := 0
+	for offset < len(d.text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// position converts a byte offset to an LSP position.
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	before := d.text[:offset]
+	line := strings.Count(before, "\n")
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return Position{Line: line, Character: len(utf16.Encode([]rune(before[lineStart:])))}
+}
+
+// lineRange returns the range from a 1-based line and byte column to the end
+// of that line, as reported by the parser.
+func (d *document) lineRange(line, column int) Range {
+	if line < 1 {
+		line = 1
+	}
+	start := d.offset(Position{Line: line - 1})
+	end := strings.IndexByte(d.text[start:], '\n')
+	if end < 0 {
+		end = len(d.text)
+	} else {
+		end += start
+	}
+	from := start
+	if column > 1 && start+column-1 <= end {
+		from = start + column - 1
+	}
+	// Skip leading whitespace so the squiggle starts at the element
+	for from < end && (d.text[from] == ' ' || d.text[from] == '\t') {
+		from++
+	}
+	to := strings.TrimRight(d.text[from:end], "\r")
+	return Range{Start: d.position(from), End: d.position(from + len(to))}
+}
+
+var (
+	setPattern       = regexp.MustCompile(`<set\s[^>]*?name\s*=\s*["']([^"']*)["']`)
+	referencePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// definition is a <set> in the document.
+type definition struct {
+	name       string
+	start, end int // Byte range of the name value
+}
+
+// definitions returns the <set> variables of the document in order.
+func (d *document) definitions() []definition {
+	var defs []definition
+	for _, m := range setPattern.FindAllStringSubmatchIndex(d.text, -1) {
+		defs = append(defs, definition{name: d.text[m[2]:m[3]], start: m[2], end: m[3]})
+	}
+	return defs
+}
+
+// reference is a {{VAR}} reference in the document.
+type reference struct {
+	name       string
+	start, end int // Byte range of the whole reference
+}
+
+func (d *document) references() []reference {
+	var refs []reference
+	for _, m := range referencePattern.FindAllStringSubmatchIndex(d.text, -1) {
+		refs = append(refs, reference{name: d.text[m[2]:m[3]], start: m[0], end: m[1]})
+	}
+	return refs
+}
+
+// referenceAt returns the {{VAR}} reference that contains offset.
+func (d *document) referenceAt(offset int) (reference, bool) {
+	for _, ref := range d.references() {
+		if offset >= ref.start && offset <= ref.end {
+			return ref, true
+		}
+	}
+	return reference{}, false
+}
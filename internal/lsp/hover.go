@@ -0,0 +1,127 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// hover returns the documentation for the variable, element or attribute
+// at a byte offset.
+func (s *Server) hover(doc *document, offset int) *Hover {
+	if ref, ok := doc.referenceAt(offset); ok {
+		return variableHover(doc, ref.name)
+	}
+
+	start, end := wordAt(doc.text, offset)
+	if start == end {
+		return nil
+	}
+	word := doc.text[start:end]
+	before := doc.text[:start]
+
+	switch {
+	case strings.HasSuffix(before, "<") || strings.HasSuffix(before, "</"):
+		if e, ok := parser.LookupElement(word); ok {
+			return markdown(fmt.Sprintf("**<%s>**\n\n%s", e.Name, e.Doc))
+		}
+	case strings.HasPrefix(strings.TrimLeft(doc.text[end:], " \t"), "="):
+		ctx := analyze(doc.text, start)
+		if attr, ok := lookupAttribute(ctx.element, word); ok {
+			text := fmt.Sprintf("**%s** on <%s>\n\n%s", attr.Name, ctx.element, attr.Doc)
+			if choices := attr.Choices(); len(choices) > 0 {
+				text += "\n\nValues: " + strings.Join(choices, ", ")
+			}
+			return markdown(text)
+		}
+	default:
+		if _, ok := variables.LookupKnown(word); ok {
+			return variableHover(doc, word)
+		}
+	}
+	return nil
+}
+
+func variableHover(doc *document, name string) *Hover {
+	var parts []string
+	if known, ok := variables.LookupKnown(name); ok {
+		parts = append(parts, fmt.Sprintf("**%s**\n\n%s", name, known.Doc))
+	}
+	if def, ok := lastDefinition(doc, name); ok {
+		if value, ok := setValue(doc.text, def); ok {
+			parts = append(parts, fmt.Sprintf("Set to `%s`", value))
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return markdown(strings.Join(parts, "\n\n"))
+}
+
+// definition returns the <set> that defines the {{VAR}} at a byte offset.
+func (s *Server) definition(doc *document, offset int) *Location {
+	ref, ok := doc.referenceAt(offset)
+	if !ok {
+		return nil
+	}
+	def, ok := lastDefinition(doc, ref.name)
+	if !ok {
+		return nil
+	}
+	return &Location{URI: doc.uri, Range: Range{Start: doc.position(def.start), End: doc.position(def.end)}}
+}
+
+// lastDefinition returns the <set> of a variable that takes effect; later
+// sets override earlier ones.
+func lastDefinition(doc *document, name string) (definition, bool) {
+	var found definition
+	ok := false
+	for _, def := range doc.definitions() {
+		if def.name == name {
+			found, ok = def, true
+		}
+	}
+	return found, ok
+}
+
+// setValue returns the value attribute of the <set> element of a definition.
+func setValue(text string, def definition) (string, bool) {
+	tagEnd := strings.IndexByte(text[def.end:], '>')
+	if tagEnd < 0 {
+		return "", false
+	}
+	tagStart := strings.LastIndexByte(text[:def.start], '<')
+	tag := text[tagStart : def.end+tagEnd]
+	for _, quote := range []string{`"`, `'`} {
+		key := "value=" + quote
+		if i := strings.Index(tag, key); i >= 0 {
+			rest := tag[i+len(key):]
+			if j := strings.Index(rest, quote); j >= 0 {
+				return rest[:j], true
+			}
+		}
+	}
+	return "", false
+}
+
+// wordAt returns the byte range of the name (letters, digits, '_', '-')
+// around offset.
+func wordAt(text string, offset int) (int, int) {
+	isWord := func(c byte) bool {
+		return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	start, end := offset, offset
+	for start > 0 && isWord(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWord(text[end]) {
+		end++
+	}
+	return start, end
+}
+
+func markdown(text string) *Hover {
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}}
+}
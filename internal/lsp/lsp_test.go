@@ -0,0 +1,315 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDocument = `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+    <set name="PRODUCT_NAME" value="Demo"/>
+    <set name="ADD_TO_PATH" value="true"/>
+    <feature name="{{PRODUCT_NAME}}">
+        <files source="bin" target="INSTALLDIR"/>
+        <shortcut name="{{UNDEFINED}}" target="DESKTOP" file="[INSTALLDIR]app.exe"/>
+    </feature>
+</setup>`
+
+// session runs the server on a scripted client conversation and returns
+// every message it wrote.
+func session(t *testing.T, messages ...map[string]any) []map[string]any {
+	t.Helper()
+	var in bytes.Buffer
+	for i, msg := range messages {
+		msg["jsonrpc"] = "2.0"
+		if _, isNotification := msg["notification"]; isNotification {
+			delete(msg, "notification")
+		} else {
+			msg["id"] = i + 1
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	if err := NewServer(&in, &out).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var replies []map[string]any
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var reply map[string]any
+		if err := json.Unmarshal(body, &reply); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func didOpen(uri, text string) map[string]any {
+	return map[string]any{
+		"notification": true,
+		"method":       "textDocument/didOpen",
+		"params":       map[string]any{"textDocument": map[string]any{"uri": uri, "text": text}},
+	}
+}
+
+func at(method, uri string, line, character int) map[string]any {
+	return map[string]any{
+		"method": method,
+		"params": map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": character},
+		},
+	}
+}
+
+// resultOf returns the result of the reply to request id, re-encoded into v.
+func resultOf(t *testing.T, replies []map[string]any, id int, v any) {
+	t.Helper()
+	for _, reply := range replies {
+		if fmt.Sprint(reply["id"]) != fmt.Sprint(id) {
+			continue
+		}
+		data, err := json.Marshal(reply["result"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("decoding result %s: %v", data, err)
+		}
+		return
+	}
+	t.Fatalf("no reply to request %d", id)
+}
+
+func diagnosticsOf(t *testing.T, replies []map[string]any) []Diagnostic {
+	t.Helper()
+	for _, reply := range replies {
+		if reply["method"] != "textDocument/publishDiagnostics" {
+			continue
+		}
+		data, _ := json.Marshal(reply["params"])
+		var params publishDiagnosticsParams
+		if err := json.Unmarshal(data, &params); err != nil {
+			t.Fatal(err)
+		}
+		return params.Diagnostics
+	}
+	t.Fatal("no diagnostics published")
+	return nil
+}
+
+func TestInitialize(t *testing.T) {
+	replies := session(t, map[string]any{"method": "initialize", "params": map[string]any{}})
+	var result struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	resultOf(t, replies, 1, &result)
+	for _, capability := range []string{"textDocumentSync", "completionProvider", "hoverProvider", "definitionProvider"} {
+		if _, ok := result.Capabilities[capability]; !ok {
+			t.Errorf("capability %s is missing", capability)
+		}
+	}
+}
+
+func TestUnknownRequest(t *testing.T) {
+	replies := session(t, map[string]any{"method": "textDocument/rename", "params": map[string]any{}})
+	if len(replies) != 1 || replies[0]["error"] == nil {
+		t.Fatalf("expected a method-not-found error, got %v", replies)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantLine int
+		wantText string
+	}{
+		{"undefined variable", testDocument, 6, "UNDEFINED"},
+		{"unknown element", "<setup>\n  <feature name=\"A\">\n    <bogus/>\n  </feature>\n</setup>", 2, "bogus"},
+		{"syntax error", "<setup>\n  <feature name=\"A\">\n</setup>", 1, "feature"},
+		{"deprecated variable", "<setup>\n  <set name=\"INCLUDE_VCREDIST\" value=\"true\"/>\n</setup>", 1, "deprecated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diags := diagnosticsOf(t, session(t, didOpen("untitled:test.msis", tt.text)))
+			for _, d := range diags {
+				if d.Range.Start.Line == tt.wantLine && strings.Contains(d.Message, tt.wantText) {
+					return
+				}
+			}
+			t.Errorf("no diagnostic on line %d mentioning %q in %+v", tt.wantLine, tt.wantText, diags)
+		})
+	}
+}
+
+func TestDiagnosticsRunICEChecks(t *testing.T) {
+	dir := t.TempDir()
+	// A package that builds cleanly has no error diagnostics after generation
+	text := `<setup>
+  <set name="PRODUCT_NAME" value="Demo"/>
+  <set name="UPGRADE_CODE" value="{11111111-2222-3333-4444-555555555555}"/>
+  <files source="bin" target="INSTALLDIR"/>
+</setup>`
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin", "app.exe"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "setup.msis"))
+	diags := diagnosticsOf(t, session(t, didOpen(uri, text)))
+	for _, d := range diags {
+		if d.Severity == severityError {
+			t.Errorf("unexpected error diagnostic: %+v", d)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "readme.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "setup.msis"))
+	text := "<setup>\n  <feature name=\"A\">\n    <\n    <files \n    <files source=\"b\n    <shortcut name=\"{{PRO\n  </feature>\n</setup>"
+
+	replies := session(t,
+		didOpen(uri, text),
+		at("textDocument/completion", uri, 2, 5),
+		at("textDocument/completion", uri, 3, 11),
+		at("textDocument/completion", uri, 4, 21),
+		at("textDocument/completion", uri, 5, 24),
+	)
+
+	tests := []struct {
+		id      int
+		want    string
+		notWant string
+	}{
+		{2, "files", "set"},
+		{3, "source", ""},
+		{4, "bin", "readme.txt"},
+		{5, "PRODUCT_NAME", ""},
+	}
+	for _, tt := range tests {
+		var items []CompletionItem
+		resultOf(t, replies, tt.id, &items)
+		var labels []string
+		for _, item := range items {
+			labels = append(labels, item.Label)
+		}
+		if !contains(labels, tt.want) {
+			t.Errorf("request %d: %q missing from %v", tt.id, tt.want, labels)
+		}
+		if tt.notWant != "" && contains(labels, tt.notWant) {
+			t.Errorf("request %d: %q should not be offered in %v", tt.id, tt.notWant, labels)
+		}
+	}
+}
+
+func TestHoverAndDefinition(t *testing.T) {
+	uri := "untitled:test.msis"
+	replies := session(t,
+		didOpen(uri, testDocument),
+		at("textDocument/hover", uri, 3, 17),      // ADD_TO_PATH in its <set>
+		at("textDocument/hover", uri, 4, 24),      // {{PRODUCT_NAME}}
+		at("textDocument/hover", uri, 5, 10),      // <files
+		at("textDocument/hover", uri, 5, 16),      // source=
+		at("textDocument/definition", uri, 4, 24), // {{PRODUCT_NAME}}
+		at("textDocument/definition", uri, 6, 27), // {{UNDEFINED}}
+	)
+
+	hovers := []struct {
+		id   int
+		want string
+	}{
+		{2, "PATH"},
+		{3, "Demo"},
+		{4, "**<files>**"},
+		{5, "**source** on <files>"},
+	}
+	for _, tt := range hovers {
+		var hover Hover
+		resultOf(t, replies, tt.id, &hover)
+		if !strings.Contains(hover.Contents.Value, tt.want) {
+			t.Errorf("hover %d: %q does not contain %q", tt.id, hover.Contents.Value, tt.want)
+		}
+	}
+
+	var loc Location
+	resultOf(t, replies, 6, &loc)
+	if loc.Range.Start.Line != 2 || loc.Range.Start.Character != 15 {
+		t.Errorf("definition: got %+v, want line 2 character 15", loc.Range.Start)
+	}
+	var none *Location
+	resultOf(t, replies, 7, &none)
+	if none != nil {
+		t.Errorf("definition of an undefined variable: got %+v, want null", none)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		text      string
+		kind      int
+		element   string
+		parent    string
+		attribute string
+		prefix    string
+	}{
+		{"<setup>\n  <fe", inElementName, "", "setup", "", "fe"},
+		{"<setup>\n  <feature name=\"A\">\n    </", inClosingTag, "", "feature", "", ""},
+		{"<setup>\n  <files source=\"bin\" ta", inAttributeName, "files", "setup", "", "ta"},
+		{"<setup>\n  <files source=\"b", inAttributeValue, "files", "setup", "source", "b"},
+		{"<setup>\n  <files source='x' target=\"IN", inAttributeValue, "files", "setup", "target", "IN"},
+		{"<setup>\n  <!-- <files ", inText, "", "setup", "", ""},
+	}
+	for _, tt := range tests {
+		ctx := analyze(tt.text, len(tt.text))
+		if ctx.kind != tt.kind || ctx.element != tt.element || ctx.parent != tt.parent || ctx.attribute != tt.attribute || ctx.prefix != tt.prefix {
+			t.Errorf("analyze(%q) = %+v", tt.text, ctx)
+		}
+	}
+}
+
+func TestDocumentPositions(t *testing.T) {
+	doc := newDocument("untitled:x", "ab\nä𝄞c\n")
+	tests := []struct {
+		pos    Position
+		offset int
+	}{
+		{Position{Line: 0, Character: 1}, 1},
+		{Position{Line: 1, Character: 0}, 3},
+		{Position{Line: 1, Character: 1}, 5},   // After ä (2 bytes)
+		{Position{Line: 1, Character: 3}, 9},   // After 𝄞 (4 bytes, 2 UTF-16 units)
+		{Position{Line: 1, Character: 99}, 10}, // Clamped to the end of the line
+	}
+	for _, tt := range tests {
+		if got := doc.offset(tt.pos); got != tt.offset {
+			t.Errorf("offset(%+v) = %d, want %d", tt.pos, got, tt.offset)
+		}
+		if tt.pos.Character < 99 {
+			if got := doc.position(tt.offset); got != tt.pos {
+				t.Errorf("position(%d) = %+v, want %+v", tt.offset, got, tt.pos)
+			}
+		}
+	}
+}
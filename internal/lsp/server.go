@@ -0,0 +1,180 @@
+// Package lsp implements a Language Server Protocol server for .msis files.
+// It speaks JSON-RPC over a byte stream (stdio for `msis /LSP`) and offers
+// element and attribute completion, hover docs, go-to-definition for
+// {{VAR}} references and diagnostics from the parser and the ICE checks.
+// It needs no WiX installation.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Server is a language server for one client connection.
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	mu   sync.Mutex // Serializes writes to out
+	docs map[string]*document
+
+	shutdown bool
+}
+
+// NewServer creates a server that reads requests from in and writes
+// responses and notifications to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// errExit ends Run after the client's exit notification.
+var errExit = errors.New("exit")
+
+// Run serves requests until the client sends exit or closes the stream.
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading message: %w", err)
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("decoding message: %w", err)
+		}
+		if err := s.handle(&req); err != nil {
+			if err == errExit {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handle dispatches a request or notification.
+func (s *Server) handle(req *request) error {
+	var result any
+	switch req.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    1, // Full document on every change
+					"save":      map[string]any{"includeText": true},
+				},
+				"completionProvider": map[string]any{
+					"triggerCharacters": []string{"<", " ", `"`, "{", "/", `\`},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "msis"},
+		}
+	case "initialized", "$/cancelRequest", "$/setTrace", "workspace/didChangeConfiguration":
+		return nil
+	case "shutdown":
+		s.shutdown = true
+	case "exit":
+		return errExit
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc := newDocument(params.TextDocument.URI, params.TextDocument.Text)
+		s.docs[doc.uri] = doc
+		return s.publishDiagnostics(doc, true)
+	case "textDocument/didChange":
+		var params didChangeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		doc := newDocument(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		s.docs[doc.uri] = doc
+		return s.publishDiagnostics(doc, false)
+	case "textDocument/didSave":
+		var params didSaveParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			return nil
+		}
+		if params.Text != nil {
+			doc.text = *params.Text
+		}
+		return s.publishDiagnostics(doc, true)
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err == nil {
+			delete(s.docs, params.TextDocument.URI)
+			return s.notify("textDocument/publishDiagnostics", publishDiagnosticsParams{URI: params.TextDocument.URI, Diagnostics: []Diagnostic{}})
+		}
+		return nil
+	case "textDocument/completion", "textDocument/hover", "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return s.reply(req, nil, &responseError{Code: codeInvalidParams, Message: err.Error()})
+		}
+		doc, ok := s.docs[params.TextDocument.URI]
+		if !ok {
+			break
+		}
+		offset := doc.offset(params.Position)
+		switch req.Method {
+		case "textDocument/completion":
+			items := s.complete(doc, offset)
+			if items == nil {
+				items = []CompletionItem{}
+			}
+			result = items
+		case "textDocument/hover":
+			if hover := s.hover(doc, offset); hover != nil {
+				result = hover
+			}
+		case "textDocument/definition":
+			if loc := s.definition(doc, offset); loc != nil {
+				result = loc
+			}
+		}
+	default:
+		if req.ID == nil {
+			return nil // Unknown notifications are ignored
+		}
+		return s.reply(req, nil, &responseError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method})
+	}
+	return s.reply(req, result, nil)
+}
+
+func (s *Server) reply(req *request, result any, rerr *responseError) error {
+	if req.ID == nil {
+		return nil
+	}
+	return s.write(response{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rerr})
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) write(msg any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeMessage(s.out, msg); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	return nil
+}
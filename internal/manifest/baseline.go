@@ -0,0 +1,186 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity classifies a component rule finding by the kind of upgrade it requires.
+type Severity int
+
+const (
+	// SeverityInfo is compatible with a minor upgrade.
+	SeverityInfo Severity = iota
+	// SeverityMajor requires a major upgrade (new ProductCode, old product removed first).
+	SeverityMajor
+	// SeverityUnsafe breaks component rules even for a major upgrade.
+	SeverityUnsafe
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityMajor:
+		return "major"
+	case SeverityUnsafe:
+		return "unsafe"
+	default:
+		return "info"
+	}
+}
+
+// Finding is a single difference between the baseline and the new component set.
+type Finding struct {
+	Severity Severity
+	GUID     string
+	Message  string
+}
+
+// Report is the result of comparing a build against a baseline manifest.
+type Report struct {
+	Findings []Finding
+}
+
+// Severity returns the highest severity of all findings.
+func (r *Report) Severity() Severity {
+	worst := SeverityInfo
+	for _, f := range r.Findings {
+		if f.Severity > worst {
+			worst = f.Severity
+		}
+	}
+	return worst
+}
+
+// Verdict returns a one-line summary of the upgrade this change requires.
+func (r *Report) Verdict() string {
+	switch r.Severity() {
+	case SeverityUnsafe:
+		return "unsafe: component rules are violated"
+	case SeverityMajor:
+		return "requires a major upgrade"
+	default:
+		return "safe as a minor upgrade"
+	}
+}
+
+// CheckBaseline compares the component set of current against the baseline
+// saved from the previous release and reports component rule violations.
+// Components are matched by GUID; auto-GUID components ('*') are derived from
+// their keypath by WiX and are therefore skipped.
+func CheckBaseline(baseline, current *Manifest) *Report {
+	report := &Report{}
+	add := func(sev Severity, guid, format string, args ...interface{}) {
+		report.Findings = append(report.Findings, Finding{Severity: sev, GUID: guid, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if baseline.Product.UpgradeCode != "" && !strings.EqualFold(baseline.Product.UpgradeCode, current.Product.UpgradeCode) {
+		add(SeverityUnsafe, "", "UPGRADE_CODE changed from %s to %s; the new package will not upgrade the old one",
+			baseline.Product.UpgradeCode, current.Product.UpgradeCode)
+	}
+
+	oldByGUID := indexByGUID(baseline.Components)
+	newByGUID := indexByGUID(current.Components)
+	oldByKeyPath := indexByKeyPath(baseline.Components)
+	newByKeyPath := indexByKeyPath(current.Components)
+
+	for _, guid := range sortedKeys(oldByGUID) {
+		old := oldByGUID[guid]
+		cur, ok := newByGUID[guid]
+		if !ok {
+			if replacement, moved := newByKeyPath[strings.ToLower(old.KeyPath)]; moved && replacement.GUID != "*" {
+				add(SeverityMajor, old.GUID, "component GUID changed for %s (%s -> %s)", old.KeyPath, old.GUID, replacement.GUID)
+			} else {
+				add(SeverityMajor, old.GUID, "component removed: %s", old.KeyPath)
+			}
+			continue
+		}
+
+		if !strings.EqualFold(old.Directory, cur.Directory) {
+			add(SeverityUnsafe, guid, "component moved from %s to %s but kept its GUID", old.Directory, cur.Directory)
+		} else if !strings.EqualFold(old.KeyPath, cur.KeyPath) {
+			add(SeverityUnsafe, guid, "component keypath changed from %s to %s but kept its GUID", old.KeyPath, cur.KeyPath)
+		}
+
+		if !sameFeatures(old.Features, cur.Features) {
+			add(SeverityMajor, guid, "component %s moved from feature %s to %s", cur.KeyPath,
+				formatFeatures(old.Features), formatFeatures(cur.Features))
+		}
+	}
+
+	for _, guid := range sortedKeys(newByGUID) {
+		cur := newByGUID[guid]
+		if _, ok := oldByGUID[guid]; ok {
+			continue
+		}
+		if _, replaced := oldByKeyPath[strings.ToLower(cur.KeyPath)]; replaced {
+			continue // Already reported as a GUID change
+		}
+		add(SeverityInfo, guid, "component added: %s", cur.KeyPath)
+	}
+
+	currentFeatures := make(map[string]bool)
+	for _, name := range current.Features {
+		currentFeatures[name] = true
+	}
+	for _, name := range baseline.Features {
+		if !currentFeatures[name] {
+			add(SeverityMajor, "", "feature removed: %s", name)
+		}
+	}
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return report.Findings[i].Severity > report.Findings[j].Severity
+	})
+	return report
+}
+
+func indexByGUID(components []Component) map[string]Component {
+	result := make(map[string]Component)
+	for _, comp := range components {
+		if comp.GUID == "" || comp.GUID == "*" {
+			continue
+		}
+		result[strings.ToLower(comp.GUID)] = comp
+	}
+	return result
+}
+
+func indexByKeyPath(components []Component) map[string]Component {
+	result := make(map[string]Component)
+	for _, comp := range components {
+		if comp.GUID == "*" {
+			continue
+		}
+		result[strings.ToLower(comp.KeyPath)] = comp
+	}
+	return result
+}
+
+func sortedKeys(m map[string]Component) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sameFeatures(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatFeatures(features []string) string {
+	if len(features) == 0 {
+		return "(none)"
+	}
+	return strings.Join(features, ", ")
+}
@@ -0,0 +1,136 @@
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func baselineManifest() *Manifest {
+	return &Manifest{
+		Product:  Product{Name: "App", Version: "1.0.0", UpgradeCode: "UPGRADE-1"},
+		Features: []string{"Main", "Main/Tools"},
+		Components: []Component{
+			{ID: "C1", GUID: "guid-1", Kind: "file", Directory: "[INSTALLDIR]", KeyPath: "[INSTALLDIR]app.exe", Features: []string{"Main"}},
+			{ID: "C2", GUID: "guid-2", Kind: "file", Directory: "[INSTALLDIR]bin", KeyPath: "[INSTALLDIR]bin\\tool.exe", Features: []string{"Main/Tools"}},
+			{ID: "C3", GUID: "*", Kind: "remove-on-uninstall", KeyPath: "HKCU\\Software\\App\\C3"},
+		},
+	}
+}
+
+func TestCheckBaselineUnchanged(t *testing.T) {
+	report := CheckBaseline(baselineManifest(), baselineManifest())
+	if len(report.Findings) != 0 {
+		t.Errorf("expected no findings, got %+v", report.Findings)
+	}
+	if report.Severity() != SeverityInfo {
+		t.Errorf("Severity() = %v, want info", report.Severity())
+	}
+	if !strings.Contains(report.Verdict(), "minor") {
+		t.Errorf("Verdict() = %q, want minor upgrade", report.Verdict())
+	}
+}
+
+func TestCheckBaselineAddedComponentIsMinor(t *testing.T) {
+	current := baselineManifest()
+	current.Components = append(current.Components, Component{
+		ID: "C4", GUID: "guid-4", Kind: "file", Directory: "[INSTALLDIR]", KeyPath: "[INSTALLDIR]new.dll", Features: []string{"Main"},
+	})
+
+	report := CheckBaseline(baselineManifest(), current)
+	if len(report.Findings) != 1 || report.Findings[0].Severity != SeverityInfo {
+		t.Fatalf("expected one info finding, got %+v", report.Findings)
+	}
+}
+
+func TestCheckBaselineMovedDirectoryKeepsGUID(t *testing.T) {
+	current := baselineManifest()
+	current.Components[1].Directory = "[INSTALLDIR]tools"
+	current.Components[1].KeyPath = "[INSTALLDIR]tools\\tool.exe"
+
+	report := CheckBaseline(baselineManifest(), current)
+	if report.Severity() != SeverityUnsafe {
+		t.Fatalf("Severity() = %v, want unsafe; findings: %+v", report.Severity(), report.Findings)
+	}
+	if !strings.Contains(report.Findings[0].Message, "kept its GUID") {
+		t.Errorf("unexpected message: %s", report.Findings[0].Message)
+	}
+}
+
+func TestCheckBaselineKeyPathChanged(t *testing.T) {
+	current := baselineManifest()
+	current.Components[0].KeyPath = "[INSTALLDIR]app2.exe"
+
+	report := CheckBaseline(baselineManifest(), current)
+	if report.Severity() != SeverityUnsafe {
+		t.Fatalf("Severity() = %v, want unsafe", report.Severity())
+	}
+}
+
+func TestCheckBaselineRemovedComponentNeedsMajor(t *testing.T) {
+	current := baselineManifest()
+	current.Components = current.Components[:1]
+
+	report := CheckBaseline(baselineManifest(), current)
+	if report.Severity() != SeverityMajor {
+		t.Fatalf("Severity() = %v, want major; findings: %+v", report.Severity(), report.Findings)
+	}
+	if !strings.Contains(report.Findings[0].Message, "component removed") {
+		t.Errorf("unexpected message: %s", report.Findings[0].Message)
+	}
+}
+
+func TestCheckBaselineGUIDChanged(t *testing.T) {
+	current := baselineManifest()
+	current.Components[0].GUID = "guid-new"
+
+	report := CheckBaseline(baselineManifest(), current)
+	if len(report.Findings) != 1 {
+		t.Fatalf("expected 1 finding, got %+v", report.Findings)
+	}
+	if report.Findings[0].Severity != SeverityMajor || !strings.Contains(report.Findings[0].Message, "GUID changed") {
+		t.Errorf("unexpected finding: %+v", report.Findings[0])
+	}
+}
+
+func TestCheckBaselineFeatureChanges(t *testing.T) {
+	current := baselineManifest()
+	current.Features = []string{"Main"}
+	current.Components[1].Features = []string{"Main"}
+
+	report := CheckBaseline(baselineManifest(), current)
+	if report.Severity() != SeverityMajor {
+		t.Fatalf("Severity() = %v, want major", report.Severity())
+	}
+	if len(report.Findings) != 2 {
+		t.Errorf("expected feature move and feature removal, got %+v", report.Findings)
+	}
+}
+
+func TestCheckBaselineUpgradeCodeChanged(t *testing.T) {
+	current := baselineManifest()
+	current.Product.UpgradeCode = "UPGRADE-2"
+
+	report := CheckBaseline(baselineManifest(), current)
+	if report.Severity() != SeverityUnsafe {
+		t.Errorf("Severity() = %v, want unsafe", report.Severity())
+	}
+}
+
+func TestManifestSaveLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "baseline.json")
+	if err := baselineManifest().Save(filename); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Components) != 3 || loaded.Components[1].KeyPath != "[INSTALLDIR]bin\\tool.exe" {
+		t.Errorf("unexpected components after round-trip: %+v", loaded.Components)
+	}
+	if loaded.Product.UpgradeCode != "UPGRADE-1" {
+		t.Errorf("UpgradeCode = %q, want UPGRADE-1", loaded.Product.UpgradeCode)
+	}
+}
@@ -0,0 +1,356 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Change kinds reported by Compare.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+	Moved   = "moved"
+)
+
+// Change is a single install-model difference between two builds.
+type Change struct {
+	Kind   string `json:"kind"`
+	Item   string `json:"item"` // Target path, registry path, service name, ...
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Diff is the semantic difference between two manifests. Generated IDs are
+// ignored; items are matched by what they install.
+type Diff struct {
+	Properties    []Change `json:"properties"`
+	Features      []Change `json:"features"`
+	Files         []Change `json:"files"`
+	Registry      []Change `json:"registry"`
+	Services      []Change `json:"services"`
+	Shortcuts     []Change `json:"shortcuts"`
+	Prerequisites []Change `json:"prerequisites"`
+	Upgrade       string   `json:"upgrade"` // Component rules verdict, see CheckBaseline
+}
+
+// upgradeVariables are the variables that influence how the new package
+// upgrades the old one, beyond the product identity.
+var upgradeVariables = []string{"INSTALLDIR", "APPDATADIR", "ADD_TO_PATH", "REMOVE_REGISTRY_TREE"}
+
+// Empty reports whether the two builds install the same thing.
+func (d *Diff) Empty() bool {
+	return len(d.Properties)+len(d.Features)+len(d.Files)+len(d.Registry)+
+		len(d.Services)+len(d.Shortcuts)+len(d.Prerequisites) == 0
+}
+
+// Compare returns the semantic difference between old and cur.
+func Compare(old, cur *Manifest) *Diff {
+	d := &Diff{
+		Properties:    compareProperties(old, cur),
+		Features:      compareNames(old.Features, cur.Features),
+		Files:         compareFiles(old.Files, cur.Files),
+		Registry:      compareRegistry(old.Registry, cur.Registry),
+		Services:      compareServices(old.Services, cur.Services),
+		Shortcuts:     compareShortcuts(old.Shortcuts, cur.Shortcuts),
+		Prerequisites: comparePrerequisites(old.Prerequisites, cur.Prerequisites),
+		Upgrade:       CheckBaseline(old, cur).Verdict(),
+	}
+	// Empty sections encode as [] rather than null for review bots
+	for _, section := range []*[]Change{&d.Properties, &d.Features, &d.Files, &d.Registry, &d.Services, &d.Shortcuts, &d.Prerequisites} {
+		if *section == nil {
+			*section = []Change{}
+		}
+	}
+	return d
+}
+
+func compareProperties(old, cur *Manifest) []Change {
+	var changes []Change
+	add := func(name, from, to string) {
+		if from != to {
+			changes = append(changes, Change{Kind: Changed, Item: name, From: from, To: to})
+		}
+	}
+	add("PRODUCT_NAME", old.Product.Name, cur.Product.Name)
+	add("PRODUCT_VERSION", old.Product.Version, cur.Product.Version)
+	add("MANUFACTURER", old.Product.Manufacturer, cur.Product.Manufacturer)
+	add("UPGRADE_CODE", old.Product.UpgradeCode, cur.Product.UpgradeCode)
+	add("PLATFORM", old.Product.Platform, cur.Product.Platform)
+	// Component baselines saved before variables were recorded have none
+	if old.Variables != nil && cur.Variables != nil {
+		for _, name := range upgradeVariables {
+			add(name, old.Variables[name], cur.Variables[name])
+		}
+	}
+	return changes
+}
+
+func compareNames(old, cur []string) []Change {
+	var changes []Change
+	oldSet := make(map[string]bool)
+	for _, name := range old {
+		oldSet[name] = true
+	}
+	newSet := make(map[string]bool)
+	for _, name := range cur {
+		newSet[name] = true
+		if !oldSet[name] {
+			changes = append(changes, Change{Kind: Added, Item: name})
+		}
+	}
+	for _, name := range old {
+		if !newSet[name] {
+			changes = append(changes, Change{Kind: Removed, Item: name})
+		}
+	}
+	return changes
+}
+
+func compareFiles(old, cur []File) []Change {
+	oldByTarget := make(map[string]File)
+	for _, f := range old {
+		oldByTarget[strings.ToLower(f.Target)] = f
+	}
+	newByTarget := make(map[string]File)
+	for _, f := range cur {
+		newByTarget[strings.ToLower(f.Target)] = f
+	}
+
+	var changes, removed, added []Change
+	var removedFiles, addedFiles []File
+	for _, key := range sortedFileKeys(oldByTarget) {
+		o := oldByTarget[key]
+		n, ok := newByTarget[key]
+		if !ok {
+			removedFiles = append(removedFiles, o)
+			continue
+		}
+		var details []string
+		if !strings.EqualFold(o.Source, n.Source) {
+			details = append(details, fmt.Sprintf("source %s -> %s", o.Source, n.Source))
+		}
+		if !sameFeatures(o.Features, n.Features) {
+			details = append(details, fmt.Sprintf("feature %s -> %s", formatFeatures(o.Features), formatFeatures(n.Features)))
+		}
+		if o.SHA256 != "" && n.SHA256 != "" && o.SHA256 != n.SHA256 {
+			details = append(details, "content changed")
+		}
+		if o.Version != nil && n.Version != nil && o.Version.FileVersion != n.Version.FileVersion {
+			details = append(details, fmt.Sprintf("version %s -> %s", o.Version.FileVersion, n.Version.FileVersion))
+		}
+		if len(details) > 0 {
+			changes = append(changes, Change{Kind: Changed, Item: n.Target, Detail: strings.Join(details, "; ")})
+		}
+	}
+	for _, key := range sortedFileKeys(newByTarget) {
+		if _, ok := oldByTarget[key]; !ok {
+			addedFiles = append(addedFiles, newByTarget[key])
+		}
+	}
+
+	// A removed and an added file are a move if they come from the same
+	// source, have the same content, or share a file name nothing else has
+	matched := make(map[int]bool)
+	matchAdded := func(o File) int {
+		for i, n := range addedFiles {
+			if !matched[i] && strings.EqualFold(o.Source, n.Source) {
+				return i
+			}
+		}
+		for i, n := range addedFiles {
+			if !matched[i] && o.SHA256 != "" && o.SHA256 == n.SHA256 {
+				return i
+			}
+		}
+		if countBaseName(removedFiles, o.Target) == 1 && countBaseName(addedFiles, o.Target) == 1 {
+			for i, n := range addedFiles {
+				if !matched[i] && strings.EqualFold(targetFileName(n.Target), targetFileName(o.Target)) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	for _, o := range removedFiles {
+		if i := matchAdded(o); i >= 0 {
+			matched[i] = true
+			changes = append(changes, Change{Kind: Moved, Item: targetFileName(o.Target), From: o.Target, To: addedFiles[i].Target})
+			continue
+		}
+		removed = append(removed, Change{Kind: Removed, Item: o.Target})
+	}
+	for i, n := range addedFiles {
+		if !matched[i] {
+			added = append(added, Change{Kind: Added, Item: n.Target, Detail: formatFeatures(n.Features)})
+		}
+	}
+	return append(append(added, removed...), changes...)
+}
+
+func sortedFileKeys(m map[string]File) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func countBaseName(files []File, target string) int {
+	n := 0
+	for _, f := range files {
+		if strings.EqualFold(targetFileName(f.Target), targetFileName(target)) {
+			n++
+		}
+	}
+	return n
+}
+
+func registryPath(v RegistryValue) string {
+	p := v.Root + "\\" + v.Key
+	if v.Name != "" {
+		return p + "\\" + v.Name
+	}
+	return p + "\\(Default)"
+}
+
+func compareRegistry(old, cur []RegistryValue) []Change {
+	index := func(values []RegistryValue) (map[string]RegistryValue, []string) {
+		m := make(map[string]RegistryValue)
+		var keys []string
+		for _, v := range values {
+			key := strings.ToLower(registryPath(v))
+			if _, dup := m[key]; !dup {
+				keys = append(keys, key)
+			}
+			m[key] = v
+		}
+		sort.Strings(keys)
+		return m, keys
+	}
+	oldMap, oldKeys := index(old)
+	newMap, newKeys := index(cur)
+
+	var changes []Change
+	for _, key := range newKeys {
+		n := newMap[key]
+		o, ok := oldMap[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Added, Item: registryPath(n), To: n.Type + ":" + n.Value})
+		case o.Type != n.Type || o.Value != n.Value:
+			changes = append(changes, Change{Kind: Changed, Item: registryPath(n), From: o.Type + ":" + o.Value, To: n.Type + ":" + n.Value})
+		}
+	}
+	for _, key := range oldKeys {
+		if _, ok := newMap[key]; !ok {
+			changes = append(changes, Change{Kind: Removed, Item: registryPath(oldMap[key])})
+		}
+	}
+	return changes
+}
+
+func compareServices(old, cur []Service) []Change {
+	oldMap := make(map[string]Service)
+	for _, s := range old {
+		oldMap[strings.ToLower(s.Name)] = s
+	}
+	newMap := make(map[string]Service)
+	for _, s := range cur {
+		newMap[strings.ToLower(s.Name)] = s
+	}
+
+	var changes []Change
+	for _, n := range cur {
+		o, ok := oldMap[strings.ToLower(n.Name)]
+		if !ok {
+			changes = append(changes, Change{Kind: Added, Item: n.Name, Detail: n.File})
+			continue
+		}
+		var details []string
+		if o.Start != n.Start {
+			details = append(details, fmt.Sprintf("start %s -> %s", o.Start, n.Start))
+		}
+		if !strings.EqualFold(o.File, n.File) {
+			details = append(details, fmt.Sprintf("file %s -> %s", o.File, n.File))
+		}
+		if o.DisplayName != n.DisplayName {
+			details = append(details, fmt.Sprintf("display name %q -> %q", o.DisplayName, n.DisplayName))
+		}
+		if o.Description != n.Description {
+			details = append(details, "description changed")
+		}
+		if !sameFeatures(o.Features, n.Features) {
+			details = append(details, fmt.Sprintf("feature %s -> %s", formatFeatures(o.Features), formatFeatures(n.Features)))
+		}
+		if len(details) > 0 {
+			changes = append(changes, Change{Kind: Changed, Item: n.Name, Detail: strings.Join(details, "; ")})
+		}
+	}
+	for _, o := range old {
+		if _, ok := newMap[strings.ToLower(o.Name)]; !ok {
+			changes = append(changes, Change{Kind: Removed, Item: o.Name})
+		}
+	}
+	return changes
+}
+
+func compareShortcuts(old, cur []Shortcut) []Change {
+	key := func(s Shortcut) string { return s.Folder + "\\" + s.Name }
+	oldMap := make(map[string]Shortcut)
+	for _, s := range old {
+		oldMap[strings.ToLower(key(s))] = s
+	}
+	newMap := make(map[string]Shortcut)
+	for _, s := range cur {
+		newMap[strings.ToLower(key(s))] = s
+	}
+
+	var changes []Change
+	for _, n := range cur {
+		o, ok := oldMap[strings.ToLower(key(n))]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Added, Item: key(n), To: n.Target})
+		case !strings.EqualFold(o.Target, n.Target):
+			changes = append(changes, Change{Kind: Changed, Item: key(n), From: o.Target, To: n.Target})
+		}
+	}
+	for _, o := range old {
+		if _, ok := newMap[strings.ToLower(key(o))]; !ok {
+			changes = append(changes, Change{Kind: Removed, Item: key(o)})
+		}
+	}
+	return changes
+}
+
+func comparePrerequisites(old, cur []Prerequisite) []Change {
+	oldMap := make(map[string]Prerequisite)
+	for _, p := range old {
+		oldMap[p.Type] = p
+	}
+	newMap := make(map[string]Prerequisite)
+	for _, p := range cur {
+		newMap[p.Type] = p
+	}
+
+	var changes []Change
+	for _, n := range cur {
+		o, ok := oldMap[n.Type]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Added, Item: n.Type, To: n.Version})
+		case o.Version != n.Version:
+			changes = append(changes, Change{Kind: Changed, Item: n.Type, From: o.Version, To: n.Version})
+		}
+	}
+	for _, o := range old {
+		if _, ok := newMap[o.Type]; !ok {
+			changes = append(changes, Change{Kind: Removed, Item: o.Type, From: o.Version})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,119 @@
+package manifest
+
+import (
+	"testing"
+)
+
+func diffManifest() *Manifest {
+	return &Manifest{
+		Product:  Product{Name: "App", Version: "1.0.0", UpgradeCode: "UPGRADE-1", Platform: "x64"},
+		Features: []string{"Main", "Main/Tools"},
+		Files: []File{
+			{Source: "bin\\app.exe", Target: "[INSTALLDIR]app.exe", Features: []string{"Main"}, SHA256: "aaa"},
+			{Source: "bin\\tool.exe", Target: "[INSTALLDIR]tools\\tool.exe", Features: []string{"Main/Tools"}},
+			{Source: "doc\\readme.txt", Target: "[INSTALLDIR]readme.txt", Features: []string{"Main"}},
+		},
+		Registry: []RegistryValue{
+			{Root: "HKLM", Key: "Software\\App", Name: "Version", Type: "string", Value: "1.0.0"},
+			{Root: "HKLM", Key: "Software\\App", Name: "Legacy", Type: "dword", Value: "1"},
+		},
+		Services:      []Service{{Name: "AppSvc", Start: "auto", File: "app.exe"}},
+		Shortcuts:     []Shortcut{{Name: "App", Folder: "DESKTOP", Target: "[INSTALLDIR]app.exe"}},
+		Prerequisites: []Prerequisite{{Type: "vcredist", Version: "2019"}},
+		Variables:     map[string]string{"INSTALLDIR": "ACME\\App"},
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+	d := Compare(diffManifest(), diffManifest())
+	if !d.Empty() {
+		t.Errorf("expected empty diff, got %+v", d)
+	}
+	if d.Upgrade != "safe as a minor upgrade" {
+		t.Errorf("Upgrade = %q", d.Upgrade)
+	}
+}
+
+func TestCompareChanges(t *testing.T) {
+	cur := diffManifest()
+	cur.Product.Version = "1.1.0"
+	cur.Variables["INSTALLDIR"] = "ACME\\App2"
+	cur.Features = []string{"Main", "Main/Extras"}
+	cur.Files = []File{
+		{Source: "bin\\app.exe", Target: "[INSTALLDIR]app.exe", Features: []string{"Main"}, SHA256: "bbb"},
+		{Source: "bin\\tool.exe", Target: "[INSTALLDIR]bin\\tool.exe", Features: []string{"Main/Tools"}},
+		{Source: "bin\\new.dll", Target: "[INSTALLDIR]new.dll", Features: []string{"Main/Extras"}},
+	}
+	cur.Registry = []RegistryValue{
+		{Root: "HKLM", Key: "Software\\App", Name: "Version", Type: "string", Value: "1.1.0"},
+		{Root: "HKLM", Key: "Software\\App", Name: "Path", Type: "string", Value: "[INSTALLDIR]"},
+	}
+	cur.Services = []Service{{Name: "AppSvc", Start: "demand", File: "app.exe"}}
+	cur.Shortcuts = nil
+	cur.Prerequisites = []Prerequisite{{Type: "vcredist", Version: "2022"}, {Type: "netfx", Version: "4.8"}}
+
+	d := Compare(diffManifest(), cur)
+
+	want := map[string][]Change{
+		"properties": {
+			{Kind: Changed, Item: "PRODUCT_VERSION", From: "1.0.0", To: "1.1.0"},
+			{Kind: Changed, Item: "INSTALLDIR", From: "ACME\\App", To: "ACME\\App2"},
+		},
+		"features": {
+			{Kind: Added, Item: "Main/Extras"},
+			{Kind: Removed, Item: "Main/Tools"},
+		},
+		"files": {
+			{Kind: Added, Item: "[INSTALLDIR]new.dll", Detail: "Main/Extras"},
+			{Kind: Removed, Item: "[INSTALLDIR]readme.txt"},
+			{Kind: Changed, Item: "[INSTALLDIR]app.exe", Detail: "content changed"},
+			{Kind: Moved, Item: "tool.exe", From: "[INSTALLDIR]tools\\tool.exe", To: "[INSTALLDIR]bin\\tool.exe"},
+		},
+		"registry": {
+			{Kind: Added, Item: "HKLM\\Software\\App\\Path", To: "string:[INSTALLDIR]"},
+			{Kind: Changed, Item: "HKLM\\Software\\App\\Version", From: "string:1.0.0", To: "string:1.1.0"},
+			{Kind: Removed, Item: "HKLM\\Software\\App\\Legacy"},
+		},
+		"services": {
+			{Kind: Changed, Item: "AppSvc", Detail: "start auto -> demand"},
+		},
+		"shortcuts": {
+			{Kind: Removed, Item: "DESKTOP\\App"},
+		},
+		"prerequisites": {
+			{Kind: Changed, Item: "vcredist", From: "2019", To: "2022"},
+			{Kind: Added, Item: "netfx", To: "4.8"},
+		},
+	}
+	got := map[string][]Change{
+		"properties":    d.Properties,
+		"features":      d.Features,
+		"files":         d.Files,
+		"registry":      d.Registry,
+		"services":      d.Services,
+		"shortcuts":     d.Shortcuts,
+		"prerequisites": d.Prerequisites,
+	}
+	for section, changes := range want {
+		if len(got[section]) != len(changes) {
+			t.Errorf("%s: got %d changes %+v, want %d", section, len(got[section]), got[section], len(changes))
+			continue
+		}
+		for i := range changes {
+			if got[section][i] != changes[i] {
+				t.Errorf("%s[%d] = %+v, want %+v", section, i, got[section][i], changes[i])
+			}
+		}
+	}
+}
+
+func TestCompareComponentBaseline(t *testing.T) {
+	// Component-only baselines have no variables; only product fields are compared
+	old := baselineManifest()
+	cur := baselineManifest()
+	cur.Variables = map[string]string{"INSTALLDIR": "Other"}
+	d := Compare(old, cur)
+	if len(d.Properties) != 0 {
+		t.Errorf("expected no property changes, got %+v", d.Properties)
+	}
+}
@@ -0,0 +1,250 @@
+// Package manifest records the contents of a generated installer as JSON.
+// A manifest saved from one release serves as the baseline for checking the
+// next release against Windows Installer component rules, and as the input
+// for the SBOM handed to compliance.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gersonkurz/msis/internal/generator"
+)
+
+// Manifest is the machine-readable record of a generated installer.
+type Manifest struct {
+	Product       Product           `json:"product"`
+	Features      []string          `json:"features"`
+	Components    []Component       `json:"components"`
+	Files         []File            `json:"files,omitempty"`
+	Registry      []RegistryValue   `json:"registry,omitempty"`
+	Services      []Service         `json:"services,omitempty"`
+	Shortcuts     []Shortcut        `json:"shortcuts,omitempty"`
+	Prerequisites []Prerequisite    `json:"prerequisites,omitempty"`
+	Variables     map[string]string `json:"variables,omitempty"`
+}
+
+// Product identifies the installer the manifest was produced for.
+type Product struct {
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	UpgradeCode  string `json:"upgradeCode"`
+	Platform     string `json:"platform"`
+}
+
+// Component is a single Windows Installer component.
+type Component struct {
+	ID        string   `json:"id"`
+	GUID      string   `json:"guid"`
+	Kind      string   `json:"kind"`
+	Directory string   `json:"directory,omitempty"`
+	KeyPath   string   `json:"keyPath"`
+	Features  []string `json:"features,omitempty"`
+}
+
+// File is an installed payload file.
+type File struct {
+	Source        string     `json:"source"`
+	Target        string     `json:"target"`
+	Features      []string   `json:"features,omitempty"`
+	ComponentID   string     `json:"componentId"`
+	ComponentGUID string     `json:"componentGuid"`
+	Size          int64      `json:"size"`
+	SHA256        string     `json:"sha256,omitempty"`
+	Version       *PEVersion `json:"version,omitempty"`
+}
+
+// RegistryValue is a registry value written during install.
+type RegistryValue struct {
+	Root      string   `json:"root"`
+	Key       string   `json:"key"`
+	Name      string   `json:"name,omitempty"`
+	Type      string   `json:"type"`
+	Value     string   `json:"value"`
+	Component string   `json:"component"`
+	Features  []string `json:"features,omitempty"`
+}
+
+// Service is an installed Windows service.
+type Service struct {
+	Name        string   `json:"name"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Start       string   `json:"start"`
+	File        string   `json:"file"`
+	Features    []string `json:"features,omitempty"`
+}
+
+// Shortcut is a Desktop or Start Menu shortcut.
+type Shortcut struct {
+	Name     string   `json:"name"`
+	Folder   string   `json:"folder"`
+	Target   string   `json:"target"`
+	Features []string `json:"features,omitempty"`
+}
+
+// Prerequisite is a runtime requirement declared with <requires>.
+type Prerequisite struct {
+	Type    string `json:"type"`
+	Version string `json:"version,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Build creates a manifest from a generator context after Generate has run.
+// File sizes, hashes and version resources are not read; call AddFileDetails
+// for a full build manifest.
+func Build(ctx *generator.Context) *Manifest {
+	vars := ctx.Variables
+	m := &Manifest{
+		Product: Product{
+			Name:         vars.ProductName(),
+			Version:      vars.ProductVersion(),
+			Manufacturer: vars.Manufacturer(),
+			UpgradeCode:  vars.UpgradeCode(),
+			Platform:     vars.Platform(),
+		},
+		Features: ctx.FeatureNames(),
+	}
+	owners := ctx.ComponentOwners()
+
+	for _, info := range ctx.Components() {
+		m.Components = append(m.Components, Component{
+			ID:        info.ID,
+			GUID:      info.GUID,
+			Kind:      info.Kind,
+			Directory: info.Directory,
+			KeyPath:   info.KeyPath,
+			Features:  info.Features,
+		})
+	}
+
+	for _, file := range ctx.Files() {
+		m.Files = append(m.Files, File{
+			Source:        file.SourcePath,
+			Target:        file.Target,
+			Features:      file.Features,
+			ComponentID:   file.ComponentID,
+			ComponentGUID: file.ComponentGUID,
+		})
+	}
+
+	for _, comp := range ctx.RegistryComponents {
+		features := owners[comp.ID]
+		for _, val := range comp.AllValues() {
+			m.Registry = append(m.Registry, RegistryValue{
+				Root:      val.Root,
+				Key:       val.Key,
+				Name:      val.Name,
+				Type:      val.Type,
+				Value:     val.Value,
+				Component: comp.ID,
+				Features:  features,
+			})
+		}
+	}
+
+	for _, svc := range ctx.Services() {
+		m.Services = append(m.Services, Service{
+			Name:        svc.Service.Name,
+			DisplayName: svc.Service.DisplayName,
+			Description: svc.Service.Description,
+			Start:       svc.Service.Start,
+			File:        svc.Service.FileName,
+			Features:    svc.Features,
+		})
+	}
+
+	addShortcuts := func(shortcuts []*generator.ShortcutComponent, folder string) {
+		for _, sc := range shortcuts {
+			m.Shortcuts = append(m.Shortcuts, Shortcut{
+				Name:     sc.Shortcut.Name,
+				Folder:   folder,
+				Target:   sc.Shortcut.Target,
+				Features: owners[sc.ID],
+			})
+		}
+	}
+	addShortcuts(ctx.DesktopShortcuts, "DESKTOP")
+	addShortcuts(ctx.StartMenuShortcuts, "STARTMENU")
+
+	for _, req := range ctx.Setup.Requires {
+		m.Prerequisites = append(m.Prerequisites, Prerequisite{Type: req.Type, Version: req.Version, Source: req.Source})
+	}
+
+	m.Variables = make(map[string]string, len(vars))
+	for name, value := range vars {
+		m.Variables[name] = value
+	}
+
+	return m
+}
+
+// AddFileDetails fills in size, SHA-256 and PE version resources for every
+// payload file. Relative source paths are resolved against workDir.
+// Missing files are reported as an error, since the MSI could not be built either.
+func (m *Manifest) AddFileDetails(workDir string) error {
+	for i := range m.Files {
+		file := &m.Files[i]
+		path := file.Source
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workDir, path)
+		}
+
+		size, hash, err := hashFile(path)
+		if err != nil {
+			return fmt.Errorf("reading payload file: %w", err)
+		}
+		file.Size = size
+		file.SHA256 = hash
+		file.Version = ReadPEVersion(path)
+	}
+	return nil
+}
+
+// hashFile returns the size and hex-encoded SHA-256 of a file.
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Load reads a manifest from a JSON file.
+func Load(filename string) (*Manifest, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", filename, err)
+	}
+	return &m, nil
+}
+
+// Save writes the manifest as indented JSON.
+func (m *Manifest) Save(filename string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func buildTestManifest(t *testing.T) (*Manifest, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "bin"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "bin", "app.exe"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	setup := &ir.Setup{
+		Requires: []ir.Requirement{{Type: "vcredist", Version: "2022"}},
+		Features: []ir.Feature{
+			{
+				Name:    "Main",
+				Enabled: true,
+				Items: []ir.Item{
+					ir.Files{Source: "bin", Target: "[INSTALLDIR]"},
+					ir.Shortcut{Name: "App", Target: "DESKTOP", File: "[INSTALLDIR]app.exe"},
+				},
+			},
+		},
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = "MyApp"
+	vars["PRODUCT_NAME"] = "MyApp"
+	vars["PRODUCT_VERSION"] = "1.2.3"
+	vars["UPGRADE_CODE"] = "{11111111-2222-3333-4444-555555555555}"
+
+	ctx := generator.NewContext(setup, vars, tmpDir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	return Build(ctx), tmpDir
+}
+
+func TestBuildManifestContents(t *testing.T) {
+	m, tmpDir := buildTestManifest(t)
+
+	if len(m.Files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(m.Files))
+	}
+	file := m.Files[0]
+	if file.Target != "[INSTALLDIR]app.exe" {
+		t.Errorf("Target = %q, want %q", file.Target, "[INSTALLDIR]app.exe")
+	}
+	if file.ComponentID == "" || file.ComponentGUID == "" {
+		t.Errorf("expected component ID and GUID, got %+v", file)
+	}
+	if len(file.Features) != 1 || file.Features[0] != "Main" {
+		t.Errorf("Features = %v, want [Main]", file.Features)
+	}
+
+	if len(m.Shortcuts) != 1 || m.Shortcuts[0].Folder != "DESKTOP" {
+		t.Errorf("expected one desktop shortcut, got %+v", m.Shortcuts)
+	}
+	if len(m.Prerequisites) != 1 || m.Prerequisites[0].Type != "vcredist" {
+		t.Errorf("expected vcredist prerequisite, got %+v", m.Prerequisites)
+	}
+	if m.Variables["PRODUCT_VERSION"] != "1.2.3" {
+		t.Errorf("Variables[PRODUCT_VERSION] = %q, want 1.2.3", m.Variables["PRODUCT_VERSION"])
+	}
+
+	if err := m.AddFileDetails(tmpDir); err != nil {
+		t.Fatalf("AddFileDetails failed: %v", err)
+	}
+	file = m.Files[0]
+	if file.Size != 5 {
+		t.Errorf("Size = %d, want 5", file.Size)
+	}
+	// sha256("hello")
+	if file.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("SHA256 = %s", file.SHA256)
+	}
+	if file.Version != nil {
+		t.Errorf("expected no version for non-PE file, got %+v", file.Version)
+	}
+}
+
+func TestAddFileDetailsMissingFile(t *testing.T) {
+	m := &Manifest{Files: []File{{Source: "missing.exe"}}}
+	if err := m.AddFileDetails(t.TempDir()); err == nil {
+		t.Error("expected error for missing payload file")
+	}
+}
+
+func TestSBOM(t *testing.T) {
+	m, tmpDir := buildTestManifest(t)
+	if err := m.AddFileDetails(tmpDir); err != nil {
+		t.Fatalf("AddFileDetails failed: %v", err)
+	}
+	m.Files[0].Version = &PEVersion{FileVersion: "1.2.3.4", ProductVersion: "1.2.0.0", Strings: map[string]string{"CompanyName": "ACME"}}
+
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	data, err := m.SBOM(timestamp)
+	if err != nil {
+		t.Fatalf("SBOM failed: %v", err)
+	}
+
+	var doc cdxDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("SBOM is not valid JSON: %v", err)
+	}
+	if doc.BOMFormat != "CycloneDX" || doc.SpecVersion != "1.5" {
+		t.Errorf("unexpected format %s %s", doc.BOMFormat, doc.SpecVersion)
+	}
+	if doc.Metadata.Timestamp != "2026-01-02T03:04:05Z" {
+		t.Errorf("Timestamp = %s", doc.Metadata.Timestamp)
+	}
+	if doc.Metadata.Component.Name != "MyApp" || doc.Metadata.Component.Version != "1.2.3" {
+		t.Errorf("unexpected product component %+v", doc.Metadata.Component)
+	}
+
+	var file *cdxComponent
+	for i := range doc.Components {
+		if doc.Components[i].Type == "file" {
+			file = &doc.Components[i]
+		}
+	}
+	if file == nil {
+		t.Fatal("expected a file component")
+	}
+	if file.Name != "app.exe" || file.Version != "1.2.3.4" {
+		t.Errorf("unexpected file component %+v", file)
+	}
+	if file.Supplier == nil || file.Supplier.Name != "ACME" {
+		t.Errorf("expected supplier from version resource, got %+v", file.Supplier)
+	}
+	if len(file.Hashes) != 1 || file.Hashes[0].Alg != "SHA-256" {
+		t.Errorf("expected SHA-256 hash, got %+v", file.Hashes)
+	}
+	if len(doc.Dependencies) != 1 || len(doc.Dependencies[0].DependsOn) != 1 {
+		t.Errorf("expected prerequisite dependency, got %+v", doc.Dependencies)
+	}
+
+	// Requirements of the same prerequisite share one component
+	m.Prerequisites = append(m.Prerequisites, m.Prerequisites[0], Prerequisite{Type: "netfx"}, Prerequisite{Type: "netfx"})
+	deduped, err := m.SBOM(timestamp)
+	if err != nil {
+		t.Fatalf("SBOM failed: %v", err)
+	}
+	var doc3 cdxDocument
+	if err := json.Unmarshal(deduped, &doc3); err != nil {
+		t.Fatal(err)
+	}
+	refs := make(map[string]bool)
+	for _, c := range doc3.Components {
+		if refs[c.BOMRef] {
+			t.Errorf("bom-ref %s is not unique", c.BOMRef)
+		}
+		refs[c.BOMRef] = true
+	}
+	if len(doc3.Dependencies) != 1 || len(doc3.Dependencies[0].DependsOn) != 2 {
+		t.Errorf("expected two prerequisite dependencies, got %+v", doc3.Dependencies)
+	}
+	m.Prerequisites = m.Prerequisites[:1]
+
+	// Same release, same serial number
+	again, _ := m.SBOM(timestamp.Add(time.Hour))
+	var doc2 cdxDocument
+	if err := json.Unmarshal(again, &doc2); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SerialNumber != doc2.SerialNumber || !strings.HasPrefix(doc.SerialNumber, "urn:uuid:") {
+		t.Errorf("serial numbers differ or malformed: %s vs %s", doc.SerialNumber, doc2.SerialNumber)
+	}
+}
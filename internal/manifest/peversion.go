@@ -0,0 +1,234 @@
+package manifest
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// PEVersion holds the version resource of a PE file (.exe, .dll, .sys).
+type PEVersion struct {
+	FileVersion    string            `json:"fileVersion"`
+	ProductVersion string            `json:"productVersion"`
+	Strings        map[string]string `json:"strings,omitempty"` // StringFileInfo entries, e.g. CompanyName
+}
+
+const (
+	rtVersion          = 16 // RT_VERSION resource type
+	fixedFileInfoMagic = 0xFEEF04BD
+)
+
+// ReadPEVersion returns the version resource of a PE file, or nil if the
+// file is not a PE image or carries no version resource.
+func ReadPEVersion(path string) *PEVersion {
+	f, err := pe.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	data := versionResource(f)
+	if data == nil {
+		return nil
+	}
+	return parseVersionInfo(data)
+}
+
+// versionResource locates the first RT_VERSION resource in the image.
+func versionResource(f *pe.File) []byte {
+	var dirs []pe.DataDirectory
+	switch oh := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = oh.DataDirectory[:oh.NumberOfRvaAndSizes]
+	case *pe.OptionalHeader64:
+		dirs = oh.DataDirectory[:oh.NumberOfRvaAndSizes]
+	}
+	if len(dirs) <= pe.IMAGE_DIRECTORY_ENTRY_RESOURCE {
+		return nil
+	}
+	rsrc := dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE]
+	if rsrc.VirtualAddress == 0 {
+		return nil
+	}
+
+	section := sectionForRVA(f, rsrc.VirtualAddress)
+	if section == nil {
+		return nil
+	}
+	sdata, err := section.Data()
+	if err != nil {
+		return nil
+	}
+	base := rsrc.VirtualAddress - section.VirtualAddress
+
+	// Resource tree: type -> name -> language -> data entry
+	offset, ok := findResourceEntry(sdata, base, base, rtVersion)
+	for level := 0; ok && level < 2; level++ {
+		offset, ok = findResourceEntry(sdata, base, offset, -1)
+	}
+	if !ok || int(offset)+16 > len(sdata) {
+		return nil
+	}
+
+	rva := binary.LittleEndian.Uint32(sdata[offset:])
+	size := binary.LittleEndian.Uint32(sdata[offset+4:])
+	target := sectionForRVA(f, rva)
+	if target == nil {
+		return nil
+	}
+	tdata, err := target.Data()
+	if err != nil {
+		return nil
+	}
+	start := rva - target.VirtualAddress
+	if uint64(start)+uint64(size) > uint64(len(tdata)) {
+		return nil
+	}
+	return tdata[start : start+size]
+}
+
+// findResourceEntry scans the resource directory at dirOffset for the entry
+// with the given ID (or the first entry if id is -1) and returns the offset
+// of the subdirectory or data entry it points to.
+func findResourceEntry(data []byte, base, dirOffset uint32, id int) (uint32, bool) {
+	if int(dirOffset)+16 > len(data) {
+		return 0, false
+	}
+	named := binary.LittleEndian.Uint16(data[dirOffset+12:])
+	ids := binary.LittleEndian.Uint16(data[dirOffset+14:])
+	for i := 0; i < int(named)+int(ids); i++ {
+		entry := int(dirOffset) + 16 + i*8
+		if entry+8 > len(data) {
+			return 0, false
+		}
+		name := binary.LittleEndian.Uint32(data[entry:])
+		target := binary.LittleEndian.Uint32(data[entry+4:])
+		if id >= 0 && (name&0x80000000 != 0 || int(name) != id) {
+			continue
+		}
+		return base + target&0x7FFFFFFF, true
+	}
+	return 0, false
+}
+
+func sectionForRVA(f *pe.File, rva uint32) *pe.Section {
+	for _, s := range f.Sections {
+		if rva >= s.VirtualAddress && rva < s.VirtualAddress+s.VirtualSize {
+			return s
+		}
+	}
+	return nil
+}
+
+// versionBlock is one node of a VS_VERSIONINFO structure.
+type versionBlock struct {
+	key      string
+	value    []byte
+	isText   bool
+	children []byte
+}
+
+// readVersionBlock decodes the block header at the start of data and returns
+// the block and its total (aligned) length.
+func readVersionBlock(data []byte) (versionBlock, int, error) {
+	if len(data) < 6 {
+		return versionBlock{}, 0, fmt.Errorf("truncated version block")
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	valueLength := int(binary.LittleEndian.Uint16(data[2:]))
+	isText := binary.LittleEndian.Uint16(data[4:]) == 1
+	if length < 6 || length > len(data) {
+		return versionBlock{}, 0, fmt.Errorf("invalid version block length %d", length)
+	}
+	block := data[:length]
+
+	key, pos := readUTF16String(block, 6)
+	pos = align4(pos)
+
+	valueBytes := valueLength
+	if isText {
+		valueBytes *= 2
+	}
+	if pos+valueBytes > length {
+		valueBytes = length - pos
+	}
+	b := versionBlock{key: key, value: block[pos : pos+valueBytes], isText: isText}
+	pos = align4(pos + valueBytes)
+	if pos < length {
+		b.children = block[pos:]
+	}
+	return b, align4(length), nil
+}
+
+// eachVersionBlock calls visit for every block in a sequence of siblings.
+func eachVersionBlock(data []byte, visit func(versionBlock)) {
+	for len(data) >= 6 {
+		b, n, err := readVersionBlock(data)
+		if err != nil {
+			return
+		}
+		visit(b)
+		if n >= len(data) {
+			return
+		}
+		data = data[n:]
+	}
+}
+
+// parseVersionInfo decodes a VS_VERSIONINFO resource.
+func parseVersionInfo(data []byte) *PEVersion {
+	root, _, err := readVersionBlock(data)
+	if err != nil || root.key != "VS_VERSION_INFO" || len(root.value) < 52 {
+		return nil
+	}
+	fixed := root.value
+	if binary.LittleEndian.Uint32(fixed) != fixedFileInfoMagic {
+		return nil
+	}
+	v := &PEVersion{
+		FileVersion:    formatVersion(binary.LittleEndian.Uint32(fixed[8:]), binary.LittleEndian.Uint32(fixed[12:])),
+		ProductVersion: formatVersion(binary.LittleEndian.Uint32(fixed[16:]), binary.LittleEndian.Uint32(fixed[20:])),
+	}
+
+	eachVersionBlock(root.children, func(info versionBlock) {
+		if info.key != "StringFileInfo" {
+			return
+		}
+		// Only the first string table (language) is recorded
+		eachVersionBlock(info.children, func(table versionBlock) {
+			if v.Strings != nil {
+				return
+			}
+			v.Strings = make(map[string]string)
+			eachVersionBlock(table.children, func(entry versionBlock) {
+				value, _ := readUTF16String(entry.value, 0)
+				v.Strings[entry.key] = value
+			})
+		})
+	})
+	return v
+}
+
+func formatVersion(ms, ls uint32) string {
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xFFFF, ls>>16, ls&0xFFFF)
+}
+
+// readUTF16String reads a NUL-terminated UTF-16LE string starting at pos and
+// returns it together with the position after the terminator.
+func readUTF16String(data []byte, pos int) (string, int) {
+	var units []uint16
+	for pos+1 < len(data) {
+		u := binary.LittleEndian.Uint16(data[pos:])
+		pos += 2
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units)), pos
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
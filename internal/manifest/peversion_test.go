@@ -0,0 +1,105 @@
+package manifest
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// versionBlockBytes encodes a VS_VERSIONINFO node the way the resource compiler does.
+func versionBlockBytes(key string, value []byte, valueLength uint16, isText bool, children ...[]byte) []byte {
+	var buf []byte
+	buf = append(buf, 0, 0) // wLength, patched below
+	buf = binary.LittleEndian.AppendUint16(buf, valueLength)
+	if isText {
+		buf = binary.LittleEndian.AppendUint16(buf, 1)
+	} else {
+		buf = binary.LittleEndian.AppendUint16(buf, 0)
+	}
+	buf = append(buf, utf16z(key)...)
+	for len(buf)%4 != 0 {
+		buf = append(buf, 0)
+	}
+	buf = append(buf, value...)
+	for _, child := range children {
+		for len(buf)%4 != 0 {
+			buf = append(buf, 0)
+		}
+		buf = append(buf, child...)
+	}
+	binary.LittleEndian.PutUint16(buf, uint16(len(buf)))
+	return buf
+}
+
+func utf16z(s string) []byte {
+	var buf []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		buf = binary.LittleEndian.AppendUint16(buf, u)
+	}
+	return append(buf, 0, 0)
+}
+
+func testVersionInfo() []byte {
+	fixed := make([]byte, 52)
+	binary.LittleEndian.PutUint32(fixed[0:], fixedFileInfoMagic)
+	binary.LittleEndian.PutUint32(fixed[8:], 1<<16|2)  // 1.2
+	binary.LittleEndian.PutUint32(fixed[12:], 3<<16|4) // .3.4
+	binary.LittleEndian.PutUint32(fixed[16:], 5<<16|0)
+	binary.LittleEndian.PutUint32(fixed[20:], 0)
+
+	text := func(key, value string) []byte {
+		return versionBlockBytes(key, utf16z(value), uint16(len([]rune(value))+1), true)
+	}
+	table := versionBlockBytes("040904b0", nil, 0, true,
+		text("CompanyName", "ACME"),
+		text("ProductName", "Widget"))
+	stringInfo := versionBlockBytes("StringFileInfo", nil, 0, true, table)
+	return versionBlockBytes("VS_VERSION_INFO", fixed, 52, false, stringInfo)
+}
+
+func TestParseVersionInfo(t *testing.T) {
+	v := parseVersionInfo(testVersionInfo())
+	if v == nil {
+		t.Fatal("parseVersionInfo returned nil")
+	}
+	if v.FileVersion != "1.2.3.4" {
+		t.Errorf("FileVersion = %q, want 1.2.3.4", v.FileVersion)
+	}
+	if v.ProductVersion != "5.0.0.0" {
+		t.Errorf("ProductVersion = %q, want 5.0.0.0", v.ProductVersion)
+	}
+	if v.Strings["CompanyName"] != "ACME" || v.Strings["ProductName"] != "Widget" {
+		t.Errorf("Strings = %v", v.Strings)
+	}
+}
+
+func TestParseVersionInfoInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated", []byte{0x10, 0x00}},
+		{"wrong key", versionBlockBytes("SOMETHING_ELSE", make([]byte, 52), 52, false)},
+		{"bad signature", versionBlockBytes("VS_VERSION_INFO", make([]byte, 52), 52, false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v := parseVersionInfo(tt.data); v != nil {
+				t.Errorf("expected nil, got %+v", v)
+			}
+		})
+	}
+}
+
+func TestReadPEVersionNonPE(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "readme.txt")
+	if err := os.WriteFile(path, []byte("not a PE file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if v := ReadPEVersion(path); v != nil {
+		t.Errorf("expected nil for non-PE file, got %+v", v)
+	}
+}
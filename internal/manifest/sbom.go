@@ -0,0 +1,173 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// CycloneDX 1.5 document, reduced to the fields msis fills in.
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies,omitempty"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     []cdxTool    `json:"tools,omitempty"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTool struct {
+	Name string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Supplier   *cdxSupplier  `json:"supplier,omitempty"`
+	Hashes     []cdxHash     `json:"hashes,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxSupplier struct {
+	Name string `json:"name"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// SBOM returns the manifest as a CycloneDX 1.5 JSON document. Every payload
+// file becomes a "file" component with its hash and PE version; prerequisites
+// become dependencies of the product. The serial number is derived from the
+// upgrade code and version so rebuilding the same release yields the same ID.
+func (m *Manifest) SBOM(timestamp time.Time) ([]byte, error) {
+	productRef := "product"
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + nameUUID(m.Product.UpgradeCode+"/"+m.Product.Version),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: timestamp.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Name: "msis"}},
+			Component: cdxComponent{
+				Type:    "application",
+				BOMRef:  productRef,
+				Name:    m.Product.Name,
+				Version: m.Product.Version,
+				Properties: []cdxProperty{
+					{Name: "msis:upgradeCode", Value: m.Product.UpgradeCode},
+					{Name: "msis:platform", Value: m.Product.Platform},
+				},
+			},
+		},
+		Components: []cdxComponent{},
+	}
+	if m.Product.Manufacturer != "" {
+		doc.Metadata.Component.Supplier = &cdxSupplier{Name: m.Product.Manufacturer}
+	}
+
+	var dependsOn []string
+	for i, file := range m.Files {
+		comp := cdxComponent{
+			Type:   "file",
+			BOMRef: fmt.Sprintf("file-%d", i+1),
+			Name:   targetFileName(file.Target),
+			Properties: []cdxProperty{
+				{Name: "msis:target", Value: file.Target},
+				{Name: "msis:source", Value: file.Source},
+				{Name: "msis:size", Value: fmt.Sprintf("%d", file.Size)},
+			},
+		}
+		if file.SHA256 != "" {
+			comp.Hashes = []cdxHash{{Alg: "SHA-256", Content: file.SHA256}}
+		}
+		if file.Version != nil {
+			comp.Version = file.Version.FileVersion
+			if company := file.Version.Strings["CompanyName"]; company != "" {
+				comp.Supplier = &cdxSupplier{Name: company}
+			}
+		}
+		for _, feature := range file.Features {
+			comp.Properties = append(comp.Properties, cdxProperty{Name: "msis:feature", Value: feature})
+		}
+		doc.Components = append(doc.Components, comp)
+	}
+
+	// A bom-ref must be unique; a prerequisite required twice is one component
+	seen := make(map[string]bool)
+	for _, req := range m.Prerequisites {
+		ref := "prerequisite-" + req.Type
+		if req.Version != "" {
+			ref += "-" + req.Version
+		}
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		doc.Components = append(doc.Components, cdxComponent{
+			Type:    "framework",
+			BOMRef:  ref,
+			Name:    req.Type,
+			Version: req.Version,
+		})
+		dependsOn = append(dependsOn, ref)
+	}
+	if len(dependsOn) > 0 {
+		doc.Dependencies = []cdxDependency{{Ref: productRef, DependsOn: dependsOn}}
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding SBOM: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// SaveSBOM writes the CycloneDX SBOM to filename.
+func (m *Manifest) SaveSBOM(filename string, timestamp time.Time) error {
+	data, err := m.SBOM(timestamp)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("writing SBOM: %w", err)
+	}
+	return nil
+}
+
+// targetFileName returns the file name part of a target path like "[INSTALLDIR]bin\app.exe".
+func targetFileName(target string) string {
+	return target[strings.LastIndexAny(target, "]\\")+1:]
+}
+
+// nameUUID returns a name-based UUID (version 5 layout, SHA-256 digest) for s.
+func nameUUID(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	hash[6] = (hash[6] & 0x0f) | 0x50
+	hash[8] = (hash[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", hash[0:4], hash[4:6], hash[6:8], hash[8:10], hash[10:16])
+}
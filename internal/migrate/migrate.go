@@ -0,0 +1,206 @@
+// Package migrate rewrites msis-2.x setups in the msis-3.x style.
+//
+// msis-3.x still reads most 2.x files, but some constructs only survive as
+// warnings: the INCLUDE_VC* variables that pulled in merge modules, VC++
+// runtime files copied next to the application and the attribute shorthand
+// of <bundle>. Setup replaces them with their 3.x equivalents and lists what
+// needs a human decision.
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// Result describes a migration.
+type Result struct {
+	Changes   []string // What was rewritten
+	FollowUps []string // What remains to be done by hand
+}
+
+// vcRedistVersion is the VC++ runtime that replaces every 2.x way of
+// shipping one; it is backward-compatible down to VC++ 2015.
+const vcRedistVersion = "2022"
+
+// deprecatedFollowUps are the manual steps left after replacing a
+// deprecated variable with <requires type="vcredist">.
+var deprecatedFollowUps = map[string]string{
+	"INCLUDE_VC100": "INCLUDE_VC100 installed the VC++ 2010 runtime, which the 2015-2022 runtime does not replace; rebuild the application with a current toolset, or add the 2010 redistributable as <exe> package of a <bundle>.",
+	"INCLUDE_MFC":   "INCLUDE_MFC installed the MFC merge modules; the VC++ 2015-2022 runtime contains MFC 14, older MFC versions need their merge module in a feature with <merge-module source=\"...\"/>.",
+}
+
+// runtimeDLL matches the file names of VC++ runtime DLLs.
+var runtimeDLL = regexp.MustCompile(`^(msvc[pr]\d+|vcruntime\d+|concrt\d+|vcomp\d+|mfc\d+u?)(_\w+)?\.dll$`)
+
+// IsVCRuntime reports whether a <files> item copies the VC++ runtime: its
+// source is a vc_redist folder or a runtime DLL.
+func IsVCRuntime(f ir.Files) bool {
+	source := strings.ToLower(f.Source)
+	if strings.Contains(source, "vc_redist") || strings.Contains(source, "vcredist") {
+		return true
+	}
+	return runtimeDLL.MatchString(source[strings.LastIndexAny(source, `\/`)+1:])
+}
+
+// CopiesVCRuntime reports whether any <files> item of a setup copies the
+// VC++ runtime.
+func CopiesVCRuntime(setup *ir.Setup) bool {
+	return slices.ContainsFunc(setup.Items, isVCRuntimeItem) || featuresCopyVCRuntime(setup.Features)
+}
+
+func featuresCopyVCRuntime(features []ir.Feature) bool {
+	for _, f := range features {
+		if slices.ContainsFunc(f.Items, isVCRuntimeItem) || featuresCopyVCRuntime(f.SubFeatures) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVCRuntimeItem(item ir.Item) bool {
+	f, ok := item.(ir.Files)
+	return ok && IsVCRuntime(f)
+}
+
+// VCRuntimeFolder is where msis-2.x projects kept the VC++ runtime, relative
+// to the .msis file.
+var VCRuntimeFolder = filepath.Join("Setup", "Tools", "vc_redist")
+
+// HasVCRuntimeFolder reports whether the folder of an .msis file still has
+// the msis-2.x VC++ runtime folder.
+func HasVCRuntimeFolder(dir string) bool {
+	info, err := os.Stat(filepath.Join(dir, VCRuntimeFolder))
+	return err == nil && info.IsDir()
+}
+
+// Setup migrates a setup in place.
+func Setup(setup *ir.Setup) *Result {
+	m := &migration{setup: setup, res: &Result{}}
+	m.deprecatedVariables()
+	m.runtimeFiles()
+	m.legacyBundle()
+	return m.res
+}
+
+type migration struct {
+	setup *ir.Setup
+	res   *Result
+}
+
+func (m *migration) change(format string, args ...any) {
+	m.res.Changes = append(m.res.Changes, fmt.Sprintf(format, args...))
+}
+
+func (m *migration) followUp(format string, args ...any) {
+	m.res.FollowUps = append(m.res.FollowUps, fmt.Sprintf(format, args...))
+}
+
+// deprecatedVariables removes the <set> of every deprecated variable; a
+// variable that is switched on becomes <requires type="vcredist">.
+func (m *migration) deprecatedVariables() {
+	for _, dep := range variables.DeprecatedVariables {
+		sets := m.removeSets(dep.Name)
+		if len(sets) == 0 {
+			continue
+		}
+		// The last <set> wins, as in variable resolution
+		last := sets[len(sets)-1]
+		if !(variables.Dictionary{dep.Name: last.Value}).GetBool(dep.Name) {
+			m.change("removed %s=%s, which msis-3.x ignores", dep.Name, last.Value)
+			continue
+		}
+		m.change("replaced %s=%s by %s", dep.Name, last.Value, m.requireVCRedist())
+		if msg, ok := deprecatedFollowUps[dep.Name]; ok {
+			m.followUp("%s", msg)
+		}
+	}
+}
+
+// removeSets removes the <set> elements of a variable and returns them.
+func (m *migration) removeSets(name string) []ir.Set {
+	var removed []ir.Set
+	kept := m.setup.Sets[:0]
+	for _, s := range m.setup.Sets {
+		if s.Name == name {
+			removed = append(removed, s)
+		} else {
+			kept = append(kept, s)
+		}
+	}
+	m.setup.Sets = kept
+	return removed
+}
+
+// requireVCRedist declares the VC++ runtime as requirement, or as
+// prerequisite of a bundle, unless it already is. It returns the element
+// that declares it.
+func (m *migration) requireVCRedist() string {
+	if b := m.setup.Bundle; b != nil {
+		for _, p := range b.Prerequisites {
+			if p.Type == "vcredist" {
+				return fmt.Sprintf(`<prerequisite type="vcredist" version="%s"/>`, p.Version)
+			}
+		}
+		b.Prerequisites = append(b.Prerequisites, ir.Prerequisite{Type: "vcredist", Version: vcRedistVersion})
+		return fmt.Sprintf(`<prerequisite type="vcredist" version="%s"/>`, vcRedistVersion)
+	}
+	for _, r := range m.setup.Requires {
+		if r.Type == "vcredist" {
+			return fmt.Sprintf(`<requires type="vcredist" version="%s"/>`, r.Version)
+		}
+	}
+	m.setup.Requires = append(m.setup.Requires, ir.Requirement{Type: "vcredist", Version: vcRedistVersion})
+	return fmt.Sprintf(`<requires type="vcredist" version="%s"/>`, vcRedistVersion)
+}
+
+// runtimeFiles removes the <files> items that copy the VC++ runtime and
+// requires the runtime instead.
+func (m *migration) runtimeFiles() {
+	var removed []string
+	m.setup.Items = removeRuntimeFiles(m.setup.Items, &removed)
+	var walk func(features []ir.Feature)
+	walk = func(features []ir.Feature) {
+		for i := range features {
+			features[i].Items = removeRuntimeFiles(features[i].Items, &removed)
+			walk(features[i].SubFeatures)
+		}
+	}
+	walk(m.setup.Features)
+	if len(removed) > 0 {
+		m.change("replaced the VC++ runtime files %s by %s", strings.Join(removed, ", "), m.requireVCRedist())
+	}
+}
+
+func removeRuntimeFiles(items []ir.Item, removed *[]string) []ir.Item {
+	kept := items[:0]
+	for _, item := range items {
+		if isVCRuntimeItem(item) {
+			*removed = append(*removed, item.(ir.Files).Source)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// legacyBundle moves the source attributes of <bundle> into a nested <msi>.
+func (m *migration) legacyBundle() {
+	b := m.setup.Bundle
+	if b == nil || b.Source64bit == "" && b.Source32bit == "" && b.SourceArm64 == "" {
+		return
+	}
+	if b.MSI != nil {
+		m.change("removed the source attributes of <bundle>, which the nested <msi> overrides")
+	} else {
+		b.MSI = &ir.BundleMSI{Source64bit: b.Source64bit, Source32bit: b.Source32bit, SourceArm64: b.SourceArm64}
+		m.change("moved the source attributes of <bundle> into a nested <msi>")
+	}
+	b.Source64bit, b.Source32bit, b.SourceArm64 = "", "", ""
+}
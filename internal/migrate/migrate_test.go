@@ -0,0 +1,162 @@
+package migrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/parser"
+)
+
+// migrateSource migrates .msis XML and returns the result in canonical form.
+func migrateSource(t *testing.T, source string) (*Result, string) {
+	t.Helper()
+	setup, err := parser.ParseBytes([]byte(source))
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	res := Setup(setup)
+	var b bytes.Buffer
+	if err := parser.Write(&b, setup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseBytes(b.Bytes()); err != nil {
+		t.Fatalf("migrated .msis does not parse: %v\n%s", err, b.String())
+	}
+	return res, b.String()
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    string
+		want      []string
+		notWant   []string
+		followUps int
+	}{
+		{
+			name: "deprecated variable",
+			source: `<setup>
+  <set name="PRODUCT_NAME" value="App"/>
+  <!-- runtime -->
+  <set name="INCLUDE_VCREDIST" value="True"/>
+</setup>`,
+			want:    []string{`<requires type="vcredist" version="2022"/>`},
+			notWant: []string{"INCLUDE_VCREDIST"},
+		},
+		{
+			name:    "deprecated variable switched off",
+			source:  `<setup><set name="INCLUDE_VC140" value="no"/></setup>`,
+			notWant: []string{"INCLUDE_VC140", "<requires"},
+		},
+		{
+			name:      "VC++ 2010 runtime",
+			source:    `<setup><set name="INCLUDE_VC100" value="1"/><set name="INCLUDE_VCREDIST" value="1"/></setup>`,
+			want:      []string{`<requires type="vcredist" version="2022"/>`},
+			followUps: 1,
+		},
+		{
+			name:      "MFC",
+			source:    `<setup><set name="INCLUDE_MFC" value="True"/></setup>`,
+			want:      []string{`<requires type="vcredist" version="2022"/>`},
+			notWant:   []string{"INCLUDE_MFC"},
+			followUps: 1,
+		},
+		{
+			name: "bundled runtime files",
+			source: `<setup>
+  <requires type="vcredist" version="2019"/>
+  <files source="bin" target="[INSTALLDIR]"/>
+  <feature name="Main">
+    <files source="Setup\Tools\vc_redist" target="[INSTALLDIR]"/>
+    <files source="redist\msvcp140.dll" target="[INSTALLDIR]"/>
+    <files source="redist\VCRUNTIME140_1.dll" target="[INSTALLDIR]"/>
+  </feature>
+</setup>`,
+			want:    []string{`<requires type="vcredist" version="2019"/>`, `<files source="bin" target="[INSTALLDIR]"/>`},
+			notWant: []string{"vc_redist", "msvcp140", "VCRUNTIME140_1", `version="2022"`},
+		},
+		{
+			name: "bundle shorthand",
+			source: `<setup>
+  <set name="INCLUDE_VCREDIST" value="True"/>
+  <bundle source_64bit="app-x64.msi" source_32bit="app-x86.msi"/>
+</setup>`,
+			want: []string{
+				"  <bundle>\n    <prerequisite type=\"vcredist\" version=\"2022\"/>\n    <msi source_64bit=\"app-x64.msi\" source_32bit=\"app-x86.msi\"/>\n  </bundle>",
+			},
+			notWant: []string{"<requires"},
+		},
+		{
+			name:    "install folder alias",
+			source:  `<setup><set name="INSTALL_FOLDER" value="Acme\App"/><create-folder target="[APPDATADIR]{{INSTALL_FOLDER}}"/></setup>`,
+			want:    []string{`<set name="INSTALL_FOLDER" value="Acme\App"/>`, `{{INSTALL_FOLDER}}`},
+			notWant: []string{"INSTALLDIR"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, migrated := migrateSource(t, tt.source)
+			for _, want := range tt.want {
+				if !strings.Contains(migrated, want) {
+					t.Errorf("migrated setup lacks %s:\n%s", want, migrated)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(migrated, notWant) {
+					t.Errorf("migrated setup still contains %s:\n%s", notWant, migrated)
+				}
+			}
+			if len(res.FollowUps) != tt.followUps {
+				t.Errorf("expected %d follow-up(s), got %q", tt.followUps, res.FollowUps)
+			}
+		})
+	}
+}
+
+func TestMigrateKeepsComments(t *testing.T) {
+	_, migrated := migrateSource(t, `<setup>
+  <!-- name -->
+  <set name="PRODUCT_NAME" value="App"/>
+  <!-- runtime -->
+  <set name="INCLUDE_VCREDIST" value="True"/>
+</setup>`)
+	if !strings.Contains(migrated, "<!-- name -->") {
+		t.Errorf("comment lost:\n%s", migrated)
+	}
+}
+
+func TestMigrateCurrentSetup(t *testing.T) {
+	res, _ := migrateSource(t, `<setup>
+  <set name="PRODUCT_NAME" value="App"/>
+  <requires type="vcredist" version="2022"/>
+  <files source="bin" target="[INSTALLDIR]"/>
+  <bundle><msi source="app.msi"/></bundle>
+</setup>`)
+	if len(res.Changes) != 0 || len(res.FollowUps) != 0 {
+		t.Errorf("a 3.x setup needs no migration, got %+v", res)
+	}
+}
+
+func TestIsVCRuntime(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{`Setup\Tools\vc_redist`, true},
+		{`redist\vcredist_x64.exe`, true},
+		{`bin\msvcp140.dll`, true},
+		{`bin/vcruntime140_1.dll`, true},
+		{`bin\mfc140u.dll`, true},
+		{`bin\msvcr100.dll`, true},
+		{`bin\app.dll`, false},
+		{`bin\msvcrt_helper.txt`, false},
+		{`bin`, false},
+	}
+	for _, tt := range tests {
+		if got := IsVCRuntime(ir.Files{Source: tt.source}); got != tt.want {
+			t.Errorf("IsVCRuntime(%q) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
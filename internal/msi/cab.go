@@ -0,0 +1,59 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// CabFile is an entry of a cabinet's file list.
+type CabFile struct {
+	Name     string    `json:"name"` // For MSI cabinets, the File table key
+	Size     uint32    `json:"size"`
+	Folder   int       `json:"folder"`
+	Modified time.Time `json:"modified"`
+}
+
+const (
+	cabHeaderSize      = 36
+	cabFileEntryHeader = 16
+)
+
+// ListCabinet returns the file list of a Microsoft cabinet. File data is not
+// decompressed.
+func ListCabinet(data []byte) ([]CabFile, error) {
+	if len(data) < cabHeaderSize || !bytes.Equal(data[:4], []byte("MSCF")) {
+		return nil, fmt.Errorf("not a cabinet file")
+	}
+	// coffFiles is an absolute offset, so optional header fields can be skipped
+	offset := int(binary.LittleEndian.Uint32(data[16:])) // coffFiles
+	count := int(binary.LittleEndian.Uint16(data[28:]))  // cFiles
+
+	files := make([]CabFile, 0, count)
+	for i := 0; i < count; i++ {
+		if offset+cabFileEntryHeader > len(data) {
+			return nil, fmt.Errorf("cabinet file list truncated")
+		}
+		entry := data[offset:]
+		nameEnd := bytes.IndexByte(entry[cabFileEntryHeader:], 0)
+		if nameEnd < 0 {
+			return nil, fmt.Errorf("cabinet file name not terminated")
+		}
+		files = append(files, CabFile{
+			Name:     string(entry[cabFileEntryHeader : cabFileEntryHeader+nameEnd]),
+			Size:     binary.LittleEndian.Uint32(entry[0:]),
+			Folder:   int(binary.LittleEndian.Uint16(entry[8:])),
+			Modified: dosTime(binary.LittleEndian.Uint16(entry[10:]), binary.LittleEndian.Uint16(entry[12:])),
+		})
+		offset += cabFileEntryHeader + nameEnd + 1
+	}
+	return files, nil
+}
+
+// dosTime converts an MS-DOS date and time to time.Time.
+func dosTime(date, clock uint16) time.Time {
+	return time.Date(
+		int(date>>9)+1980, time.Month(date>>5&0x0F), int(date&0x1F),
+		int(clock>>11), int(clock>>5&0x3F), int(clock&0x1F)*2, 0, time.UTC)
+}
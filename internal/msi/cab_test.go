@@ -0,0 +1,59 @@
+package msi
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// buildCabinetHeader writes a cabinet header, one folder and the file list.
+// File data is omitted; ListCabinet never reads it.
+func buildCabinetHeader(names []string, sizes []uint32) []byte {
+	buf := make([]byte, cabHeaderSize+8)
+	copy(buf, "MSCF")
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(buf))) // coffFiles
+	buf[24], buf[25] = 3, 1
+	binary.LittleEndian.PutUint16(buf[26:], 1)
+	binary.LittleEndian.PutUint16(buf[28:], uint16(len(names)))
+
+	date := uint16((2024-1980)<<9 | 3<<5 | 15) // 2024-03-15
+	clock := uint16(10<<11 | 30<<5 | 10)       // 10:30:20
+	for i, name := range names {
+		entry := make([]byte, cabFileEntryHeader)
+		binary.LittleEndian.PutUint32(entry[0:], sizes[i])
+		binary.LittleEndian.PutUint16(entry[10:], date)
+		binary.LittleEndian.PutUint16(entry[12:], clock)
+		buf = append(buf, entry...)
+		buf = append(buf, name...)
+		buf = append(buf, 0)
+	}
+	binary.LittleEndian.PutUint32(buf[8:], uint32(len(buf)))
+	return buf
+}
+
+func TestListCabinet(t *testing.T) {
+	files, err := ListCabinet(buildCabinetHeader([]string{"FILE_ID00000", "FILE_ID00001"}, []uint32{100, 2048}))
+	if err != nil {
+		t.Fatalf("ListCabinet failed: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	if files[1].Name != "FILE_ID00001" || files[1].Size != 2048 {
+		t.Errorf("unexpected entry %+v", files[1])
+	}
+	want := time.Date(2024, 3, 15, 10, 30, 20, 0, time.UTC)
+	if !files[0].Modified.Equal(want) {
+		t.Errorf("Modified = %v, want %v", files[0].Modified, want)
+	}
+}
+
+func TestListCabinetInvalid(t *testing.T) {
+	if _, err := ListCabinet([]byte("not a cabinet")); err == nil {
+		t.Error("expected error for non-cabinet data")
+	}
+	cab := buildCabinetHeader([]string{"FILE_ID00000"}, []uint32{1})
+	if _, err := ListCabinet(cab[:len(cab)-3]); err == nil {
+		t.Error("expected error for truncated file list")
+	}
+}
@@ -0,0 +1,269 @@
+// Package msi reads Windows Installer databases without Windows.
+// It implements the OLE compound file container, the MSI string pool and
+// table streams, and enough of the cabinet format to list embedded files.
+// Writing is limited to embedding transforms in a built MSI.
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Compound file constants (MS-CFB).
+const (
+	cfbHeaderSize    = 512
+	cfbDirEntrySize  = 128
+	cfbMaxRegSect    = 0xFFFFFFFA
+	cfbEndOfChain    = 0xFFFFFFFE
+	cfbFreeSect      = 0xFFFFFFFF
+	cfbNoStream      = 0xFFFFFFFF
+	cfbHeaderDIFAT   = 109
+	cfbTypeStorage   = 1
+	cfbTypeStream    = 2
+	cfbTypeRoot      = 5
+	cfbMaxChainSteps = 1 << 24 // Guards against FAT loops in corrupt files
+)
+
+var cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+// compoundFile is a parsed OLE compound file held in memory.
+type compoundFile struct {
+	data           []byte
+	sectorSize     int
+	miniSectorSize int
+	miniCutoff     uint32
+	fat            []uint32
+	miniFAT        []uint32
+	entries        []dirEntry
+	miniStream     []byte
+}
+
+// dirEntry is a directory entry of the compound file.
+type dirEntry struct {
+	name        string
+	objType     byte
+	colour      byte // 0 red, 1 black
+	left, right uint32
+	child       uint32
+	clsid       [16]byte
+	start       uint32
+	size        uint64
+}
+
+// openCompoundFile parses the container structure of data.
+func openCompoundFile(data []byte) (*compoundFile, error) {
+	if len(data) < cfbHeaderSize || !bytes.Equal(data[:8], cfbSignature) {
+		return nil, fmt.Errorf("not an OLE compound file")
+	}
+	if binary.LittleEndian.Uint16(data[28:]) != 0xFFFE {
+		return nil, fmt.Errorf("unsupported byte order")
+	}
+
+	cf := &compoundFile{
+		data:           data,
+		sectorSize:     1 << binary.LittleEndian.Uint16(data[30:]),
+		miniSectorSize: 1 << binary.LittleEndian.Uint16(data[32:]),
+		miniCutoff:     binary.LittleEndian.Uint32(data[56:]),
+	}
+	if cf.sectorSize != 512 && cf.sectorSize != 4096 {
+		return nil, fmt.Errorf("unsupported sector size %d", cf.sectorSize)
+	}
+
+	numFATSectors := binary.LittleEndian.Uint32(data[44:])
+	firstDirSector := binary.LittleEndian.Uint32(data[48:])
+	firstMiniFATSector := binary.LittleEndian.Uint32(data[60:])
+	firstDIFATSector := binary.LittleEndian.Uint32(data[68:])
+
+	// The DIFAT lists the sectors holding the FAT: 109 entries in the header,
+	// the rest in a chain of DIFAT sectors whose last entry links to the next
+	var fatSectors []uint32
+	for i := 0; i < cfbHeaderDIFAT; i++ {
+		sect := binary.LittleEndian.Uint32(data[76+i*4:])
+		if sect <= cfbMaxRegSect {
+			fatSectors = append(fatSectors, sect)
+		}
+	}
+	perSector := cf.sectorSize/4 - 1
+	for sect, steps := firstDIFATSector, 0; sect <= cfbMaxRegSect; steps++ {
+		if steps > cfbMaxChainSteps {
+			return nil, fmt.Errorf("DIFAT chain loops")
+		}
+		buf, err := cf.sector(sect)
+		if err != nil {
+			return nil, fmt.Errorf("reading DIFAT: %w", err)
+		}
+		for i := 0; i < perSector; i++ {
+			if entry := binary.LittleEndian.Uint32(buf[i*4:]); entry <= cfbMaxRegSect {
+				fatSectors = append(fatSectors, entry)
+			}
+		}
+		sect = binary.LittleEndian.Uint32(buf[perSector*4:])
+	}
+	if uint32(len(fatSectors)) < numFATSectors {
+		return nil, fmt.Errorf("FAT has %d sectors, header declares %d", len(fatSectors), numFATSectors)
+	}
+
+	for _, sect := range fatSectors {
+		buf, err := cf.sector(sect)
+		if err != nil {
+			return nil, fmt.Errorf("reading FAT: %w", err)
+		}
+		for i := 0; i < cf.sectorSize; i += 4 {
+			cf.fat = append(cf.fat, binary.LittleEndian.Uint32(buf[i:]))
+		}
+	}
+
+	dirData, err := cf.readChain(firstDirSector, -1)
+	if err != nil {
+		return nil, fmt.Errorf("reading directory: %w", err)
+	}
+	for off := 0; off+cfbDirEntrySize <= len(dirData); off += cfbDirEntrySize {
+		entry := parseDirEntry(dirData[off : off+cfbDirEntrySize])
+		if cf.sectorSize == 512 {
+			// Version 3 files may leave garbage in the high part of the size
+			entry.size &= 0xFFFFFFFF
+		}
+		cf.entries = append(cf.entries, entry)
+	}
+	if len(cf.entries) == 0 || cf.entries[0].objType != cfbTypeRoot {
+		return nil, fmt.Errorf("missing root directory entry")
+	}
+
+	if firstMiniFATSector <= cfbMaxRegSect {
+		miniFATData, err := cf.readChain(firstMiniFATSector, -1)
+		if err != nil {
+			return nil, fmt.Errorf("reading mini FAT: %w", err)
+		}
+		for i := 0; i+4 <= len(miniFATData); i += 4 {
+			cf.miniFAT = append(cf.miniFAT, binary.LittleEndian.Uint32(miniFATData[i:]))
+		}
+	}
+
+	root := cf.entries[0]
+	if root.start <= cfbMaxRegSect {
+		cf.miniStream, err = cf.readChain(root.start, int64(root.size))
+		if err != nil {
+			return nil, fmt.Errorf("reading mini stream: %w", err)
+		}
+	}
+
+	return cf, nil
+}
+
+func parseDirEntry(buf []byte) dirEntry {
+	nameLen := int(binary.LittleEndian.Uint16(buf[64:]))
+	if nameLen > 64 {
+		nameLen = 64
+	}
+	var units []uint16
+	for i := 0; i+1 < nameLen; i += 2 {
+		u := binary.LittleEndian.Uint16(buf[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	entry := dirEntry{
+		name:    string(utf16.Decode(units)),
+		objType: buf[66],
+		colour:  buf[67],
+		left:    binary.LittleEndian.Uint32(buf[68:]),
+		right:   binary.LittleEndian.Uint32(buf[72:]),
+		child:   binary.LittleEndian.Uint32(buf[76:]),
+		start:   binary.LittleEndian.Uint32(buf[116:]),
+		size:    binary.LittleEndian.Uint64(buf[120:]),
+	}
+	copy(entry.clsid[:], buf[80:96])
+	return entry
+}
+
+// sector returns the contents of a regular sector.
+func (cf *compoundFile) sector(sect uint32) ([]byte, error) {
+	off := (int64(sect) + 1) * int64(cf.sectorSize)
+	if off+int64(cf.sectorSize) > int64(len(cf.data)) {
+		return nil, fmt.Errorf("sector %d beyond end of file", sect)
+	}
+	return cf.data[off : off+int64(cf.sectorSize)], nil
+}
+
+// readChain concatenates a FAT sector chain. size < 0 reads the whole chain.
+func (cf *compoundFile) readChain(start uint32, size int64) ([]byte, error) {
+	var out []byte
+	for sect, steps := start, 0; sect <= cfbMaxRegSect; steps++ {
+		if steps > cfbMaxChainSteps || int(sect) >= len(cf.fat) {
+			return nil, fmt.Errorf("invalid sector chain")
+		}
+		buf, err := cf.sector(sect)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, buf...)
+		if size >= 0 && int64(len(out)) >= size {
+			break
+		}
+		sect = cf.fat[sect]
+	}
+	if size >= 0 {
+		if int64(len(out)) < size {
+			return nil, fmt.Errorf("stream truncated")
+		}
+		out = out[:size]
+	}
+	return out, nil
+}
+
+// readMiniChain reads a stream stored in the mini stream.
+func (cf *compoundFile) readMiniChain(start uint32, size int64) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for sect, steps := start, 0; sect <= cfbMaxRegSect && int64(len(out)) < size; steps++ {
+		if steps > cfbMaxChainSteps || int(sect) >= len(cf.miniFAT) {
+			return nil, fmt.Errorf("invalid mini sector chain")
+		}
+		off := int(sect) * cf.miniSectorSize
+		if off >= len(cf.miniStream) {
+			return nil, fmt.Errorf("mini sector %d beyond end of mini stream", sect)
+		}
+		end := min(off+cf.miniSectorSize, len(cf.miniStream))
+		out = append(out, cf.miniStream[off:end]...)
+		sect = cf.miniFAT[sect]
+	}
+	if int64(len(out)) < size {
+		return nil, fmt.Errorf("stream truncated")
+	}
+	return out[:size], nil
+}
+
+// rootStreams returns the streams stored directly in the root storage, keyed
+// by their raw (still encoded) names.
+func (cf *compoundFile) rootStreams() map[string]dirEntry {
+	result := make(map[string]dirEntry)
+	visited := make(map[uint32]bool)
+	var walk func(id uint32)
+	walk = func(id uint32) {
+		if id == cfbNoStream || int(id) >= len(cf.entries) || visited[id] {
+			return
+		}
+		visited[id] = true
+		entry := cf.entries[id]
+		if entry.objType == cfbTypeStream {
+			result[entry.name] = entry
+		}
+		walk(entry.left)
+		walk(entry.right)
+	}
+	walk(cf.entries[0].child)
+	return result
+}
+
+// readStream returns the contents of a stream.
+func (cf *compoundFile) readStream(entry dirEntry) ([]byte, error) {
+	if entry.size == 0 {
+		return nil, nil
+	}
+	if entry.size < uint64(cf.miniCutoff) {
+		return cf.readMiniChain(entry.start, int64(entry.size))
+	}
+	return cf.readChain(entry.start, int64(entry.size))
+}
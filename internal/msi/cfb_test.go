@@ -0,0 +1,227 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+)
+
+// testStream is a stream to be written by buildCompoundFile. The name is
+// the raw directory entry name, i.e. already MSI-encoded for MSI streams.
+type testStream struct {
+	name string
+	data []byte
+}
+
+// buildCompoundFile writes a version 3 compound file with all streams in
+// the root storage. Streams below 4096 bytes go to the mini stream, as
+// Windows Installer does it.
+func buildCompoundFile(streams []testStream) []byte {
+	const sectorSize = 512
+	const miniSize = 64
+	const cutoff = 4096
+	sectorsFor := func(n, size int) int { return (n + size - 1) / size }
+
+	// Mini stream and mini FAT
+	var miniStream []byte
+	var miniFAT []uint32
+	miniStart := make([]uint32, len(streams))
+	for i, s := range streams {
+		if len(s.data) >= cutoff || len(s.data) == 0 {
+			continue
+		}
+		first := uint32(len(miniFAT))
+		miniStart[i] = first
+		n := sectorsFor(len(s.data), miniSize)
+		for j := 0; j < n; j++ {
+			next := first + uint32(j) + 1
+			if j == n-1 {
+				next = cfbEndOfChain
+			}
+			miniFAT = append(miniFAT, next)
+		}
+		padded := make([]byte, n*miniSize)
+		copy(padded, s.data)
+		miniStream = append(miniStream, padded...)
+	}
+
+	dirSectors := sectorsFor((len(streams)+1)*cfbDirEntrySize, sectorSize)
+	miniFATSectors := sectorsFor(len(miniFAT)*4, sectorSize)
+	miniStreamSectors := sectorsFor(len(miniStream), sectorSize)
+	bigSectors := 0
+	for _, s := range streams {
+		if len(s.data) >= cutoff {
+			bigSectors += sectorsFor(len(s.data), sectorSize)
+		}
+	}
+	rest := dirSectors + miniFATSectors + miniStreamSectors + bigSectors
+	fatSectors := 1
+	for sectorsFor(fatSectors+rest, sectorSize/4) > fatSectors {
+		fatSectors++
+	}
+	total := fatSectors + rest
+
+	fat := make([]uint32, fatSectors*sectorSize/4)
+	for i := range fat {
+		fat[i] = cfbFreeSect
+	}
+	next := uint32(0)
+	chain := func(n int) uint32 {
+		if n == 0 {
+			return cfbEndOfChain
+		}
+		first := next
+		for j := 0; j < n; j++ {
+			if j == n-1 {
+				fat[next] = cfbEndOfChain
+			} else {
+				fat[next] = next + 1
+			}
+			next++
+		}
+		return first
+	}
+	for i := 0; i < fatSectors; i++ {
+		fat[next] = 0xFFFFFFFD // FATSECT
+		next++
+	}
+	dirStart := chain(dirSectors)
+	miniFATStart := chain(miniFATSectors)
+	miniStreamStart := chain(miniStreamSectors)
+	bigStart := make([]uint32, len(streams))
+	for i, s := range streams {
+		if len(s.data) >= cutoff {
+			bigStart[i] = chain(sectorsFor(len(s.data), sectorSize))
+		}
+	}
+
+	out := make([]byte, (total+1)*sectorSize)
+	sectorAt := func(sect uint32) []byte { return out[(int(sect)+1)*sectorSize:] }
+
+	// Header
+	copy(out, cfbSignature)
+	binary.LittleEndian.PutUint16(out[24:], 0x3E)
+	binary.LittleEndian.PutUint16(out[26:], 3)
+	binary.LittleEndian.PutUint16(out[28:], 0xFFFE)
+	binary.LittleEndian.PutUint16(out[30:], 9)
+	binary.LittleEndian.PutUint16(out[32:], 6)
+	binary.LittleEndian.PutUint32(out[44:], uint32(fatSectors))
+	binary.LittleEndian.PutUint32(out[48:], dirStart)
+	binary.LittleEndian.PutUint32(out[56:], cutoff)
+	binary.LittleEndian.PutUint32(out[60:], miniFATStart)
+	binary.LittleEndian.PutUint32(out[64:], uint32(miniFATSectors))
+	binary.LittleEndian.PutUint32(out[68:], cfbEndOfChain)
+	for i := 0; i < cfbHeaderDIFAT; i++ {
+		v := uint32(cfbFreeSect)
+		if i < fatSectors {
+			v = uint32(i)
+		}
+		binary.LittleEndian.PutUint32(out[76+i*4:], v)
+	}
+
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(sectorAt(uint32(i * 4 / sectorSize))[i*4%sectorSize:], v)
+	}
+
+	// Directory: root entry, then each stream as the right sibling of the previous one
+	dir := sectorAt(dirStart)
+	writeEntry := func(index int, name string, objType byte, right, child, start uint32, size int) {
+		e := dir[index*cfbDirEntrySize:]
+		units := utf16.Encode([]rune(name))
+		for j, u := range units {
+			binary.LittleEndian.PutUint16(e[j*2:], u)
+		}
+		binary.LittleEndian.PutUint16(e[64:], uint16((len(units)+1)*2))
+		e[66] = objType
+		e[67] = 1 // black
+		binary.LittleEndian.PutUint32(e[68:], cfbNoStream)
+		binary.LittleEndian.PutUint32(e[72:], right)
+		binary.LittleEndian.PutUint32(e[76:], child)
+		binary.LittleEndian.PutUint32(e[116:], start)
+		binary.LittleEndian.PutUint64(e[120:], uint64(size))
+	}
+	rootChild := uint32(cfbNoStream)
+	if len(streams) > 0 {
+		rootChild = 1
+	}
+	writeEntry(0, "Root Entry", cfbTypeRoot, cfbNoStream, rootChild, miniStreamStart, len(miniStream))
+	for i, s := range streams {
+		right := uint32(i + 2)
+		if i == len(streams)-1 {
+			right = cfbNoStream
+		}
+		start := uint32(cfbEndOfChain)
+		switch {
+		case len(s.data) >= cutoff:
+			start = bigStart[i]
+		case len(s.data) > 0:
+			start = miniStart[i]
+		}
+		writeEntry(i+1, s.name, cfbTypeStream, right, cfbNoStream, start, len(s.data))
+	}
+
+	miniFATData := sectorAt(miniFATStart)
+	for i, v := range miniFAT {
+		binary.LittleEndian.PutUint32(miniFATData[i*4:], v)
+	}
+	copy(sectorAt(miniStreamStart), miniStream)
+	for i, s := range streams {
+		if len(s.data) >= cutoff {
+			copy(sectorAt(bigStart[i]), s.data)
+		}
+	}
+	return out
+}
+
+func TestCompoundFileStreams(t *testing.T) {
+	big := bytes.Repeat([]byte("0123456789"), 1000)
+	data := buildCompoundFile([]testStream{
+		{name: "small", data: []byte("hello, world")},
+		{name: "big", data: big},
+		{name: "empty"},
+		{name: "odd", data: bytes.Repeat([]byte{0xAB}, 65)},
+	})
+
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		t.Fatalf("openCompoundFile failed: %v", err)
+	}
+	streams := cf.rootStreams()
+	if len(streams) != 4 {
+		t.Fatalf("expected 4 streams, got %d", len(streams))
+	}
+
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		{"small", []byte("hello, world")},
+		{"big", big},
+		{"empty", nil},
+		{"odd", bytes.Repeat([]byte{0xAB}, 65)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cf.readStream(streams[tt.name])
+			if err != nil {
+				t.Fatalf("readStream failed: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("stream contents differ: got %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestCompoundFileInvalid(t *testing.T) {
+	if _, err := openCompoundFile([]byte("PK\x03\x04 not a compound file")); err == nil {
+		t.Error("expected error for non-CFB data")
+	}
+
+	data := buildCompoundFile([]testStream{{name: "s", data: []byte("x")}})
+	truncated := data[:cfbHeaderSize+100]
+	if _, err := openCompoundFile(truncated); err == nil {
+		t.Error("expected error for truncated file")
+	}
+}
@@ -0,0 +1,333 @@
+package msi
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"slices"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Sector markers of the FAT (MS-CFB).
+const (
+	cfbFATSect   = 0xFFFFFFFD
+	cfbDIFATSect = 0xFFFFFFFC
+)
+
+// cfbNode is a storage or stream of a compound file, read into memory as a
+// whole so that it can be written again.
+type cfbNode struct {
+	name     string // Raw directory entry name
+	storage  bool
+	clsid    [16]byte
+	data     []byte     // Stream contents
+	children []*cfbNode // Streams and storages of a storage
+}
+
+// child returns the entry of a storage with the given name, or nil.
+func (n *cfbNode) child(name string) *cfbNode {
+	for _, c := range n.children {
+		if compareEntryNames(c.name, name) == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+// tree reads the root storage with all its streams and storages.
+func (cf *compoundFile) tree() (*cfbNode, error) {
+	visited := make(map[uint32]bool)
+	var readStorage func(node *cfbNode, entry dirEntry) error
+	readStorage = func(node *cfbNode, entry dirEntry) error {
+		var walk func(id uint32) error
+		walk = func(id uint32) error {
+			if id == cfbNoStream || int(id) >= len(cf.entries) || visited[id] {
+				return nil
+			}
+			visited[id] = true
+			e := cf.entries[id]
+			switch e.objType {
+			case cfbTypeStream:
+				data, err := cf.readStream(e)
+				if err != nil {
+					return fmt.Errorf("stream %q: %w", e.name, err)
+				}
+				node.children = append(node.children, &cfbNode{name: e.name, clsid: e.clsid, data: data})
+			case cfbTypeStorage:
+				child := &cfbNode{name: e.name, storage: true, clsid: e.clsid}
+				if err := readStorage(child, e); err != nil {
+					return err
+				}
+				node.children = append(node.children, child)
+			}
+			if err := walk(e.left); err != nil {
+				return err
+			}
+			return walk(e.right)
+		}
+		return walk(entry.child)
+	}
+
+	root := cf.entries[0]
+	visited[0] = true
+	node := &cfbNode{name: root.name, storage: true, clsid: root.clsid}
+	if err := readStorage(node, root); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// compareEntryNames orders directory entry names as compound files require:
+// shorter names first, then by upper case UTF-16 code units.
+func compareEntryNames(a, b string) int {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	if len(ua) != len(ub) {
+		return cmp.Compare(len(ua), len(ub))
+	}
+	for i := range ua {
+		if c := cmp.Compare(upperUnit(ua[i]), upperUnit(ub[i])); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func upperUnit(u uint16) uint16 {
+	if utf16.IsSurrogate(rune(u)) {
+		return u
+	}
+	return uint16(unicode.ToUpper(rune(u)))
+}
+
+// writeCompoundFile writes a version 3 compound file with 512 byte sectors.
+// Streams below 4096 bytes go to the mini stream, as Windows Installer does
+// it. The entries of each storage form a balanced red-black tree.
+func writeCompoundFile(root *cfbNode) ([]byte, error) {
+	const sectorSize = 512
+	const miniSectorSize = 64
+	const miniCutoff = 4096
+	const perSector = sectorSize / 4
+	sectorsFor := func(n, size int) int { return (n + size - 1) / size }
+
+	// Directory entries: the root, then the entries of each storage, which
+	// are linked as a tree below the storage
+	type dirLinks struct {
+		left, right, child uint32
+		black              bool
+	}
+	nodes := []*cfbNode{root}
+	links := []dirLinks{{left: cfbNoStream, right: cfbNoStream, child: cfbNoStream, black: true}}
+	var place func(id uint32) error
+	place = func(id uint32) error {
+		children := slices.SortedFunc(slices.Values(nodes[id].children), func(a, b *cfbNode) int {
+			return compareEntryNames(a.name, b.name)
+		})
+		ids := make([]uint32, len(children))
+		for i, c := range children {
+			if len(utf16.Encode([]rune(c.name))) > 31 {
+				return fmt.Errorf("entry name %q is longer than 31 characters", c.name)
+			}
+			if i > 0 && compareEntryNames(children[i-1].name, c.name) == 0 {
+				return fmt.Errorf("entry %q is stored twice", c.name)
+			}
+			ids[i] = uint32(len(nodes))
+			nodes = append(nodes, c)
+			links = append(links, dirLinks{})
+		}
+		// Splitting at the middle leaves all empty subtrees at two adjacent
+		// depths; nodes at the lower one are red, so that every path has the
+		// same number of black nodes
+		redDepth := bits.Len(uint(len(children)+1)) - 1
+		var build func(lo, hi, depth int) uint32
+		build = func(lo, hi, depth int) uint32 {
+			if lo >= hi {
+				return cfbNoStream
+			}
+			mid := (lo + hi) / 2
+			l := &links[ids[mid]]
+			l.black = depth < redDepth
+			l.left = build(lo, mid, depth+1)
+			l.right = build(mid+1, hi, depth+1)
+			l.child = cfbNoStream
+			return ids[mid]
+		}
+		links[id].child = build(0, len(children), 0)
+		for i, c := range children {
+			if c.storage {
+				if err := place(ids[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := place(0); err != nil {
+		return nil, err
+	}
+
+	// Sector chains in file order: large streams, the mini stream, the mini
+	// FAT and the directory, followed by the FAT and DIFAT sectors
+	var fat []uint32
+	var body []byte
+	chain := func(data []byte) uint32 {
+		n := sectorsFor(len(data), sectorSize)
+		if n == 0 {
+			return cfbEndOfChain
+		}
+		first := uint32(len(fat))
+		for i := 1; i < n; i++ {
+			fat = append(fat, first+uint32(i))
+		}
+		fat = append(fat, cfbEndOfChain)
+		padded := make([]byte, n*sectorSize)
+		copy(padded, data)
+		body = append(body, padded...)
+		return first
+	}
+
+	starts := make([]uint32, len(nodes))
+	var miniStream []byte
+	var miniFAT []uint32
+	for i, n := range nodes {
+		switch {
+		case n.storage:
+			starts[i] = 0
+		case len(n.data) == 0:
+			starts[i] = cfbEndOfChain
+		case len(n.data) >= miniCutoff:
+			starts[i] = chain(n.data)
+		default:
+			count := sectorsFor(len(n.data), miniSectorSize)
+			first := uint32(len(miniFAT))
+			for j := 1; j < count; j++ {
+				miniFAT = append(miniFAT, first+uint32(j))
+			}
+			miniFAT = append(miniFAT, cfbEndOfChain)
+			padded := make([]byte, count*miniSectorSize)
+			copy(padded, n.data)
+			miniStream = append(miniStream, padded...)
+			starts[i] = first
+		}
+	}
+	starts[0] = chain(miniStream)
+	miniFATData := make([]byte, len(miniFAT)*4)
+	for i, v := range miniFAT {
+		binary.LittleEndian.PutUint32(miniFATData[i*4:], v)
+	}
+	miniFATStart := chain(miniFATData)
+
+	dir := make([]byte, sectorsFor(len(nodes), 4)*4*cfbDirEntrySize)
+	for i := range sectorsFor(len(nodes), 4) * 4 {
+		e := dir[i*cfbDirEntrySize:]
+		binary.LittleEndian.PutUint32(e[68:], cfbNoStream)
+		binary.LittleEndian.PutUint32(e[72:], cfbNoStream)
+		binary.LittleEndian.PutUint32(e[76:], cfbNoStream)
+		if i >= len(nodes) {
+			continue
+		}
+		n, l := nodes[i], links[i]
+		units := utf16.Encode([]rune(n.name))
+		for j, u := range units {
+			binary.LittleEndian.PutUint16(e[j*2:], u)
+		}
+		binary.LittleEndian.PutUint16(e[64:], uint16((len(units)+1)*2))
+		size := len(n.data)
+		switch {
+		case i == 0:
+			e[66] = cfbTypeRoot
+			size = len(miniStream)
+		case n.storage:
+			e[66] = cfbTypeStorage
+		default:
+			e[66] = cfbTypeStream
+		}
+		if l.black {
+			e[67] = 1
+		}
+		binary.LittleEndian.PutUint32(e[68:], l.left)
+		binary.LittleEndian.PutUint32(e[72:], l.right)
+		binary.LittleEndian.PutUint32(e[76:], l.child)
+		copy(e[80:96], n.clsid[:])
+		binary.LittleEndian.PutUint32(e[116:], starts[i])
+		binary.LittleEndian.PutUint64(e[120:], uint64(size))
+	}
+	dirStart := chain(dir)
+
+	// The FAT covers itself and the DIFAT, which lists the FAT sectors
+	// beyond the 109 in the header
+	dataSectors := len(fat)
+	fatSectors, difatSectors := 0, 0
+	for {
+		f := sectorsFor(dataSectors+fatSectors+difatSectors, perSector)
+		d := 0
+		if f > cfbHeaderDIFAT {
+			d = sectorsFor(f-cfbHeaderDIFAT, perSector-1)
+		}
+		if f == fatSectors && d == difatSectors {
+			break
+		}
+		fatSectors, difatSectors = f, d
+	}
+	fatStart := uint32(dataSectors)
+	difatStart := fatStart + uint32(fatSectors)
+	for range fatSectors {
+		fat = append(fat, cfbFATSect)
+	}
+	for range difatSectors {
+		fat = append(fat, cfbDIFATSect)
+	}
+	for len(fat) < fatSectors*perSector {
+		fat = append(fat, cfbFreeSect)
+	}
+	fatData := make([]byte, len(fat)*4)
+	for i, v := range fat {
+		binary.LittleEndian.PutUint32(fatData[i*4:], v)
+	}
+	body = append(body, fatData...)
+
+	difat := make([]byte, difatSectors*sectorSize)
+	for i := range difatSectors * perSector {
+		binary.LittleEndian.PutUint32(difat[i*4:], cfbFreeSect)
+	}
+	for i := cfbHeaderDIFAT; i < fatSectors; i++ {
+		k := i - cfbHeaderDIFAT
+		sector, slot := k/(perSector-1), k%(perSector-1)
+		binary.LittleEndian.PutUint32(difat[sector*sectorSize+slot*4:], fatStart+uint32(i))
+	}
+	for s := range difatSectors {
+		next := uint32(cfbEndOfChain)
+		if s < difatSectors-1 {
+			next = difatStart + uint32(s) + 1
+		}
+		binary.LittleEndian.PutUint32(difat[s*sectorSize+(perSector-1)*4:], next)
+	}
+	body = append(body, difat...)
+
+	header := make([]byte, cfbHeaderSize)
+	copy(header, cfbSignature)
+	binary.LittleEndian.PutUint16(header[24:], 0x3E)
+	binary.LittleEndian.PutUint16(header[26:], 3)
+	binary.LittleEndian.PutUint16(header[28:], 0xFFFE)
+	binary.LittleEndian.PutUint16(header[30:], 9)
+	binary.LittleEndian.PutUint16(header[32:], 6)
+	binary.LittleEndian.PutUint32(header[44:], uint32(fatSectors))
+	binary.LittleEndian.PutUint32(header[48:], dirStart)
+	binary.LittleEndian.PutUint32(header[56:], miniCutoff)
+	binary.LittleEndian.PutUint32(header[60:], miniFATStart)
+	binary.LittleEndian.PutUint32(header[64:], uint32(sectorsFor(len(miniFATData), sectorSize)))
+	binary.LittleEndian.PutUint32(header[68:], cfbEndOfChain)
+	if difatSectors > 0 {
+		binary.LittleEndian.PutUint32(header[68:], difatStart)
+	}
+	binary.LittleEndian.PutUint32(header[72:], uint32(difatSectors))
+	for i := range cfbHeaderDIFAT {
+		v := uint32(cfbFreeSect)
+		if i < fatSectors {
+			v = fatStart + uint32(i)
+		}
+		binary.LittleEndian.PutUint32(header[76+i*4:], v)
+	}
+	return append(header, body...), nil
+}
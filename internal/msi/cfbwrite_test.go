@@ -0,0 +1,143 @@
+package msi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// checkStorageTree checks that the entries of each storage form a sorted
+// red-black tree: no red node has a red child, and every path down has the
+// same number of black nodes.
+func checkStorageTree(t *testing.T, cf *compoundFile, id uint32) {
+	t.Helper()
+	var names []string
+	var walk func(id uint32, parentRed bool) int
+	walk = func(id uint32, parentRed bool) int {
+		if id == cfbNoStream {
+			return 0
+		}
+		e := cf.entries[id]
+		red := e.colour == 0
+		if red && parentRed {
+			t.Errorf("red entry %q has a red parent", e.name)
+		}
+		left := walk(e.left, red)
+		names = append(names, e.name)
+		right := walk(e.right, red)
+		if left != right {
+			t.Errorf("entry %q: black heights %d and %d differ", e.name, left, right)
+		}
+		if e.objType == cfbTypeStorage {
+			checkStorageTree(t, cf, id)
+		}
+		if red {
+			return left
+		}
+		return left + 1
+	}
+	walk(cf.entries[id].child, false)
+	for i := 1; i < len(names); i++ {
+		if compareEntryNames(names[i-1], names[i]) >= 0 {
+			t.Errorf("entries %q and %q are out of order", names[i-1], names[i])
+		}
+	}
+}
+
+// equalNodes reports the first difference between two trees.
+func equalNodes(a, b *cfbNode) error {
+	if a.name != b.name || a.storage != b.storage || a.clsid != b.clsid || !bytes.Equal(a.data, b.data) {
+		return fmt.Errorf("entry %q differs", a.name)
+	}
+	if len(a.children) != len(b.children) {
+		return fmt.Errorf("storage %q has %d entries, want %d", b.name, len(b.children), len(a.children))
+	}
+	for _, c := range a.children {
+		other := b.child(c.name)
+		if other == nil {
+			return fmt.Errorf("storage %q lacks %q", b.name, c.name)
+		}
+		if err := equalNodes(c, other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWriteCompoundFile(t *testing.T) {
+	sub := &cfbNode{name: "1031", storage: true, clsid: [16]byte{0x82, 0x10, 0x0C}, children: []*cfbNode{
+		{name: "small", data: []byte("transform")},
+		{name: "big", data: bytes.Repeat([]byte("abc"), 3000)},
+	}}
+	root := &cfbNode{name: "Root Entry", storage: true, clsid: [16]byte{0x84, 0x10, 0x0C}, children: []*cfbNode{
+		{name: "small", data: []byte("hello, world")},
+		{name: "big", data: bytes.Repeat([]byte("0123456789"), 1000)},
+		{name: "empty"},
+		{name: "odd", data: bytes.Repeat([]byte{0xAB}, 65)},
+		sub,
+	}}
+	for i := range 40 {
+		root.children = append(root.children, &cfbNode{name: fmt.Sprintf("Stream%d", i), data: []byte{byte(i)}})
+	}
+
+	data, err := writeCompoundFile(root)
+	if err != nil {
+		t.Fatalf("writeCompoundFile failed: %v", err)
+	}
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		t.Fatalf("openCompoundFile failed: %v", err)
+	}
+	got, err := cf.tree()
+	if err != nil {
+		t.Fatalf("tree failed: %v", err)
+	}
+	if err := equalNodes(root, got); err != nil {
+		t.Error(err)
+	}
+	checkStorageTree(t, cf, 0)
+}
+
+func TestWriteCompoundFileDIFAT(t *testing.T) {
+	// More sectors than the 109 FAT sectors of the header can map
+	big := bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7}, cfbHeaderDIFAT*128*512/7+1000)
+	root := &cfbNode{name: "Root Entry", storage: true, children: []*cfbNode{{name: "big", data: big}}}
+	data, err := writeCompoundFile(root)
+	if err != nil {
+		t.Fatalf("writeCompoundFile failed: %v", err)
+	}
+	if data[72] == 0 {
+		t.Fatalf("expected DIFAT sectors")
+	}
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		t.Fatalf("openCompoundFile failed: %v", err)
+	}
+	got, err := cf.readStream(cf.rootStreams()["big"])
+	if err != nil {
+		t.Fatalf("readStream failed: %v", err)
+	}
+	if !bytes.Equal(got, big) {
+		t.Errorf("stream contents differ: got %d bytes, want %d", len(got), len(big))
+	}
+}
+
+func TestWriteCompoundFileInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		children []*cfbNode
+		want     string
+	}{
+		{"long name", []*cfbNode{{name: "ThisNameIsLongerThanThirtyOneCharacters"}}, "longer than 31"},
+		{"duplicate", []*cfbNode{{name: "Data"}, {name: "DATA"}}, "stored twice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := writeCompoundFile(&cfbNode{name: "Root Entry", storage: true, children: tt.children})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
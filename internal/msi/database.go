@@ -0,0 +1,434 @@
+package msi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Column type bits as stored in the _Columns table.
+const (
+	colWidthMask   = 0x00FF
+	colValid       = 0x0100
+	colLocalizable = 0x0400
+	colString      = 0x0800
+	colNullable    = 0x1000
+	colKey         = 0x2000
+)
+
+// Column describes one column of an MSI table.
+type Column struct {
+	Name string `json:"name"`
+	Type int    `json:"type"`
+}
+
+// IsString reports whether the column holds string pool references.
+func (c Column) IsString() bool {
+	return c.Type&colString != 0 && !c.IsBinary()
+}
+
+// IsBinary reports whether the column refers to a binary stream.
+func (c Column) IsBinary() bool {
+	return c.Type&^colNullable == colString|colValid
+}
+
+// IsKey reports whether the column is part of the primary key.
+func (c Column) IsKey() bool {
+	return c.Type&colKey != 0
+}
+
+// IsNullable reports whether the column accepts null values.
+func (c Column) IsNullable() bool {
+	return c.Type&colNullable != 0
+}
+
+// Table is a decoded MSI table. Row values are nil (null), int or string.
+// Binary columns hold the name of the stream that stores the data.
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []Column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+}
+
+// ColumnIndex returns the index of the named column, or -1.
+func (t *Table) ColumnIndex(name string) int {
+	for i, col := range t.Columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Database is a read-only Windows Installer database.
+type Database struct {
+	cf       *compoundFile
+	streams  map[string]dirEntry // decoded stream name -> entry; table streams carry a "!" prefix
+	strings  []string            // string pool, index 0 is the null string
+	refSize  int                 // size of a string reference in bytes (2 or 3)
+	Codepage int
+	tables   []string
+	columns  map[string][]Column
+}
+
+// Open reads an MSI (or MSM/PCP) file.
+func Open(filename string) (*Database, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading MSI: %w", err)
+	}
+	db, err := OpenBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return db, nil
+}
+
+// OpenBytes parses an MSI database held in memory.
+func OpenBytes(data []byte) (*Database, error) {
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		cf:      cf,
+		streams: make(map[string]dirEntry),
+		columns: make(map[string][]Column),
+	}
+	for raw, entry := range cf.rootStreams() {
+		name, isTable := decodeStreamName(raw)
+		if isTable {
+			name = "!" + name
+		}
+		db.streams[name] = entry
+	}
+
+	if err := db.loadStringPool(); err != nil {
+		return nil, err
+	}
+	if err := db.loadSchema(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Tables returns the names of all tables in the database, sorted.
+func (db *Database) Tables() []string {
+	return db.tables
+}
+
+// HasTable reports whether the database contains the named table.
+func (db *Database) HasTable(name string) bool {
+	_, ok := db.columns[name]
+	return ok
+}
+
+// Streams returns the names of all non-table streams, sorted.
+// These are embedded cabinets, Binary and Icon table data and similar.
+func (db *Database) Streams() []string {
+	var names []string
+	for name := range db.streams {
+		if !strings.HasPrefix(name, "!") && !strings.HasPrefix(name, "\x05") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stream returns the contents of a non-table stream.
+func (db *Database) Stream(name string) ([]byte, error) {
+	entry, ok := db.streams[name]
+	if !ok {
+		return nil, fmt.Errorf("stream %q not found", name)
+	}
+	return db.cf.readStream(entry)
+}
+
+// tableStream returns the raw data of a table stream, or nil if the table is empty.
+func (db *Database) tableStream(name string) ([]byte, error) {
+	entry, ok := db.streams["!"+name]
+	if !ok {
+		return nil, nil
+	}
+	return db.cf.readStream(entry)
+}
+
+// loadStringPool decodes _StringPool (lengths and refcounts) and _StringData.
+func (db *Database) loadStringPool() error {
+	pool, err := db.tableStream("_StringPool")
+	if err != nil {
+		return fmt.Errorf("reading string pool: %w", err)
+	}
+	data, err := db.tableStream("_StringData")
+	if err != nil {
+		return fmt.Errorf("reading string data: %w", err)
+	}
+	if len(pool) < 4 {
+		return fmt.Errorf("missing string pool")
+	}
+
+	header := binary.LittleEndian.Uint32(pool)
+	db.refSize = 2
+	if header&0x80000000 != 0 {
+		db.refSize = 3
+	}
+	db.Codepage = int(header & 0x7FFFFFFF)
+
+	words := make([]uint16, len(pool)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(pool[i*2:])
+	}
+
+	// Each entry is (length, refcount). Strings longer than 64K are stored as
+	// an entry with length 0 followed by an entry holding the full length.
+	db.strings = []string{""}
+	offset := 0
+	count := len(words) / 2
+	for i := 1; i < count; {
+		length, refs := int(words[i*2]), words[i*2+1]
+		switch {
+		case length == 0 && refs == 0:
+			db.strings = append(db.strings, "")
+			i++
+			continue
+		case length == 0:
+			if i+1 >= count {
+				return fmt.Errorf("truncated string pool")
+			}
+			length = int(words[i*2+3])<<16 | int(words[i*2+2])
+			i += 2
+		default:
+			i++
+		}
+		if offset+length > len(data) {
+			return fmt.Errorf("string pool exceeds string data")
+		}
+		db.strings = append(db.strings, decodeString(data[offset:offset+length]))
+		offset += length
+	}
+	return nil
+}
+
+// decodeString converts string data to UTF-8. Databases built with a
+// Windows codepage store bytes in that codepage; they are mapped as Latin-1,
+// which matches Windows-1252 for all printable characters below 0x80 and most above.
+func decodeString(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// stringAt resolves a string pool reference.
+func (db *Database) stringAt(ref int) (string, error) {
+	if ref < 0 || ref >= len(db.strings) {
+		return "", fmt.Errorf("string reference %d out of range", ref)
+	}
+	return db.strings[ref], nil
+}
+
+// loadSchema reads _Tables and _Columns.
+func (db *Database) loadSchema() error {
+	tables, err := db.readRows("_Tables", []Column{{Name: "Name", Type: colValid | colString | colKey | 64}})
+	if err != nil {
+		return err
+	}
+	columns, err := db.readRows("_Columns", []Column{
+		{Name: "Table", Type: colValid | colString | colKey | 64},
+		{Name: "Number", Type: colValid | colKey | 2},
+		{Name: "Name", Type: colValid | colString | 64},
+		{Name: "Type", Type: colValid | 2},
+	})
+	if err != nil {
+		return err
+	}
+
+	type numbered struct {
+		number int
+		col    Column
+	}
+	byTable := make(map[string][]numbered)
+	for _, row := range columns {
+		table, _ := row[0].(string)
+		number, _ := row[1].(int)
+		name, _ := row[2].(string)
+		typ, _ := row[3].(int)
+		byTable[table] = append(byTable[table], numbered{number, Column{Name: name, Type: typ}})
+	}
+
+	for _, row := range tables {
+		name, _ := row[0].(string)
+		db.tables = append(db.tables, name)
+		cols := byTable[name]
+		sort.Slice(cols, func(i, j int) bool { return cols[i].number < cols[j].number })
+		for _, c := range cols {
+			db.columns[name] = append(db.columns[name], c.col)
+		}
+		if cols == nil {
+			db.columns[name] = nil
+		}
+	}
+	sort.Strings(db.tables)
+	return nil
+}
+
+// Table reads a table by name.
+func (db *Database) Table(name string) (*Table, error) {
+	columns, ok := db.columns[name]
+	if !ok {
+		return nil, fmt.Errorf("table %s not found", name)
+	}
+	rows, err := db.readRows(name, columns)
+	if err != nil {
+		return nil, err
+	}
+	return &Table{Name: name, Columns: columns, Rows: rows}, nil
+}
+
+// columnSize returns the number of bytes one value of the column occupies.
+func (db *Database) columnSize(col Column) int {
+	switch {
+	case col.IsBinary():
+		return 2
+	case col.Type&colString != 0:
+		return db.refSize
+	case col.Type&colWidthMask <= 2:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// readRows decodes a table stream. Tables are stored column by column:
+// all values of the first column, then all values of the second, and so on.
+func (db *Database) readRows(table string, columns []Column) ([][]any, error) {
+	data, err := db.tableStream(table)
+	if err != nil {
+		return nil, fmt.Errorf("reading table %s: %w", table, err)
+	}
+	if len(data) == 0 || len(columns) == 0 {
+		return nil, nil
+	}
+
+	rowSize := 0
+	for _, col := range columns {
+		rowSize += db.columnSize(col)
+	}
+	if len(data)%rowSize != 0 {
+		return nil, fmt.Errorf("table %s: stream size %d is not a multiple of row size %d", table, len(data), rowSize)
+	}
+	rowCount := len(data) / rowSize
+
+	rows := make([][]any, rowCount)
+	for i := range rows {
+		rows[i] = make([]any, len(columns))
+	}
+
+	offset := 0
+	for c, col := range columns {
+		size := db.columnSize(col)
+		for r := 0; r < rowCount; r++ {
+			raw := readUint(data[offset:], size)
+			offset += size
+			if raw == 0 {
+				continue // null
+			}
+			switch {
+			case col.IsBinary():
+				rows[r][c] = "" // filled in below, once all key columns are known
+			case col.Type&colString != 0:
+				s, err := db.stringAt(int(raw))
+				if err != nil {
+					return nil, fmt.Errorf("table %s column %s: %w", table, col.Name, err)
+				}
+				rows[r][c] = s
+			case size == 2:
+				rows[r][c] = int(raw) - 0x8000
+			default:
+				rows[r][c] = int(int32(raw - 0x80000000))
+			}
+		}
+	}
+
+	// Binary data lives in a stream named after the table and the row's key values
+	for c, col := range columns {
+		if !col.IsBinary() {
+			continue
+		}
+		for _, row := range rows {
+			if row[c] != nil {
+				row[c] = binaryStreamName(table, columns, row)
+			}
+		}
+	}
+	return rows, nil
+}
+
+func binaryStreamName(table string, columns []Column, row []any) string {
+	parts := []string{table}
+	for i, col := range columns {
+		if col.IsKey() {
+			parts = append(parts, fmt.Sprint(row[i]))
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func readUint(b []byte, size int) uint32 {
+	switch size {
+	case 2:
+		return uint32(binary.LittleEndian.Uint16(b))
+	case 3:
+		return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+	default:
+		return binary.LittleEndian.Uint32(b)
+	}
+}
+
+// decodeStreamName undoes the compression MSI applies to stream names: two
+// characters from the set [0-9A-Za-z._] are packed into one code point in
+// the range 0x3800-0x47FF, a single one into 0x4800-0x483F. Table streams
+// start with 0x4840.
+func decodeStreamName(raw string) (string, bool) {
+	var sb strings.Builder
+	isTable := false
+	for i, r := range raw {
+		switch {
+		case i == 0 && r == 0x4840:
+			isTable = true
+		case r >= 0x3800 && r < 0x4800:
+			v := r - 0x3800
+			sb.WriteByte(mimeChar(int(v & 0x3F)))
+			sb.WriteByte(mimeChar(int(v >> 6 & 0x3F)))
+		case r >= 0x4800 && r < 0x4840:
+			sb.WriteByte(mimeChar(int(r - 0x4800)))
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), isTable
+}
+
+func mimeChar(v int) byte {
+	switch {
+	case v < 10:
+		return byte('0' + v)
+	case v < 36:
+		return byte('A' + v - 10)
+	case v < 62:
+		return byte('a' + v - 36)
+	case v == 62:
+		return '.'
+	default:
+		return '_'
+	}
+}
@@ -0,0 +1,314 @@
+package msi
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testTable is a table to be written by buildDatabase. Row values are nil,
+// int or string; binary columns take any non-nil value.
+type testTable struct {
+	name    string
+	columns []Column
+	rows    [][]any
+}
+
+func strCol(name string, key bool) Column {
+	typ := colValid | colString | 255
+	if key {
+		typ |= colKey
+	}
+	return Column{Name: name, Type: typ}
+}
+
+func intCol(name string, width int, nullable bool) Column {
+	typ := colValid | width
+	if nullable {
+		typ |= colNullable
+	}
+	return Column{Name: name, Type: typ}
+}
+
+// encodeStreamName is the inverse of decodeStreamName.
+func encodeStreamName(name string, table bool) string {
+	mime := func(c byte) int {
+		switch {
+		case c >= '0' && c <= '9':
+			return int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			return int(c-'A') + 10
+		case c >= 'a' && c <= 'z':
+			return int(c-'a') + 36
+		case c == '.':
+			return 62
+		case c == '_':
+			return 63
+		}
+		return -1
+	}
+
+	var runes []rune
+	if table {
+		runes = append(runes, 0x4840)
+	}
+	for i := 0; i < len(name); i++ {
+		first := mime(name[i])
+		if first < 0 {
+			runes = append(runes, rune(name[i]))
+			continue
+		}
+		if i+1 < len(name) {
+			if second := mime(name[i+1]); second >= 0 {
+				runes = append(runes, rune(0x3800+second<<6+first))
+				i++
+				continue
+			}
+		}
+		runes = append(runes, rune(0x4800+first))
+	}
+	return string(runes)
+}
+
+// buildDatabase writes an MSI database with the given tables and extra
+// (non-table) streams. longRefs selects 3-byte string references.
+func buildDatabase(tables []testTable, extra []testStream, longRefs bool) []byte {
+	var pool []string
+	index := map[string]int{}
+	intern := func(s string) int {
+		if s == "" {
+			return 0
+		}
+		if i, ok := index[s]; ok {
+			return i
+		}
+		pool = append(pool, s)
+		index[s] = len(pool)
+		return len(pool)
+	}
+	refSize := 2
+	if longRefs {
+		refSize = 3
+	}
+	putRef := func(buf []byte, ref int) []byte {
+		buf = append(buf, byte(ref), byte(ref>>8))
+		if refSize == 3 {
+			buf = append(buf, byte(ref>>16))
+		}
+		return buf
+	}
+
+	encodeTable := func(columns []Column, rows [][]any) []byte {
+		var buf []byte
+		for c, col := range columns {
+			for _, row := range rows {
+				v := row[c]
+				switch {
+				case col.IsBinary():
+					if v == nil {
+						buf = append(buf, 0, 0)
+					} else {
+						buf = append(buf, 1, 0)
+					}
+				case col.Type&colString != 0:
+					s, _ := v.(string)
+					buf = putRef(buf, intern(s))
+				case col.Type&colWidthMask <= 2:
+					if v == nil {
+						buf = binary.LittleEndian.AppendUint16(buf, 0)
+					} else {
+						buf = binary.LittleEndian.AppendUint16(buf, uint16(v.(int)+0x8000))
+					}
+				default:
+					if v == nil {
+						buf = binary.LittleEndian.AppendUint32(buf, 0)
+					} else {
+						buf = binary.LittleEndian.AppendUint32(buf, uint32(int32(v.(int)))+0x80000000)
+					}
+				}
+			}
+		}
+		return buf
+	}
+
+	var streams []testStream
+	var tableRows, columnRows [][]any
+	for _, table := range tables {
+		tableRows = append(tableRows, []any{table.name})
+		for i, col := range table.columns {
+			columnRows = append(columnRows, []any{table.name, i + 1, col.Name, col.Type})
+		}
+		if len(table.rows) > 0 {
+			streams = append(streams, testStream{encodeStreamName(table.name, true), encodeTable(table.columns, table.rows)})
+		}
+	}
+	streams = append(streams,
+		testStream{encodeStreamName("_Tables", true), encodeTable([]Column{strCol("Name", true)}, tableRows)},
+		testStream{encodeStreamName("_Columns", true), encodeTable([]Column{
+			strCol("Table", true), intCol("Number", 2, false), strCol("Name", false), intCol("Type", 2, false),
+		}, columnRows)},
+	)
+
+	header := uint32(1252)
+	if longRefs {
+		header |= 0x80000000
+	}
+	poolData := binary.LittleEndian.AppendUint32(nil, header)
+	var stringData []byte
+	for _, s := range pool {
+		if len(s) > 0xFFFF {
+			poolData = binary.LittleEndian.AppendUint16(poolData, 0)
+			poolData = binary.LittleEndian.AppendUint16(poolData, 1)
+			poolData = binary.LittleEndian.AppendUint16(poolData, uint16(len(s)))
+			poolData = binary.LittleEndian.AppendUint16(poolData, uint16(len(s)>>16))
+		} else {
+			poolData = binary.LittleEndian.AppendUint16(poolData, uint16(len(s)))
+			poolData = binary.LittleEndian.AppendUint16(poolData, 1)
+		}
+		stringData = append(stringData, s...)
+	}
+	streams = append(streams,
+		testStream{encodeStreamName("_StringPool", true), poolData},
+		testStream{encodeStreamName("_StringData", true), stringData},
+	)
+	for _, s := range extra {
+		streams = append(streams, testStream{encodeStreamName(s.name, false), s.data})
+	}
+	return buildCompoundFile(streams)
+}
+
+func propertyTable(rows ...[]any) testTable {
+	return testTable{
+		name:    "Property",
+		columns: []Column{strCol("Property", true), strCol("Value", false)},
+		rows:    rows,
+	}
+}
+
+func TestStreamNameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		table bool
+	}{
+		{"_StringPool", true},
+		{"Property", true},
+		{"cab1.cab", false},
+		{"Binary.WixUI_Bmp_Banner", false},
+		{"odd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, isTable := decodeStreamName(encodeStreamName(tt.name, tt.table))
+			if got != tt.name || isTable != tt.table {
+				t.Errorf("decodeStreamName = (%q, %v), want (%q, %v)", got, isTable, tt.name, tt.table)
+			}
+		})
+	}
+}
+
+func TestDatabaseTables(t *testing.T) {
+	for _, longRefs := range []bool{false, true} {
+		data := buildDatabase([]testTable{
+			propertyTable(
+				[]any{"ProductName", "My App"},
+				[]any{"ProductVersion", "1.2.3"},
+			),
+			{
+				name: "Feature",
+				columns: []Column{
+					strCol("Feature", true), {Name: "Feature_Parent", Type: colValid | colString | colNullable | 72},
+					intCol("Display", 2, true), intCol("Level", 2, false), intCol("Attributes", 4, false),
+				},
+				rows: [][]any{
+					{"FEATURE_00000", nil, 2, 1, 0},
+					{"FEATURE_00001", "FEATURE_00000", nil, -5, 70000},
+				},
+			},
+			{name: "Empty", columns: []Column{strCol("Key", true)}},
+		}, nil, longRefs)
+
+		db, err := OpenBytes(data)
+		if err != nil {
+			t.Fatalf("OpenBytes(longRefs=%v) failed: %v", longRefs, err)
+		}
+		if db.Codepage != 1252 {
+			t.Errorf("Codepage = %d, want 1252", db.Codepage)
+		}
+		if got := strings.Join(db.Tables(), ","); got != "Empty,Feature,Property" {
+			t.Errorf("Tables() = %s", got)
+		}
+
+		props, err := db.Table("Property")
+		if err != nil {
+			t.Fatalf("Table(Property) failed: %v", err)
+		}
+		if len(props.Rows) != 2 || props.Rows[1][0] != "ProductVersion" || props.Rows[1][1] != "1.2.3" {
+			t.Errorf("unexpected Property rows %v", props.Rows)
+		}
+
+		features, err := db.Table("Feature")
+		if err != nil {
+			t.Fatalf("Table(Feature) failed: %v", err)
+		}
+		want := [][]any{
+			{"FEATURE_00000", nil, 2, 1, 0},
+			{"FEATURE_00001", "FEATURE_00000", nil, -5, 70000},
+		}
+		for r := range want {
+			for c := range want[r] {
+				if features.Rows[r][c] != want[r][c] {
+					t.Errorf("Feature[%d][%s] = %v, want %v", r, features.Columns[c].Name, features.Rows[r][c], want[r][c])
+				}
+			}
+		}
+
+		empty, err := db.Table("Empty")
+		if err != nil || len(empty.Rows) != 0 {
+			t.Errorf("expected empty table, got %v (%v)", empty, err)
+		}
+		if _, err := db.Table("Missing"); err == nil {
+			t.Error("expected error for missing table")
+		}
+	}
+}
+
+func TestDatabaseLongString(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	db, err := OpenBytes(buildDatabase([]testTable{
+		propertyTable([]any{"Short", "a"}, []any{"Long", long}, []any{"After", "b"}),
+	}, nil, false))
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	props, err := db.Table("Property")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Rows[1][1] != long {
+		t.Errorf("long string not decoded, got %d chars", len(props.Rows[1][1].(string)))
+	}
+	if props.Rows[2][1] != "b" {
+		t.Errorf("string after long string = %v, want b", props.Rows[2][1])
+	}
+}
+
+func TestDatabaseBinaryColumn(t *testing.T) {
+	db, err := OpenBytes(buildDatabase([]testTable{{
+		name:    "Binary",
+		columns: []Column{strCol("Name", true), {Name: "Data", Type: colValid | colString}},
+		rows:    [][]any{{"Banner", 1}},
+	}}, []testStream{{name: "Binary.Banner", data: []byte("BM")}}, false))
+	if err != nil {
+		t.Fatalf("OpenBytes failed: %v", err)
+	}
+	table, err := db.Table("Binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Rows[0][1] != "Binary.Banner" {
+		t.Errorf("binary column = %v, want stream name", table.Rows[0][1])
+	}
+	if data, err := db.Stream("Binary.Banner"); err != nil || string(data) != "BM" {
+		t.Errorf("Stream(Binary.Banner) = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,214 @@
+package msi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// summaryStream is the raw name of the summary information stream.
+const summaryStream = "\x05SummaryInformation"
+
+// Summary information properties and types (MS-OLEPS).
+const (
+	pidTemplate = 7 // Platform and languages, e.g. "x64;1033"
+	vtLPSTR     = 30
+)
+
+// LanguageTransform is a language transform to embed in an MSI.
+type LanguageTransform struct {
+	LCID string // Language of the transform, which names its substorage
+	File string // The .mst
+}
+
+// EmbedLanguageTransforms stores language transforms in an MSI as
+// substorages named by their LCID, and lists their languages after the
+// language of the package in the summary information. Windows Installer
+// then applies the transform of the user's UI language on its own.
+// Language transforms embedded before are removed.
+func EmbedLanguageTransforms(msiFile string, transforms []LanguageTransform) error {
+	data, err := os.ReadFile(msiFile)
+	if err != nil {
+		return fmt.Errorf("reading MSI: %w", err)
+	}
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msiFile, err)
+	}
+	root, err := cf.tree()
+	if err != nil {
+		return fmt.Errorf("%s: %w", msiFile, err)
+	}
+
+	summary := root.child(summaryStream)
+	if summary == nil {
+		return fmt.Errorf("%s: no summary information", msiFile)
+	}
+	template, err := summaryString(summary.data, pidTemplate)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msiFile, err)
+	}
+	// The package language comes first; the transforms of the others were
+	// embedded before
+	platform, languages, _ := strings.Cut(template, ";")
+	languages, embedded, _ := strings.Cut(languages, ",")
+	for lcid := range strings.SplitSeq(embedded, ",") {
+		root.children = slices.DeleteFunc(root.children, func(c *cfbNode) bool {
+			return c.storage && c.name == lcid
+		})
+	}
+
+	for _, t := range transforms {
+		if t.LCID == "" || strings.Trim(t.LCID, "0123456789") != "" {
+			return fmt.Errorf("transform %s: LCID %q is not a number", t.File, t.LCID)
+		}
+		if root.child(t.LCID) != nil {
+			return fmt.Errorf("transform %s: the MSI already has an entry %s", t.File, t.LCID)
+		}
+		transform, err := readTransform(t.File)
+		if err != nil {
+			return err
+		}
+		transform.name = t.LCID
+		root.children = append(root.children, transform)
+		languages += "," + t.LCID
+	}
+
+	summary.data, err = setSummaryString(summary.data, pidTemplate, platform+";"+languages)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msiFile, err)
+	}
+	out, err := writeCompoundFile(root)
+	if err != nil {
+		return fmt.Errorf("%s: %w", msiFile, err)
+	}
+	if err := os.WriteFile(msiFile, out, 0644); err != nil {
+		return fmt.Errorf("writing MSI: %w", err)
+	}
+	return nil
+}
+
+// readTransform reads the root storage of an .mst.
+func readTransform(filename string) (*cfbNode, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading transform: %w", err)
+	}
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	root, err := cf.tree()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return root, nil
+}
+
+// summaryProperty is a property of the summary information with its type
+// and value as stored.
+type summaryProperty struct {
+	id    uint32
+	value []byte
+}
+
+// parseSummary splits a property set stream with one section into the
+// header, which ends with the offset of the section, and its properties.
+func parseSummary(data []byte) (header []byte, props []summaryProperty, err error) {
+	const headerSize = 48 // Byte order to CLSID, set count, FMTID and offset
+	if len(data) < headerSize || binary.LittleEndian.Uint16(data) != 0xFFFE {
+		return nil, nil, fmt.Errorf("invalid summary information")
+	}
+	if binary.LittleEndian.Uint32(data[24:]) != 1 {
+		return nil, nil, fmt.Errorf("summary information has %d property sets", binary.LittleEndian.Uint32(data[24:]))
+	}
+	offset := int(binary.LittleEndian.Uint32(data[44:]))
+	if offset+8 > len(data) {
+		return nil, nil, fmt.Errorf("summary information truncated")
+	}
+	section := data[offset:]
+	size := int(binary.LittleEndian.Uint32(section))
+	count := int(binary.LittleEndian.Uint32(section[4:]))
+	if size > len(section) || 8+count*8 > size {
+		return nil, nil, fmt.Errorf("summary information truncated")
+	}
+	section = section[:size]
+
+	offsets := make([]int, count)
+	for i := range count {
+		offsets[i] = int(binary.LittleEndian.Uint32(section[12+i*8:]))
+	}
+	ends := slices.Sorted(slices.Values(append(offsets[:count:count], size)))
+	for i := range count {
+		start := offsets[i]
+		end := ends[slices.Index(ends, start)+1]
+		if start < 8+count*8 || end > size {
+			return nil, nil, fmt.Errorf("summary information property out of range")
+		}
+		props = append(props, summaryProperty{
+			id:    binary.LittleEndian.Uint32(section[8+i*8:]),
+			value: section[start:end],
+		})
+	}
+	return data[:headerSize], props, nil
+}
+
+// summaryString returns a string property of the summary information.
+func summaryString(data []byte, id uint32) (string, error) {
+	_, props, err := parseSummary(data)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range props {
+		if p.id != id {
+			continue
+		}
+		if len(p.value) < 8 || binary.LittleEndian.Uint32(p.value) != vtLPSTR {
+			return "", fmt.Errorf("summary information property %d is not a string", id)
+		}
+		n := int(binary.LittleEndian.Uint32(p.value[4:]))
+		if 8+n > len(p.value) {
+			return "", fmt.Errorf("summary information property %d truncated", id)
+		}
+		return strings.TrimRight(string(p.value[8:8+n]), "\x00"), nil
+	}
+	return "", fmt.Errorf("summary information has no property %d", id)
+}
+
+// setSummaryString returns the summary information with a string property
+// set, which must be ASCII to fit any codepage.
+func setSummaryString(data []byte, id uint32, value string) ([]byte, error) {
+	header, props, err := parseSummary(data)
+	if err != nil {
+		return nil, err
+	}
+	n := len(value) + 1
+	encoded := make([]byte, 8+(n+3)/4*4)
+	binary.LittleEndian.PutUint32(encoded, vtLPSTR)
+	binary.LittleEndian.PutUint32(encoded[4:], uint32(n))
+	copy(encoded[8:], value)
+
+	i := slices.IndexFunc(props, func(p summaryProperty) bool { return p.id == id })
+	if i < 0 {
+		props = append(props, summaryProperty{id: id})
+		i = len(props) - 1
+	}
+	props[i].value = encoded
+
+	section := make([]byte, 8+len(props)*8)
+	binary.LittleEndian.PutUint32(section[4:], uint32(len(props)))
+	for i, p := range props {
+		binary.LittleEndian.PutUint32(section[8+i*8:], p.id)
+		binary.LittleEndian.PutUint32(section[12+i*8:], uint32(len(section)))
+		section = append(section, p.value...)
+		for len(section)%4 != 0 {
+			section = append(section, 0)
+		}
+	}
+	binary.LittleEndian.PutUint32(section, uint32(len(section)))
+	out := slices.Clone(header)
+	binary.LittleEndian.PutUint32(out[44:], uint32(len(header)))
+	return append(out, section...), nil
+}
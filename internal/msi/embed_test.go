@@ -0,0 +1,154 @@
+package msi
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildSummary writes summary information with a title and the template.
+func buildSummary(template string) []byte {
+	header := make([]byte, 48)
+	binary.LittleEndian.PutUint16(header, 0xFFFE)
+	binary.LittleEndian.PutUint32(header[24:], 1)
+	binary.LittleEndian.PutUint32(header[44:], 48)
+	section := []byte{8, 0, 0, 0, 0, 0, 0, 0} // No properties yet
+	data, _ := setSummaryString(append(header, section...), 2, "Installation Database")
+	data, _ = setSummaryString(data, pidTemplate, template)
+	return data
+}
+
+// writeTestMSI writes a database with a Property table and summary
+// information to the folder.
+func writeTestMSI(t *testing.T, dir, template string) string {
+	t.Helper()
+	cf, err := openCompoundFile(buildDatabase([]testTable{propertyTable([]any{"ProductName", "My App"})}, nil, false))
+	if err != nil {
+		t.Fatalf("openCompoundFile failed: %v", err)
+	}
+	root, err := cf.tree()
+	if err != nil {
+		t.Fatalf("tree failed: %v", err)
+	}
+	root.children = append(root.children, &cfbNode{name: summaryStream, data: buildSummary(template)})
+	data, err := writeCompoundFile(root)
+	if err != nil {
+		t.Fatalf("writeCompoundFile failed: %v", err)
+	}
+	path := filepath.Join(dir, "app.msi")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestTransform writes an .mst with one table stream.
+func writeTestTransform(t *testing.T, dir, name, value string) string {
+	t.Helper()
+	path := filepath.Join(dir, name+".mst")
+	data := buildCompoundFile([]testStream{{name: encodeStreamName("Property", true), data: []byte(value)}})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readTestMSI returns the root storage and the template of an MSI.
+func readTestMSI(t *testing.T, path string) (*cfbNode, string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf, err := openCompoundFile(data)
+	if err != nil {
+		t.Fatalf("openCompoundFile failed: %v", err)
+	}
+	root, err := cf.tree()
+	if err != nil {
+		t.Fatalf("tree failed: %v", err)
+	}
+	template, err := summaryString(root.child(summaryStream).data, pidTemplate)
+	if err != nil {
+		t.Fatalf("summaryString failed: %v", err)
+	}
+	return root, template
+}
+
+func TestEmbedLanguageTransforms(t *testing.T) {
+	dir := t.TempDir()
+	msiFile := writeTestMSI(t, dir, "x64;1033")
+	err := EmbedLanguageTransforms(msiFile, []LanguageTransform{
+		{LCID: "1031", File: writeTestTransform(t, dir, "de-de", "German")},
+		{LCID: "1036", File: writeTestTransform(t, dir, "fr-fr", "French")},
+	})
+	if err != nil {
+		t.Fatalf("EmbedLanguageTransforms failed: %v", err)
+	}
+
+	root, template := readTestMSI(t, msiFile)
+	if template != "x64;1033,1031,1036" {
+		t.Errorf("template = %q, want x64;1033,1031,1036", template)
+	}
+	for lcid, want := range map[string]string{"1031": "German", "1036": "French"} {
+		storage := root.child(lcid)
+		if storage == nil || !storage.storage {
+			t.Fatalf("expected a substorage %s", lcid)
+		}
+		if table := storage.child(encodeStreamName("Property", true)); table == nil || string(table.data) != want {
+			t.Errorf("substorage %s does not hold its transform", lcid)
+		}
+	}
+	title, err := summaryString(root.child(summaryStream).data, 2)
+	if err != nil || title != "Installation Database" {
+		t.Errorf("title = %q, %v; other properties must be kept", title, err)
+	}
+
+	// The database itself is unchanged
+	db, err := Open(msiFile)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	table, err := db.Table("Property")
+	if err != nil || len(table.Rows) != 1 || table.Rows[0][1] != "My App" {
+		t.Errorf("Property table = %+v, %v", table, err)
+	}
+
+	// Embedding again replaces the language transforms
+	if err := EmbedLanguageTransforms(msiFile, []LanguageTransform{{LCID: "1031", File: writeTestTransform(t, dir, "de-de", "Deutsch")}}); err != nil {
+		t.Fatalf("EmbedLanguageTransforms failed: %v", err)
+	}
+	root, template = readTestMSI(t, msiFile)
+	if template != "x64;1033,1031" || root.child("1036") != nil {
+		t.Errorf("template = %q; expected the French transform to be removed", template)
+	}
+	if table := root.child("1031").child(encodeStreamName("Property", true)); string(table.data) != "Deutsch" {
+		t.Errorf("expected the German transform to be replaced, got %q", table.data)
+	}
+}
+
+func TestEmbedLanguageTransformsErrors(t *testing.T) {
+	dir := t.TempDir()
+	msiFile := writeTestMSI(t, dir, "Intel;1033")
+	transform := writeTestTransform(t, dir, "de-de", "German")
+	tests := []struct {
+		name       string
+		msiFile    string
+		transforms []LanguageTransform
+		want       string
+	}{
+		{"LCID", msiFile, []LanguageTransform{{LCID: "de-de", File: transform}}, `LCID "de-de" is not a number`},
+		{"missing transform", msiFile, []LanguageTransform{{LCID: "1031", File: filepath.Join(dir, "missing.mst")}}, "reading transform"},
+		{"not an MSI", transform, []LanguageTransform{{LCID: "1031", File: transform}}, "no summary information"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := EmbedLanguageTransforms(tt.msiFile, tt.transforms)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
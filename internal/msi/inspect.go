@@ -0,0 +1,136 @@
+package msi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InspectedTables are the tables reported by Inspect, in output order.
+var InspectedTables = []string{
+	"Property", "Feature", "Component", "File", "Directory",
+	"Registry", "Shortcut", "ServiceInstall", "CustomAction",
+}
+
+// Inspection summarizes the contents of an MSI file.
+type Inspection struct {
+	Path     string    `json:"path"`
+	Codepage int       `json:"codepage"`
+	Tables   []*Table  `json:"tables"`
+	Cabinets []Cabinet `json:"cabinets,omitempty"`
+}
+
+// Cabinet is a cabinet referenced from the Media table.
+type Cabinet struct {
+	Name     string        `json:"name"`
+	Embedded bool          `json:"embedded"`
+	Files    []CabinetFile `json:"files,omitempty"`
+}
+
+// CabinetFile is a cabinet entry joined with its File table row.
+type CabinetFile struct {
+	CabFile
+	FileName  string `json:"fileName,omitempty"`
+	Component string `json:"component,omitempty"`
+}
+
+// Inspect reads the standard tables and the cabinet file lists of an MSI.
+// Tables missing from the database are skipped.
+func Inspect(path string) (*Inspection, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Inspection{Path: path, Codepage: db.Codepage}
+	for _, name := range InspectedTables {
+		if !db.HasTable(name) {
+			continue
+		}
+		table, err := db.Table(name)
+		if err != nil {
+			return nil, err
+		}
+		result.Tables = append(result.Tables, table)
+	}
+
+	cabinets, err := db.cabinets()
+	if err != nil {
+		return nil, err
+	}
+	result.Cabinets = cabinets
+	return result, nil
+}
+
+// Table returns an inspected table by name, or nil.
+func (in *Inspection) Table(name string) *Table {
+	for _, t := range in.Tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// cabinets lists the cabinets named in the Media table. Embedded cabinets
+// ("#name") are read from their stream; external ones are only named.
+func (db *Database) cabinets() ([]Cabinet, error) {
+	if !db.HasTable("Media") {
+		return nil, nil
+	}
+	media, err := db.Table("Media")
+	if err != nil {
+		return nil, err
+	}
+	cabCol := media.ColumnIndex("Cabinet")
+	if cabCol < 0 {
+		return nil, nil
+	}
+
+	files := make(map[string][2]string) // File key -> long file name, component
+	if db.HasTable("File") {
+		fileTable, err := db.Table("File")
+		if err != nil {
+			return nil, err
+		}
+		keyCol, nameCol, compCol := fileTable.ColumnIndex("File"), fileTable.ColumnIndex("FileName"), fileTable.ColumnIndex("Component_")
+		for _, row := range fileTable.Rows {
+			key, _ := row[keyCol].(string)
+			name, _ := row[nameCol].(string)
+			comp, _ := row[compCol].(string)
+			files[key] = [2]string{LongFileName(name), comp}
+		}
+	}
+
+	var result []Cabinet
+	for _, row := range media.Rows {
+		name, _ := row[cabCol].(string)
+		if name == "" {
+			continue
+		}
+		cab := Cabinet{Name: strings.TrimPrefix(name, "#"), Embedded: strings.HasPrefix(name, "#")}
+		if cab.Embedded {
+			data, err := db.Stream(cab.Name)
+			if err != nil {
+				return nil, fmt.Errorf("reading cabinet: %w", err)
+			}
+			entries, err := ListCabinet(data)
+			if err != nil {
+				return nil, fmt.Errorf("cabinet %s: %w", cab.Name, err)
+			}
+			for _, entry := range entries {
+				info := files[entry.Name]
+				cab.Files = append(cab.Files, CabinetFile{CabFile: entry, FileName: info[0], Component: info[1]})
+			}
+		}
+		result = append(result, cab)
+	}
+	return result, nil
+}
+
+// LongFileName returns the long name of a "SHORT~1.EXE|LongName.exe" pair.
+func LongFileName(name string) string {
+	if i := strings.IndexByte(name, '|'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
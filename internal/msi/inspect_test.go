@@ -0,0 +1,85 @@
+package msi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	data := buildDatabase([]testTable{
+		propertyTable([]any{"ProductName", "My App"}),
+		{
+			name: "File",
+			columns: []Column{
+				strCol("File", true), strCol("Component_", false), strCol("FileName", false),
+				intCol("FileSize", 4, false), intCol("Sequence", 2, false),
+			},
+			rows: [][]any{
+				{"FILE_ID00000", "CID_1", "APP~1.EXE|app.exe", 100, 1},
+				{"FILE_ID00001", "CID_2", "readme.txt", 2048, 2},
+			},
+		},
+		{
+			name: "Media",
+			columns: []Column{
+				intCol("DiskId", 2, false), intCol("LastSequence", 4, false), strCol("Cabinet", false),
+			},
+			rows: [][]any{{1, 2, "#cab1.cab"}, {2, 3, "external.cab"}},
+		},
+	}, []testStream{
+		{name: "cab1.cab", data: buildCabinetHeader([]string{"FILE_ID00000", "FILE_ID00001"}, []uint32{100, 2048})},
+	}, false)
+
+	path := filepath.Join(t.TempDir(), "setup.msi")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := Inspect(path)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if in.Table("Property") == nil || in.Table("File") == nil {
+		t.Fatalf("expected Property and File tables, got %d tables", len(in.Tables))
+	}
+	if in.Table("Registry") != nil {
+		t.Error("tables missing from the database should be skipped")
+	}
+	if in.Table("Media") != nil {
+		t.Error("Media is not one of the inspected tables")
+	}
+
+	if len(in.Cabinets) != 2 {
+		t.Fatalf("expected 2 cabinets, got %d", len(in.Cabinets))
+	}
+	embedded := in.Cabinets[0]
+	if embedded.Name != "cab1.cab" || !embedded.Embedded || len(embedded.Files) != 2 {
+		t.Fatalf("unexpected embedded cabinet %+v", embedded)
+	}
+	if embedded.Files[0].FileName != "app.exe" || embedded.Files[0].Component != "CID_1" {
+		t.Errorf("cabinet entry not joined with File table: %+v", embedded.Files[0])
+	}
+	if in.Cabinets[1].Embedded || in.Cabinets[1].Files != nil {
+		t.Errorf("external cabinet should only be named: %+v", in.Cabinets[1])
+	}
+}
+
+func TestInspectNotMSI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setup.msi")
+	if err := os.WriteFile(path, []byte("not an msi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inspect(path); err == nil {
+		t.Error("expected error for non-MSI file")
+	}
+}
+
+func TestLongFileName(t *testing.T) {
+	if got := LongFileName("APP~1.EXE|app.exe"); got != "app.exe" {
+		t.Errorf("LongFileName = %q", got)
+	}
+	if got := LongFileName("app.exe"); got != "app.exe" {
+		t.Errorf("LongFileName = %q", got)
+	}
+}
@@ -0,0 +1,411 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"gopkg.in/yaml.v2"
+)
+
+// Syntax is the syntax of an .msis document.
+type Syntax int
+
+const (
+	XML  Syntax = iota // .msis
+	JSON               // .msis.json
+	YAML               // .msis.yaml or .msis.yml
+)
+
+// SyntaxOf returns the syntax of an .msis document by its file name.
+func SyntaxOf(filename string) Syntax {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".msis.json"):
+		return JSON
+	case strings.HasSuffix(lower, ".msis.yaml"), strings.HasSuffix(lower, ".msis.yml"):
+		return YAML
+	}
+	return XML
+}
+
+// TrimExt returns a file name without its .msis, .msis.json or .msis.yaml
+// extension, as the base for output file names.
+func TrimExt(filename string) string {
+	if SyntaxOf(filename) != XML {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// ParseJSON parses a .msis.json document.
+//
+// The document maps 1:1 onto ir.Setup. Elements are objects whose keys are
+// the attribute names of the XML syntax; the children of <setup>,
+// <feature> and <bundle> are arrays, so document order is kept:
+//
+//	{
+//	  "sets": [{"name": "PRODUCT_NAME", "value": "Demo"}],
+//	  "items": [{"files": {"source": "bin", "target": "[INSTALLDIR]"}}],
+//	  "features": [{"name": "Main", "items": [...], "features": [...]}],
+//	  "bundle": {"prerequisites": [...], "msi": {...}, "exePackages": [...]}
+//	}
+//
+// Each entry of "items" is an object with a single key, the element name.
+// Attribute values may be strings, numbers or booleans; the verbatim WiX of
+// a <wix> block is its "xml" key. Validation is the same as for XML.
+func ParseJSON(data []byte) (*ir.Setup, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber() // Keep "1.0" from becoming 1
+	var doc any
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	return parseDocument(doc)
+}
+
+// ParseYAML parses a .msis.yaml document, which has the structure described
+// for ParseJSON. Scalars keep their text, so version: 1.0 stays "1.0".
+func ParseYAML(data []byte) (*ir.Setup, error) {
+	var doc yamlNode
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing YAML: %w", err)
+	}
+	return parseDocument(doc.value)
+}
+
+// yamlNode decodes YAML into the generic form of encoding/json, with every
+// scalar as its source text.
+type yamlNode struct {
+	value any
+}
+
+func (n *yamlNode) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		n.value = s
+		return nil
+	}
+	var list []yamlNode
+	if err := unmarshal(&list); err == nil {
+		values := make([]any, len(list))
+		for i, v := range list {
+			values[i] = v.value
+		}
+		n.value = values
+		return nil
+	}
+	var m map[string]yamlNode
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+	values := make(map[string]any, len(m))
+	for k, v := range m {
+		values[k] = v.value
+	}
+	n.value = values
+	return nil
+}
+
+// parseDocument converts a decoded JSON or YAML document through the same
+// intermediate types and checks as the XML path.
+func parseDocument(doc any) (*ir.Setup, error) {
+	var raw xmlSetup
+	children, err := decodeElement("setup", doc, &raw, "sets", "requires", "setupTypes", "instances", "transforms", "items", "features", "bundle")
+	if err != nil {
+		return nil, err
+	}
+	if err := eachObject(children["sets"], "sets", func(path string, v any) error {
+		var set xmlSet
+		_, err := decodeElement("set", v, &set)
+		raw.Sets = append(raw.Sets, set)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := eachObject(children["requires"], "requires", func(path string, v any) error {
+		var req xmlRequires
+		if _, err := decodeElement("requires", v, &req); err != nil {
+			return err
+		}
+		if err := req.check(); err != nil {
+			return err
+		}
+		raw.Requires = append(raw.Requires, req)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := eachObject(children["setupTypes"], "setupTypes", func(path string, v any) error {
+		var st xmlSetupType
+		_, err := decodeElement("setup-type", v, &st)
+		raw.SetupTypes = append(raw.SetupTypes, st)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if v, ok := children["instances"]; ok {
+		raw.Instances = &xmlInstances{}
+		if _, err := decodeElement("instances", v, raw.Instances); err != nil {
+			return nil, fmt.Errorf("instances: %w", err)
+		}
+	}
+	if err := eachObject(children["transforms"], "transforms", func(path string, v any) error {
+		var t xmlTransform
+		children, err := decodeElement("transform", v, &t, "properties")
+		if err != nil {
+			return err
+		}
+		if err := eachObject(children["properties"], path+".properties", func(path string, v any) error {
+			var p xmlProperty
+			_, err := decodeElement("property", v, &p)
+			t.Properties = append(t.Properties, p)
+			return err
+		}); err != nil {
+			return err
+		}
+		raw.Transforms = append(raw.Transforms, t)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if raw.Items, err = decodeItems(children["items"], "setup", "items"); err != nil {
+		return nil, err
+	}
+	if raw.Features, err = decodeFeatures(children["features"], "features"); err != nil {
+		return nil, err
+	}
+	if v, ok := children["bundle"]; ok {
+		if raw.Bundle, err = decodeBundle(v); err != nil {
+			return nil, fmt.Errorf("bundle: %w", err)
+		}
+	}
+	return convertSetup(&raw)
+}
+
+func decodeFeatures(v any, path string) ([]xmlFeature, error) {
+	var features []xmlFeature
+	err := eachObject(v, path, func(path string, v any) error {
+		var f xmlFeature
+		children, err := decodeElement("feature", v, &f, "items", "features")
+		if err != nil {
+			return err
+		}
+		if f.Items, err = decodeItems(children["items"], "feature", path+".items"); err != nil {
+			return err
+		}
+		if f.SubFeatures, err = decodeFeatures(children["features"], path+".features"); err != nil {
+			return err
+		}
+		features = append(features, f)
+		return nil
+	})
+	return features, err
+}
+
+func decodeItems(v any, parent, path string) ([]ir.Item, error) {
+	var items []ir.Item
+	err := eachObject(v, path, func(path string, v any) error {
+		obj := v.(map[string]any)
+		if len(obj) != 1 {
+			return fmt.Errorf("an item needs exactly one key, the element name")
+		}
+		for name, attrs := range obj {
+			t, ok := itemTypes[name]
+			if !ok {
+				return fmt.Errorf("unknown element <%s> in <%s>", name, parent)
+			}
+			var childKeys []string
+			if t.Element().Verbatim {
+				childKeys = []string{"xml"}
+			}
+			start, children, err := decodeAttributes(name, attrs, childKeys...)
+			if err != nil {
+				return err
+			}
+			src := ItemSource{Name: name, Attrs: make(map[string]string, len(start.Attr))}
+			if content, ok := children["xml"]; ok {
+				if src.Content, err = scalar(content); err != nil {
+					return fmt.Errorf("'xml' of <%s> %w", name, err)
+				}
+			}
+			for _, attr := range start.Attr {
+				src.Attrs[attr.Name.Local] = attr.Value
+			}
+			item, err := t.Parse(src)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+func decodeBundle(v any) (*xmlBundle, error) {
+	var b xmlBundle
+	children, err := decodeElement("bundle", v, &b, "prerequisites", "msi", "exePackages")
+	if err != nil {
+		return nil, err
+	}
+	if err := eachObject(children["prerequisites"], "prerequisites", func(path string, v any) error {
+		var p xmlPrerequisite
+		if _, err := decodeElement("prerequisite", v, &p); err != nil {
+			return err
+		}
+		b.Prerequisites = append(b.Prerequisites, p)
+		return p.check()
+	}); err != nil {
+		return nil, err
+	}
+	if v, ok := children["msi"]; ok {
+		var msi xmlBundleMSI
+		if _, err := decodeElement("msi", v, &msi); err != nil {
+			return nil, fmt.Errorf("msi: %w", err)
+		}
+		if err := msi.check(); err != nil {
+			return nil, fmt.Errorf("msi: %w", err)
+		}
+		b.MSI = &msi
+	}
+	if err := eachObject(children["exePackages"], "exePackages", func(path string, v any) error {
+		var exe xmlExePackage
+		_, err := decodeElement("exe", v, &exe)
+		b.ExePackages = append(b.ExePackages, exe)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// eachObject calls fn for every object of an array, prefixing errors with
+// the path of the object. A missing array is empty.
+func eachObject(v any, path string, fn func(path string, v any) error) error {
+	if v == nil {
+		return nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("%s: must be an array", path)
+	}
+	for i, elem := range list {
+		elemPath := fmt.Sprintf("%s[%d]", path, i)
+		if _, ok := elem.(map[string]any); !ok {
+			return fmt.Errorf("%s: must be an object", elemPath)
+		}
+		if err := fn(elemPath, elem); err != nil {
+			// Errors of nested objects already carry a more precise path
+			var perr *pathError
+			if errors.As(err, &perr) {
+				return err
+			}
+			return &pathError{path: elemPath, err: err}
+		}
+	}
+	return nil
+}
+
+// pathError is an error in a JSON or YAML document, at a path like
+// features[0].items[2].
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string { return e.path + ": " + e.err.Error() }
+func (e *pathError) Unwrap() error { return e.err }
+
+// decodeElement validates the keys of an object against the registry entry
+// of an element and stores the attributes in v, an xml* struct, through its
+// attr struct tags. The values of the child keys are returned.
+func decodeElement(name string, value any, v any, childKeys ...string) (map[string]any, error) {
+	start, children, err := decodeAttributes(name, value, childKeys...)
+	if err != nil {
+		return nil, err
+	}
+	setAttributes(v, start.Attr)
+	return children, nil
+}
+
+// decodeAttributes validates the keys of an object against the registry
+// entry of an element and returns the attributes as a start element, and
+// the values of the child keys.
+func decodeAttributes(name string, value any, childKeys ...string) (xml.StartElement, map[string]any, error) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return xml.StartElement{}, nil, fmt.Errorf("<%s> must be an object", name)
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // Report the same error on every run
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	children := make(map[string]any)
+	for _, k := range keys {
+		if contains(childKeys, k) {
+			children[k] = obj[k]
+			continue
+		}
+		s, err := scalar(obj[k])
+		if err != nil {
+			return xml.StartElement{}, nil, fmt.Errorf("attribute '%s' on <%s> %w", k, name, err)
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: k}, Value: s})
+	}
+	if err := validateAttributes(start); err != nil {
+		return xml.StartElement{}, nil, err
+	}
+	return start, children, nil
+}
+
+// scalar returns the text of an attribute value.
+func scalar(v any) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case bool:
+		return fmt.Sprint(s), nil
+	case json.Number:
+		return s.String(), nil
+	}
+	return "", fmt.Errorf("must be a string, number or boolean")
+}
+
+// setAttributes stores attribute values in the fields of an xml* struct
+// whose tags name them, as xml.Decoder does.
+func setAttributes(v any, attrs []xml.Attr) {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("xml")
+		name, isAttr := strings.CutSuffix(tag, ",attr")
+		if !isAttr {
+			continue
+		}
+		for _, attr := range attrs {
+			if attr.Name.Local == name {
+				rv.Field(i).SetString(attr.Value)
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+func TestSyntaxOf(t *testing.T) {
+	tests := []struct {
+		filename string
+		syntax   Syntax
+		base     string
+	}{
+		{"setup.msis", XML, "setup"},
+		{"setup.msis.json", JSON, "setup"},
+		{"Setup.MSIS.JSON", JSON, "Setup"},
+		{"setup.msis.yaml", YAML, "setup"},
+		{"out/setup.msis.yml", YAML, "out/setup"},
+		{"manifest.json", XML, "manifest"},
+	}
+	for _, tt := range tests {
+		if got := SyntaxOf(tt.filename); got != tt.syntax {
+			t.Errorf("SyntaxOf(%q) = %d, want %d", tt.filename, got, tt.syntax)
+		}
+		if got := TrimExt(tt.filename); got != tt.base {
+			t.Errorf("TrimExt(%q) = %q, want %q", tt.filename, got, tt.base)
+		}
+	}
+}
+
+func TestParseDocumentItemOrder(t *testing.T) {
+	docs := map[string]func([]byte) (*ir.Setup, error){
+		`{
+  "sets": [{"name": "PRODUCT_VERSION", "value": 1.0}],
+  "features": [{
+    "name": "Test",
+    "enabled": false,
+    "items": [
+      {"files": {"source": "src1", "target": "[INSTALLDIR]dest1"}},
+      {"set-env": {"name": "VAR1", "value": "value1"}},
+      {"files": {"source": "src2", "target": "[INSTALLDIR]dest2"}},
+      {"execute": {"cmd": "setup.bat", "when": "after-install"}},
+      {"set-env": {"name": "VAR2", "value": "value2"}}
+    ]
+  }]
+}`: ParseJSON,
+		`sets:
+  - name: PRODUCT_VERSION
+    value: 1.0
+features:
+  - name: Test
+    enabled: no
+    items:
+      - files: {source: src1, target: "[INSTALLDIR]dest1"}
+      - set-env: {name: VAR1, value: value1}
+      - files: {source: src2, target: "[INSTALLDIR]dest2"}
+      - execute: {cmd: setup.bat, when: after-install}
+      - set-env: {name: VAR2, value: value2}
+`: ParseYAML,
+	}
+	for doc, parse := range docs {
+		setup, err := parse([]byte(doc))
+		if err != nil {
+			t.Fatalf("parse failed: %v\n%s", err, doc)
+		}
+		if len(setup.Sets) != 1 || setup.Sets[0].Value != "1.0" {
+			t.Errorf("version must keep its text, got %+v", setup.Sets)
+		}
+		if len(setup.Features) != 1 || setup.Features[0].Enabled {
+			t.Fatalf("expected one disabled feature, got %+v", setup.Features)
+		}
+		items := setup.Features[0].Items
+		expectedOrder := []string{"files", "set-env", "files", "execute", "set-env"}
+		if len(items) != len(expectedOrder) {
+			t.Fatalf("expected %d items, got %d", len(expectedOrder), len(items))
+		}
+		for i, expected := range expectedOrder {
+			if items[i].ItemType() != expected {
+				t.Errorf("item[%d]: expected %s, got %s", i, expected, items[i].ItemType())
+			}
+		}
+		if files := items[2].(ir.Files); files.Source != "src2" {
+			t.Errorf("item[2]: expected source src2, got %q", files.Source)
+		}
+	}
+}
+
+// TestParseDocumentValidation checks that JSON is validated like XML.
+func TestParseDocumentValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"unknown attribute", `{"features": [{"name": "A", "bogus": "x"}]}`, "features[0]: unknown attribute 'bogus' on <feature>"},
+		{"missing required", `{"features": [{"name": "A", "items": [{"files": {"source": "bin"}}]}]}`, "features[0].items[0]: <files> requires 'target' attribute"},
+		{"unknown element", `{"items": [{"bogus": {}}]}`, "items[0]: unknown element <bogus> in <setup>"},
+		{"two item keys", `{"items": [{"files": {}, "registry": {}}]}`, "exactly one key"},
+		{"cross-attribute rule", `{"requires": [{"type": "vcredist"}]}`, "requires[0]: <requires> requires 'version' or 'source' attribute"},
+		{"bundle msi", `{"bundle": {"msi": {}}}`, "bundle: msi: <msi> requires 'source'"},
+		{"nested value", `{"sets": [{"name": "A", "value": {"x": 1}}]}`, "attribute 'value' on <set> must be a string"},
+		{"not an array", `{"features": {"name": "A"}}`, "features: must be an array"},
+		{"syntax error", `{"features": [`, "parsing JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseJSON([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestDumpJSONRoundTrip checks that a dumped setup parses back to the same
+// setup, and that JSON input reads as YAML too.
+func TestDumpJSONRoundTrip(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "bootstrap", "*.msis"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no example files: %v", err)
+	}
+	files = append(files, "") // Plus every element of the test below
+	for _, file := range files {
+		var setup *ir.Setup
+		if file == "" {
+			setup, err = ParseBytes([]byte(`<setup silent="yes">
+  <set name="A" value="1"/>
+  <requires type="netfx" version="4.8"/>
+  <setup-type name="Typical" features="F" description="Most used"/>
+  <instances count="3" property="TENANT"/>
+  <transform name="site-a">
+    <property name="SERVER" value="a.example.com"/>
+  </transform>
+  <registry file="a.reg" permanent="true"/>
+  <feature name="F" allowed="false" condition="X=1">
+    <service file-name="s.exe" service-name="S" start="demand"/>
+    <feature name="G">
+      <remove-on-uninstall folder="[APPDATADIR]Logs"/>
+    </feature>
+  </feature>
+  <bundle>
+    <prerequisite type="vcredist" version="2022"/>
+    <msi source="a.msi"/>
+    <exe source="b.exe" args="/q"/>
+  </bundle>
+</setup>`))
+		} else {
+			setup, err = Parse(file)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		dump, err := DumpJSON(setup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, parse := range map[string]func([]byte) (*ir.Setup, error){"JSON": ParseJSON, "YAML": ParseYAML} {
+			again, err := parse(dump)
+			if err != nil {
+				t.Fatalf("%s: %s: %v\n%s", file, name, err, dump)
+			}
+			if got, _ := DumpJSON(again); !bytes.Equal(got, dump) {
+				t.Errorf("%s: %s round trip differs:\n%s\nwant:\n%s", file, name, got, dump)
+			}
+		}
+	}
+}
+
+func TestParseJSONFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "setup.msis.json")
+	doc := `{"silent": true, "items": [{"create-folder": {"target": "[INSTALLDIR]logs"}}]}`
+	if err := os.WriteFile(filename, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setup, err := Parse(filename)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !setup.Silent || len(setup.Items) != 1 || setup.Items[0].ItemType() != "create-folder" {
+		t.Errorf("unexpected setup: %+v", setup)
+	}
+}
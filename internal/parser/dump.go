@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// DumpJSON returns a setup as a .msis.json document, the structure
+// ParseJSON reads. Positions and comments are not part of the document.
+func DumpJSON(setup *ir.Setup) ([]byte, error) {
+	root := setupNode(setup)
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false) // Keep < and > of conditions and <wix> blocks readable
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(documentObject(&root)); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// documentArrays maps child elements to the keys of the arrays that hold
+// them in a document.
+var documentArrays = map[string]string{
+	"set":          "sets",
+	"requires":     "requires",
+	"setup-type":   "setupTypes",
+	"transform":    "transforms",
+	"property":     "properties",
+	"feature":      "features",
+	"prerequisite": "prerequisites",
+	"exe":          "exePackages",
+}
+
+// documentObject converts a node into an object of its attributes, followed
+// by its children grouped by key.
+func documentObject(n *node) object {
+	var obj object
+	if e, ok := LookupElement(n.name); ok {
+		for _, a := range e.Attributes {
+			v := n.attrs[a.Name]
+			switch {
+			case v == "" && !a.Required:
+			case a.Type == Bool:
+				obj = append(obj, field{a.Name, v == "true"})
+			default:
+				obj = append(obj, field{a.Name, v})
+			}
+		}
+	}
+	if n.content != "" {
+		obj = append(obj, field{"xml", n.content})
+	}
+	var keys []string
+	groups := make(map[string]any)
+	for i := range n.children {
+		child := &n.children[i]
+		key, isArray := documentArrays[child.name]
+		value := any(documentObject(child))
+		if slices.Contains(itemElements, child.name) {
+			key, isArray = "items", true
+			value = object{{child.name, value}}
+		}
+		if !isArray {
+			key = child.name // <bundle> and <msi> occur once
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		if isArray {
+			list, _ := groups[key].([]any)
+			groups[key] = append(list, value)
+		} else {
+			groups[key] = value
+		}
+	}
+	for _, key := range keys {
+		obj = append(obj, field{key, groups[key]})
+	}
+	return obj
+}
+
+// object is a JSON object that keeps the order of its keys.
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalValue(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// marshalValue is json.Marshal without escaping <, > and &.
+func marshalValue(v any) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,367 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// ItemSource is an item element as written in the .msis source, in any
+// syntax.
+type ItemSource struct {
+	Name     string            // Element name
+	Attrs    map[string]string // Attribute values; a missing attribute is ""
+	Content  string            // Inner XML of a Verbatim element
+	Pos      ir.Pos
+	Comments []string // Comments before the element, verbatim
+}
+
+// Bool returns a boolean attribute; missing and unknown values are false.
+func (s ItemSource) Bool(name string) bool {
+	return parseMsisBool(s.Attrs[name])
+}
+
+// BoolDefault returns a boolean attribute that defaults to def if missing.
+func (s ItemSource) BoolDefault(name string, def bool) bool {
+	return parseMsisBoolDefault(s.Attrs[name], def)
+}
+
+// ItemType reads and writes an item element, a child of <setup> and
+// <feature>. Its Element describes the attributes, which are validated
+// before Parse sees them; Parse checks what the schema cannot express.
+// Write is the inverse of Parse, for /FORMAT and /DUMP-IR.
+type ItemType interface {
+	Element() Element
+	Parse(src ItemSource) (ir.Item, error)
+	Write(item ir.Item) ItemSource
+}
+
+// RegisterItem adds an item element to the registry, after the built-in
+// ones. The element may then appear in <setup> and <feature>, and is part
+// of the XSD, the CLI help and the language server. RegisterItem is not
+// safe for concurrent use; call it before parsing, e.g. from init.
+func RegisterItem(t ItemType) error {
+	e := t.Element()
+	if e.Name == "" {
+		return fmt.Errorf("item element needs a name")
+	}
+	if _, ok := LookupElement(e.Name); ok {
+		return fmt.Errorf("element <%s> already exists", e.Name)
+	}
+	Elements = append(Elements, e)
+	for _, parent := range []string{"setup", "feature"} {
+		p, _ := LookupElement(parent)
+		p.Children = append(p.Children, e.Name)
+	}
+	itemElements = append(itemElements, e.Name)
+	itemTypes[e.Name] = t
+	return nil
+}
+
+// LookupItem returns the item type of an element.
+func LookupItem(name string) (ItemType, bool) {
+	t, ok := itemTypes[name]
+	return t, ok
+}
+
+// decodeItem validates the attributes of an item element and parses it.
+func decodeItem(d *xml.Decoder, start xml.StartElement, t ItemType, pos ir.Pos, comments []string) (ir.Item, error) {
+	if err := validateAttributes(start); err != nil {
+		return nil, err
+	}
+	src := ItemSource{Name: start.Name.Local, Attrs: make(map[string]string, len(start.Attr)), Pos: pos, Comments: comments}
+	if t.Element().Verbatim {
+		var content struct {
+			XML string `xml:",innerxml"`
+		}
+		if err := d.DecodeElement(&content, &start); err != nil {
+			return nil, err
+		}
+		src.Content = content.XML
+	} else if err := d.Skip(); err != nil {
+		return nil, err
+	}
+	for _, attr := range start.Attr {
+		src.Attrs[attr.Name.Local] = attr.Value
+	}
+	return t.Parse(src)
+}
+
+// writeItem returns the node of an item.
+func writeItem(item ir.Item) node {
+	t, ok := itemTypes[item.ItemType()]
+	if !ok {
+		return node{name: item.ItemType()}
+	}
+	src := t.Write(item)
+	return node{name: item.ItemType(), attrs: src.Attrs, comments: src.Comments, content: src.Content}
+}
+
+// checkWellFormed checks that verbatim XML content is well-formed: tags
+// balance and attributes are quoted. Namespace prefixes such as util: are
+// declared by the template, so they are not checked.
+func checkWellFormed(content string) error {
+	d := xml.NewDecoder(strings.NewReader("<wix>" + content + "</wix>"))
+	for {
+		if _, err := d.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("malformed XML: %w", err)
+		}
+	}
+}
+
+// builtinItem is an item type of msis itself. Its element is in Elements.
+type builtinItem struct {
+	name  string
+	parse func(src ItemSource) (ir.Item, error)
+	write func(item ir.Item) ItemSource
+}
+
+func (b builtinItem) Element() Element {
+	e, _ := LookupElement(b.name)
+	return *e
+}
+
+func (b builtinItem) Parse(src ItemSource) (ir.Item, error) { return b.parse(src) }
+func (b builtinItem) Write(item ir.Item) ItemSource         { return b.write(item) }
+
+// itemTypes are the item types by element name.
+var itemTypes = map[string]ItemType{}
+
+func init() {
+	for _, b := range builtinItems {
+		itemTypes[b.name] = b
+	}
+}
+
+// builtinItems are the items of msis, in the order of itemElements.
+var builtinItems = []builtinItem{
+	{
+		name: "files",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Files{
+				Source:         src.Attrs["source"],
+				Target:         src.Attrs["target"],
+				DoNotOverwrite: src.Bool("do-not-overwrite"),
+				Pos:            src.Pos,
+				Comments:       src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Files)
+			return ItemSource{
+				Attrs:    map[string]string{"source": v.Source, "target": v.Target, "do-not-overwrite": boolAttr(v.DoNotOverwrite)},
+				Comments: v.Comments,
+			}
+		},
+	},
+	{
+		name: "registry",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Registry{
+				File:      src.Attrs["file"],
+				SDDL:      src.Attrs["sddl"],
+				Preserve:  src.Bool("preserve"),
+				Permanent: src.Bool("permanent"),
+				Condition: src.Attrs["condition"],
+				Pos:       src.Pos,
+				Comments:  src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Registry)
+			return ItemSource{
+				Attrs:    map[string]string{"file": v.File, "sddl": v.SDDL, "preserve": boolAttr(v.Preserve), "permanent": boolAttr(v.Permanent), "condition": v.Condition},
+				Comments: v.Comments,
+			}
+		},
+	},
+	{
+		name: "set-env",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.SetEnv{
+				Name:      src.Attrs["name"],
+				Value:     src.Attrs["value"],
+				Permanent: src.Bool("permanent"),
+				Pos:       src.Pos,
+				Comments:  src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.SetEnv)
+			return ItemSource{
+				Attrs:    map[string]string{"name": v.Name, "value": v.Value, "permanent": boolAttr(v.Permanent)},
+				Comments: v.Comments,
+			}
+		},
+	},
+	{
+		name: "shortcut",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Shortcut{
+				Name:        src.Attrs["name"],
+				Target:      src.Attrs["target"],
+				File:        src.Attrs["file"],
+				Description: src.Attrs["description"],
+				Icon:        src.Attrs["icon"],
+				Pos:         src.Pos,
+				Comments:    src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Shortcut)
+			return ItemSource{
+				Attrs:    map[string]string{"name": v.Name, "target": v.Target, "file": v.File, "description": v.Description, "icon": v.Icon},
+				Comments: v.Comments,
+			}
+		},
+	},
+	{
+		name: "service",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Service{
+				FileName:           src.Attrs["file-name"],
+				ServiceName:        src.Attrs["service-name"],
+				ServiceDisplayName: src.Attrs["service-display-name"],
+				Start:              src.Attrs["start"],
+				Description:        src.Attrs["description"],
+				ServiceType:        src.Attrs["service-type"],
+				ErrorControl:       src.Attrs["error-control"],
+				Restart:            src.Attrs["restart"],
+				StartAfterInstall:  src.Attrs["start-after-install"],
+				Pos:                src.Pos,
+				Comments:           src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Service)
+			return ItemSource{
+				Attrs: map[string]string{
+					"file-name":            v.FileName,
+					"service-name":         v.ServiceName,
+					"service-display-name": v.ServiceDisplayName,
+					"start":                v.Start,
+					"description":          v.Description,
+					"service-type":         v.ServiceType,
+					"error-control":        v.ErrorControl,
+					"restart":              v.Restart,
+					"start-after-install":  v.StartAfterInstall,
+				},
+				Comments: v.Comments,
+			}
+		},
+	},
+	{
+		name: "exclude",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Exclude{Folder: src.Attrs["folder"], Pos: src.Pos, Comments: src.Comments}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Exclude)
+			return ItemSource{Attrs: map[string]string{"folder": v.Folder}, Comments: v.Comments}
+		},
+	},
+	{
+		name: "create-folder",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.CreateFolder{Target: src.Attrs["target"], Pos: src.Pos, Comments: src.Comments}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.CreateFolder)
+			return ItemSource{Attrs: map[string]string{"target": v.Target}, Comments: v.Comments}
+		},
+	},
+	{
+		name: "execute",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Execute{
+				Cmd:       src.Attrs["cmd"],
+				When:      src.Attrs["when"],
+				Directory: src.Attrs["directory"],
+				Pos:       src.Pos,
+				Comments:  src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Execute)
+			return ItemSource{Attrs: map[string]string{"cmd": v.Cmd, "when": v.When, "directory": v.Directory}, Comments: v.Comments}
+		},
+	},
+	{
+		name: "remove-on-uninstall",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.RemoveOnUninstall{
+				Registry: src.Attrs["registry"],
+				Folder:   src.Attrs["folder"],
+				Pos:      src.Pos,
+				Comments: src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.RemoveOnUninstall)
+			return ItemSource{Attrs: map[string]string{"registry": v.Registry, "folder": v.Folder}, Comments: v.Comments}
+		},
+	},
+	{
+		name: "wix",
+		parse: func(src ItemSource) (ir.Item, error) {
+			if err := checkWellFormed(src.Content); err != nil {
+				return nil, fmt.Errorf("<wix>: %w", err)
+			}
+			return ir.Wix{Slot: src.Attrs["slot"], XML: src.Content, Pos: src.Pos, Comments: src.Comments}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Wix)
+			return ItemSource{Attrs: map[string]string{"slot": v.Slot}, Content: v.XML, Comments: v.Comments}
+		},
+	},
+	{
+		name: "merge-module",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.MergeModule{Source: src.Attrs["source"], Target: src.Attrs["target"], Pos: src.Pos, Comments: src.Comments}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.MergeModule)
+			return ItemSource{Attrs: map[string]string{"source": v.Source, "target": v.Target}, Comments: v.Comments}
+		},
+	},
+	{
+		name: "directory",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.Directory{
+				ID:           src.Attrs["id"],
+				Root:         src.Attrs["root"],
+				Path:         src.Attrs["path"],
+				Configurable: src.Bool("configurable"),
+				Pos:          src.Pos,
+				Comments:     src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.Directory)
+			return ItemSource{
+				Attrs:    map[string]string{"id": v.ID, "root": v.Root, "path": v.Path, "configurable": boolAttr(v.Configurable)},
+				Comments: v.Comments,
+			}
+		},
+	},
+	{
+		name: "wix-reference",
+		parse: func(src ItemSource) (ir.Item, error) {
+			return ir.WixReference{
+				Source:         src.Attrs["source"],
+				ComponentGroup: src.Attrs["component-group"],
+				Pos:            src.Pos,
+				Comments:       src.Comments,
+			}, nil
+		},
+		write: func(item ir.Item) ItemSource {
+			v := item.(ir.WixReference)
+			return ItemSource{Attrs: map[string]string{"source": v.Source, "component-group": v.ComponentGroup}, Comments: v.Comments}
+		},
+	},
+}
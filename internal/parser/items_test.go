@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// licenseKey is a custom item for the registry tests.
+type licenseKey struct {
+	Value    string
+	Hidden   bool
+	Pos      ir.Pos
+	Comments []string
+}
+
+func (l licenseKey) ItemType() string { return "license-key" }
+func (l licenseKey) Position() ir.Pos { return l.Pos }
+
+type licenseKeyType struct{}
+
+func (licenseKeyType) Element() Element {
+	return Element{
+		Name: "license-key",
+		Doc:  "Stores a license key.",
+		Attributes: []Attribute{
+			{Name: "value", Type: String, Required: true, Doc: "The key."},
+			{Name: "hidden", Type: Bool, Doc: "Hide the key in the UI."},
+		},
+	}
+}
+
+func (licenseKeyType) Parse(src ItemSource) (ir.Item, error) {
+	if len(src.Attrs["value"]) != 8 {
+		return nil, fmt.Errorf("license key %q must have 8 characters", src.Attrs["value"])
+	}
+	return licenseKey{Value: src.Attrs["value"], Hidden: src.Bool("hidden"), Pos: src.Pos, Comments: src.Comments}, nil
+}
+
+func (licenseKeyType) Write(item ir.Item) ItemSource {
+	l := item.(licenseKey)
+	return ItemSource{Attrs: map[string]string{"value": l.Value, "hidden": boolAttr(l.Hidden)}, Comments: l.Comments}
+}
+
+// registerTestItem registers an item type and restores the registry when
+// the test ends, so the XSD tests keep seeing the built-in elements only.
+func registerTestItem(t *testing.T, it ItemType) {
+	t.Helper()
+	elements := slices.Clone(Elements)
+	for i := range elements {
+		elements[i].Children = slices.Clone(elements[i].Children)
+	}
+	items := slices.Clone(itemElements)
+	types := maps.Clone(itemTypes)
+	t.Cleanup(func() {
+		Elements, itemElements, itemTypes = elements, items, types
+	})
+	if err := RegisterItem(it); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisterItem(t *testing.T) {
+	registerTestItem(t, licenseKeyType{})
+
+	setup, err := ParseBytes([]byte(`<setup>
+  <feature name="Main">
+    <!-- Demo key -->
+    <license-key value="ABCD1234" hidden="yes"/>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := setup.Features[0].Items
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	l, ok := items[0].(licenseKey)
+	if !ok || l.Value != "ABCD1234" || !l.Hidden || l.Pos.Line != 4 || len(l.Comments) != 1 {
+		t.Errorf("unexpected item %+v", items[0])
+	}
+
+	var b strings.Builder
+	if err := Write(&b, setup); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `<license-key value="ABCD1234" hidden="true"/>`) {
+		t.Errorf("custom item not written:\n%s", b.String())
+	}
+
+	setup, err = ParseYAML([]byte("items:\n  - license-key: {value: ABCD1234}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(setup.Items) != 1 || setup.Items[0].(licenseKey).Value != "ABCD1234" {
+		t.Errorf("unexpected YAML items %+v", setup.Items)
+	}
+
+	if !strings.Contains(string(XSD()), `name="license-key"`) {
+		t.Error("custom item missing from the XSD")
+	}
+}
+
+func TestRegisterItemErrors(t *testing.T) {
+	registerTestItem(t, licenseKeyType{})
+
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{"unknown attribute", `<setup><license-key value="ABCD1234" color="red"/></setup>`, "color"},
+		{"missing attribute", `<setup><license-key/></setup>`, "value"},
+		{"parse error", `<setup><license-key value="short"/></setup>`, "must have 8 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBytes([]byte(tt.xml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if err := RegisterItem(licenseKeyType{}); err == nil {
+		t.Error("registering an element twice should fail")
+	}
+}
@@ -2,8 +2,11 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -11,21 +14,54 @@ import (
 )
 
 // Parse reads an .msis file and returns the parsed Setup structure.
+// .msis.json and .msis.yaml files are read with ParseJSON and ParseYAML.
 func Parse(filename string) (*ir.Setup, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("reading file: %w", err)
 	}
 
+	switch SyntaxOf(filename) {
+	case JSON:
+		return ParseJSON(data)
+	case YAML:
+		return ParseYAML(data)
+	}
 	return ParseBytes(data)
 }
 
-// ParseBytes parses .msis XML from a byte slice.
+// ParseBytes parses .msis XML from a byte slice. Comments are kept with the
+// element that follows them, so Write can reproduce them; comments after
+// </setup> are kept with the setup.
 func ParseBytes(data []byte) (*ir.Setup, error) {
 	var raw xmlSetup
-	if err := xml.Unmarshal(data, &raw); err != nil {
-		return nil, fmt.Errorf("parsing XML: %w", err)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var comments []string
+	decoded := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF && decoded {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing XML: %w", err)
+		}
+		if c, ok := tok.(xml.Comment); ok {
+			comments = append(comments, string(c))
+			continue
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			if decoded {
+				return nil, fmt.Errorf("parsing XML: <%s> after </setup>", start.Name.Local)
+			}
+			if err := d.DecodeElement(&raw, &start); err != nil {
+				return nil, fmt.Errorf("parsing XML: %w", err)
+			}
+			raw.Comments, comments = comments, nil
+			decoded = true
+		}
 	}
+	raw.FinalComments = comments
 
 	return convertSetup(&raw)
 }
@@ -36,98 +72,44 @@ type xmlSetup struct {
 	XMLName xml.Name `xml:"setup"`
 	Silent  string   `xml:"silent,attr"`
 	// Children captured in document order via custom UnmarshalXML
-	Sets     []xmlSet
-	Requires []xmlRequires // Top-level runtime requirements
-	Features []xmlFeature
-	Items    []xmlItem // Preserves document order
-	Bundle   *xmlBundle
-}
-
-// xmlItem holds any item type with its original position
-type xmlItem struct {
-	Type              string // "files", "registry", "set-env", etc.
-	Files             *xmlFiles
-	Registry          *xmlRegistry
-	SetEnv            *xmlSetEnv
-	Shortcut          *xmlShortcut
-	Service           *xmlService
-	Exclude           *xmlExclude
-	Execute           *xmlExecute
-	CreateFolder      *xmlCreateFolder
-	RemoveOnUninstall *xmlRemoveOnUninstall
+	Sets       []xmlSet
+	Requires   []xmlRequires // Top-level runtime requirements
+	SetupTypes []xmlSetupType
+	Instances  *xmlInstances
+	Transforms []xmlTransform
+	Features   []xmlFeature
+	Items      []ir.Item // Preserves document order
+	Bundle     *xmlBundle
+
+	Comments         []string `xml:"-"` // Comments before <setup>
+	TrailingComments []string `xml:"-"` // Comments before </setup>
+	FinalComments    []string `xml:"-"` // Comments after </setup>
 }
 
 type xmlSet struct {
-	Name  string `xml:"name,attr"`
-	Value string `xml:"value,attr"`
+	Name     string   `xml:"name,attr"`
+	Value    string   `xml:"value,attr"`
+	Comments []string `xml:"-"` // Comments before the element
 }
 
 type xmlFeature struct {
-	Name        string `xml:"name,attr"`
-	Enabled     string `xml:"enabled,attr"`
-	Condition   string `xml:"condition,attr"`
-	Allowed     string `xml:"allowed,attr"`
-	SubFeatures []xmlFeature
-	Items       []xmlItem // Preserves document order
-}
-
-type xmlFiles struct {
-	Source         string `xml:"source,attr"`
-	Target         string `xml:"target,attr"`
-	DoNotOverwrite string `xml:"do-not-overwrite,attr"`
-}
-
-type xmlRegistry struct {
-	File      string `xml:"file,attr"`
-	SDDL      string `xml:"sddl,attr"`
-	Preserve  string `xml:"preserve,attr"`
-	Permanent string `xml:"permanent,attr"`
-	Condition string `xml:"condition,attr"`
-}
-
-type xmlSetEnv struct {
-	Name      string `xml:"name,attr"`
-	Value     string `xml:"value,attr"`
-	Permanent string `xml:"permanent,attr"`
-}
-
-type xmlShortcut struct {
-	Name        string `xml:"name,attr"`
-	Target      string `xml:"target,attr"`
-	File        string `xml:"file,attr"`
-	Description string `xml:"description,attr"`
-	Icon        string `xml:"icon,attr"`
-}
-
-type xmlService struct {
-	FileName           string `xml:"file-name,attr"`
-	ServiceName        string `xml:"service-name,attr"`
-	ServiceDisplayName string `xml:"service-display-name,attr"`
-	Start              string `xml:"start,attr"`
-	Description        string `xml:"description,attr"`
-	ServiceType        string `xml:"service-type,attr"`
-	ErrorControl       string `xml:"error-control,attr"`
-	Restart            string `xml:"restart,attr"`
-	StartAfterInstall  string `xml:"start-after-install,attr"`
-}
-
-type xmlExclude struct {
-	Folder string `xml:"folder,attr"`
-}
-
-type xmlExecute struct {
-	Cmd       string `xml:"cmd,attr"`
-	When      string `xml:"when,attr"`
-	Directory string `xml:"directory,attr"`
-}
-
-type xmlCreateFolder struct {
-	Target string `xml:"target,attr"`
-}
-
-type xmlRemoveOnUninstall struct {
-	Registry string `xml:"registry,attr"`
-	Folder   string `xml:"folder,attr"`
+	Name           string `xml:"name,attr"`
+	Enabled        string `xml:"enabled,attr"`
+	Condition      string `xml:"condition,attr"`
+	Allowed        string `xml:"allowed,attr"`
+	ID             string `xml:"id,attr"`
+	Description    string `xml:"description,attr"`
+	Display        string `xml:"display,attr"`
+	Level          string `xml:"level,attr"`
+	Advertise      string `xml:"advertise,attr"`
+	InstallDefault string `xml:"install-default,attr"`
+	TypicalDefault string `xml:"typical-default,attr"`
+	SubFeatures    []xmlFeature
+	Items          []ir.Item // Preserves document order
+	Pos            ir.Pos
+
+	Comments         []string `xml:"-"` // Comments before <feature>
+	TrailingComments []string `xml:"-"` // Comments before </feature>
 }
 
 type xmlBundle struct {
@@ -140,280 +122,190 @@ type xmlBundle struct {
 	Prerequisites []xmlPrerequisite
 	MSI           *xmlBundleMSI
 	ExePackages   []xmlExePackage
+
+	Comments         []string `xml:"-"` // Comments before <bundle>
+	TrailingComments []string `xml:"-"` // Comments before </bundle>
 }
 
 type xmlPrerequisite struct {
-	Type    string `xml:"type,attr"`
-	Version string `xml:"version,attr"`
-	Source  string `xml:"source,attr"`
+	Type     string   `xml:"type,attr"`
+	Version  string   `xml:"version,attr"`
+	Source   string   `xml:"source,attr"`
+	Comments []string `xml:"-"` // Comments before the element
 }
 
 type xmlBundleMSI struct {
-	Source      string `xml:"source,attr"`
-	Source64bit string `xml:"source_64bit,attr"`
-	Source32bit string `xml:"source_32bit,attr"`
-	SourceArm64 string `xml:"source_arm64,attr"`
+	Source      string   `xml:"source,attr"`
+	Source64bit string   `xml:"source_64bit,attr"`
+	Source32bit string   `xml:"source_32bit,attr"`
+	SourceArm64 string   `xml:"source_arm64,attr"`
+	Comments    []string `xml:"-"` // Comments before the element
 }
 
 type xmlExePackage struct {
-	ID              string `xml:"id,attr"`
-	Source          string `xml:"source,attr"`
-	DetectCondition string `xml:"detect,attr"`
-	InstallArgs     string `xml:"args,attr"`
+	ID              string   `xml:"id,attr"`
+	Source          string   `xml:"source,attr"`
+	DetectCondition string   `xml:"detect,attr"`
+	InstallArgs     string   `xml:"args,attr"`
+	Comments        []string `xml:"-"` // Comments before the element
 }
 
 // xmlRequires represents a top-level runtime requirement
 type xmlRequires struct {
-	Type    string `xml:"type,attr"`
-	Version string `xml:"version,attr"`
-	Source  string `xml:"source,attr"`
+	Type     string   `xml:"type,attr"`
+	Version  string   `xml:"version,attr"`
+	Source   string   `xml:"source,attr"`
+	Comments []string `xml:"-"` // Comments before the element
+}
+
+// xmlSetupType represents a setup type
+type xmlSetupType struct {
+	Name        string   `xml:"name,attr"`
+	Features    string   `xml:"features,attr"`
+	Description string   `xml:"description,attr"`
+	Pos         ir.Pos   `xml:"-"`
+	Comments    []string `xml:"-"` // Comments before the element
+}
+
+// xmlInstances represents the instances of a multiple-instance package
+type xmlInstances struct {
+	Count    string   `xml:"count,attr"`
+	Property string   `xml:"property,attr"`
+	Pos      ir.Pos   `xml:"-"`
+	Comments []string `xml:"-"` // Comments before the element
 }
 
+// xmlTransform represents a configuration preset built into an .mst
+type xmlTransform struct {
+	Name       string `xml:"name,attr"`
+	Properties []xmlProperty
+
+	Pos              ir.Pos   `xml:"-"`
+	Comments         []string `xml:"-"` // Comments before <transform>
+	TrailingComments []string `xml:"-"` // Comments before </transform>
+}
+
+// xmlProperty represents a property default of a transform
+type xmlProperty struct {
+	Name     string   `xml:"name,attr"`
+	Value    string   `xml:"value,attr"`
+	Comments []string `xml:"-"` // Comments before the element
+}
+
+// The leaf elements validate their attributes against the Elements
+// registry and then decode them through their struct tags. The plain type
+// conversion drops the UnmarshalXML method, so DecodeElement does not recurse.
+
 // UnmarshalXML for xmlSet - validates attributes
 func (s *xmlSet) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasName, hasValue := false, false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "name":
-			s.Name = attr.Value
-			hasName = true
-		case "value":
-			s.Value = attr.Value
-			hasValue = true
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <set>", attr.Name.Local)
-		}
-	}
-	if !hasName {
-		return fmt.Errorf("<set> requires 'name' attribute")
-	}
-	if !hasValue {
-		return fmt.Errorf("<set> requires 'value' attribute")
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	// Consume any content (should be empty)
-	return d.Skip()
+	type plain xmlSet
+	return d.DecodeElement((*plain)(s), &start)
 }
 
-// UnmarshalXML for xmlFiles - validates attributes
-func (f *xmlFiles) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasSource, hasTarget := false, false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "source":
-			f.Source = attr.Value
-			hasSource = true
-		case "target":
-			f.Target = attr.Value
-			hasTarget = true
-		case "do-not-overwrite":
-			f.DoNotOverwrite = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <files>", attr.Name.Local)
-		}
-	}
-	if !hasSource {
-		return fmt.Errorf("<files> requires 'source' attribute")
+// UnmarshalXML for xmlSetupType - validates attributes
+func (t *xmlSetupType) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	if !hasTarget {
-		return fmt.Errorf("<files> requires 'target' attribute")
-	}
-	return d.Skip()
+	type plain xmlSetupType
+	return d.DecodeElement((*plain)(t), &start)
 }
 
-// UnmarshalXML for xmlRegistry - validates attributes
-func (r *xmlRegistry) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasFile := false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "file":
-			r.File = attr.Value
-			hasFile = true
-		case "sddl":
-			r.SDDL = attr.Value
-		case "preserve":
-			r.Preserve = attr.Value
-		case "permanent":
-			r.Permanent = attr.Value
-		case "condition":
-			r.Condition = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <registry>", attr.Name.Local)
-		}
-	}
-	if !hasFile {
-		return fmt.Errorf("<registry> requires 'file' attribute")
+// UnmarshalXML for xmlInstances - validates attributes
+func (i *xmlInstances) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	return d.Skip()
+	type plain xmlInstances
+	return d.DecodeElement((*plain)(i), &start)
 }
 
-// UnmarshalXML for xmlSetEnv - validates attributes
-func (s *xmlSetEnv) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasName, hasValue := false, false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "name":
-			s.Name = attr.Value
-			hasName = true
-		case "value":
-			s.Value = attr.Value
-			hasValue = true
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <set-env>", attr.Name.Local)
-		}
-	}
-	if !hasName {
-		return fmt.Errorf("<set-env> requires 'name' attribute")
+// UnmarshalXML for xmlProperty - validates attributes
+func (p *xmlProperty) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	if !hasValue {
-		return fmt.Errorf("<set-env> requires 'value' attribute")
-	}
-	return d.Skip()
+	type plain xmlProperty
+	return d.DecodeElement((*plain)(p), &start)
 }
 
-// UnmarshalXML for xmlShortcut - validates attributes
-func (s *xmlShortcut) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasName, hasTarget, hasFile := false, false, false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "name":
-			s.Name = attr.Value
-			hasName = true
-		case "target":
-			s.Target = attr.Value
-			hasTarget = true
-		case "file":
-			s.File = attr.Value
-			hasFile = true
-		case "description":
-			s.Description = attr.Value
-		case "icon":
-			s.Icon = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <shortcut>", attr.Name.Local)
-		}
-	}
-	if !hasName {
-		return fmt.Errorf("<shortcut> requires 'name' attribute")
-	}
-	if !hasTarget {
-		return fmt.Errorf("<shortcut> requires 'target' attribute")
+// UnmarshalXML for xmlRequires - validates attributes
+func (r *xmlRequires) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	if !hasFile {
-		return fmt.Errorf("<shortcut> requires 'file' attribute")
+	type plain xmlRequires
+	if err := d.DecodeElement((*plain)(r), &start); err != nil {
+		return err
 	}
-	return d.Skip()
+	return r.check()
 }
 
-// UnmarshalXML for xmlService - validates attributes
-func (s *xmlService) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasFileName, hasServiceName := false, false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "file-name":
-			s.FileName = attr.Value
-			hasFileName = true
-		case "service-name":
-			s.ServiceName = attr.Value
-			hasServiceName = true
-		case "service-display-name":
-			s.ServiceDisplayName = attr.Value
-		case "start":
-			s.Start = attr.Value
-		case "description":
-			s.Description = attr.Value
-		case "service-type":
-			s.ServiceType = attr.Value
-		case "error-control":
-			s.ErrorControl = attr.Value
-		case "restart":
-			s.Restart = attr.Value
-		case "start-after-install":
-			s.StartAfterInstall = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <service>", attr.Name.Local)
-		}
-	}
-	if !hasFileName {
-		return fmt.Errorf("<service> requires 'file-name' attribute")
-	}
-	if !hasServiceName {
-		return fmt.Errorf("<service> requires 'service-name' attribute")
+// check normalizes the type and validates the rules that span attributes.
+func (r *xmlRequires) check() error {
+	r.Type = strings.ToLower(r.Type) // Normalize to lowercase
+	if r.Version == "" && r.Source == "" {
+		return fmt.Errorf("<requires> requires 'version' or 'source' attribute")
 	}
-	return d.Skip()
+	return nil
 }
 
-// UnmarshalXML for xmlExclude - validates attributes
-func (e *xmlExclude) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasFolder := false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "folder":
-			e.Folder = attr.Value
-			hasFolder = true
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <exclude>", attr.Name.Local)
-		}
+// UnmarshalXML for xmlPrerequisite - validates attributes
+func (p *xmlPrerequisite) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	if !hasFolder {
-		return fmt.Errorf("<exclude> requires 'folder' attribute")
+	type plain xmlPrerequisite
+	if err := d.DecodeElement((*plain)(p), &start); err != nil {
+		return err
 	}
-	return d.Skip()
+	return p.check()
 }
 
-// UnmarshalXML for xmlExecute - validates attributes
-func (e *xmlExecute) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasCmd, hasWhen := false, false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "cmd":
-			e.Cmd = attr.Value
-			hasCmd = true
-		case "when":
-			e.When = attr.Value
-			hasWhen = true
-		case "directory":
-			e.Directory = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <execute>", attr.Name.Local)
-		}
+func (p *xmlPrerequisite) check() error {
+	if p.Version == "" && p.Source == "" {
+		return fmt.Errorf("<prerequisite> requires 'version' or 'source' attribute")
 	}
-	if !hasCmd {
-		return fmt.Errorf("<execute> requires 'cmd' attribute")
+	return nil
+}
+
+// UnmarshalXML for xmlBundleMSI - validates attributes
+func (m *xmlBundleMSI) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	if !hasWhen {
-		return fmt.Errorf("<execute> requires 'when' attribute")
+	type plain xmlBundleMSI
+	if err := d.DecodeElement((*plain)(m), &start); err != nil {
+		return err
 	}
-	return d.Skip()
+	return m.check()
 }
 
-// UnmarshalXML for xmlRequires - validates attributes
-func (r *xmlRequires) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	hasType := false
-	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "type":
-			r.Type = strings.ToLower(attr.Value) // Normalize to lowercase
-			hasType = true
-		case "version":
-			r.Version = attr.Value
-		case "source":
-			r.Source = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <requires>", attr.Name.Local)
-		}
-	}
-	if !hasType {
-		return fmt.Errorf("<requires> requires 'type' attribute")
+func (m *xmlBundleMSI) check() error {
+	if m.Source == "" && m.Source64bit == "" && m.Source32bit == "" && m.SourceArm64 == "" {
+		return fmt.Errorf("<msi> requires 'source', 'source_64bit', 'source_32bit', or 'source_arm64' attribute")
 	}
-	if r.Version == "" && r.Source == "" {
-		return fmt.Errorf("<requires> requires 'version' or 'source' attribute")
+	return nil
+}
+
+// UnmarshalXML for xmlExePackage - validates attributes
+func (e *xmlExePackage) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
 	}
-	return d.Skip()
+	type plain xmlExePackage
+	return d.DecodeElement((*plain)(e), &start)
 }
 
 // UnmarshalXML for xmlBundle - supports both legacy shorthand and nested elements
 func (b *xmlBundle) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	// Parse attributes (legacy shorthand)
+	if err := validateAttributes(start); err != nil {
+		return err
+	}
 	for _, attr := range start.Attr {
 		switch attr.Name.Local {
 		case "source_64bit":
@@ -422,12 +314,11 @@ func (b *xmlBundle) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			b.Source32bit = attr.Value
 		case "source_arm64":
 			b.SourceArm64 = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <bundle>", attr.Name.Local)
 		}
 	}
 
 	// Parse nested elements
+	var comments []string
 	for {
 		tok, err := d.Token()
 		if err != nil {
@@ -435,6 +326,8 @@ func (b *xmlBundle) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		}
 
 		switch t := tok.(type) {
+		case xml.Comment:
+			comments = append(comments, string(t))
 		case xml.StartElement:
 			switch t.Name.Local {
 			case "prerequisite":
@@ -442,35 +335,67 @@ func (b *xmlBundle) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 				if err := d.DecodeElement(&prereq, &t); err != nil {
 					return err
 				}
-				if prereq.Type == "" {
-					return fmt.Errorf("<prerequisite> requires 'type' attribute")
-				}
-				if prereq.Version == "" && prereq.Source == "" {
-					return fmt.Errorf("<prerequisite> requires 'version' or 'source' attribute")
-				}
+				prereq.Comments = comments
 				b.Prerequisites = append(b.Prerequisites, prereq)
 			case "msi":
 				var msi xmlBundleMSI
 				if err := d.DecodeElement(&msi, &t); err != nil {
 					return err
 				}
-				if msi.Source == "" && msi.Source64bit == "" && msi.Source32bit == "" && msi.SourceArm64 == "" {
-					return fmt.Errorf("<msi> requires 'source', 'source_64bit', 'source_32bit', or 'source_arm64' attribute")
-				}
+				msi.Comments = comments
 				b.MSI = &msi
 			case "exe":
 				var exe xmlExePackage
 				if err := d.DecodeElement(&exe, &t); err != nil {
 					return err
 				}
-				if exe.Source == "" {
-					return fmt.Errorf("<exe> requires 'source' attribute")
-				}
+				exe.Comments = comments
 				b.ExePackages = append(b.ExePackages, exe)
 			default:
 				return fmt.Errorf("unknown element <%s> in <bundle>", t.Name.Local)
 			}
+			comments = nil
 		case xml.EndElement:
+			b.TrailingComments = comments
+			return nil
+		}
+	}
+}
+
+// UnmarshalXML for xmlTransform - parses the properties with their comments
+func (t *xmlTransform) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := validateAttributes(start); err != nil {
+		return err
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "name" {
+			t.Name = attr.Value
+		}
+	}
+
+	var comments []string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tt := tok.(type) {
+		case xml.Comment:
+			comments = append(comments, string(tt))
+		case xml.StartElement:
+			if tt.Name.Local != "property" {
+				return fmt.Errorf("unknown element <%s> in <transform>", tt.Name.Local)
+			}
+			var prop xmlProperty
+			if err := d.DecodeElement(&prop, &tt); err != nil {
+				return err
+			}
+			prop.Comments = comments
+			t.Properties = append(t.Properties, prop)
+			comments = nil
+		case xml.EndElement:
+			t.TrailingComments = comments
 			return nil
 		}
 	}
@@ -479,122 +404,111 @@ func (b *xmlBundle) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 // UnmarshalXML for xmlSetup to preserve item order
 func (s *xmlSetup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	// Parse and validate attributes
+	if err := validateAttributes(start); err != nil {
+		return err
+	}
 	for _, attr := range start.Attr {
-		switch attr.Name.Local {
-		case "silent":
+		if attr.Name.Local == "silent" {
 			s.Silent = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <setup>", attr.Name.Local)
 		}
 	}
 
-	// Parse child elements in order
+	// Parse child elements in order, attaching comments to the next one
+	var comments []string
 	for {
+		// The decoder stands right before the next token, so this is where
+		// a start element begins
+		pos := inputPos(d)
 		tok, err := d.Token()
 		if err != nil {
 			return err
 		}
 
 		switch t := tok.(type) {
+		case xml.Comment:
+			comments = append(comments, string(t))
+
 		case xml.StartElement:
 			switch t.Name.Local {
 			case "set":
 				var set xmlSet
 				if err := d.DecodeElement(&set, &t); err != nil {
-					return err
+					return atPos(pos, err)
 				}
+				set.Comments = comments
 				s.Sets = append(s.Sets, set)
 
 			case "feature":
 				var feat xmlFeature
 				if err := d.DecodeElement(&feat, &t); err != nil {
-					return err
+					return atPos(pos, err)
 				}
+				feat.Pos = pos
+				feat.Comments = comments
 				s.Features = append(s.Features, feat)
 
 			case "bundle":
 				var bundle xmlBundle
 				if err := d.DecodeElement(&bundle, &t); err != nil {
-					return err
+					return atPos(pos, err)
 				}
+				bundle.Comments = comments
 				s.Bundle = &bundle
 
 			case "requires":
 				var req xmlRequires
 				if err := d.DecodeElement(&req, &t); err != nil {
-					return err
+					return atPos(pos, err)
 				}
+				req.Comments = comments
 				s.Requires = append(s.Requires, req)
 
-			case "files":
-				var files xmlFiles
-				if err := d.DecodeElement(&files, &t); err != nil {
-					return err
-				}
-				s.Items = append(s.Items, xmlItem{Type: "files", Files: &files})
-
-			case "registry":
-				var reg xmlRegistry
-				if err := d.DecodeElement(&reg, &t); err != nil {
-					return err
+			case "setup-type":
+				var st xmlSetupType
+				if err := d.DecodeElement(&st, &t); err != nil {
+					return atPos(pos, err)
 				}
-				s.Items = append(s.Items, xmlItem{Type: "registry", Registry: &reg})
+				st.Pos = pos
+				st.Comments = comments
+				s.SetupTypes = append(s.SetupTypes, st)
 
-			case "set-env":
-				var env xmlSetEnv
-				if err := d.DecodeElement(&env, &t); err != nil {
-					return err
+			case "instances":
+				if s.Instances != nil {
+					return atPos(pos, fmt.Errorf("<instances> is declared twice"))
 				}
-				s.Items = append(s.Items, xmlItem{Type: "set-env", SetEnv: &env})
-
-			case "shortcut":
-				var sc xmlShortcut
-				if err := d.DecodeElement(&sc, &t); err != nil {
-					return err
+				var inst xmlInstances
+				if err := d.DecodeElement(&inst, &t); err != nil {
+					return atPos(pos, err)
 				}
-				s.Items = append(s.Items, xmlItem{Type: "shortcut", Shortcut: &sc})
-
-			case "service":
-				var svc xmlService
-				if err := d.DecodeElement(&svc, &t); err != nil {
-					return err
+				inst.Pos = pos
+				inst.Comments = comments
+				s.Instances = &inst
+
+			case "transform":
+				var tr xmlTransform
+				if err := d.DecodeElement(&tr, &t); err != nil {
+					return atPos(pos, err)
 				}
-				s.Items = append(s.Items, xmlItem{Type: "service", Service: &svc})
+				tr.Pos = pos
+				tr.Comments = comments
+				s.Transforms = append(s.Transforms, tr)
 
-			case "exclude":
-				var exc xmlExclude
-				if err := d.DecodeElement(&exc, &t); err != nil {
-					return err
+			default:
+				it, ok := itemTypes[t.Name.Local]
+				if !ok {
+					return atPos(pos, fmt.Errorf("unknown element <%s> in <setup>", t.Name.Local))
 				}
-				s.Items = append(s.Items, xmlItem{Type: "exclude", Exclude: &exc})
-
-			case "create-folder":
-				var cf xmlCreateFolder
-				if err := d.DecodeElement(&cf, &t); err != nil {
-					return err
+				item, err := decodeItem(d, t, it, pos, comments)
+				if err != nil {
+					return atPos(pos, err)
 				}
-				s.Items = append(s.Items, xmlItem{Type: "create-folder", CreateFolder: &cf})
-
-			case "execute":
-				var exec xmlExecute
-				if err := d.DecodeElement(&exec, &t); err != nil {
-					return err
-				}
-				s.Items = append(s.Items, xmlItem{Type: "execute", Execute: &exec})
-
-			case "remove-on-uninstall":
-				var rem xmlRemoveOnUninstall
-				if err := d.DecodeElement(&rem, &t); err != nil {
-					return err
-				}
-				s.Items = append(s.Items, xmlItem{Type: "remove-on-uninstall", RemoveOnUninstall: &rem})
-
-			default:
-				return fmt.Errorf("unknown element <%s> in <setup>", t.Name.Local)
+				s.Items = append(s.Items, item)
 			}
+			comments = nil
 
 		case xml.EndElement:
 			if t.Name == start.Name {
+				s.TrailingComments = comments
 				return nil
 			}
 		}
@@ -603,145 +517,178 @@ func (s *xmlSetup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 // UnmarshalXML for xmlFeature to preserve item order
 func (f *xmlFeature) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	// Parse and validate attributes (track presence, not value)
-	hasName := false
+	// Parse and validate attributes (required ones by presence, not value)
+	if err := validateAttributes(start); err != nil {
+		return err
+	}
 	for _, attr := range start.Attr {
 		switch attr.Name.Local {
 		case "name":
 			f.Name = attr.Value
-			hasName = true
 		case "enabled":
 			f.Enabled = attr.Value
 		case "condition":
 			f.Condition = attr.Value
 		case "allowed":
 			f.Allowed = attr.Value
-		default:
-			return fmt.Errorf("unknown attribute '%s' on <feature>", attr.Name.Local)
+		case "id":
+			f.ID = attr.Value
+		case "description":
+			f.Description = attr.Value
+		case "display":
+			f.Display = attr.Value
+		case "level":
+			f.Level = attr.Value
+		case "advertise":
+			f.Advertise = attr.Value
+		case "install-default":
+			f.InstallDefault = attr.Value
+		case "typical-default":
+			f.TypicalDefault = attr.Value
 		}
 	}
 
-	// Validate required attributes by presence
-	if !hasName {
-		return fmt.Errorf("<feature> requires 'name' attribute")
-	}
-
-	// Parse child elements in order
+	// Parse child elements in order, attaching comments to the next one
+	var comments []string
 	for {
+		// The decoder stands right before the next token, so this is where
+		// a start element begins
+		pos := inputPos(d)
 		tok, err := d.Token()
 		if err != nil {
 			return err
 		}
 
 		switch t := tok.(type) {
+		case xml.Comment:
+			comments = append(comments, string(t))
+
 		case xml.StartElement:
 			switch t.Name.Local {
 			case "feature":
 				var feat xmlFeature
 				if err := d.DecodeElement(&feat, &t); err != nil {
-					return err
+					return atPos(pos, err)
 				}
+				feat.Pos = pos
+				feat.Comments = comments
 				f.SubFeatures = append(f.SubFeatures, feat)
 
-			case "files":
-				var files xmlFiles
-				if err := d.DecodeElement(&files, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "files", Files: &files})
-
-			case "registry":
-				var reg xmlRegistry
-				if err := d.DecodeElement(&reg, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "registry", Registry: &reg})
-
-			case "set-env":
-				var env xmlSetEnv
-				if err := d.DecodeElement(&env, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "set-env", SetEnv: &env})
-
-			case "shortcut":
-				var sc xmlShortcut
-				if err := d.DecodeElement(&sc, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "shortcut", Shortcut: &sc})
-
-			case "service":
-				var svc xmlService
-				if err := d.DecodeElement(&svc, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "service", Service: &svc})
-
-			case "exclude":
-				var exc xmlExclude
-				if err := d.DecodeElement(&exc, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "exclude", Exclude: &exc})
-
-			case "create-folder":
-				var cf xmlCreateFolder
-				if err := d.DecodeElement(&cf, &t); err != nil {
-					return err
-				}
-				f.Items = append(f.Items, xmlItem{Type: "create-folder", CreateFolder: &cf})
-
-			case "execute":
-				var exec xmlExecute
-				if err := d.DecodeElement(&exec, &t); err != nil {
-					return err
+			default:
+				it, ok := itemTypes[t.Name.Local]
+				if !ok {
+					return atPos(pos, fmt.Errorf("unknown element <%s> in <feature>", t.Name.Local))
 				}
-				f.Items = append(f.Items, xmlItem{Type: "execute", Execute: &exec})
-
-			case "remove-on-uninstall":
-				var rem xmlRemoveOnUninstall
-				if err := d.DecodeElement(&rem, &t); err != nil {
-					return err
+				item, err := decodeItem(d, t, it, pos, comments)
+				if err != nil {
+					return atPos(pos, err)
 				}
-				f.Items = append(f.Items, xmlItem{Type: "remove-on-uninstall", RemoveOnUninstall: &rem})
-
-			default:
-				return fmt.Errorf("unknown element <%s> in <feature>", t.Name.Local)
+				f.Items = append(f.Items, item)
 			}
+			comments = nil
 
 		case xml.EndElement:
 			if t.Name == start.Name {
+				f.TrailingComments = comments
 				return nil
 			}
 		}
 	}
 }
 
+// inputPos returns the decoder's current position in the source.
+// Error is a parse error of an element at a known position in the .msis source.
+type Error struct {
+	Pos ir.Pos
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %s: %v", e.Pos, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// atPos attaches a position to an element error. Errors from nested
+// elements keep their own, more precise position.
+func atPos(pos ir.Pos, err error) error {
+	var perr *Error
+	if errors.As(err, &perr) {
+		return err
+	}
+	return &Error{Pos: pos, Err: err}
+}
+
+func inputPos(d *xml.Decoder) ir.Pos {
+	line, column := d.InputPos()
+	return ir.Pos{Line: line, Column: column}
+}
+
 // Conversion functions
 
 func convertSetup(raw *xmlSetup) (*ir.Setup, error) {
 	setup := &ir.Setup{
-		Silent: parseMsisBool(raw.Silent),
+		Silent:           parseMsisBool(raw.Silent),
+		Comments:         raw.Comments,
+		TrailingComments: raw.TrailingComments,
+		FinalComments:    raw.FinalComments,
 	}
 
 	// Convert sets
 	for _, s := range raw.Sets {
 		setup.Sets = append(setup.Sets, ir.Set{
-			Name:  s.Name,
-			Value: s.Value,
+			Name:     s.Name,
+			Value:    s.Value,
+			Comments: s.Comments,
 		})
 	}
 
 	// Convert requirements
 	for _, r := range raw.Requires {
 		setup.Requires = append(setup.Requires, ir.Requirement{
-			Type:    r.Type,
-			Version: r.Version,
-			Source:  r.Source,
+			Type:     r.Type,
+			Version:  r.Version,
+			Source:   r.Source,
+			Comments: r.Comments,
 		})
 	}
 
+	// Convert setup types
+	for _, t := range raw.SetupTypes {
+		setup.SetupTypes = append(setup.SetupTypes, ir.SetupType{
+			Name:        t.Name,
+			Features:    t.Features,
+			Description: t.Description,
+			Pos:         t.Pos,
+			Comments:    t.Comments,
+		})
+	}
+
+	if raw.Instances != nil {
+		setup.Instances = &ir.Instances{
+			Count:    raw.Instances.Count,
+			Property: raw.Instances.Property,
+			Pos:      raw.Instances.Pos,
+			Comments: raw.Instances.Comments,
+		}
+	}
+
+	// Convert transforms
+	for _, t := range raw.Transforms {
+		transform := ir.Transform{
+			Name:             t.Name,
+			Pos:              t.Pos,
+			Comments:         t.Comments,
+			TrailingComments: t.TrailingComments,
+		}
+		for _, p := range t.Properties {
+			transform.Properties = append(transform.Properties, ir.Property{Name: p.Name, Value: p.Value, Comments: p.Comments})
+		}
+		setup.Transforms = append(setup.Transforms, transform)
+	}
+
 	// Convert features
 	for _, f := range raw.Features {
 		feature, err := convertFeature(&f)
@@ -751,12 +698,8 @@ func convertSetup(raw *xmlSetup) (*ir.Setup, error) {
 		setup.Features = append(setup.Features, *feature)
 	}
 
-	// Convert top-level items (preserves document order)
-	items, err := convertItems(raw.Items)
-	if err != nil {
-		return nil, err
-	}
-	setup.Items = items
+	// Top-level items were converted while parsing (document order)
+	setup.Items = raw.Items
 
 	// Convert bundle
 	if raw.Bundle != nil {
@@ -764,14 +707,18 @@ func convertSetup(raw *xmlSetup) (*ir.Setup, error) {
 			Source64bit: raw.Bundle.Source64bit,
 			Source32bit: raw.Bundle.Source32bit,
 			SourceArm64: raw.Bundle.SourceArm64,
+
+			Comments:         raw.Bundle.Comments,
+			TrailingComments: raw.Bundle.TrailingComments,
 		}
 
 		// Convert prerequisites
 		for _, p := range raw.Bundle.Prerequisites {
 			bundle.Prerequisites = append(bundle.Prerequisites, ir.Prerequisite{
-				Type:    p.Type,
-				Version: p.Version,
-				Source:  p.Source,
+				Type:     p.Type,
+				Version:  p.Version,
+				Source:   p.Source,
+				Comments: p.Comments,
 			})
 		}
 
@@ -782,6 +729,7 @@ func convertSetup(raw *xmlSetup) (*ir.Setup, error) {
 				Source64bit: raw.Bundle.MSI.Source64bit,
 				Source32bit: raw.Bundle.MSI.Source32bit,
 				SourceArm64: raw.Bundle.MSI.SourceArm64,
+				Comments:    raw.Bundle.MSI.Comments,
 			}
 		}
 
@@ -792,6 +740,7 @@ func convertSetup(raw *xmlSetup) (*ir.Setup, error) {
 				Source:          e.Source,
 				DetectCondition: e.DetectCondition,
 				InstallArgs:     e.InstallArgs,
+				Comments:        e.Comments,
 			})
 		}
 
@@ -803,18 +752,25 @@ func convertSetup(raw *xmlSetup) (*ir.Setup, error) {
 
 func convertFeature(raw *xmlFeature) (*ir.Feature, error) {
 	feature := &ir.Feature{
-		Name:      raw.Name,
-		Enabled:   parseMsisBoolDefault(raw.Enabled, true),
-		Condition: raw.Condition,
-		Allowed:   parseMsisBoolDefault(raw.Allowed, true),
-	}
-
-	// Convert items (preserves document order)
-	items, err := convertItems(raw.Items)
-	if err != nil {
-		return nil, err
-	}
-	feature.Items = items
+		Name:           raw.Name,
+		ID:             raw.ID,
+		Enabled:        parseMsisBoolDefault(raw.Enabled, true),
+		Condition:      raw.Condition,
+		Allowed:        parseMsisBoolDefault(raw.Allowed, true),
+		Description:    raw.Description,
+		Display:        raw.Display,
+		Level:          raw.Level,
+		Advertise:      raw.Advertise,
+		InstallDefault: raw.InstallDefault,
+		TypicalDefault: raw.TypicalDefault,
+		Pos:            raw.Pos,
+
+		Comments:         raw.Comments,
+		TrailingComments: raw.TrailingComments,
+	}
+
+	// Items were converted while parsing (document order)
+	feature.Items = raw.Items
 
 	// Convert nested features
 	for _, sf := range raw.SubFeatures {
@@ -828,84 +784,6 @@ func convertFeature(raw *xmlFeature) (*ir.Feature, error) {
 	return feature, nil
 }
 
-func convertItems(rawItems []xmlItem) ([]ir.Item, error) {
-	var items []ir.Item
-
-	for _, raw := range rawItems {
-		switch raw.Type {
-		case "files":
-			items = append(items, ir.Files{
-				Source:         raw.Files.Source,
-				Target:         raw.Files.Target,
-				DoNotOverwrite: parseMsisBool(raw.Files.DoNotOverwrite),
-			})
-
-		case "registry":
-			items = append(items, ir.Registry{
-				File:      raw.Registry.File,
-				SDDL:      raw.Registry.SDDL,
-				Preserve:  parseMsisBool(raw.Registry.Preserve),
-				Permanent: parseMsisBool(raw.Registry.Permanent),
-				Condition: raw.Registry.Condition,
-			})
-
-		case "set-env":
-			items = append(items, ir.SetEnv{
-				Name:      raw.SetEnv.Name,
-				Value:     raw.SetEnv.Value,
-				Permanent: parseMsisBool(raw.SetEnv.Permanent),
-			})
-
-		case "shortcut":
-			items = append(items, ir.Shortcut{
-				Name:        raw.Shortcut.Name,
-				Target:      raw.Shortcut.Target,
-				File:        raw.Shortcut.File,
-				Description: raw.Shortcut.Description,
-				Icon:        raw.Shortcut.Icon,
-			})
-
-		case "service":
-			items = append(items, ir.Service{
-				FileName:           raw.Service.FileName,
-				ServiceName:        raw.Service.ServiceName,
-				ServiceDisplayName: raw.Service.ServiceDisplayName,
-				Start:              raw.Service.Start,
-				Description:        raw.Service.Description,
-				ServiceType:        raw.Service.ServiceType,
-				ErrorControl:       raw.Service.ErrorControl,
-				Restart:            raw.Service.Restart,
-				StartAfterInstall:  raw.Service.StartAfterInstall,
-			})
-
-		case "exclude":
-			items = append(items, ir.Exclude{
-				Folder: raw.Exclude.Folder,
-			})
-
-		case "create-folder":
-			items = append(items, ir.CreateFolder{
-				Target: raw.CreateFolder.Target,
-			})
-
-		case "execute":
-			items = append(items, ir.Execute{
-				Cmd:       raw.Execute.Cmd,
-				When:      raw.Execute.When,
-				Directory: raw.Execute.Directory,
-			})
-
-		case "remove-on-uninstall":
-			items = append(items, ir.RemoveOnUninstall{
-				Registry: raw.RemoveOnUninstall.Registry,
-				Folder:   raw.RemoveOnUninstall.Folder,
-			})
-		}
-	}
-
-	return items, nil
-}
-
 // parseMsisBool parses msis-style boolean values.
 // Valid values: true, false, yes, no, on, off, 1, 0 (case-insensitive)
 // Empty string or unrecognized values return false.
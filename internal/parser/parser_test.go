@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -241,6 +242,79 @@ func TestParseSilentSetup(t *testing.T) {
 	}
 }
 
+func TestParseAfterSetup(t *testing.T) {
+	setup, err := ParseBytes([]byte("<setup/>\n<!-- after -->\n"))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(setup.FinalComments) != 1 || setup.FinalComments[0] != " after " {
+		t.Errorf("unexpected final comments %q", setup.FinalComments)
+	}
+
+	_, err = ParseBytes([]byte(`<setup/><setup/>`))
+	if err == nil || !strings.Contains(err.Error(), "<setup> after </setup>") {
+		t.Errorf("expected an error for a second root, got %v", err)
+	}
+}
+
+func TestParseInstances(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+    <instances count="10"/>
+</setup>`
+
+	setup, err := ParseBytes([]byte(xml))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if setup.Instances == nil || setup.Instances.Count != "10" || setup.Instances.Property != "" {
+		t.Errorf("unexpected instances %+v", setup.Instances)
+	}
+	if setup.Instances.Pos.Line != 3 {
+		t.Errorf("expected instances at line 3, got %s", setup.Instances.Pos)
+	}
+
+	_, err = ParseBytes([]byte(`<setup><instances count="2"/><instances count="3"/></setup>`))
+	if err == nil || !strings.Contains(err.Error(), "<instances> is declared twice") {
+		t.Errorf("expected a duplicate error, got %v", err)
+	}
+}
+
+func TestParseTransforms(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+    <transform name="site-berlin">
+        <!-- Site server -->
+        <property name="SERVER" value="berlin01"/>
+        <property name="PORT" value="8080"/>
+    </transform>
+</setup>`
+
+	setup, err := ParseBytes([]byte(xml))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(setup.Transforms) != 1 {
+		t.Fatalf("expected 1 transform, got %d", len(setup.Transforms))
+	}
+	tr := setup.Transforms[0]
+	if tr.Name != "site-berlin" || tr.Pos.Line != 3 || len(tr.Properties) != 2 {
+		t.Fatalf("unexpected transform %+v", tr)
+	}
+	if p := tr.Properties[0]; p.Name != "SERVER" || p.Value != "berlin01" || len(p.Comments) != 1 {
+		t.Errorf("unexpected property %+v", p)
+	}
+
+	_, err = ParseBytes([]byte(`<setup><transform name="a"><files source="x"/></transform></setup>`))
+	if err == nil || !strings.Contains(err.Error(), "unknown element <files> in <transform>") {
+		t.Errorf("expected an unknown element error, got %v", err)
+	}
+	_, err = ParseBytes([]byte(`<setup><transform name="a"><property name="A"/></transform></setup>`))
+	if err == nil || !strings.Contains(err.Error(), "value") {
+		t.Errorf("expected a missing value error, got %v", err)
+	}
+}
+
 func TestParseBundle(t *testing.T) {
 	xml := `<?xml version="1.0" encoding="utf-8"?>
 <setup>
@@ -906,3 +980,94 @@ func TestParseNg1BmoExample(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePositions(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+    <!-- top-level items -->
+    <files source="a" target="[INSTALLDIR]"/>
+    <feature name="Main">
+        <set-env name="X" value="1"/>
+        <feature name="Sub">
+          <shortcut name="App" target="DESKTOP" file="[INSTALLDIR]app.exe"/>
+        </feature>
+    </feature>
+</setup>`
+
+	setup, err := ParseBytes([]byte(xml))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  ir.Pos
+		want ir.Pos
+	}{
+		{"files", setup.Items[0].Position(), ir.Pos{Line: 4, Column: 5}},
+		{"feature", setup.Features[0].Pos, ir.Pos{Line: 5, Column: 5}},
+		{"set-env", setup.Features[0].Items[0].Position(), ir.Pos{Line: 6, Column: 9}},
+		{"sub-feature", setup.Features[0].SubFeatures[0].Pos, ir.Pos{Line: 7, Column: 9}},
+		{"shortcut", setup.Features[0].SubFeatures[0].Items[0].Position(), ir.Pos{Line: 8, Column: 11}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got position %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+    <feature name="Main">
+        <unknown-thing/>
+    </feature>
+</setup>`
+
+	_, err := ParseBytes([]byte(xml))
+	if err == nil {
+		t.Fatal("expected an error for an unknown element")
+	}
+	var perr *Error
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *parser.Error, got %T: %v", err, err)
+	}
+	if perr.Pos.Line != 4 {
+		t.Errorf("got line %d, want 4", perr.Pos.Line)
+	}
+	if !strings.Contains(err.Error(), "unknown-thing") {
+		t.Errorf("error %q does not name the element", err)
+	}
+}
+
+func TestParseWix(t *testing.T) {
+	setup, err := ParseBytes([]byte(`<setup>
+  <wix><Property Id="A" Value="1"/><!-- kept --></wix>
+  <feature name="Main">
+    <wix slot="feature:Main"><MergeRef Id="CRT"/></wix>
+  </feature>
+</setup>`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	w, ok := setup.Items[0].(ir.Wix)
+	if !ok || w.Slot != "" || w.XML != `<Property Id="A" Value="1"/><!-- kept -->` {
+		t.Errorf("unexpected top-level block %+v", setup.Items[0])
+	}
+	w, ok = setup.Features[0].Items[0].(ir.Wix)
+	if !ok || w.Slot != "feature:Main" || w.XML != `<MergeRef Id="CRT"/>` || w.Pos.Line != 4 {
+		t.Errorf("unexpected feature block %+v", setup.Features[0].Items[0])
+	}
+
+	setup, err = ParseJSON([]byte(`{"items": [{"wix": {"slot": "ui", "xml": "<UIRef Id=\"WixUI_Minimal\"/>"}}]}`))
+	if err != nil {
+		t.Fatalf("ParseJSON failed: %v", err)
+	}
+	if w := setup.Items[0].(ir.Wix); w.Slot != "ui" || w.XML != `<UIRef Id="WixUI_Minimal"/>` {
+		t.Errorf("unexpected JSON block %+v", w)
+	}
+	if _, err := ParseJSON([]byte(`{"items": [{"wix": {"xml": "<UIRef Id='X'>"}}]}`)); err == nil || !strings.Contains(err.Error(), "malformed XML") {
+		t.Errorf("expected a malformed XML error, got %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+)
+
+// AttrType is the value type of an attribute.
+type AttrType int
+
+const (
+	String AttrType = iota // Free text
+	Bool                   // msis boolean: true/false, yes/no, on/off, 1/0
+	Enum                   // One of Values
+	Path                   // File or folder, relative to the .msis file
+)
+
+// Attribute describes an attribute of an .msis element.
+type Attribute struct {
+	Name     string
+	Type     AttrType
+	Required bool
+	Values   []string // Allowed values of an Enum attribute
+	Doc      string
+}
+
+// Choices returns the values an attribute documents, for completion and help.
+func (a Attribute) Choices() []string {
+	if a.Type == Bool {
+		return []string{"true", "false"}
+	}
+	return a.Values
+}
+
+// Element describes an .msis element.
+type Element struct {
+	Name       string
+	Doc        string
+	Attributes []Attribute
+	Children   []string // Elements allowed inside, in schema order
+	Verbatim   bool     // Content is verbatim WiX XML instead of elements
+}
+
+// Attribute returns the schema of an attribute of the element.
+func (e *Element) Attribute(name string) (*Attribute, bool) {
+	for i := range e.Attributes {
+		if e.Attributes[i].Name == name {
+			return &e.Attributes[i], true
+		}
+	}
+	return nil, false
+}
+
+// itemElements may appear in both <setup> and <feature>.
+var itemElements = []string{"files", "registry", "set-env", "shortcut", "service", "exclude", "create-folder", "execute", "remove-on-uninstall", "wix", "merge-module", "wix-reference", "directory"}
+
+// Elements is the registry of every .msis element and attribute. The
+// parser validates attributes against it, and the XSD, the CLI help and the
+// language server are generated from it. Attribute values may reference
+// {{VARIABLES}}, so the parser checks names and presence only; values are
+// checked once the variables are resolved.
+var Elements = []Element{
+	{
+		Name:       "setup",
+		Doc:        "Root element of an .msis file.",
+		Attributes: []Attribute{{Name: "silent", Type: Bool, Doc: "Build a package without UI."}},
+		Children:   append([]string{"set", "requires", "setup-type", "instances", "transform", "feature", "bundle"}, itemElements...),
+	},
+	{
+		Name: "set",
+		Doc:  "Defines a variable, referenced as {{NAME}}.",
+		Attributes: []Attribute{
+			{Name: "name", Required: true, Doc: "Variable name."},
+			{Name: "value", Required: true, Doc: "Variable value; may reference other variables."},
+		},
+	},
+	{
+		Name: "requires",
+		Doc:  "Declares a runtime prerequisite. Triggers auto-bundling unless /STANDALONE is used. Needs version or source.",
+		Attributes: []Attribute{
+			{Name: "type", Type: Enum, Required: true, Values: []string{"vcredist", "netfx"}, Doc: "Type of requirement."},
+			{Name: "version", Doc: "Version of the requirement, e.g. 2022 or 4.8."},
+			{Name: "source", Type: Path, Doc: "Path to the prerequisite installer for offline builds."},
+		},
+	},
+	{
+		Name: "setup-type",
+		Doc:  "Declares a setup type like Typical or Complete, chosen in the setup type dialog or with SETUPTYPE on the command line. The first one is the default.",
+		Attributes: []Attribute{
+			{Name: "name", Required: true, Doc: "Name of the setup type, the value of SETUPTYPE."},
+			{Name: "features", Doc: "Comma-separated names, paths or IDs of the features it installs, with their sub-features. Without features, the user picks them in the feature tree."},
+			{Name: "description", Doc: "Text shown next to the setup type in the dialog."},
+		},
+	},
+	{
+		Name: "instances",
+		Doc:  "Makes the package installable several times side by side, e.g. once per tenant. Each instance has its own product code, services and INSTALLDIR; install one with MSINEWINSTANCE=1 TRANSFORMS=:I01. Needs OUTPUT_TYPE msi.",
+		Attributes: []Attribute{
+			{Name: "count", Required: true, Doc: "Number of instances, named I01, I02 and so on."},
+			{Name: "property", Doc: "Property that holds the name of the installed instance. Default: INSTANCE_NAME."},
+		},
+	},
+	{
+		Name:       "transform",
+		Doc:        "Builds an .mst transform next to the MSI that sets property defaults, e.g. for a site. Install with TRANSFORMS=<msi>-<name>.mst. Needs OUTPUT_TYPE msi.",
+		Attributes: []Attribute{{Name: "name", Required: true, Doc: "Name of the transform, part of the .mst file name."}},
+		Children:   []string{"property"},
+	},
+	{
+		Name: "property",
+		Doc:  "A property default of a transform.",
+		Attributes: []Attribute{
+			{Name: "name", Required: true, Doc: "Public property, in upper case."},
+			{Name: "value", Required: true, Doc: "Value of the property; may reference variables."},
+		},
+	},
+	{
+		Name: "feature",
+		Doc:  "Groups items into a feature the user can select. Features nest.",
+		Attributes: []Attribute{
+			{Name: "name", Required: true, Doc: "Feature title."},
+			{Name: "id", Doc: "Feature ID, e.g. for ADDLOCAL=Server. Default: FEATURE_00000, numbered in document order."},
+			{Name: "enabled", Type: Bool, Doc: "Whether the feature is selected by default. Default: true."},
+			{Name: "condition", Doc: "Windows Installer condition for the feature."},
+			{Name: "allowed", Type: Bool, Doc: "Whether the user may deselect the feature. Default: true."},
+			{Name: "description", Doc: "Description shown in the feature tree."},
+			{Name: "display", Type: Enum, Values: []string{"expand", "collapse", "hidden"}, Doc: "How the feature tree shows the feature. Default: collapse."},
+			{Name: "level", Doc: "Install level from 0 (never installed) to 32767; overrides enabled. Default: 1, or 32767 if not enabled."},
+			{Name: "advertise", Type: Enum, Values: []string{"no", "allow", "prefer"}, Doc: "Whether the feature may be advertised, i.e. installed on first use; prefer advertises it by default."},
+			{Name: "install-default", Type: Enum, Values: []string{"local", "source", "follow-parent"}, Doc: "How a selected feature is installed: to the local disk, run from the source, or as its parent. Default: local."},
+			{Name: "typical-default", Type: Enum, Values: []string{"install", "advertise"}, Doc: "Whether a typical installation installs or advertises the feature. Default: install, or advertise with advertise=\"prefer\"."},
+		},
+		Children: append([]string{"feature"}, itemElements...),
+	},
+	{
+		Name: "files",
+		Doc:  "Installs a folder tree or a single file.",
+		Attributes: []Attribute{
+			{Name: "source", Type: Path, Required: true, Doc: "Source folder or file, relative to the .msis file."},
+			{Name: "target", Required: true, Doc: "Target folder, e.g. [INSTALLDIR]bin."},
+			{Name: "do-not-overwrite", Type: Bool, Doc: "Keep files the user changed on reinstall."},
+		},
+	},
+	{
+		Name: "registry",
+		Doc:  "Imports a .reg file.",
+		Attributes: []Attribute{
+			{Name: "file", Type: Path, Required: true, Doc: "The .reg file, relative to the .msis file."},
+			{Name: "sddl", Doc: "SDDL security descriptor for the keys."},
+			{Name: "preserve", Type: Bool, Doc: "Keep values the user changed on upgrade."},
+			{Name: "permanent", Type: Bool, Doc: "Keep the values on uninstall."},
+			{Name: "condition", Doc: "Windows Installer condition for the component."},
+		},
+	},
+	{
+		Name: "set-env",
+		Doc:  "Sets a system environment variable.",
+		Attributes: []Attribute{
+			{Name: "name", Required: true, Doc: "Environment variable name."},
+			{Name: "value", Required: true, Doc: "Value; msis roots like [INSTALLDIR] are resolved."},
+			{Name: "permanent", Type: Bool, Doc: "Keep the variable on uninstall."},
+		},
+	},
+	{
+		Name: "shortcut",
+		Doc:  "Creates a desktop or start menu shortcut.",
+		Attributes: []Attribute{
+			{Name: "name", Required: true, Doc: "Shortcut name."},
+			{Name: "target", Type: Enum, Required: true, Values: []string{"DESKTOP", "STARTMENU"}, Doc: "Where the shortcut is created."},
+			{Name: "file", Required: true, Doc: "Installed file the shortcut points to, e.g. [INSTALLDIR]app.exe."},
+			{Name: "description", Doc: "Shortcut tooltip."},
+			{Name: "icon", Type: Path, Doc: "Icon file, relative to the .msis file."},
+		},
+	},
+	{
+		Name: "service",
+		Doc:  "Installs a Windows service from an installed executable.",
+		Attributes: []Attribute{
+			{Name: "file-name", Required: true, Doc: "Service executable installed by a <files> item."},
+			{Name: "service-name", Required: true, Doc: "Service name."},
+			{Name: "service-display-name", Doc: "Display name in the services console."},
+			{Name: "start", Type: Enum, Values: []string{"auto", "demand", "manual", "disabled"}, Doc: "Start type. Default: auto."},
+			{Name: "description", Doc: "Service description."},
+			{Name: "service-type", Type: Enum, Values: []string{"ownProcess", "shareProcess"}, Doc: "Service process type."},
+			{Name: "error-control", Type: Enum, Values: []string{"ignore", "normal", "critical"}, Doc: "Error handling if the service fails to start."},
+			{Name: "restart", Doc: "Restart the service on failure."},
+			{Name: "start-after-install", Type: Enum, Values: []string{"yes", "no"}, Doc: "Start the service after installation. Default: yes."},
+		},
+	},
+	{
+		Name:       "exclude",
+		Doc:        "Excludes a folder from the <files> items.",
+		Attributes: []Attribute{{Name: "folder", Type: Path, Required: true, Doc: "Folder to exclude."}},
+	},
+	{
+		Name:       "create-folder",
+		Doc:        "Creates an empty folder at install time.",
+		Attributes: []Attribute{{Name: "target", Required: true, Doc: "Folder to create, e.g. [APPDATADIR]Logs."}},
+	},
+	{
+		Name: "execute",
+		Doc:  "Runs a command as a custom action.",
+		Attributes: []Attribute{
+			{Name: "cmd", Required: true, Doc: "Command line."},
+			{Name: "when", Type: Enum, Required: true, Values: []string{"before-install", "after-install", "after-install-not-patch", "before-upgrade", "before-uninstall"}, Doc: "When the command runs."},
+			{Name: "directory", Doc: "Working directory ID. Default: INSTALLDIR."},
+		},
+	},
+	{
+		Name: "remove-on-uninstall",
+		Doc:  "Removes a registry key or folder tree on uninstall.",
+		Attributes: []Attribute{
+			{Name: "registry", Doc: "Registry key, e.g. HKLM\\Software\\Company\\Product."},
+			{Name: "folder", Doc: "Folder, e.g. [APPDATADIR]Logs."},
+		},
+	},
+	{
+		Name: "wix",
+		Doc:  "Verbatim WiX XML, inserted into a slot of the template. Components in a <wix> block inside a <feature> are referenced by the feature.",
+		Attributes: []Attribute{
+			{Name: "slot", Doc: "Where the XML goes: package (default), ui, install-execute-sequence or feature:Name."},
+		},
+		Verbatim: true,
+	},
+	{
+		Name: "merge-module",
+		Doc:  "Merges a vendor merge module (.msm) into the feature.",
+		Attributes: []Attribute{
+			{Name: "source", Type: Path, Required: true, Doc: "The .msm file, relative to the .msis file."},
+			{Name: "target", Doc: "Folder the module installs to, e.g. [INSTALLDIR]vendor. Default: [INSTALLDIR]."},
+		},
+	},
+	{
+		Name: "wix-reference",
+		Doc:  "Builds a WiX library (.wixlib) or source fragment (.wxs) with the setup and references a component group of it from the feature.",
+		Attributes: []Attribute{
+			{Name: "source", Type: Path, Required: true, Doc: "The .wixlib or .wxs file, relative to the .msis file."},
+			{Name: "component-group", Doc: "ComponentGroup to install with the feature; omit to only link the file."},
+		},
+	},
+	{
+		Name: "directory",
+		Doc:  "Declares a folder with its own ID, usable as a target root like [INSTALLDIR].",
+		Attributes: []Attribute{
+			{Name: "id", Required: true, Doc: "Directory ID, e.g. DATADIR; targets then use [DATADIR]."},
+			{Name: "root", Doc: "INSTALLDIR, another msis root, a declared directory or a standard WiX folder like FontsFolder. Default: INSTALLDIR."},
+			{Name: "path", Required: true, Doc: "Folder below the root, e.g. Company\\Data."},
+			{Name: "configurable", Type: Bool, Doc: "Let the user change the folder in the feature dialog; the directory must be declared in that feature."},
+		},
+	},
+	{
+		Name: "bundle",
+		Doc:  "Builds a bootstrapper bundle instead of an MSI.",
+		Attributes: []Attribute{
+			{Name: "source_64bit", Type: Path, Doc: "x64 MSI (legacy shorthand)."},
+			{Name: "source_32bit", Type: Path, Doc: "x86 MSI (legacy shorthand)."},
+			{Name: "source_arm64", Type: Path, Doc: "ARM64 MSI (legacy shorthand)."},
+		},
+		Children: []string{"prerequisite", "msi", "exe"},
+	},
+	{
+		Name: "prerequisite",
+		Doc:  "A well-known prerequisite of the bundle. Needs version or source.",
+		Attributes: []Attribute{
+			{Name: "type", Type: Enum, Required: true, Values: []string{"vcredist", "netfx"}, Doc: "Type of prerequisite."},
+			{Name: "version", Doc: "Version, e.g. 2022 or 4.8."},
+			{Name: "source", Type: Path, Doc: "Path to the installer for offline builds."},
+		},
+	},
+	{
+		Name: "msi",
+		Doc:  "The MSI package(s) of the bundle. Needs at least one source.",
+		Attributes: []Attribute{
+			{Name: "source", Type: Path, Doc: "Platform-neutral MSI."},
+			{Name: "source_64bit", Type: Path, Doc: "x64 MSI."},
+			{Name: "source_32bit", Type: Path, Doc: "x86 MSI."},
+			{Name: "source_arm64", Type: Path, Doc: "ARM64 MSI."},
+		},
+	},
+	{
+		Name: "exe",
+		Doc:  "A custom executable package in the bundle chain.",
+		Attributes: []Attribute{
+			{Name: "id", Doc: "Package ID."},
+			{Name: "source", Type: Path, Required: true, Doc: "The executable."},
+			{Name: "detect", Doc: "Detect condition."},
+			{Name: "args", Doc: "Install arguments."},
+		},
+	},
+}
+
+// LookupElement returns the schema of an element.
+func LookupElement(name string) (*Element, bool) {
+	for i := range Elements {
+		if Elements[i].Name == name {
+			return &Elements[i], true
+		}
+	}
+	return nil, false
+}
+
+// validateAttributes checks the attributes of a start element against the
+// registry: every attribute must be known and every required one present.
+func validateAttributes(start xml.StartElement) error {
+	e, ok := LookupElement(start.Name.Local)
+	if !ok {
+		return fmt.Errorf("unknown element <%s>", start.Name.Local)
+	}
+	present := make(map[string]bool, len(start.Attr))
+	for _, attr := range start.Attr {
+		if _, ok := e.Attribute(attr.Name.Local); !ok {
+			return fmt.Errorf("unknown attribute '%s' on <%s>", attr.Name.Local, e.Name)
+		}
+		present[attr.Name.Local] = true
+	}
+	for _, attr := range e.Attributes {
+		if attr.Required && !present[attr.Name] {
+			return fmt.Errorf("<%s> requires '%s' attribute", e.Name, attr.Name)
+		}
+	}
+	return nil
+}
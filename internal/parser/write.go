@@ -0,0 +1,262 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// Write writes a setup as canonical .msis XML: two-space indentation,
+// attributes in the order of the Elements registry, and the children of
+// <setup> in the order set, requires, setup-type, instances, transform,
+// items, features, bundle.
+// Comments are written before the element they preceded when parsed, or
+// after </setup> if they followed it; a blank line separates commented elements and features from their
+// predecessor.
+func Write(w io.Writer, setup *ir.Setup) error {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	root := setupNode(setup)
+	writeNode(&b, &root, 0, true)
+	for _, c := range setup.FinalComments {
+		fmt.Fprintf(&b, "<!--%s-->\n", c)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Format parses .msis XML and returns it in canonical form.
+func Format(data []byte) ([]byte, error) {
+	setup, err := ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := Write(&b, setup); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// maxLineLength is the length above which a start tag is wrapped.
+const maxLineLength = 120
+
+// node is an element to write.
+type node struct {
+	name     string
+	attrs    map[string]string
+	comments []string
+	children []node
+	trailing []string // Comments before the end tag
+	content  string   // Verbatim inner XML, written as is
+}
+
+func setupNode(setup *ir.Setup) node {
+	n := node{
+		name:     "setup",
+		attrs:    map[string]string{"silent": boolAttr(setup.Silent)},
+		comments: setup.Comments,
+		trailing: setup.TrailingComments,
+	}
+	for _, s := range setup.Sets {
+		n.children = append(n.children, node{
+			name:     "set",
+			attrs:    map[string]string{"name": s.Name, "value": s.Value},
+			comments: s.Comments,
+		})
+	}
+	for _, r := range setup.Requires {
+		n.children = append(n.children, node{
+			name:     "requires",
+			attrs:    map[string]string{"type": r.Type, "version": r.Version, "source": r.Source},
+			comments: r.Comments,
+		})
+	}
+	for _, t := range setup.SetupTypes {
+		n.children = append(n.children, node{
+			name:     "setup-type",
+			attrs:    map[string]string{"name": t.Name, "features": t.Features, "description": t.Description},
+			comments: t.Comments,
+		})
+	}
+	if i := setup.Instances; i != nil {
+		n.children = append(n.children, node{
+			name:     "instances",
+			attrs:    map[string]string{"count": i.Count, "property": i.Property},
+			comments: i.Comments,
+		})
+	}
+	for _, t := range setup.Transforms {
+		n.children = append(n.children, transformNode(&t))
+	}
+	for _, item := range setup.Items {
+		n.children = append(n.children, writeItem(item))
+	}
+	for i := range setup.Features {
+		n.children = append(n.children, featureNode(&setup.Features[i]))
+	}
+	if setup.Bundle != nil {
+		n.children = append(n.children, bundleNode(setup.Bundle))
+	}
+	return n
+}
+
+func featureNode(f *ir.Feature) node {
+	n := node{
+		name: "feature",
+		attrs: map[string]string{
+			"name":            f.Name,
+			"id":              f.ID,
+			"enabled":         defaultTrueAttr(f.Enabled),
+			"condition":       f.Condition,
+			"allowed":         defaultTrueAttr(f.Allowed),
+			"description":     f.Description,
+			"display":         f.Display,
+			"level":           f.Level,
+			"advertise":       f.Advertise,
+			"install-default": f.InstallDefault,
+			"typical-default": f.TypicalDefault,
+		},
+		comments: f.Comments,
+		trailing: f.TrailingComments,
+	}
+	for _, item := range f.Items {
+		n.children = append(n.children, writeItem(item))
+	}
+	for i := range f.SubFeatures {
+		n.children = append(n.children, featureNode(&f.SubFeatures[i]))
+	}
+	return n
+}
+
+func transformNode(t *ir.Transform) node {
+	n := node{
+		name:     "transform",
+		attrs:    map[string]string{"name": t.Name},
+		comments: t.Comments,
+		trailing: t.TrailingComments,
+	}
+	for _, p := range t.Properties {
+		n.children = append(n.children, node{
+			name:     "property",
+			attrs:    map[string]string{"name": p.Name, "value": p.Value},
+			comments: p.Comments,
+		})
+	}
+	return n
+}
+
+func bundleNode(b *ir.Bundle) node {
+	n := node{
+		name:     "bundle",
+		attrs:    map[string]string{"source_64bit": b.Source64bit, "source_32bit": b.Source32bit, "source_arm64": b.SourceArm64},
+		comments: b.Comments,
+		trailing: b.TrailingComments,
+	}
+	for _, p := range b.Prerequisites {
+		n.children = append(n.children, node{
+			name:     "prerequisite",
+			attrs:    map[string]string{"type": p.Type, "version": p.Version, "source": p.Source},
+			comments: p.Comments,
+		})
+	}
+	if b.MSI != nil {
+		n.children = append(n.children, node{
+			name:     "msi",
+			attrs:    map[string]string{"source": b.MSI.Source, "source_64bit": b.MSI.Source64bit, "source_32bit": b.MSI.Source32bit, "source_arm64": b.MSI.SourceArm64},
+			comments: b.MSI.Comments,
+		})
+	}
+	for _, e := range b.ExePackages {
+		n.children = append(n.children, node{
+			name:     "exe",
+			attrs:    map[string]string{"id": e.ID, "source": e.Source, "detect": e.DetectCondition, "args": e.InstallArgs},
+			comments: e.Comments,
+		})
+	}
+	return n
+}
+
+// writeNode writes an element and its children at a nesting depth.
+func writeNode(b *bytes.Buffer, n *node, depth int, first bool) {
+	indent := strings.Repeat("  ", depth)
+	if !first && (len(n.comments) > 0 || len(n.children) > 0) {
+		b.WriteString("\n")
+	}
+	for _, c := range n.comments {
+		fmt.Fprintf(b, "%s<!--%s-->\n", indent, c)
+	}
+
+	var attrs []string
+	if e, ok := LookupElement(n.name); ok {
+		for _, a := range e.Attributes {
+			if v := n.attrs[a.Name]; v != "" || a.Required {
+				attrs = append(attrs, fmt.Sprintf(`%s="%s"`, a.Name, escapeAttr(v)))
+			}
+		}
+	}
+	empty := len(n.children) == 0 && len(n.trailing) == 0 && n.content == ""
+	end := ">"
+	if empty {
+		end = "/>"
+	}
+	tag := indent + "<" + n.name
+	// Long tags get one attribute per line, aligned under the first
+	if line := tag + " " + strings.Join(attrs, " ") + end; len(attrs) > 1 && len(line) > maxLineLength {
+		align := "\n" + strings.Repeat(" ", len(tag)+1)
+		b.WriteString(tag + " " + strings.Join(attrs, align) + end + "\n")
+	} else {
+		for _, a := range attrs {
+			tag += " " + a
+		}
+		b.WriteString(tag + end + "\n")
+	}
+	if empty {
+		return
+	}
+	if n.content != "" {
+		// Verbatim content keeps its own layout; the end tag follows it
+		b.Truncate(b.Len() - 1)
+		fmt.Fprintf(b, "%s</%s>\n", n.content, n.name)
+		return
+	}
+	for i := range n.children {
+		writeNode(b, &n.children[i], depth+1, i == 0)
+	}
+	for _, c := range n.trailing {
+		fmt.Fprintf(b, "%s  <!--%s-->\n", indent, c)
+	}
+	fmt.Fprintf(b, "%s</%s>\n", indent, n.name)
+}
+
+// boolAttr writes a boolean that defaults to false.
+func boolAttr(v bool) string {
+	if v {
+		return "true"
+	}
+	return ""
+}
+
+// defaultTrueAttr writes a boolean that defaults to true.
+func defaultTrueAttr(v bool) string {
+	if v {
+		return ""
+	}
+	return "false"
+}
+
+var attrEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	`"`, "&quot;",
+	"\t", "&#x9;",
+	"\n", "&#xA;",
+	"\r", "&#xD;",
+)
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
@@ -0,0 +1,267 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "attribute order and indentation",
+			in:   `<setup><feature name="Main"><files target="[INSTALLDIR]" source="bin" do-not-overwrite="yes"/></feature></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <feature name="Main">
+    <files source="bin" target="[INSTALLDIR]" do-not-overwrite="true"/>
+  </feature>
+</setup>
+`,
+		},
+		{
+			name: "canonical child order",
+			in:   `<setup><feature name="A"/><set name="X" value="1"/><files source="a" target="b"/><requires type="VCRedist" version="2022"/></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <set name="X" value="1"/>
+  <requires type="vcredist" version="2022"/>
+  <files source="a" target="b"/>
+  <feature name="A"/>
+</setup>
+`,
+		},
+		{
+			name: "comments",
+			in: `<!-- header -->
+<setup>
+  <!-- version -->
+  <set name="PRODUCT_VERSION" value="1.0"/>
+  <set name="A" value=""/>
+  <!-- main -->
+  <!-- second -->
+  <feature name="Main" enabled="off">
+    <set-env name="P" value="1" permanent="1"/>
+    <!-- trailing -->
+  </feature>
+  <!-- end -->
+</setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<!-- header -->
+<setup>
+  <!-- version -->
+  <set name="PRODUCT_VERSION" value="1.0"/>
+  <set name="A" value=""/>
+
+  <!-- main -->
+  <!-- second -->
+  <feature name="Main" enabled="false">
+    <set-env name="P" value="1" permanent="true"/>
+    <!-- trailing -->
+  </feature>
+  <!-- end -->
+</setup>
+`,
+		},
+		{
+			name: "comments after setup",
+			in: `<setup><set name="A" value="1"/></setup>
+<!-- after -->
+<!-- last -->
+`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <set name="A" value="1"/>
+</setup>
+<!-- after -->
+<!-- last -->
+`,
+		},
+		{
+			name: "escaping",
+			in:   `<setup><feature name="A &amp; B" condition="VersionNT &gt; 600 AND X=&quot;1&quot;"/></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <feature name="A &amp; B" condition="VersionNT > 600 AND X=&quot;1&quot;"/>
+</setup>
+`,
+		},
+		{
+			name: "long tags wrap",
+			in:   `<setup><bundle><msi source_64bit="product-{{PRODUCT_VERSION}}-x64.msi" source_32bit="product-{{PRODUCT_VERSION}}-x86.msi" source_arm64="product-{{PRODUCT_VERSION}}-arm64.msi"/></bundle></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <bundle>
+    <msi source_64bit="product-{{PRODUCT_VERSION}}-x64.msi"
+         source_32bit="product-{{PRODUCT_VERSION}}-x86.msi"
+         source_arm64="product-{{PRODUCT_VERSION}}-arm64.msi"/>
+  </bundle>
+</setup>
+`,
+		},
+		{
+			name: "verbatim wix",
+			in: `<setup><feature name="Main"><wix slot="ui">
+      <Publish Dialog='ExitDialog' Control="Finish" Event="EndDialog" Value="Return"/>
+    </wix></feature></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <feature name="Main">
+    <wix slot="ui">
+      <Publish Dialog='ExitDialog' Control="Finish" Event="EndDialog" Value="Return"/>
+    </wix>
+  </feature>
+</setup>
+`,
+		},
+		{
+			name: "merge modules and references",
+			in:   `<setup><feature name="Main"><merge-module source="vendor.msm"/><wix-reference source="lib.wixlib" component-group="Lib"/></feature></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <feature name="Main">
+    <merge-module source="vendor.msm"/>
+    <wix-reference source="lib.wixlib" component-group="Lib"/>
+  </feature>
+</setup>
+`,
+		},
+		{
+			name: "setup types",
+			in:   `<setup><feature name="Core"/><setup-type features="Core" name="Typical"/><set name="A" value="1"/><setup-type name="Custom" description="Pick features"/></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <set name="A" value="1"/>
+  <setup-type name="Typical" features="Core"/>
+  <setup-type name="Custom" description="Pick features"/>
+  <feature name="Core"/>
+</setup>
+`,
+		},
+		{
+			name: "instances",
+			in:   `<setup><feature name="Core"/><instances property="TENANT" count="{{TENANTS}}"/><set name="TENANTS" value="10"/></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <set name="TENANTS" value="10"/>
+  <instances count="{{TENANTS}}" property="TENANT"/>
+  <feature name="Core"/>
+</setup>
+`,
+		},
+		{
+			name: "transforms",
+			in:   `<setup><feature name="Core"/><transform name="site-berlin"><property value="berlin01" name="SERVER"/><!-- Default port --></transform><set name="A" value="1"/></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <set name="A" value="1"/>
+
+  <transform name="site-berlin">
+    <property name="SERVER" value="berlin01"/>
+    <!-- Default port -->
+  </transform>
+  <feature name="Core"/>
+</setup>
+`,
+		},
+		{
+			name: "feature presentation",
+			in:   `<setup><feature typical-default="advertise" install-default="source" advertise="allow" level="3" display="hidden" description="Server files" name="Server" id="Server"/></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <feature name="Server"
+           id="Server"
+           description="Server files"
+           display="hidden"
+           level="3"
+           advertise="allow"
+           install-default="source"
+           typical-default="advertise"/>
+</setup>
+`,
+		},
+		{
+			name: "directory",
+			in:   `<setup><feature name="Data"><directory id="DATADIR" root="APPDATADIR" path="Company\Data" configurable="yes"/></feature></setup>`,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <feature name="Data">
+    <directory id="DATADIR" root="APPDATADIR" path="Company\Data" configurable="true"/>
+  </feature>
+</setup>
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Format failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			again, err := Format(got)
+			if err != nil {
+				t.Fatalf("Format of formatted output failed: %v", err)
+			}
+			if !bytes.Equal(again, got) {
+				t.Errorf("Format is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+// TestFormatExamples checks that the shipped .msis files are canonical.
+func TestFormatExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "bootstrap", "*.msis"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no example files: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		got, err := Format(data)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s is not in canonical form:\n%s", file, got)
+		}
+	}
+}
+
+func TestWriteAfterSetVariable(t *testing.T) {
+	setup, err := ParseBytes([]byte(`<setup>
+  <!-- Bump on release -->
+  <set name="PRODUCT_VERSION" value="1.0.0"/>
+</setup>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup.SetVariable("PRODUCT_VERSION", "1.1.0")
+	setup.SetVariable("MANUFACTURER", "Acme")
+
+	var b bytes.Buffer
+	if err := Write(&b, setup); err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="utf-8"?>
+<setup>
+  <!-- Bump on release -->
+  <set name="PRODUCT_VERSION" value="1.1.0"/>
+  <set name="MANUFACTURER" value="Acme"/>
+</setup>
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// XSD returns the XML schema of .msis files, generated from Elements.
+func XSD() []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" elementFormDefault="qualified" attributeFormDefault="unqualified">
+  <xs:annotation>
+    <xs:documentation>
+      msis schema, generated by "msis /SCHEMA" from the element registry in
+      internal/parser. Do not edit by hand.
+    </xs:documentation>
+  </xs:annotation>
+
+  <xs:simpleType name="msisBoolean">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="([Tt][Rr][Uu][Ee]|[Ff][Aa][Ll][Ss][Ee]|[Yy][Ee][Ss]|[Nn][Oo]|[Oo][Nn]|[Oo][Ff][Ff]|1|0)"/>
+    </xs:restriction>
+  </xs:simpleType>
+
+  <!-- Values that reference variables are checked after resolution -->
+  <xs:simpleType name="msisTemplate">
+    <xs:restriction base="xs:string">
+      <xs:pattern value=".*\{\{.+\}\}.*"/>
+    </xs:restriction>
+  </xs:simpleType>
+`)
+
+	for _, e := range Elements {
+		if e.Name == "setup" {
+			continue
+		}
+		mixed := ""
+		if e.Verbatim {
+			mixed = ` mixed="true"`
+		}
+		fmt.Fprintf(&b, "\n  <xs:complexType name=%q%s>\n", typeName(e.Name), mixed)
+		writeComplexContent(&b, &e, "    ")
+		b.WriteString("  </xs:complexType>\n")
+	}
+
+	setup, _ := LookupElement("setup")
+	b.WriteString("\n  <xs:element name=\"setup\">\n")
+	writeDoc(&b, setup.Doc, "    ")
+	b.WriteString("    <xs:complexType>\n")
+	writeComplexContent(&b, setup, "      ")
+	b.WriteString("    </xs:complexType>\n")
+	b.WriteString("  </xs:element>\n")
+	b.WriteString("</xs:schema>\n")
+	return b.Bytes()
+}
+
+// writeComplexContent writes the children and attributes of an element type.
+func writeComplexContent(b *bytes.Buffer, e *Element, indent string) {
+	if e.Name != "setup" {
+		writeDoc(b, e.Doc, indent)
+	}
+	if len(e.Children) > 0 {
+		fmt.Fprintf(b, "%s<xs:sequence>\n", indent)
+		fmt.Fprintf(b, "%s  <xs:choice minOccurs=\"0\" maxOccurs=\"unbounded\">\n", indent)
+		for _, child := range e.Children {
+			fmt.Fprintf(b, "%s    <xs:element name=%q type=%q/>\n", indent, child, typeName(child))
+		}
+		fmt.Fprintf(b, "%s  </xs:choice>\n", indent)
+		fmt.Fprintf(b, "%s</xs:sequence>\n", indent)
+	}
+	if e.Verbatim {
+		// WiX elements are not part of this schema
+		fmt.Fprintf(b, "%s<xs:sequence>\n", indent)
+		fmt.Fprintf(b, "%s  <xs:any minOccurs=\"0\" maxOccurs=\"unbounded\" processContents=\"skip\"/>\n", indent)
+		fmt.Fprintf(b, "%s</xs:sequence>\n", indent)
+	}
+	for _, a := range e.Attributes {
+		use := "optional"
+		if a.Required {
+			use = "required"
+		}
+		if a.Type == Enum {
+			fmt.Fprintf(b, "%s<xs:attribute name=%q use=%q>\n", indent, a.Name, use)
+			writeDoc(b, a.Doc, indent+"  ")
+			fmt.Fprintf(b, "%s  <xs:simpleType>\n", indent)
+			fmt.Fprintf(b, "%s    <xs:union memberTypes=\"msisTemplate\">\n", indent)
+			fmt.Fprintf(b, "%s      <xs:simpleType>\n", indent)
+			fmt.Fprintf(b, "%s        <xs:restriction base=\"xs:string\">\n", indent)
+			for _, v := range a.Values {
+				fmt.Fprintf(b, "%s          <xs:enumeration value=%q/>\n", indent, v)
+			}
+			fmt.Fprintf(b, "%s        </xs:restriction>\n", indent)
+			fmt.Fprintf(b, "%s      </xs:simpleType>\n", indent)
+			fmt.Fprintf(b, "%s    </xs:union>\n", indent)
+			fmt.Fprintf(b, "%s  </xs:simpleType>\n", indent)
+			fmt.Fprintf(b, "%s</xs:attribute>\n", indent)
+			continue
+		}
+		xsdType := "xs:string"
+		if a.Type == Bool {
+			xsdType = "msisBoolean"
+		}
+		fmt.Fprintf(b, "%s<xs:attribute name=%q type=%q use=%q>\n", indent, a.Name, xsdType, use)
+		writeDoc(b, a.Doc, indent+"  ")
+		fmt.Fprintf(b, "%s</xs:attribute>\n", indent)
+	}
+}
+
+func writeDoc(b *bytes.Buffer, doc, indent string) {
+	if doc == "" {
+		return
+	}
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(doc))
+	fmt.Fprintf(b, "%s<xs:annotation><xs:documentation>%s</xs:documentation></xs:annotation>\n", indent, escaped.String())
+}
+
+// typeName returns the XSD type name of an element: set-env becomes SetEnvType.
+func typeName(element string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(element, "-") {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	b.WriteString("Type")
+	return b.String()
+}
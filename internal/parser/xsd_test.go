@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestXSDMatchesDocs keeps docs/msis.xsd in sync with the registry.
+// Regenerate it with: msis /SCHEMA > docs/msis.xsd
+func TestXSDMatchesDocs(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("..", "..", "docs", "msis.xsd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	if !bytes.Equal(XSD(), want) {
+		t.Error("docs/msis.xsd is out of date; regenerate it with: msis /SCHEMA > docs/msis.xsd")
+	}
+}
+
+func TestXSDIsWellFormed(t *testing.T) {
+	d := xml.NewDecoder(bytes.NewReader(XSD()))
+	for {
+		if _, err := d.Token(); err != nil {
+			if err == io.EOF {
+				return
+			}
+			t.Fatalf("XSD is not well-formed: %v", err)
+		}
+	}
+}
+
+// TestXSDCoversRegistry checks that every element and attribute the parser
+// accepts appears in the schema.
+func TestXSDCoversRegistry(t *testing.T) {
+	xsd := string(XSD())
+	for _, e := range Elements {
+		if !strings.Contains(xsd, `name="`+e.Name+`"`) {
+			t.Errorf("element <%s> missing from XSD", e.Name)
+		}
+		for _, a := range e.Attributes {
+			if !strings.Contains(xsd, `<xs:attribute name="`+a.Name+`"`) {
+				t.Errorf("attribute %s of <%s> missing from XSD", a.Name, e.Name)
+			}
+		}
+	}
+}
+
+func TestRegistryDrivesValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		xml     string
+		wantErr string
+	}{
+		{"set-env permanent", `<setup><set-env name="A" value="1" permanent="yes"/></setup>`, ""},
+		{"create-folder", `<setup><create-folder target="[APPDATADIR]Logs"/></setup>`, ""},
+		{"unknown attribute", `<setup><create-folder target="x" mode="0755"/></setup>`, "unknown attribute 'mode' on <create-folder>"},
+		{"missing required", `<setup><create-folder/></setup>`, "<create-folder> requires 'target' attribute"},
+		{"unknown bundle child attribute", `<setup><bundle><exe source="a.exe" silent="yes"/></bundle></setup>`, "unknown attribute 'silent' on <exe>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseBytes([]byte(tt.xml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
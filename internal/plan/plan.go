@@ -0,0 +1,361 @@
+// Package plan builds an install-plan preview from a generated context: the
+// resolved target tree of every root with file sizes and owning features,
+// the install actions in execution order and the installed size per feature.
+package plan
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/generator"
+)
+
+// Plan is the install-plan preview of one .msis file.
+type Plan struct {
+	Product   string        `json:"product"`
+	Version   string        `json:"version"`
+	Roots     []*Node       `json:"roots"`
+	Steps     []Step        `json:"steps"`
+	Features  []FeatureSize `json:"features"`
+	TotalSize int64         `json:"total_size"`
+}
+
+// Node is a directory or file of the target tree. Root nodes are named after
+// their msis root, e.g. "[INSTALLDIR]", and carry the resolved folder path.
+type Node struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path,omitempty"` // Root nodes only, e.g. "NGBT\chimera"
+	Dir      bool     `json:"dir,omitempty"`
+	Size     int64    `json:"size"` // File size, or the total size of a directory
+	Files    int      `json:"files,omitempty"`
+	Features []string `json:"features,omitempty"`
+	Children []*Node  `json:"children,omitempty"`
+}
+
+// Step is an install action and the entries it processes. Steps are listed
+// in InstallExecuteSequence order.
+type Step struct {
+	Action    string  `json:"action"` // Standard action or custom action ID
+	Sequence  int     `json:"sequence"`
+	When      string  `json:"when,omitempty"` // Custom actions: msis timing, e.g. "after-install"
+	Condition string  `json:"condition,omitempty"`
+	Entries   []Entry `json:"entries"`
+}
+
+// Entry is one thing a step does.
+type Entry struct {
+	Description string   `json:"description"`
+	Features    []string `json:"features,omitempty"`
+}
+
+// FeatureSize is the installed size of a feature. Files owned by several
+// features count towards each of them.
+type FeatureSize struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// Sequence numbers of the standard actions in InstallExecuteSequence.
+const (
+	seqCostFinalize            = 1000
+	seqInstallInitialize       = 1500
+	seqInstallFiles            = 4000
+	seqCreateShortcuts         = 4500
+	seqWriteRegistryValues     = 5000
+	seqWriteEnvironmentStrings = 5200
+	seqInstallServices         = 5800
+	seqStartServices           = 5900
+	seqInstallFinalize         = 6600
+)
+
+// standardSequences are the sequence numbers of the actions custom actions
+// are scheduled against.
+var standardSequences = map[string]int{
+	"CostFinalize":      seqCostFinalize,
+	"InstallInitialize": seqInstallInitialize,
+	"InstallFinalize":   seqInstallFinalize,
+}
+
+// customActionSequence places a custom action right before or after the
+// standard action the generator schedules it against.
+func customActionSequence(timing generator.CustomActionTiming) (int, bool) {
+	seq, ok := standardSequences[timing.Reference]
+	if !ok {
+		return 0, false
+	}
+	if timing.Position == "Before" {
+		return seq - 1, true
+	}
+	return seq + 1, true
+}
+
+// Build creates the plan for a generated context. Payload files are read
+// from disk for their sizes, relative to the context's work directory.
+func Build(ctx *generator.Context) (*Plan, error) {
+	p := &Plan{
+		Product: ctx.Variables.ProductName(),
+		Version: ctx.Variables.ProductVersion(),
+	}
+
+	roots := make(map[string]*Node)
+	rootNode := func(key string) *Node {
+		if node, ok := roots[key]; ok {
+			return node
+		}
+		node := &Node{Name: "[" + key + "]", Path: rootPath(ctx, key), Dir: true}
+		roots[key] = node
+		p.Roots = append(p.Roots, node)
+		return node
+	}
+	for _, dir := range ctx.Directories() {
+		if !strings.HasPrefix(dir.Target, "[") {
+			continue // Directories above the root's custom ID
+		}
+		// Declared directories are roots of their own, like their files
+		rootKey, subPath := generator.ParseTarget(dir.Target)
+		descend(rootNode(rootKey), subPath)
+	}
+
+	featureSizes := make(map[string]*FeatureSize)
+	for _, file := range ctx.Files() {
+		path := file.SourcePath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(ctx.WorkDir, path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading payload file: %w", err)
+		}
+
+		rootKey, subPath := generator.ParseTarget(file.Target)
+		dirPath, name := "", subPath
+		if i := strings.LastIndex(subPath, `\`); i >= 0 {
+			dirPath, name = subPath[:i], subPath[i+1:]
+		}
+		dir := descend(rootNode(rootKey), dirPath)
+		dir.Children = append(dir.Children, &Node{Name: name, Size: info.Size(), Features: file.Features})
+
+		p.TotalSize += info.Size()
+		for _, feature := range file.Features {
+			fs, ok := featureSizes[feature]
+			if !ok {
+				fs = &FeatureSize{Name: feature}
+				featureSizes[feature] = fs
+			}
+			fs.Files++
+			fs.Size += info.Size()
+		}
+	}
+
+	sort.Slice(p.Roots, func(i, j int) bool { return p.Roots[i].Name < p.Roots[j].Name })
+	for _, root := range p.Roots {
+		summarize(root)
+	}
+	for _, name := range ctx.FeatureNames() {
+		if fs, ok := featureSizes[name]; ok {
+			p.Features = append(p.Features, *fs)
+		} else {
+			p.Features = append(p.Features, FeatureSize{Name: name})
+		}
+	}
+
+	p.Steps = buildSteps(ctx, p.Roots)
+	return p, nil
+}
+
+// descend returns the directory node at a backslash-separated path below
+// node, creating missing directories.
+func descend(node *Node, path string) *Node {
+	for _, part := range strings.Split(path, `\`) {
+		if part == "" {
+			continue
+		}
+		var next *Node
+		for _, child := range node.Children {
+			if child.Dir && strings.EqualFold(child.Name, part) {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			next = &Node{Name: part, Dir: true}
+			node.Children = append(node.Children, next)
+		}
+		node = next
+	}
+	return node
+}
+
+// summarize sorts a directory (subdirectories first, then files, each by
+// name) and totals its size and file count.
+func summarize(node *Node) {
+	sort.SliceStable(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Dir != b.Dir {
+			return a.Dir
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	node.Size, node.Files = 0, 0
+	for _, child := range node.Children {
+		if child.Dir {
+			summarize(child)
+			node.Files += child.Files
+		} else {
+			node.Files++
+		}
+		node.Size += child.Size
+	}
+}
+
+// rootPath returns the folder a root resolves to, e.g. "NGBT\chimera" for
+// INSTALLDIR="NGBT\chimera".
+func rootPath(ctx *generator.Context, key string) string {
+	var parts []string
+	dir := ctx.DirectoryTrees[key]
+	if dir != nil && dir.StandardID != "" {
+		return "" // Standard folders are their own location
+	}
+	for dir != nil {
+		if dir.Name != "" {
+			parts = append(parts, dir.Name)
+		}
+		if dir.CustomID == key || len(dir.Children) == 0 {
+			break
+		}
+		// Above the custom ID, each directory has exactly one child on the way down
+		var next *generator.Directory
+		for _, child := range dir.Children {
+			if next == nil || child.CustomID == key {
+				next = child
+			}
+		}
+		dir = next
+	}
+	return strings.Join(parts, `\`)
+}
+
+// buildSteps lists the install actions in execution order.
+func buildSteps(ctx *generator.Context, roots []*Node) []Step {
+	var steps []Step
+	add := func(step Step) {
+		if len(step.Entries) > 0 {
+			steps = append(steps, step)
+		}
+	}
+
+	for _, ca := range ctx.CustomActions {
+		timing, ok := generator.CustomActionTimings[ca.When]
+		if !ok {
+			continue // Not scheduled by the generator either
+		}
+		sequence, ok := customActionSequence(timing)
+		if !ok {
+			continue
+		}
+		entry := Entry{Description: ca.Command}
+		if ca.Directory != "" {
+			entry.Description += " (in [" + ca.Directory + "])"
+		}
+		add(Step{Action: ca.ID, Sequence: sequence, When: ca.When, Condition: timing.Condition, Entries: []Entry{entry}})
+	}
+
+	files := Step{Action: "InstallFiles", Sequence: seqInstallFiles}
+	for _, root := range roots {
+		if root.Files > 0 {
+			files.Entries = append(files.Entries, Entry{Description: fmt.Sprintf("%s: %s, %s", root.Name, formatFiles(root.Files), FormatSize(root.Size))})
+		}
+	}
+	add(files)
+
+	shortcuts := Step{Action: "CreateShortcuts", Sequence: seqCreateShortcuts}
+	addShortcuts := func(list []*generator.ShortcutComponent, folder string) {
+		for _, sc := range list {
+			shortcuts.Entries = append(shortcuts.Entries, Entry{
+				Description: fmt.Sprintf("[%s]%s -> %s", folder, sc.Shortcut.Name, sc.Shortcut.Target),
+				Features:    ctx.ComponentFeatures(sc.ID),
+			})
+		}
+	}
+	addShortcuts(ctx.DesktopShortcuts, "DesktopFolder")
+	addShortcuts(ctx.StartMenuShortcuts, "ProgramMenuFolder")
+	add(shortcuts)
+
+	registry := Step{Action: "WriteRegistryValues", Sequence: seqWriteRegistryValues}
+	for _, comp := range ctx.RegistryComponents {
+		features := ctx.ComponentFeatures(comp.ID)
+		for _, val := range comp.AllValues() {
+			name := val.Name
+			if name == "" {
+				name = "(Default)"
+			}
+			value := strings.ReplaceAll(val.Value, "\x00", `\0`)
+			registry.Entries = append(registry.Entries, Entry{
+				Description: fmt.Sprintf(`%s\%s: %s = %s (%s)`, val.Root, val.Key, name, value, val.Type),
+				Features:    features,
+			})
+		}
+	}
+	add(registry)
+
+	environment := Step{Action: "WriteEnvironmentStrings", Sequence: seqWriteEnvironmentStrings}
+	for _, env := range ctx.Environments() {
+		op := "="
+		if env.Environment.Part == "last" {
+			op = "+="
+		}
+		description := fmt.Sprintf("%s %s %s", env.Environment.Name, op, env.Environment.Value)
+		if env.Environment.Permanent {
+			description += " (permanent)"
+		}
+		environment.Entries = append(environment.Entries, Entry{Description: description, Features: env.Features})
+	}
+	add(environment)
+
+	install := Step{Action: "InstallServices", Sequence: seqInstallServices}
+	start := Step{Action: "StartServices", Sequence: seqStartServices}
+	for _, svc := range ctx.Services() {
+		details := "start " + svc.Service.Start
+		if svc.Service.DisplayName != "" {
+			details = svc.Service.DisplayName + ", " + details
+		}
+		install.Entries = append(install.Entries, Entry{
+			Description: fmt.Sprintf("%s (%s): %s", svc.Service.Name, details, svc.Service.FileName),
+			Features:    svc.Features,
+		})
+		if svc.Service.StartAfterInstall {
+			start.Entries = append(start.Entries, Entry{Description: svc.Service.Name, Features: svc.Features})
+		}
+	}
+	add(install)
+	add(start)
+
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].Sequence < steps[j].Sequence })
+	return steps
+}
+
+// formatFiles formats a file count, e.g. "1 file" or "4 files".
+func formatFiles(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+// FormatSize formats a byte count for display, e.g. "1.5 MB".
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
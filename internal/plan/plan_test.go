@@ -0,0 +1,220 @@
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func buildPlan(t *testing.T) *Plan {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]int{
+		"bin/app.exe":         2048,
+		"bin/plugins/a.dll":   100,
+		"tools/tool.exe":      3000,
+		"data/settings.ini":   10,
+		"service/service.exe": 500,
+	}
+	for name, size := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setup := &ir.Setup{
+		Features: []ir.Feature{
+			{
+				Name:    "Main",
+				Enabled: true,
+				Items: []ir.Item{
+					ir.Files{Source: "bin", Target: "[INSTALLDIR]"},
+					ir.Files{Source: "data", Target: "[APPDATADIR]config"},
+					ir.Files{Source: "service", Target: "[INSTALLDIR]"},
+					ir.Service{FileName: "service.exe", ServiceName: "MySvc", ServiceDisplayName: "My Service", Start: "auto"},
+					ir.SetEnv{Name: "MYAPP_HOME", Value: "[INSTALLDIR]"},
+					ir.Shortcut{Name: "App", Target: "DESKTOP", File: "[INSTALLDIR]app.exe"},
+					ir.Execute{Cmd: "[INSTALLDIR]app.exe --register", When: "after-install"},
+					ir.Execute{Cmd: "[INSTALLDIR]app.exe --prepare", When: "before-install"},
+				},
+				SubFeatures: []ir.Feature{{
+					Name:    "Tools",
+					Enabled: true,
+					Items:   []ir.Item{ir.Files{Source: "tools", Target: "[INSTALLDIR]tools"}},
+				}},
+			},
+		},
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = `NGBT\MyApp`
+	vars["PRODUCT_NAME"] = "MyApp"
+	vars["PRODUCT_VERSION"] = "1.2.3"
+
+	ctx := generator.NewContext(setup, vars, dir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	p, err := Build(ctx)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	return p
+}
+
+func TestBuildTreeAndSizes(t *testing.T) {
+	p := buildPlan(t)
+
+	if len(p.Roots) != 2 || p.Roots[0].Name != "[APPDATADIR]" || p.Roots[1].Name != "[INSTALLDIR]" {
+		t.Fatalf("unexpected roots: %+v", p.Roots)
+	}
+	install := p.Roots[1]
+	if install.Path != `NGBT\MyApp` {
+		t.Errorf("INSTALLDIR path = %q", install.Path)
+	}
+	if install.Files != 4 || install.Size != 2048+100+3000+500 {
+		t.Errorf("INSTALLDIR summary = %d files, %d bytes", install.Files, install.Size)
+	}
+	// Directories first, then files
+	var names []string
+	for _, child := range install.Children {
+		names = append(names, child.Name)
+	}
+	if got := strings.Join(names, ","); got != "plugins,tools,app.exe,service.exe" {
+		t.Errorf("INSTALLDIR children = %s", got)
+	}
+	if p.TotalSize != 2048+100+3000+500+10 {
+		t.Errorf("TotalSize = %d", p.TotalSize)
+	}
+
+	want := map[string]int64{"Main": 2048 + 100 + 500 + 10, "Main/Tools": 3000}
+	if len(p.Features) != 2 {
+		t.Fatalf("unexpected features: %+v", p.Features)
+	}
+	for _, fs := range p.Features {
+		if fs.Size != want[fs.Name] {
+			t.Errorf("feature %s size = %d, want %d", fs.Name, fs.Size, want[fs.Name])
+		}
+	}
+}
+
+func TestStepsInExecutionOrder(t *testing.T) {
+	p := buildPlan(t)
+
+	var actions []string
+	for i, step := range p.Steps {
+		if i > 0 && step.Sequence < p.Steps[i-1].Sequence {
+			t.Errorf("step %s out of order", step.Action)
+		}
+		if step.When != "" {
+			actions = append(actions, step.When)
+		} else {
+			actions = append(actions, step.Action)
+		}
+	}
+	want := "before-install,InstallFiles,CreateShortcuts,WriteEnvironmentStrings,InstallServices,StartServices,after-install"
+	if got := strings.Join(actions, ","); got != want {
+		t.Errorf("steps = %s\nwant    %s", got, want)
+	}
+}
+
+func TestServiceWithoutDisplayName(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "helper.exe"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setup := &ir.Setup{Features: []ir.Feature{{Name: "Main", Enabled: true, Items: []ir.Item{
+		ir.Files{Source: "helper.exe", Target: "[INSTALLDIR]"},
+		ir.Service{FileName: "helper.exe", ServiceName: "MyHelper", Start: "demand"},
+	}}}}
+	ctx := generator.NewContext(setup, variables.New(), dir)
+	if _, err := ctx.Generate(); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	p, err := Build(ctx)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if tree := RenderTree(p); !strings.Contains(tree, "MyHelper (start demand): helper.exe") {
+		t.Errorf("tree output missing the service:\n%s", tree)
+	}
+}
+
+func TestCustomActionSequences(t *testing.T) {
+	for when, timing := range generator.CustomActionTimings {
+		seq, ok := customActionSequence(timing)
+		if !ok {
+			t.Errorf("%s: no sequence for %s %s", when, timing.Position, timing.Reference)
+			continue
+		}
+		if ref := standardSequences[timing.Reference]; timing.Position == "Before" && seq >= ref || timing.Position == "After" && seq <= ref {
+			t.Errorf("%s: sequence %d is not %s %s (%d)", when, seq, timing.Position, timing.Reference, ref)
+		}
+	}
+}
+
+func TestRenderFormats(t *testing.T) {
+	p := buildPlan(t)
+
+	tests := []struct {
+		name   string
+		render func(*Plan) string
+		golden string
+	}{
+		{"tree", RenderTree, "plan.txt"},
+		{"markdown", RenderMarkdown, "plan.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := os.ReadFile(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Git may check the golden files out with CRLF line endings
+			want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+			if got := tt.render(p); got != string(want) {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Plan
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.TotalSize != p.TotalSize || len(decoded.Roots) != len(p.Roots) {
+		t.Errorf("JSON round trip lost data: %s", data)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.size); got != tt.want {
+			t.Errorf("FormatSize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
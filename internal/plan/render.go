@@ -0,0 +1,131 @@
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderTree formats the plan as an indented tree for the console.
+func RenderTree(p *Plan) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", p.Product, p.Version)
+
+	for _, root := range p.Roots {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "%s  (%s)\n", strings.TrimSpace(root.Name+" "+root.Path), dirSummary(root))
+		writeTree(&b, root.Children, "")
+	}
+
+	if len(p.Steps) > 0 {
+		b.WriteString("\nExecution order:\n")
+		for _, step := range p.Steps {
+			fmt.Fprintf(&b, "  %4d %s%s\n", step.Sequence, step.Action, stepSchedule(step))
+			for _, entry := range step.Entries {
+				fmt.Fprintf(&b, "         %s%s\n", entry.Description, featureSuffix(entry.Features))
+			}
+		}
+	}
+
+	b.WriteString("\nInstalled size:\n")
+	for _, fs := range p.Features {
+		fmt.Fprintf(&b, "  %-30s %12s  %10s\n", fs.Name, formatFiles(fs.Files), FormatSize(fs.Size))
+	}
+	fmt.Fprintf(&b, "  %-30s %12s  %10s\n", "Total", formatFiles(totalFiles(p)), FormatSize(p.TotalSize))
+	return b.String()
+}
+
+func writeTree(b *strings.Builder, nodes []*Node, prefix string) {
+	for i, node := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		if node.Dir {
+			fmt.Fprintf(b, "%s%s%s\\  (%s)\n", prefix, branch, node.Name, dirSummary(node))
+			writeTree(b, node.Children, prefix+indent)
+		} else {
+			fmt.Fprintf(b, "%s%s%s  %s%s\n", prefix, branch, node.Name, FormatSize(node.Size), featureSuffix(node.Features))
+		}
+	}
+}
+
+// RenderMarkdown formats the plan as a Markdown document, e.g. for release
+// notes or review comments.
+func RenderMarkdown(p *Plan) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Install plan: %s %s\n", p.Product, p.Version)
+
+	for _, root := range p.Roots {
+		fmt.Fprintf(&b, "\n## %s\n\n", strings.TrimSpace("`"+root.Name+"` "+markdownEscape(root.Path)))
+		b.WriteString("| Path | Size | Features |\n")
+		b.WriteString("|------|-----:|----------|\n")
+		writeMarkdownRows(&b, root.Children, "")
+	}
+
+	if len(p.Steps) > 0 {
+		b.WriteString("\n## Execution order\n\n")
+		for i, step := range p.Steps {
+			fmt.Fprintf(&b, "%d. **%s** (%d)%s\n", i+1, step.Action, step.Sequence, markdownEscape(stepSchedule(step)))
+			for _, entry := range step.Entries {
+				fmt.Fprintf(&b, "   - %s%s\n", markdownEscape(entry.Description), featureSuffix(entry.Features))
+			}
+		}
+	}
+
+	b.WriteString("\n## Installed size\n\n")
+	b.WriteString("| Feature | Files | Size |\n")
+	b.WriteString("|---------|------:|-----:|\n")
+	for _, fs := range p.Features {
+		fmt.Fprintf(&b, "| %s | %d | %s |\n", markdownEscape(fs.Name), fs.Files, FormatSize(fs.Size))
+	}
+	fmt.Fprintf(&b, "| **Total** | %d | %s |\n", totalFiles(p), FormatSize(p.TotalSize))
+	return b.String()
+}
+
+func writeMarkdownRows(b *strings.Builder, nodes []*Node, prefix string) {
+	for _, node := range nodes {
+		path := prefix + node.Name
+		if node.Dir {
+			fmt.Fprintf(b, "| %s\\ | %s | |\n", markdownEscape(path), FormatSize(node.Size))
+			writeMarkdownRows(b, node.Children, path+`\`)
+		} else {
+			fmt.Fprintf(b, "| %s | %s | %s |\n", markdownEscape(path), FormatSize(node.Size), markdownEscape(strings.Join(node.Features, ", ")))
+		}
+	}
+}
+
+// markdownEscape escapes characters that would break table cells or turn
+// into emphasis.
+func markdownEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`").Replace(s)
+}
+
+func dirSummary(node *Node) string {
+	return fmt.Sprintf("%s, %s", formatFiles(node.Files), FormatSize(node.Size))
+}
+
+func stepSchedule(step Step) string {
+	switch {
+	case step.When != "" && step.Condition != "":
+		return fmt.Sprintf(" [%s] if %s", step.When, step.Condition)
+	case step.When != "":
+		return fmt.Sprintf(" [%s]", step.When)
+	}
+	return ""
+}
+
+func featureSuffix(features []string) string {
+	if len(features) == 0 {
+		return ""
+	}
+	return "  (" + strings.Join(features, ", ") + ")"
+}
+
+// totalFiles counts the files of all roots.
+func totalFiles(p *Plan) int {
+	n := 0
+	for _, root := range p.Roots {
+		n += root.Files
+	}
+	return n
+}
@@ -4,6 +4,7 @@
 package prereqcache
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -141,8 +142,8 @@ func (c *Cache) GetCachedPath(prereqType, version, arch string) string {
 
 // EnsurePrerequisite ensures a prerequisite is available in the cache.
 // If customSource is provided, it's used instead of downloading.
-// Returns the path to the cached file.
-func (c *Cache) EnsurePrerequisite(prereqType, version, arch, customSource string, progress func(msg string)) (string, error) {
+// Returns the path to the cached file. Cancelling ctx aborts a download.
+func (c *Cache) EnsurePrerequisite(ctx context.Context, prereqType, version, arch, customSource string, progress func(msg string)) (string, error) {
 	// If custom source is provided, use it directly (no caching)
 	if customSource != "" {
 		if _, err := os.Stat(customSource); err != nil {
@@ -178,7 +179,7 @@ func (c *Cache) EnsurePrerequisite(prereqType, version, arch, customSource strin
 		progress(fmt.Sprintf("Downloading: %s", urlInfo.FileName))
 	}
 
-	if err := downloadFile(urlInfo.URL, destPath, progress); err != nil {
+	if err := downloadFile(ctx, urlInfo.URL, destPath, progress); err != nil {
 		return "", fmt.Errorf("downloading %s: %w", urlInfo.FileName, err)
 	}
 
@@ -247,7 +248,7 @@ func getExpectedFileName(prereqType, version, arch string) string {
 var DownloadTimeout = 5 * time.Minute
 
 // downloadFile downloads a file from URL to destPath with progress reporting.
-func downloadFile(url, destPath string, progress func(msg string)) error {
+func downloadFile(ctx context.Context, url, destPath string, progress func(msg string)) error {
 	// Create temporary file
 	tempPath := destPath + ".download"
 	out, err := os.Create(tempPath)
@@ -265,7 +266,11 @@ func downloadFile(url, destPath string, progress func(msg string)) error {
 	}
 
 	// Download
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
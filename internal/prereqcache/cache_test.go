@@ -1,6 +1,7 @@
 package prereqcache
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -93,7 +94,7 @@ func TestCacheCustomSource(t *testing.T) {
 	cache := &Cache{CacheDir: tempDir}
 
 	// Custom source should be returned as-is
-	path, err := cache.EnsurePrerequisite("vcredist", "2022", "x64", customFile, nil)
+	path, err := cache.EnsurePrerequisite(context.Background(), "vcredist", "2022", "x64", customFile, nil)
 	if err != nil {
 		t.Fatalf("EnsurePrerequisite failed: %v", err)
 	}
@@ -112,7 +113,7 @@ func TestCacheCustomSourceNotFound(t *testing.T) {
 	cache := &Cache{CacheDir: tempDir}
 
 	// Non-existent custom source should error
-	_, err = cache.EnsurePrerequisite("vcredist", "2022", "x64", "/nonexistent/file.exe", nil)
+	_, err = cache.EnsurePrerequisite(context.Background(), "vcredist", "2022", "x64", "/nonexistent/file.exe", nil)
 	if err == nil {
 		t.Error("expected error for non-existent custom source")
 	}
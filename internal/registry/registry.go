@@ -2,7 +2,6 @@
 package registry
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -12,6 +11,7 @@ import (
 
 	"github.com/gersonkurz/go-regis3"
 	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/wxs"
 )
 
 // DefaultSDDL is the default security descriptor for registry keys.
@@ -27,6 +27,8 @@ type Component struct {
 	Condition string
 	SDDL      string
 	Keys      []*RegistryKey
+
+	MultiInstance bool // Gets new GUIDs in each instance transform
 }
 
 // RegistryKey represents a WiX RegistryKey element.
@@ -302,17 +304,15 @@ func (p *Processor) GenerateXML(components []*Component, setPermissions bool) st
 
 // GenerateXMLWithPreservedIDs generates WiX XML for the components, using pre-built preserved IDs.
 func (p *Processor) GenerateXMLWithPreservedIDs(components []*Component, setPermissions bool, allPreservedIDs []map[string]int) string {
-	var sb strings.Builder
-
+	var elements []any
 	for i, comp := range components {
 		var preservedIDs map[string]int
 		if allPreservedIDs != nil && i < len(allPreservedIDs) {
 			preservedIDs = allPreservedIDs[i]
 		}
-		p.generateComponentXML(comp, &sb, setPermissions, preservedIDs)
+		elements = append(elements, p.componentElement(comp, setPermissions, preservedIDs))
 	}
-
-	return sb.String()
+	return wxs.MustRender(2, elements...)
 }
 
 // GeneratePreservationXML generates Property+RegistrySearch elements for preserved registry values.
@@ -320,8 +320,7 @@ func (p *Processor) GenerateXMLWithPreservedIDs(components []*Component, setPerm
 // values are read before the install writes new ones. If a value already exists, it's preserved;
 // otherwise the default from the .reg file is used.
 func (p *Processor) GeneratePreservationXML(components []*Component, allPreservedIDs []map[string]int) string {
-	var sb strings.Builder
-
+	var elements []any
 	for i, comp := range components {
 		if !comp.Preserve {
 			continue
@@ -335,12 +334,11 @@ func (p *Processor) GeneratePreservationXML(components []*Component, allPreserve
 		}
 		for _, key := range comp.Keys {
 			if !key.RemoveFlag {
-				p.generatePreservationPropertiesRecursive(key, key.Root, &sb, preservedIDs)
+				elements = append(elements, p.preservationElements(key, key.Root, preservedIDs)...)
 			}
 		}
 	}
-
-	return sb.String()
+	return wxs.MustRender(1, elements...)
 }
 
 // collectPreservedIDs recursively collects preserved value IDs from the key tree.
@@ -380,15 +378,16 @@ func shouldPreserveValue(val *RegistryValue) bool {
 	return true
 }
 
-// generatePreservationPropertiesRecursive walks the key tree and generates
-// preservation XML for each preservable value. Uses a three-element pattern:
+// preservationElements walks the key tree and generates preservation
+// elements for each preservable value. Uses a three-element pattern:
 //  1. PS_RV_XXXXX — Property holding the default value from the .reg file
 //  2. PS_RS_XXXXX — Search property with RegistrySearch (empty if value not found)
 //  3. SetProperty — conditionally copies found value into PS_RV_XXXXX
 //
 // This avoids the MSI AppSearch behavior where a failed RegistrySearch clears
 // the Property default, which would lose the .reg file default on first install.
-func (p *Processor) generatePreservationPropertiesRecursive(key *RegistryKey, root string, sb *strings.Builder, preservedIDs map[string]int) {
+func (p *Processor) preservationElements(key *RegistryKey, root string, preservedIDs map[string]int) []any {
+	var elements []any
 	for _, val := range key.Values {
 		if val.RemoveFlag || !shouldPreserveValue(val) {
 			continue
@@ -398,38 +397,29 @@ func (p *Processor) generatePreservationPropertiesRecursive(key *RegistryKey, ro
 		if !ok {
 			continue
 		}
+		valueID := fmt.Sprintf("PS_RV_%05d", id)
+		searchID := fmt.Sprintf("PS_RS_%05d", id)
 
-		// Encode default value based on type
-		defaultValue := encodePreservationDefault(val)
-
-		// 1. Default property — holds the .reg file default, never touched by AppSearch.
-		//    Secure='yes' ensures the value survives client→server handoff during elevated installs.
-		if defaultValue == "" {
-			sb.WriteString(fmt.Sprintf("    <Property Id='PS_RV_%05d' Secure='yes'/>\n", id))
-		} else {
-			sb.WriteString(fmt.Sprintf("    <Property Id='PS_RV_%05d' Value='%s' Secure='yes'/>\n", id, defaultValue))
-		}
-
-		// 2. Search property — RegistrySearch reads existing value (or clears to empty)
-		nameAttr := ""
-		if val.Name != "" {
-			nameAttr = fmt.Sprintf(" Name='%s'", escapeXML(val.Name))
-		}
-		sb.WriteString(fmt.Sprintf("    <Property Id='PS_RS_%05d' Secure='yes'>\n", id))
-		sb.WriteString(fmt.Sprintf("        <RegistrySearch Id='PS_RS_%05d_Registry' Type='raw' Root='%s' Key='%s'%s/>\n",
-			id, root, escapeXML(key.Key), nameAttr))
-		sb.WriteString("    </Property>\n")
-
-		// 3. Conditional override — only copies search result when the search found something
-		sb.WriteString(fmt.Sprintf("    <SetProperty Id='PS_RV_%05d' Value='[PS_RS_%05d]' After='AppSearch' Sequence='both' Condition='PS_RS_%05d'/>\n",
-			id, id, id))
+		elements = append(elements,
+			// 1. Default property — holds the .reg file default, never touched by AppSearch.
+			//    Secure='yes' ensures the value survives client→server handoff during elevated installs.
+			//    An empty default omits the Value attribute.
+			&wxs.Property{ID: valueID, Value: encodePreservationDefault(val), Secure: "yes"},
+			// 2. Search property — RegistrySearch reads existing value (or clears to empty)
+			&wxs.Property{ID: searchID, Secure: "yes", Children: []any{
+				&wxs.RegistrySearch{ID: searchID + "_Registry", Type: "raw", Root: root, Key: key.Key, Name: val.Name},
+			}},
+			// 3. Conditional override — only copies search result when the search found something
+			&wxs.SetProperty{ID: valueID, Value: "[" + searchID + "]", After: "AppSearch", Sequence: "both", Condition: searchID},
+		)
 	}
 
 	for _, subKey := range key.SubKeys {
 		if !subKey.RemoveFlag {
-			p.generatePreservationPropertiesRecursive(subKey, root, sb, preservedIDs)
+			elements = append(elements, p.preservationElements(subKey, root, preservedIDs)...)
 		}
 	}
+	return elements
 }
 
 // encodePreservationDefault encodes a registry value's default for a WiX Property Value attribute.
@@ -461,7 +451,7 @@ func encodeBinaryForPreserve(hexStr string) string {
 	return sb.String()
 }
 
-func (p *Processor) generateComponentXML(comp *Component, sb *strings.Builder, setPermissions bool, preservedIDs map[string]int) {
+func (p *Processor) componentElement(comp *Component, setPermissions bool, preservedIDs map[string]int) *wxs.Component {
 	// Collect all removal entries first (they go at component level in WiX 6)
 	var removals []RemovalEntry
 	for _, key := range comp.Keys {
@@ -469,32 +459,29 @@ func (p *Processor) generateComponentXML(comp *Component, sb *strings.Builder, s
 	}
 
 	// Component attributes - KeyPath must be on a RegistryValue, not Component
-	attrs := fmt.Sprintf("Id='%s' Guid='%s'", comp.ID, comp.GUID)
-	if comp.Permanent {
-		attrs += " Permanent='yes'"
+	element := &wxs.Component{
+		ID:             comp.ID,
+		GUID:           comp.GUID,
+		Permanent:      wxs.Yes(comp.Permanent),
+		NeverOverwrite: wxs.Yes(comp.Preserve),
+		Condition:      comp.Condition,
+		MultiInstance:  wxs.Yes(comp.MultiInstance),
 	}
-	if comp.Preserve {
-		attrs += " NeverOverwrite='yes'"
-	}
-	if comp.Condition != "" {
-		attrs += fmt.Sprintf(" Condition='%s'", escapeXML(comp.Condition))
-	}
-
-	sb.WriteString(fmt.Sprintf("        <Component %s>\n", attrs))
 
 	// Emit removal entries at component level (WiX 6 requirement)
 	for _, removal := range removals {
-		indent := "            "
 		if removal.IsKey {
-			sb.WriteString(fmt.Sprintf("%s<RemoveRegistryKey Action='removeOnInstall' Root='%s' Key='%s'/>\n",
-				indent, removal.Root, escapeXML(removal.Key)))
+			element.Content = append(element.Content, &wxs.RemoveRegistryKey{
+				Action: "removeOnInstall",
+				Root:   removal.Root,
+				Key:    removal.Key,
+			})
 		} else {
-			nameAttr := ""
-			if removal.Name != "" {
-				nameAttr = fmt.Sprintf(" Name='%s'", escapeXML(removal.Name))
-			}
-			sb.WriteString(fmt.Sprintf("%s<RemoveRegistryValue Root='%s' Key='%s'%s/>\n",
-				indent, removal.Root, escapeXML(removal.Key), nameAttr))
+			element.Content = append(element.Content, &wxs.RemoveRegistryValue{
+				Root: removal.Root,
+				Key:  removal.Key,
+				Name: removal.Name,
+			})
 		}
 	}
 
@@ -502,7 +489,8 @@ func (p *Processor) generateComponentXML(comp *Component, sb *strings.Builder, s
 	isFirstValue := true
 	for _, key := range comp.Keys {
 		if !key.RemoveFlag {
-			p.generateRegistryKeyXML(key, sb, comp.SDDL, setPermissions, !comp.Permanent, 3, &isFirstValue, preservedIDs)
+			element.Content = append(element.Content,
+				p.registryKeyElement(key, true, comp.SDDL, setPermissions, !comp.Permanent, &isFirstValue, preservedIDs))
 		}
 	}
 
@@ -512,12 +500,18 @@ func (p *Processor) generateComponentXML(comp *Component, sb *strings.Builder, s
 		// Find the first non-removal key to use as the keypath location
 		root, keyPath := p.findFirstKeyPath(comp.Keys)
 		if root != "" && keyPath != "" {
-			sb.WriteString(fmt.Sprintf("            <RegistryValue Root='%s' Key='%s' Name='_msis_keypath' Value='' Type='string' KeyPath='yes'/>\n",
-				root, escapeXML(keyPath)))
+			element.Content = append(element.Content, &wxs.RegistryValue{
+				Root:    root,
+				Key:     keyPath,
+				Name:    "_msis_keypath",
+				Value:   wxs.String(""),
+				Type:    "string",
+				KeyPath: "yes",
+			})
 		}
 	}
 
-	sb.WriteString("        </Component>\n")
+	return element
 }
 
 // collectRemovals recursively collects all removal entries from the key tree.
@@ -549,104 +543,56 @@ func (p *Processor) collectRemovals(key *RegistryKey, removals *[]RemovalEntry)
 	}
 }
 
-func (p *Processor) generateRegistryKeyXML(key *RegistryKey, sb *strings.Builder, sddl string, setPermissions bool, canForceDelete bool, depth int, isFirstValue *bool, preservedIDs map[string]int) {
-	indent := strings.Repeat("    ", depth)
-
-	if key.RemoveFlag {
-		// Removals are handled at component level
-		return
+// registryKeyElement builds a RegistryKey element. Top-level keys carry the
+// root and full key path; nested keys only the last part of the path.
+func (p *Processor) registryKeyElement(key *RegistryKey, topLevel bool, sddl string, setPermissions bool, canForceDelete bool, isFirstValue *bool, preservedIDs map[string]int) *wxs.RegistryKey {
+	element := &wxs.RegistryKey{Key: key.Key, ForceCreateOnInstall: "yes"}
+	if topLevel {
+		element.Root = key.Root
+	} else {
+		// Extract just the last part of the key path for nested keys
+		parts := strings.Split(key.Key, "\\")
+		element.Key = parts[len(parts)-1]
 	}
 
 	// Only add ForceDeleteOnUninstall to empty keys (no values in this key or any subkeys).
 	// Keys with values are left alone — MSI removes individual values it created, and
 	// runtime-created values (not in the .reg file) are preserved.
-	deleteAttr := ""
 	if canForceDelete && !keyTreeHasValues(key) {
-		deleteAttr = " ForceDeleteOnUninstall='yes'"
+		element.ForceDeleteOnUninstall = "yes"
 	}
-	sb.WriteString(fmt.Sprintf("%s<RegistryKey Root='%s' Key='%s' ForceCreateOnInstall='yes'%s>\n",
-		indent, key.Root, escapeXML(key.Key), deleteAttr))
 
 	// Add permissions if enabled
 	// Note: Use core WiX PermissionEx (not util:PermissionEx) for Sddl attribute on registry keys
 	if setPermissions && sddl != "" {
-		sb.WriteString(fmt.Sprintf("%s    <PermissionEx Sddl='%s'/>\n", indent, escapeXML(sddl)))
+		element.Children = append(element.Children, &wxs.PermissionEx{Sddl: sddl})
 	}
 
 	// Generate values (skip removals, they're at component level)
 	for _, val := range key.Values {
 		if !val.RemoveFlag {
-			p.generateRegistryValueXML(val, key, sb, depth+1, isFirstValue, preservedIDs)
+			element.Children = append(element.Children, p.registryValueElement(val, key, isFirstValue, preservedIDs))
 		}
 	}
 
-	// Generate subkeys
+	// Generate subkeys (removals are handled at component level)
 	for _, subKey := range key.SubKeys {
-		// Subkeys don't repeat Root
-		p.generateSubKeyXML(subKey, sb, sddl, setPermissions, canForceDelete, depth+1, isFirstValue, preservedIDs)
-	}
-
-	sb.WriteString(fmt.Sprintf("%s</RegistryKey>\n", indent))
-}
-
-func (p *Processor) generateSubKeyXML(key *RegistryKey, sb *strings.Builder, sddl string, setPermissions bool, canForceDelete bool, depth int, isFirstValue *bool, preservedIDs map[string]int) {
-	indent := strings.Repeat("    ", depth)
-
-	if key.RemoveFlag {
-		// Removals are handled at component level
-		return
-	}
-
-	// Extract just the last part of the key path for nested keys
-	parts := strings.Split(key.Key, "\\")
-	keyName := parts[len(parts)-1]
-
-	// Only add ForceDeleteOnUninstall to empty keys (no values in this key or any subkeys)
-	deleteAttr := ""
-	if canForceDelete && !keyTreeHasValues(key) {
-		deleteAttr = " ForceDeleteOnUninstall='yes'"
-	}
-	sb.WriteString(fmt.Sprintf("%s<RegistryKey Key='%s' ForceCreateOnInstall='yes'%s>\n",
-		indent, escapeXML(keyName), deleteAttr))
-
-	// Add permissions if enabled (core WiX PermissionEx, not util:PermissionEx)
-	if setPermissions && sddl != "" {
-		sb.WriteString(fmt.Sprintf("%s    <PermissionEx Sddl='%s'/>\n", indent, escapeXML(sddl)))
-	}
-
-	// Generate values (skip removals, they're at component level)
-	for _, val := range key.Values {
-		if !val.RemoveFlag {
-			p.generateRegistryValueXML(val, key, sb, depth+1, isFirstValue, preservedIDs)
+		if !subKey.RemoveFlag {
+			element.Children = append(element.Children,
+				p.registryKeyElement(subKey, false, sddl, setPermissions, canForceDelete, isFirstValue, preservedIDs))
 		}
 	}
 
-	// Generate subkeys
-	for _, subKey := range key.SubKeys {
-		p.generateSubKeyXML(subKey, sb, sddl, setPermissions, canForceDelete, depth+1, isFirstValue, preservedIDs)
-	}
-
-	sb.WriteString(fmt.Sprintf("%s</RegistryKey>\n", indent))
+	return element
 }
 
-func (p *Processor) generateRegistryValueXML(val *RegistryValue, key *RegistryKey, sb *strings.Builder, depth int, isFirstValue *bool, preservedIDs map[string]int) {
-	indent := strings.Repeat("    ", depth)
-
-	if val.RemoveFlag {
-		// Removals are handled at component level
-		return
-	}
-
-	// Name attribute (empty for default value)
-	nameAttr := ""
-	if val.Name != "" {
-		nameAttr = fmt.Sprintf(" Name='%s'", escapeXML(val.Name))
-	}
+func (p *Processor) registryValueElement(val *RegistryValue, key *RegistryKey, isFirstValue *bool, preservedIDs map[string]int) *wxs.RegistryValue {
+	// Name attribute is empty for the default value
+	element := &wxs.RegistryValue{Name: val.Name, Type: val.Type}
 
 	// KeyPath goes on the first RegistryValue (WiX 6 requirement)
-	keyPathAttr := ""
 	if *isFirstValue {
-		keyPathAttr = " KeyPath='yes'"
+		element.KeyPath = "yes"
 		*isFirstValue = false
 	}
 
@@ -656,24 +602,19 @@ func (p *Processor) generateRegistryValueXML(val *RegistryValue, key *RegistryKe
 		if id, ok := preservedIDs[lookupKey]; ok {
 			// Emit reference to preservation property instead of literal value
 			// Type is always 'string' — WiX interprets the prefixed content from the property
-			sb.WriteString(fmt.Sprintf("%s<RegistryValue%s Value='[PS_RV_%05d]' Type='string'%s/>\n",
-				indent, nameAttr, id, keyPathAttr))
-			return
+			element.Value = wxs.String(fmt.Sprintf("[PS_RV_%05d]", id))
+			element.Type = "string"
+			return element
 		}
 	}
 
 	if val.Type == "multiString" {
 		// MultiString needs child elements
-		sb.WriteString(fmt.Sprintf("%s<RegistryValue%s Type='%s'%s>\n", indent, nameAttr, val.Type, keyPathAttr))
-		for _, s := range val.MultiValue {
-			sb.WriteString(fmt.Sprintf("%s    <MultiStringValue>%s</MultiStringValue>\n", indent, escapeXML(s)))
-		}
-		sb.WriteString(fmt.Sprintf("%s</RegistryValue>\n", indent))
+		element.MultiStrings = val.MultiValue
 	} else {
-		// Simple value
-		sb.WriteString(fmt.Sprintf("%s<RegistryValue%s Value='%s' Type='%s'%s/>\n",
-			indent, nameAttr, escapeXML(val.Value), val.Type, keyPathAttr))
+		element.Value = wxs.String(val.Value)
 	}
+	return element
 }
 
 // keyTreeHasValues returns true if the key or any of its subkeys contain non-removal values.
@@ -721,6 +662,83 @@ func (p *Processor) findFirstKeyPathInSubKeys(keys []*RegistryKey) (string, stri
 	return "", ""
 }
 
+// KeyPath returns the registry location used as the component's KeyPath,
+// formatted as "ROOT\Key\Name". This mirrors componentElement: the first
+// non-removal value in document order wins, and delete-only files fall back to
+// the synthetic _msis_keypath value.
+func (comp *Component) KeyPath() string {
+	for _, key := range comp.Keys {
+		if key.RemoveFlag {
+			continue
+		}
+		if path := firstValuePath(key); path != "" {
+			return path
+		}
+	}
+	for _, key := range comp.Keys {
+		if !key.RemoveFlag {
+			return key.Root + "\\" + key.Key + "\\_msis_keypath"
+		}
+	}
+	return ""
+}
+
+// ValueEntry is a flattened registry value written by a component.
+type ValueEntry struct {
+	Root  string
+	Key   string
+	Name  string // Empty for the default value
+	Type  string
+	Value string // MultiString values are joined with "\x00"
+}
+
+// AllValues returns every value the component writes, in generation order.
+// Removal entries are not included.
+func (comp *Component) AllValues() []ValueEntry {
+	var result []ValueEntry
+	var walk func(key *RegistryKey)
+	walk = func(key *RegistryKey) {
+		if key.RemoveFlag {
+			return
+		}
+		for _, val := range key.Values {
+			if val.RemoveFlag {
+				continue
+			}
+			value := val.Value
+			if val.Type == "multiString" {
+				value = strings.Join(val.MultiValue, "\x00")
+			}
+			result = append(result, ValueEntry{Root: key.Root, Key: key.Key, Name: val.Name, Type: val.Type, Value: value})
+		}
+		for _, subKey := range key.SubKeys {
+			walk(subKey)
+		}
+	}
+	for _, key := range comp.Keys {
+		walk(key)
+	}
+	return result
+}
+
+// firstValuePath returns the path of the first non-removal value in the key tree.
+func firstValuePath(key *RegistryKey) string {
+	for _, val := range key.Values {
+		if !val.RemoveFlag {
+			return key.Root + "\\" + key.Key + "\\" + val.Name
+		}
+	}
+	for _, subKey := range key.SubKeys {
+		if subKey.RemoveFlag {
+			continue
+		}
+		if path := firstValuePath(subKey); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
 // nextComponentIDStr generates a unique component ID.
 func (p *Processor) nextComponentIDStr() string {
 	id := fmt.Sprintf("REG_CID_%05d", p.componentCounter)
@@ -763,25 +781,3 @@ func generateGUID(path string) string {
 		hex.EncodeToString(hash[8:10]),
 		hex.EncodeToString(hash[10:16]))
 }
-
-// escapeXML escapes special characters for XML attributes.
-func escapeXML(s string) string {
-	var buf bytes.Buffer
-	for _, r := range s {
-		switch r {
-		case '&':
-			buf.WriteString("&amp;")
-		case '<':
-			buf.WriteString("&lt;")
-		case '>':
-			buf.WriteString("&gt;")
-		case '"':
-			buf.WriteString("&quot;")
-		case '\'':
-			buf.WriteString("&apos;")
-		default:
-			buf.WriteRune(r)
-		}
-	}
-	return buf.String()
-}
@@ -1,6 +1,7 @@
 package registry
 
 import (
+	"encoding/xml"
 	"os"
 	"path/filepath"
 	"strings"
@@ -288,23 +289,51 @@ func TestMapHiveToWixRoot(t *testing.T) {
 	}
 }
 
-func TestEscapeXML(t *testing.T) {
+func TestGenerateXMLEscaping(t *testing.T) {
+	content := `Windows Registry Editor Version 5.00
+
+[HKEY_LOCAL_MACHINE\SOFTWARE\Tom & Jerry's]
+"<name>"="say \"hi\" & bye"
+`
+	tmpDir := t.TempDir()
+	regFile := filepath.Join(tmpDir, "test.reg")
+	if err := os.WriteFile(regFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	proc := NewProcessor(tmpDir, "")
+	components, err := proc.Process(ir.Registry{File: "test.reg"})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	output := proc.GenerateXML(components, false)
+	var comp struct {
+		Key struct {
+			Key struct {
+				Key   string `xml:"Key,attr"`
+				Value struct {
+					Name  string `xml:"Name,attr"`
+					Value string `xml:"Value,attr"`
+				} `xml:"RegistryValue"`
+			} `xml:"RegistryKey"`
+		} `xml:"RegistryKey"`
+	}
+	if err := xml.Unmarshal([]byte(output), &comp); err != nil {
+		t.Fatalf("parsing generated XML: %v\n%s", err, output)
+	}
 	tests := []struct {
-		input    string
-		expected string
+		name string
+		got  string
+		want string
 	}{
-		{"simple", "simple"},
-		{"<tag>", "&lt;tag&gt;"},
-		{"a & b", "a &amp; b"},
-		{`"quoted"`, "&quot;quoted&quot;"},
-		{"it's", "it&apos;s"},
-		{`<a href="test">link</a>`, "&lt;a href=&quot;test&quot;&gt;link&lt;/a&gt;"},
+		{"key", comp.Key.Key.Key, "Tom & Jerry's"},
+		{"value name", comp.Key.Key.Value.Name, "<name>"},
+		{"value", comp.Key.Key.Value.Value, `say "hi" & bye`},
 	}
-
 	for _, tt := range tests {
-		result := escapeXML(tt.input)
-		if result != tt.expected {
-			t.Errorf("escapeXML(%q) = %q, want %q", tt.input, result, tt.expected)
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q in XML:\n%s", tt.name, tt.got, tt.want, output)
 		}
 	}
 }
@@ -868,3 +897,28 @@ func TestPreserveEmptyStringValue(t *testing.T) {
 		t.Errorf("Empty string should produce self-closing Property without Value attribute, got:\n%s", preserveXML)
 	}
 }
+
+func TestComponentKeyPath(t *testing.T) {
+	content := `Windows Registry Editor Version 5.00
+
+[-HKEY_LOCAL_MACHINE\SOFTWARE\Old]
+
+[HKEY_LOCAL_MACHINE\SOFTWARE\TestApp\Settings]
+"Level"=dword:00000001
+`
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.reg"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	proc := NewProcessor(tmpDir, "")
+	components, err := proc.Process(ir.Registry{File: "test.reg"})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	want := "HKLM\\SOFTWARE\\TestApp\\Settings\\Level"
+	if got := components[0].KeyPath(); got != want {
+		t.Errorf("KeyPath() = %q, want %q", got, want)
+	}
+}
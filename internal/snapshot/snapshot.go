@@ -0,0 +1,128 @@
+// Package snapshot renders a generated install model as normalized text for
+// golden-file tests. Generated IDs are replaced by names derived from what
+// they install, so adding one file does not renumber the whole snapshot.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/textdiff"
+)
+
+// Header is the first line of every snapshot file.
+const Header = "# msis snapshot v1"
+
+// generatedID matches IDs produced by generator and registry counters and hashes.
+var generatedID = regexp.MustCompile(`\b(?:DIR_ID\d+|FILE_ID\d+|CID_[0-9a-f]{16}(?:_\d+)?|FEATURE_\d+|SHORTCUT_ID\d+|ENV_ID\d+|SVC_ID\d+|REG_CID_\d+|RV_\d+|CUSTOMACTION_\d+)\b`)
+
+// Options controls what goes into a snapshot.
+type Options struct {
+	WXS   string            // Rendered WXS to include; empty to leave it out
+	Paths map[string]string // Machine-specific paths to replace, e.g. work dir -> "{workdir}"
+}
+
+// Render returns the snapshot text for a generated context.
+func Render(ctx *generator.Context, output *generator.GeneratedOutput, opts Options) string {
+	var sb strings.Builder
+	sb.WriteString(Header + "\n")
+
+	sb.WriteString("\n[variables]\n")
+	names := make([]string, 0, len(ctx.Variables))
+	for name := range ctx.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s=%s\n", name, ctx.Variables[name])
+	}
+
+	for _, section := range output.Sections() {
+		if strings.TrimSpace(section.XML) == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n[%s]\n", section.Name)
+		sb.WriteString(normalizeLines(section.XML))
+	}
+
+	if opts.WXS != "" {
+		sb.WriteString("\n[wxs]\n")
+		sb.WriteString(normalizeLines(opts.WXS))
+	}
+
+	return normalizeIDs(replacePaths(sb.String(), opts.Paths), ctx.StableNames())
+}
+
+// normalizeLines drops carriage returns, trailing blanks and blank lines at the
+// ends, and makes sure the text ends with a newline.
+func normalizeLines(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// replacePaths substitutes machine-specific paths, longest first so that a
+// template folder inside the work dir is replaced as a whole.
+func replacePaths(text string, paths map[string]string) string {
+	keys := make([]string, 0, len(paths))
+	for path := range paths {
+		if path != "" {
+			keys = append(keys, path)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, path := range keys {
+		text = strings.ReplaceAll(text, path, paths[path])
+	}
+	return text
+}
+
+// normalizeIDs replaces generated IDs by stable names. IDs without a stable
+// name are numbered in order of first appearance, e.g. {SHORTCUT_ID#1}.
+func normalizeIDs(text string, stable map[string]string) string {
+	seen := make(map[string]string)
+	counts := make(map[string]int)
+	return generatedID.ReplaceAllStringFunc(text, func(id string) string {
+		if name, ok := stable[id]; ok {
+			return "{" + name + "}"
+		}
+		if name, ok := seen[id]; ok {
+			return name
+		}
+		prefix := strings.TrimRight(id, "0123456789")
+		counts[prefix]++
+		name := fmt.Sprintf("{%s#%d}", strings.TrimSuffix(prefix, "_"), counts[prefix])
+		seen[id] = name
+		return name
+	})
+}
+
+// Check compares a rendered snapshot with the golden file and returns a
+// unified diff, or "" if they match. A missing golden file is reported as an
+// error wrapping os.ErrNotExist.
+func Check(filename, snapshot string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("snapshot %s does not exist: %w", filename, os.ErrNotExist)
+		}
+		return "", fmt.Errorf("reading snapshot: %w", err)
+	}
+	golden := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return textdiff.Unified(filename, "generated", golden, snapshot, 3), nil
+}
+
+// Write saves a snapshot as the new golden file.
+func Write(filename, snapshot string) error {
+	if err := os.WriteFile(filename, []byte(snapshot), 0644); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+func renderSnapshot(t *testing.T, dir string, files ...string) string {
+	t.Helper()
+	for _, name := range files {
+		path := filepath.Join(dir, "bin", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setup := &ir.Setup{
+		Features: []ir.Feature{{
+			Name:    "Main",
+			Enabled: true,
+			Items: []ir.Item{
+				ir.Files{Source: "bin", Target: "[INSTALLDIR]"},
+				ir.Shortcut{Name: "App", Target: "DESKTOP", File: "[INSTALLDIR]app.exe"},
+			},
+		}},
+	}
+	vars := variables.New()
+	vars["INSTALLDIR"] = "MyApp"
+	vars["PRODUCT_NAME"] = "MyApp"
+	vars["UPGRADE_CODE"] = "{11111111-2222-3333-4444-555555555555}"
+
+	ctx := generator.NewContext(setup, vars, dir)
+	output, err := ctx.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	return Render(ctx, output, Options{
+		WXS:   "<Wix>\r\n  <Include Source='" + dir + "/license.rtf'/>  \r\n</Wix>\r\n",
+		Paths: map[string]string{dir: "{workdir}"},
+	})
+}
+
+func TestRenderIsIDIndependent(t *testing.T) {
+	got := renderSnapshot(t, t.TempDir(), "app.exe")
+
+	// Generated IDs are replaced by stable names, the work directory by a
+	// placeholder, and line endings are normalized
+	want, err := os.ReadFile(filepath.Join("testdata", "app.snapshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Git may check the golden file out with CRLF line endings
+	want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	if got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderAddedFileIsLocalChange(t *testing.T) {
+	dir := t.TempDir()
+	before := renderSnapshot(t, dir, "app.exe", "zeta.dll")
+	after := renderSnapshot(t, dir, "beta.dll") // app.exe and zeta.dll still exist
+
+	// beta.dll sorts before zeta.dll and shifts all counter IDs; the snapshot
+	// must only grow by the new component, its file and its feature reference
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+	added := 0
+	seen := make(map[string]int)
+	for _, line := range beforeLines {
+		seen[line]++
+	}
+	for _, line := range afterLines {
+		if seen[line] > 0 {
+			seen[line]--
+			continue
+		}
+		added++
+		if !strings.Contains(line, "beta.dll") && !strings.Contains(line, "</Component>") {
+			t.Errorf("unexpected changed line %q", line)
+		}
+	}
+	if added == 0 {
+		t.Error("expected the new file in the snapshot")
+	}
+}
+
+func TestCheckAndWrite(t *testing.T) {
+	dir := t.TempDir()
+	snap := filepath.Join(dir, "setup.snap")
+
+	if _, err := Check(snap, "x\n"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected ErrNotExist for missing snapshot, got %v", err)
+	}
+
+	if err := Write(snap, "a\nb\nc\n"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	diff, err := Check(snap, "a\nb\nc\n")
+	if err != nil || diff != "" {
+		t.Errorf("expected match, got diff %q err %v", diff, err)
+	}
+
+	diff, err = Check(snap, "a\nB\nc\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "-b\n+B\n") {
+		t.Errorf("expected readable diff, got:\n%s", diff)
+	}
+}
+
+func TestNormalizeIDsFallbackNumbering(t *testing.T) {
+	got := normalizeIDs("RV_00007 SHORTCUT_ID0003 RV_00002 RV_00007", nil)
+	want := "{RV#1} {SHORTCUT_ID#1} {RV#2} {RV#1}"
+	if got != want {
+		t.Errorf("normalizeIDs = %q, want %q", got, want)
+	}
+}
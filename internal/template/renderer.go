@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/aymerick/raymond"
 	"github.com/gersonkurz/msis/internal/generator"
@@ -118,11 +120,29 @@ func (r *Renderer) RenderSilent() (string, error) {
 	return result, nil
 }
 
+// RenderSetup renders the template of a setup: the silent template for a
+// silent setup if there is one, the regular template otherwise.
+func (r *Renderer) RenderSetup(silent bool) (string, error) {
+	if silent {
+		result, err := r.RenderSilent()
+		if err != nil || result != "" {
+			return result, err
+		}
+		// No silent template available, fall back to regular
+	}
+	return r.Render()
+}
+
 func (r *Renderer) getTemplatePath(platform string, silent bool) string {
 	var templateName string
-	if silent {
+	switch {
+	case r.Variables.OutputType() == variables.OutputMSM:
+		templateName = "module.wxs"
+	case r.Variables.OutputType() == variables.OutputWixlib:
+		templateName = "fragment.wxs"
+	case silent:
 		templateName = "template-silent.wxs"
-	} else {
+	default:
 		templateName = "template.wxs"
 	}
 
@@ -150,6 +170,9 @@ func (r *Renderer) buildContext() map[string]interface{} {
 		ctx["CUSTOM_TEMPLATES"] = r.CustomTemplates
 	}
 
+	// Merge modules need an identifier; derive it from the product name
+	ctx["MODULE_ID"] = moduleID(r.Variables.ProductName())
+
 	// Add LCID (language code ID)
 	ctx["LCID"] = r.getLCID()
 	ctx["CODEPAGE"] = r.getCodepage()
@@ -197,6 +220,13 @@ func (r *Renderer) buildContext() map[string]interface{} {
 	ctx["REMOVE_ON_UNINSTALL"] = r.GeneratedData.RemoveOnUninstallXML
 	ctx["LAUNCH_CONDITION_SEARCHES"] = r.GeneratedData.LaunchConditionSearchXML
 	ctx["LAUNCH_CONDITIONS"] = r.GeneratedData.LaunchConditionsXML
+	ctx["PACKAGE_CONTENT"] = r.GeneratedData.PackageXML
+	ctx["UI_CONTENT"] = r.GeneratedData.UIXML
+	// The UI flow leads to this dialog for the feature selection
+	ctx["FEATURES_DIALOG"] = r.GeneratedData.FeaturesDialog
+	if ctx["FEATURES_DIALOG"] == "" {
+		ctx["FEATURES_DIALOG"] = "CustomizeDlg"
+	}
 
 	// Add boolean flags for conditional rendering
 	ctx["SETUP_ICON"] = r.Variables["SETUP_ICON"]
@@ -216,6 +246,19 @@ func (r *Renderer) buildContext() map[string]interface{} {
 	return ctx
 }
 
+// moduleID returns a WiX identifier for a product name, e.g. My_App for
+// "My App".
+func moduleID(name string) string {
+	id := invalidIDChars.ReplaceAllString(name, "_")
+	if id == "" || !unicode.IsLetter(rune(id[0])) && id[0] != '_' {
+		id = "_" + id
+	}
+	return id
+}
+
+// invalidIDChars matches characters not allowed in WiX identifiers.
+var invalidIDChars = regexp.MustCompile(`[^A-Za-z0-9_.]`)
+
 // languageInfo holds LCID and codepage for a language.
 type languageInfo struct {
 	LCID     string
@@ -273,13 +316,18 @@ var languageMap = map[string]languageInfo{
 }
 
 func (r *Renderer) getLCID() string {
-	lang := strings.ToLower(r.Variables["LANGUAGE"])
-	if info, ok := languageMap[lang]; ok {
-		return info.LCID
+	if lcid, ok := LCID(r.Variables["LANGUAGE"]); ok {
+		return lcid
 	}
 	return "1033" // Default to English (US)
 }
 
+// LCID returns the Windows language ID of a language tag such as de-de.
+func LCID(language string) (string, bool) {
+	info, ok := languageMap[strings.ToLower(language)]
+	return info.LCID, ok
+}
+
 func (r *Renderer) getCodepage() string {
 	lang := strings.ToLower(r.Variables["LANGUAGE"])
 	if info, ok := languageMap[lang]; ok {
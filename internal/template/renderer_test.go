@@ -105,6 +105,43 @@ func TestGetTemplatePath(t *testing.T) {
 	}
 }
 
+func TestGetTemplatePathOutputType(t *testing.T) {
+	vars := variables.New()
+	r := NewRenderer(vars, t.TempDir(), "", nil)
+
+	tests := []struct {
+		outputType string
+		platform   string
+		wantSuffix string
+	}{
+		{"msm", "x64", "x64/module.wxs"},
+		{"msm", "x86", "x86/module.wxs"},
+		{"wixlib", "x64", "x64/fragment.wxs"},
+	}
+	for _, tt := range tests {
+		vars["OUTPUT_TYPE"] = tt.outputType
+		// Merge modules and libraries have no silent variant
+		got := filepath.ToSlash(r.getTemplatePath(tt.platform, true))
+		if !strings.HasSuffix(got, tt.wantSuffix) {
+			t.Errorf("%s on %s: getTemplatePath = %q, want suffix %q", tt.outputType, tt.platform, got, tt.wantSuffix)
+		}
+	}
+}
+
+func TestModuleID(t *testing.T) {
+	tests := map[string]string{
+		"App":        "App",
+		"My App 2.0": "My_App_2.0",
+		"7-Zip":      "_7_Zip",
+		"":           "_",
+	}
+	for name, want := range tests {
+		if got := moduleID(name); got != want {
+			t.Errorf("moduleID(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
 func TestBuildContext(t *testing.T) {
 	vars := variables.New()
 	vars["PRODUCT_NAME"] = "Test Product"
@@ -137,6 +174,11 @@ func TestBuildContext(t *testing.T) {
 	if ctx["INSTALLDIR_FILES"] != "<Directory Id='TEST'/>" {
 		t.Errorf("INSTALLDIR_FILES = %v, want directory XML", ctx["INSTALLDIR_FILES"])
 	}
+
+	// Without setup types, the feature tree follows the welcome dialogs
+	if ctx["FEATURES_DIALOG"] != "CustomizeDlg" {
+		t.Errorf("FEATURES_DIALOG = %v, want CustomizeDlg", ctx["FEATURES_DIALOG"])
+	}
 }
 
 func TestLogoDefaultsNoPrefix(t *testing.T) {
@@ -0,0 +1,164 @@
+// Package textdiff produces line-based unified diffs for human review.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of a diff line.
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is one line of an edit script.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines computes the shortest edit script turning a into b (Myers' algorithm).
+func Lines(a, b []string) []Line {
+	n, m := len(a), len(b)
+	limit := n + m
+	if limit == 0 {
+		return nil
+	}
+	offset := limit
+	v := make([]int, 2*limit+2)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // down: insertion
+			} else {
+				x = v[offset+k-1] + 1 // right: deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset, d)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the saved V arrays from the end to recover the edit script.
+func backtrack(trace [][]int, a, b []string, offset, d int) []Line {
+	var script []Line
+	x, y := len(a), len(b)
+	for ; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			script = append(script, Line{Equal, a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				script = append(script, Line{Insert, b[y]})
+			} else {
+				x--
+				script = append(script, Line{Delete, a[x]})
+			}
+		}
+	}
+	for i, j := 0, len(script)-1; i < j; i, j = i+1, j-1 {
+		script[i], script[j] = script[j], script[i]
+	}
+	return script
+}
+
+// Unified returns a unified diff of two texts with the given number of
+// context lines, or "" if they are equal.
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	if oldText == newText {
+		return ""
+	}
+	script := Lines(splitLines(oldText), splitLines(newText))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Line numbers before each script entry
+	oldLine, newLine := make([]int, len(script)+1), make([]int, len(script)+1)
+	for i, l := range script {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if l.Op != Insert {
+			oldLine[i+1]++
+		}
+		if l.Op != Delete {
+			newLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(script); {
+		if script[i].Op == Equal {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are closer than 2*context lines apart
+		start := max(0, i-context)
+		end := i
+		for end < len(script) {
+			if script[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(script) && script[run].Op == Equal {
+				run++
+			}
+			if run == len(script) || run-end > 2*context {
+				end = min(len(script), end+context)
+				break
+			}
+			end = run
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n",
+			oldLine[start]+1, oldLine[end]-oldLine[start], newLine[start]+1, newLine[end]-newLine[start])
+		for _, l := range script[start:end] {
+			switch l.Op {
+			case Insert:
+				sb.WriteString("+" + l.Text + "\n")
+			case Delete:
+				sb.WriteString("-" + l.Text + "\n")
+			default:
+				sb.WriteString(" " + l.Text + "\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,77 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinesReproducesBothSides(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"empty", "", ""},
+		{"insert only", "", "a b c"},
+		{"delete only", "a b c", ""},
+		{"middle change", "a b c d e", "a b x d e"},
+		{"reorder", "a b c d", "d c b a"},
+		{"mixed", "a b c a b b a", "c b a b a c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			var gotA, gotB []string
+			for _, l := range Lines(a, b) {
+				if l.Op != Insert {
+					gotA = append(gotA, l.Text)
+				}
+				if l.Op != Delete {
+					gotB = append(gotB, l.Text)
+				}
+			}
+			if strings.Join(gotA, " ") != tt.a || strings.Join(gotB, " ") != tt.b {
+				t.Errorf("script does not reproduce inputs: %v / %v", gotA, gotB)
+			}
+		})
+	}
+}
+
+func TestLinesIsMinimal(t *testing.T) {
+	script := Lines(strings.Fields("a b c a b b a"), strings.Fields("c b a b a c"))
+	edits := 0
+	for _, l := range script {
+		if l.Op != Equal {
+			edits++
+		}
+	}
+	if edits != 5 {
+		t.Errorf("expected 5 edits, got %d", edits)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	cur := "1\n2\n3\nfour\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	got := Unified("old.snap", "new", old, cur, 2)
+	want := `--- old.snap
++++ new
+@@ -2,5 +2,5 @@
+ 2
+ 3
+-4
++four
+ 5
+ 6
+@@ -11,2 +11,3 @@
+ 11
+ 12
++13
+`
+	if got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+
+	if Unified("a", "b", old, old, 3) != "" {
+		t.Error("expected empty diff for equal texts")
+	}
+}
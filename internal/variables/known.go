@@ -0,0 +1,53 @@
+package variables
+
+// KnownVariable documents a variable that msis or the standard templates
+// give a meaning to.
+type KnownVariable struct {
+	Name string
+	Doc  string
+}
+
+// KnownVariables lists the documented variables in alphabetical order.
+var KnownVariables = []KnownVariable{
+	{"ADD_TO_PATH", "If true, INSTALLDIR is appended to the system PATH. Default: False."},
+	{"APPDATADIR", "Folder name below CommonAppDataFolder (C:\\ProgramData) for [APPDATADIR] targets. Defaults to INSTALLDIR."},
+	{"APPDATADIR_PREFIX", "Prefix for the APPDATADIR folder name. Default: empty."},
+	{"BUILD_TARGET", "File name of the generated MSI. Default: PRODUCT_NAME-PRODUCT_VERSION-PLATFORM.msi."},
+	{"CODEPAGE", "Codepage of the package strings. Default: 1252 (Western)."},
+	{"COMMONFILESDIR", "Folder name below CommonFilesFolder for [COMMONFILESDIR] targets."},
+	{"DO_NOT_UPGRADE_MESSAGE", "Message shown when a newer version is already installed."},
+	{"INSTALLDIR", "Folder name below ProgramFilesFolder, e.g. \"Company\\Product\". Defaults to PRODUCT_NAME."},
+	{"INSTALL_DIR_DIALOG", "If true, the UI lets the user choose the install folder."},
+	{"INSTALL_FOLDER", "Alias for INSTALLDIR."},
+	{"LANGUAGE", "Culture of the package, e.g. de-de, localized by its .wxl in the wixlib template folder. Default: English (1033)."},
+	{"LANGUAGES", "Cultures of a multi-language MSI, e.g. en-us,de-de,fr-fr. The first is the package language; transforms to the others are embedded, and Windows Installer picks the user's UI language. Sets LANGUAGE to the first culture."},
+	{"LCID", "Language of the package. Default: 1033 (English)."},
+	{"LICENSE_FILE", "RTF license shown in the license dialog."},
+	{"LICENSE_URL", "License URL shown by the bundle UI."},
+	{"LOCALAPPDATADIR", "Folder name below LocalAppDataFolder for [LOCALAPPDATADIR] targets. Defaults to INSTALLDIR."},
+	{"LOGO_BANNER", "Banner bitmap for the installer UI."},
+	{"LOGO_DIALOG", "Dialog background bitmap for the installer UI."},
+	{"LOGO_PREFIX", "Prefix for UI bitmaps, e.g. \"MyCompany\" uses MyCompany_WixUiBanner.bmp. Default: WiX bitmaps."},
+	{"MANUFACTURER", "Manufacturer shown in Programs and Features."},
+	{"PLATFORM", "Target platform: x64, x86 or arm64. Default: x64."},
+	{"PREREQUISITES_FOLDER", "Folder with offline copies of bundle prerequisites."},
+	{"PRODUCT_CODE", "Product code GUID. Default: a new one for every build, or with <transform> or LANGUAGES one derived from UPGRADE_CODE, PRODUCT_VERSION and PLATFORM."},
+	{"PRODUCT_NAME", "Product name shown in Programs and Features. Required."},
+	{"PRODUCT_VERSION", "Product version (major.minor.build). Required."},
+	{"REMOVE_REGISTRY_TREE", "If true, the registry keys written by <registry> items are removed recursively on uninstall. Default: False."},
+	{"ROAMINGAPPDATADIR", "Folder name below AppDataFolder (%APPDATA%) for [ROAMINGAPPDATADIR] targets. Defaults to INSTALLDIR."},
+	{"SETUP_ICON", "Icon shown in Programs and Features."},
+	{"SYSTEMDIR", "Folder name below System64Folder for [SYSTEMDIR] targets."},
+	{"UPGRADE_CODE", "Upgrade code GUID; must stay the same across versions of a product. Required."},
+	{"WINDOWSDIR", "Folder name below WindowsFolder for [WINDOWSDIR] targets."},
+}
+
+// LookupKnown returns the documentation of a known variable.
+func LookupKnown(name string) (KnownVariable, bool) {
+	for _, v := range KnownVariables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return KnownVariable{}, false
+}
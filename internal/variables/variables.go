@@ -153,6 +153,34 @@ func (d Dictionary) BuildTarget() string {
 	return d.Get("BUILD_TARGET")
 }
 
+// Output types of OUTPUT_TYPE.
+const (
+	OutputMSI    = "msi"    // Installer package (default)
+	OutputMSM    = "msm"    // Merge module
+	OutputWixlib = "wixlib" // WiX library
+)
+
+// OutputType returns the kind of package to build: msi, msm or wixlib.
+func (d Dictionary) OutputType() string {
+	if t := strings.ToLower(d.Get("OUTPUT_TYPE")); t != "" {
+		return t
+	}
+	return OutputMSI
+}
+
+// Languages returns the cultures of LANGUAGES, e.g. en-us,de-de,fr-fr. The
+// first is the language of the package; the MSI embeds transforms to the
+// others.
+func (d Dictionary) Languages() []string {
+	var languages []string
+	for culture := range strings.SplitSeq(d.Get("LANGUAGES"), ",") {
+		if culture = strings.TrimSpace(culture); culture != "" {
+			languages = append(languages, culture)
+		}
+	}
+	return languages
+}
+
 // DeprecatedVariable describes a deprecated variable with migration guidance.
 type DeprecatedVariable struct {
 	Name    string
@@ -175,7 +203,7 @@ var DeprecatedVariables = []DeprecatedVariable{
 	},
 	{
 		Name:    "INCLUDE_MFC",
-		Message: "INCLUDE_MFC is deprecated. Merge modules are no longer supported in msis 3.x.",
+		Message: "INCLUDE_MFC is deprecated. Use <requires type=\"vcredist\" version=\"2022\"/> instead, which contains MFC 14; older MFC versions need their merge module in a feature with <merge-module source=\"...\"/>.",
 	},
 }
 
@@ -1,6 +1,7 @@
 package variables
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/gersonkurz/msis/internal/ir"
@@ -153,6 +154,28 @@ func TestConvenienceMethods(t *testing.T) {
 	}
 }
 
+func TestOutputType(t *testing.T) {
+	d := New()
+	if d.OutputType() != OutputMSI {
+		t.Errorf("default OutputType = %s", d.OutputType())
+	}
+	d["OUTPUT_TYPE"] = "MSM"
+	if d.OutputType() != OutputMSM {
+		t.Errorf("OutputType = %s", d.OutputType())
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	d := New()
+	if d.Languages() != nil {
+		t.Errorf("default Languages = %v", d.Languages())
+	}
+	d["LANGUAGES"] = " en-us, de-de,,fr-fr "
+	if got := strings.Join(d.Languages(), "|"); got != "en-us|de-de|fr-fr" {
+		t.Errorf("Languages = %s", got)
+	}
+}
+
 func TestContainsTemplate(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -236,3 +259,16 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestKnownVariablesSorted(t *testing.T) {
+	for i := 1; i < len(KnownVariables); i++ {
+		if KnownVariables[i-1].Name >= KnownVariables[i].Name {
+			t.Errorf("KnownVariables not sorted: %s before %s", KnownVariables[i-1].Name, KnownVariables[i].Name)
+		}
+	}
+	for name := range New() {
+		if _, ok := LookupKnown(name); !ok {
+			t.Errorf("default variable %s is not documented", name)
+		}
+	}
+}
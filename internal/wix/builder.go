@@ -3,13 +3,14 @@ package wix
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"github.com/gersonkurz/msis/internal/cli"
 	"github.com/gersonkurz/msis/internal/variables"
 )
 
@@ -19,11 +20,15 @@ type Builder struct {
 	OutputFile      string
 	Platform        string
 	Language        string
+	OutputType      string // msi, msm or wixlib; empty for msi
 	TemplateFolder  string
 	CustomTemplates string
-	SourceDir       string // Directory of the original .msis file (for resolving source paths)
+	SourceDir       string   // Directory of the original .msis file (for resolving source paths)
+	Sources         []string // Further .wxs and .wixlib files to build with the WXS, relative to SourceDir
 	Variables       variables.Dictionary
 	RetainWxs       bool
+	Stdout          io.Writer        // Receives the output of the WiX CLI; nil discards it
+	Log             func(msg string) // Receives the WiX command lines; may be nil
 }
 
 // NewBuilder creates a WiX builder from variables and paths.
@@ -32,8 +37,8 @@ func NewBuilder(vars variables.Dictionary, wxsFile, templateFolder, customTempla
 	// Determine output file
 	outputFile := vars.BuildTarget()
 	if outputFile == "" {
-		// Default to input filename with .msi extension
-		outputFile = strings.TrimSuffix(wxsFile, filepath.Ext(wxsFile)) + ".msi"
+		// Default to input filename with the extension of the output type
+		outputFile = strings.TrimSuffix(wxsFile, filepath.Ext(wxsFile)) + "." + vars.OutputType()
 	}
 
 	return &Builder{
@@ -41,6 +46,7 @@ func NewBuilder(vars variables.Dictionary, wxsFile, templateFolder, customTempla
 		OutputFile:      outputFile,
 		Platform:        vars.Platform(),
 		Language:        vars["LANGUAGE"],
+		OutputType:      vars.OutputType(),
 		TemplateFolder:  templateFolder,
 		CustomTemplates: customTemplates,
 		SourceDir:       sourceDir,
@@ -49,20 +55,21 @@ func NewBuilder(vars variables.Dictionary, wxsFile, templateFolder, customTempla
 	}
 }
 
-// Build invokes WiX CLI to compile the WXS into an MSI.
-func (b *Builder) Build() error {
+// Build invokes WiX CLI to compile the WXS into an MSI. Cancelling ctx
+// kills the WiX process.
+func (b *Builder) Build(ctx context.Context) error {
 	// Check if output file exists and can be overwritten
 	if err := b.checkOutputWritable(); err != nil {
 		return err
 	}
 
 	// Ensure EULA is accepted
-	if err := b.ensureEulaAccepted(); err != nil {
+	if err := b.ensureEulaAccepted(ctx); err != nil {
 		return fmt.Errorf("EULA check: %w", err)
 	}
 
 	// Build MSI
-	if err := b.runWixBuild(); err != nil {
+	if err := b.runWixBuild(ctx); err != nil {
 		return fmt.Errorf("wix build: %w", err)
 	}
 
@@ -94,11 +101,11 @@ func (b *Builder) checkOutputWritable() error {
 }
 
 // ensureEulaAccepted checks if WiX EULA has been accepted and accepts it if needed.
-func (b *Builder) ensureEulaAccepted() error {
+func (b *Builder) ensureEulaAccepted(ctx context.Context) error {
 	wixPath := GetWixPath()
 
 	// Try running a simple wix command to see if EULA is already accepted
-	cmd := exec.Command(wixPath, "--version")
+	cmd := exec.CommandContext(ctx, wixPath, "--version")
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
@@ -111,10 +118,10 @@ func (b *Builder) ensureEulaAccepted() error {
 	errOutput := stderr.String()
 	if strings.Contains(errOutput, "EULA") || strings.Contains(errOutput, "eula") {
 		// Accept EULA for WiX 6
-		fmt.Println("  Accepting WiX 6 EULA...")
-		acceptCmd := exec.Command(wixPath, "eula", "accept", "wix6")
-		acceptCmd.Stdout = os.Stdout
-		acceptCmd.Stderr = os.Stderr
+		b.log("Accepting WiX 6 EULA...")
+		acceptCmd := exec.CommandContext(ctx, wixPath, "eula", "accept", "wix6")
+		acceptCmd.Stdout = b.Stdout
+		acceptCmd.Stderr = b.Stdout
 		if err := acceptCmd.Run(); err != nil {
 			return fmt.Errorf("accepting EULA: %w", err)
 		}
@@ -129,21 +136,52 @@ func (b *Builder) ensureEulaAccepted() error {
 }
 
 // runWixBuild executes wix build command.
-func (b *Builder) runWixBuild() error {
+func (b *Builder) runWixBuild(ctx context.Context) error {
+	args, workDir := b.buildArgs()
+	wixPath := GetWixPath()
+	b.log(wixPath + " " + strings.Join(args, " "))
+
+	cmd := exec.CommandContext(ctx, wixPath, args...)
+	cmd.Dir = workDir
+	cmd.Stdout = b.Stdout
+	cmd.Stderr = b.Stdout
+
+	return cmd.Run()
+}
+
+// buildArgs returns the arguments of wix build and the directory to run it in.
+func (b *Builder) buildArgs() (args []string, workDir string) {
 	// Convert paths to absolute for consistent resolution
 	absWxsFile, _ := filepath.Abs(b.WxsFile)
 	absOutputFile, _ := filepath.Abs(b.OutputFile)
-	workDir := filepath.Dir(absWxsFile)
+	workDir = filepath.Dir(absWxsFile)
 
 	// Build args - use just filename since we run from its directory
 	wxsFilename := filepath.Base(absWxsFile)
-	args := []string{"build", wxsFilename}
+	args = []string{"build", wxsFilename}
+
+	// Referenced fragments and libraries
+	for _, source := range b.Sources {
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(b.SourceDir, source)
+		}
+		absSource, _ := filepath.Abs(source)
+		args = append(args, absSource)
+	}
 
 	// Architecture
 	if b.Platform != "" {
 		args = append(args, "-arch", strings.ToLower(b.Platform))
 	}
 
+	// Output type; libraries carry their files so consumers need no bind paths
+	switch b.OutputType {
+	case variables.OutputMSM:
+		args = append(args, "-outputtype", "module")
+	case variables.OutputWixlib:
+		args = append(args, "-outputtype", "library", "-bindfiles")
+	}
+
 	// Extensions
 	args = append(args,
 		"-ext", "WixToolset.UI.wixext",
@@ -186,34 +224,73 @@ func (b *Builder) runWixBuild() error {
 	// Output file - use absolute path
 	args = append(args, "-o", absOutputFile)
 
+	return args, workDir
+}
+
+func (b *Builder) log(msg string) {
+	if b.Log != nil {
+		b.Log(msg)
+	}
+}
+
+// Transform types of BuildTransform, which select the checks Windows
+// Installer makes before it applies the transform.
+const (
+	TransformDefault  = ""
+	TransformLanguage = "language" // Skips the language check
+)
+
+// BuildTransform runs wix msi transform to create the .mst that turns the
+// target MSI into the updated one. Cancelling ctx kills the WiX process.
+func (b *Builder) BuildTransform(ctx context.Context, target, updated, output, transformType string) error {
+	args := transformArgs(target, updated, output, transformType)
 	wixPath := GetWixPath()
-	fmt.Printf("  Running: %s %s\n", cli.Filename(wixPath), strings.Join(args, " "))
+	b.log(wixPath + " " + strings.Join(args, " "))
 
-	cmd := exec.Command(wixPath, args...)
-	cmd.Dir = workDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd := exec.CommandContext(ctx, wixPath, args...)
+	cmd.Stdout = b.Stdout
+	cmd.Stderr = b.Stdout
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wix msi transform: %w", err)
+	}
+	return nil
+}
 
-	return cmd.Run()
+// transformArgs returns the arguments of wix msi transform.
+func transformArgs(target, updated, output, transformType string) []string {
+	absTarget, _ := filepath.Abs(target)
+	absUpdated, _ := filepath.Abs(updated)
+	absOutput, _ := filepath.Abs(output)
+	args := []string{"msi", "transform", absTarget, absUpdated}
+	if transformType != TransformDefault {
+		args = append(args, "-t", transformType)
+	}
+	return append(args, "-o", absOutput)
 }
 
 // getLocalizationFile returns the absolute path to the WiX localization file.
 func (b *Builder) getLocalizationFile() string {
-	if b.Language == "" {
+	return LocalizationFile(b.TemplateFolder, b.Language)
+}
+
+// LocalizationFile returns the absolute path to the WiX localization file of
+// a culture in the template folder, or "" if there is none.
+func LocalizationFile(templateFolder, culture string) string {
+	if culture == "" {
 		return ""
 	}
 
 	// Template folder should already be absolute, but ensure it
-	absTemplateFolder, _ := filepath.Abs(b.TemplateFolder)
+	absTemplateFolder, _ := filepath.Abs(templateFolder)
 
 	// Look in template folder's wixlib directory
-	locFile := filepath.Join(absTemplateFolder, "wixlib", b.Language+".wxl")
+	locFile := filepath.Join(absTemplateFolder, "wixlib", culture+".wxl")
 	if _, err := os.Stat(locFile); err == nil {
 		return locFile
 	}
 
 	// Try lowercase
-	locFile = filepath.Join(absTemplateFolder, "wixlib", strings.ToLower(b.Language)+".wxl")
+	locFile = filepath.Join(absTemplateFolder, "wixlib", strings.ToLower(culture)+".wxl")
 	if _, err := os.Stat(locFile); err == nil {
 		return locFile
 	}
@@ -306,6 +383,8 @@ type BundleBuilder struct {
 	CustomTemplates string
 	Variables       variables.Dictionary
 	RetainWxs       bool
+	Stdout          io.Writer        // Receives the output of the WiX CLI; nil discards it
+	Log             func(msg string) // Receives the WiX command lines; may be nil
 }
 
 // NewBundleBuilder creates a WiX bundle builder from variables and paths.
@@ -327,21 +406,22 @@ func NewBundleBuilder(vars variables.Dictionary, wxsFile, templateFolder, custom
 	}
 }
 
-// Build invokes WiX CLI to compile the bundle WXS into an EXE.
-func (b *BundleBuilder) Build() error {
+// Build invokes WiX CLI to compile the bundle WXS into an EXE. Cancelling
+// ctx kills the WiX process.
+func (b *BundleBuilder) Build(ctx context.Context) error {
 	// Check if output file exists and can be overwritten
 	if err := b.checkOutputWritable(); err != nil {
 		return err
 	}
 
 	// Ensure EULA is accepted (reuse MSI builder logic)
-	msiBuilder := &Builder{} // Create temporary for EULA check
-	if err := msiBuilder.ensureEulaAccepted(); err != nil {
+	msiBuilder := &Builder{Stdout: b.Stdout, Log: b.Log} // Create temporary for EULA check
+	if err := msiBuilder.ensureEulaAccepted(ctx); err != nil {
 		return fmt.Errorf("EULA check: %w", err)
 	}
 
 	// Build bundle
-	if err := b.runWixBuild(); err != nil {
+	if err := b.runWixBuild(ctx); err != nil {
 		return fmt.Errorf("wix build: %w", err)
 	}
 
@@ -372,7 +452,7 @@ func (b *BundleBuilder) checkOutputWritable() error {
 }
 
 // runWixBuild executes wix build command for bundle.
-func (b *BundleBuilder) runWixBuild() error {
+func (b *BundleBuilder) runWixBuild(ctx context.Context) error {
 	absWxsFile, _ := filepath.Abs(b.WxsFile)
 	absOutputFile, _ := filepath.Abs(b.OutputFile)
 	workDir := filepath.Dir(absWxsFile)
@@ -405,16 +485,22 @@ func (b *BundleBuilder) runWixBuild() error {
 	args = append(args, "-o", absOutputFile)
 
 	wixPath := GetWixPath()
-	fmt.Printf("  Running: %s %s\n", cli.Filename(wixPath), strings.Join(args, " "))
+	b.log(wixPath + " " + strings.Join(args, " "))
 
-	cmd := exec.Command(wixPath, args...)
+	cmd := exec.CommandContext(ctx, wixPath, args...)
 	cmd.Dir = workDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = b.Stdout
+	cmd.Stderr = b.Stdout
 
 	return cmd.Run()
 }
 
+func (b *BundleBuilder) log(msg string) {
+	if b.Log != nil {
+		b.Log(msg)
+	}
+}
+
 // cleanup removes temporary files unless retention is requested.
 func (b *BundleBuilder) cleanup() {
 	// Remove .wixpdb if it exists
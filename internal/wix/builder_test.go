@@ -195,3 +195,67 @@ func TestPlatformLowercase(t *testing.T) {
 		t.Errorf("Platform should be case-insensitively equal to x64")
 	}
 }
+
+func TestBuildArgsSources(t *testing.T) {
+	dir := t.TempDir()
+	vars := variables.New()
+	b := NewBuilder(vars, filepath.Join(dir, "setup.wxs"), "", "", dir, false)
+	b.Sources = []string{"lib/vendor.wixlib", filepath.Join(dir, "extra.wxs")}
+
+	args, workDir := b.buildArgs()
+	if workDir != dir {
+		t.Errorf("workDir = %s, want %s", workDir, dir)
+	}
+	want := []string{"build", "setup.wxs", filepath.Join(dir, "lib", "vendor.wixlib"), filepath.Join(dir, "extra.wxs")}
+	if len(args) < len(want) || strings.Join(args[:len(want)], " ") != strings.Join(want, " ") {
+		t.Errorf("args start with %q, want %q", args, want)
+	}
+}
+
+func TestBuildArgsOutputType(t *testing.T) {
+	tests := []struct {
+		outputType string
+		wantFile   string
+		wantArgs   string
+	}{
+		{"", "setup.msi", ""},
+		{"msm", "setup.msm", "-outputtype module"},
+		{"wixlib", "setup.wixlib", "-outputtype library -bindfiles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.outputType, func(t *testing.T) {
+			vars := variables.New()
+			vars["OUTPUT_TYPE"] = tt.outputType
+			b := NewBuilder(vars, "setup.wxs", "", "", "", false)
+			if b.OutputFile != tt.wantFile {
+				t.Errorf("OutputFile = %s, want %s", b.OutputFile, tt.wantFile)
+			}
+			args, _ := b.buildArgs()
+			joined := strings.Join(args, " ")
+			if tt.wantArgs != "" && !strings.Contains(joined, tt.wantArgs) {
+				t.Errorf("args %q lack %q", joined, tt.wantArgs)
+			}
+			if tt.wantArgs == "" && strings.Contains(joined, "-outputtype") {
+				t.Errorf("args %q of an MSI have an output type", joined)
+			}
+		})
+	}
+}
+
+func TestTransformArgs(t *testing.T) {
+	dir := t.TempDir()
+	target, updated := filepath.Join(dir, "app.msi"), filepath.Join(dir, "app-site.msi")
+	tests := []struct {
+		transformType string
+		want          []string
+	}{
+		{TransformDefault, []string{"msi", "transform", target, updated, "-o", filepath.Join(dir, "app.mst")}},
+		{TransformLanguage, []string{"msi", "transform", target, updated, "-t", "language", "-o", filepath.Join(dir, "app.mst")}},
+	}
+	for _, tt := range tests {
+		args := transformArgs(target, updated, filepath.Join(dir, "app.mst"), tt.transformType)
+		if strings.Join(args, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("args = %q, want %q", args, tt.want)
+		}
+	}
+}
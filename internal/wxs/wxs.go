@@ -0,0 +1,460 @@
+// Package wxs is a typed model of the WiX source elements msis generates.
+// Elements are serialized with encoding/xml, so every attribute value and
+// text node is escaped, and rendered in the single-quoted, four-space
+// indented style of the msis templates.
+package wxs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Indent is the indentation unit of generated WiX source.
+const Indent = "    "
+
+// Directory is a <Directory> element. Children holds nested directories
+// and components.
+type Directory struct {
+	XMLName  xml.Name `xml:"Directory"`
+	ID       string   `xml:"Id,attr"`
+	Name     string   `xml:"Name,attr,omitempty"`
+	Children []any
+}
+
+// StandardDirectory is a <StandardDirectory> element, a predefined Windows
+// Installer folder like FontsFolder. Children holds directories and
+// components.
+type StandardDirectory struct {
+	XMLName  xml.Name `xml:"StandardDirectory"`
+	ID       string   `xml:"Id,attr"`
+	Children []any
+}
+
+// Component is a <Component> element. Content holds the resources the
+// component installs, in output order.
+type Component struct {
+	XMLName        xml.Name `xml:"Component"`
+	ID             string   `xml:"Id,attr"`
+	GUID           string   `xml:"Guid,attr"`
+	Directory      string   `xml:"Directory,attr,omitempty"`
+	Permanent      string   `xml:"Permanent,attr,omitempty"`
+	NeverOverwrite string   `xml:"NeverOverwrite,attr,omitempty"`
+	Condition      string   `xml:"Condition,attr,omitempty"`
+	MultiInstance  string   `xml:"MultiInstance,attr,omitempty"`
+	Content        []any
+}
+
+// File is a <File> element.
+type File struct {
+	XMLName   xml.Name `xml:"File"`
+	ID        string   `xml:"Id,attr"`
+	Name      string   `xml:"Name,attr"`
+	ShortName string   `xml:"ShortName,attr,omitempty"`
+	Source    string   `xml:"Source,attr"`
+	KeyPath   string   `xml:"KeyPath,attr,omitempty"`
+}
+
+// Environment is an <Environment> element.
+type Environment struct {
+	XMLName   xml.Name `xml:"Environment"`
+	ID        string   `xml:"Id,attr"`
+	Name      string   `xml:"Name,attr"`
+	Value     string   `xml:"Value,attr"`
+	Permanent string   `xml:"Permanent,attr"`
+	Part      string   `xml:"Part,attr"`
+	Action    string   `xml:"Action,attr"`
+	System    string   `xml:"System,attr"`
+}
+
+// ServiceInstall is a <ServiceInstall> element.
+type ServiceInstall struct {
+	XMLName      xml.Name `xml:"ServiceInstall"`
+	ID           string   `xml:"Id,attr"`
+	Name         string   `xml:"Name,attr"`
+	DisplayName  string   `xml:"DisplayName,attr"`
+	Start        string   `xml:"Start,attr"`
+	Type         string   `xml:"Type,attr"`
+	ErrorControl string   `xml:"ErrorControl,attr"`
+	Description  string   `xml:"Description,omitempty"`
+}
+
+// ServiceControl is a <ServiceControl> element.
+type ServiceControl struct {
+	XMLName xml.Name `xml:"ServiceControl"`
+	ID      string   `xml:"Id,attr"`
+	Name    string   `xml:"Name,attr"`
+	Start   string   `xml:"Start,attr,omitempty"`
+	Stop    string   `xml:"Stop,attr"`
+	Remove  string   `xml:"Remove,attr"`
+	Wait    string   `xml:"Wait,attr"`
+}
+
+// CreateFolder is a <CreateFolder> element.
+type CreateFolder struct {
+	XMLName     xml.Name `xml:"CreateFolder"`
+	Permissions []UtilPermissionEx
+}
+
+// UtilPermissionEx is a <util:PermissionEx> element (WiX util extension).
+type UtilPermissionEx struct {
+	XMLName        xml.Name `xml:"util:PermissionEx"`
+	User           string   `xml:"User,attr"`
+	Domain         string   `xml:"Domain,attr,omitempty"`
+	GenericAll     string   `xml:"GenericAll,attr,omitempty"`
+	GenericRead    string   `xml:"GenericRead,attr,omitempty"`
+	Read           string   `xml:"Read,attr,omitempty"`
+	GenericExecute string   `xml:"GenericExecute,attr,omitempty"`
+}
+
+// PermissionEx is a core <PermissionEx> element, used for SDDL on registry keys.
+type PermissionEx struct {
+	XMLName xml.Name `xml:"PermissionEx"`
+	Sddl    string   `xml:"Sddl,attr"`
+}
+
+// Feature is a <Feature> element. Children holds component references and
+// sub-features.
+type Feature struct {
+	XMLName               xml.Name `xml:"Feature"`
+	ID                    string   `xml:"Id,attr"`
+	Title                 string   `xml:"Title,attr"`
+	Description           string   `xml:"Description,attr,omitempty"`
+	Level                 string   `xml:"Level,attr"`
+	Display               string   `xml:"Display,attr,omitempty"`
+	AllowAdvertise        string   `xml:"AllowAdvertise,attr,omitempty"`
+	InstallDefault        string   `xml:"InstallDefault,attr,omitempty"`
+	TypicalDefault        string   `xml:"TypicalDefault,attr,omitempty"`
+	AllowAbsent           string   `xml:"AllowAbsent,attr"`
+	ConfigurableDirectory string   `xml:"ConfigurableDirectory,attr,omitempty"`
+	Children              []any
+}
+
+// Level is a <Level> element: the install level of a feature under a condition.
+type Level struct {
+	XMLName   xml.Name `xml:"Level"`
+	Value     string   `xml:"Value,attr"`
+	Condition string   `xml:"Condition,attr"`
+}
+
+// Raw is verbatim WiX XML, such as a <wix> block of an .msis file. It is
+// written as is, without the msis style.
+type Raw struct {
+	XML string
+}
+
+// rawElement stands in for a Raw until restyle is done, so that the
+// encoder indents it. The XML is base64 encoded, which restyle leaves alone.
+var rawElement = regexp.MustCompile(`<msis-raw xml='([A-Za-z0-9+/=]*)'></msis-raw>`)
+
+func (r Raw) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	placeholder := xml.StartElement{
+		Name: xml.Name{Local: "msis-raw"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xml"}, Value: base64.StdEncoding.EncodeToString([]byte(r.XML))}},
+	}
+	return e.EncodeElement(struct{}{}, placeholder)
+}
+
+// ComponentRef is a <ComponentRef> element.
+type ComponentRef struct {
+	XMLName xml.Name `xml:"ComponentRef"`
+	ID      string   `xml:"Id,attr"`
+}
+
+// ComponentGroup is a <ComponentGroup> element, which stands in for a
+// <Feature> in merge modules and libraries. Children holds component and
+// component group references.
+type ComponentGroup struct {
+	XMLName  xml.Name `xml:"ComponentGroup"`
+	ID       string   `xml:"Id,attr"`
+	Children []any
+}
+
+// ComponentGroupRef is a <ComponentGroupRef> element.
+type ComponentGroupRef struct {
+	XMLName xml.Name `xml:"ComponentGroupRef"`
+	ID      string   `xml:"Id,attr"`
+}
+
+// Merge is a <Merge> element, a merge module installed to its directory.
+type Merge struct {
+	XMLName    xml.Name `xml:"Merge"`
+	ID         string   `xml:"Id,attr"`
+	SourceFile string   `xml:"SourceFile,attr"`
+	DiskID     string   `xml:"DiskId,attr"`
+	Language   string   `xml:"Language,attr"`
+}
+
+// MergeRef is a <MergeRef> element.
+type MergeRef struct {
+	XMLName xml.Name `xml:"MergeRef"`
+	ID      string   `xml:"Id,attr"`
+}
+
+// Shortcut is a <Shortcut> element.
+type Shortcut struct {
+	XMLName          xml.Name `xml:"Shortcut"`
+	ID               string   `xml:"Id,attr"`
+	Name             string   `xml:"Name,attr"`
+	Description      string   `xml:"Description,attr"`
+	Target           string   `xml:"Target,attr"`
+	WorkingDirectory string   `xml:"WorkingDirectory,attr"`
+	Icon             *Icon
+}
+
+// Icon is an <Icon> element.
+type Icon struct {
+	XMLName    xml.Name `xml:"Icon"`
+	ID         string   `xml:"Id,attr"`
+	SourceFile string   `xml:"SourceFile,attr"`
+}
+
+// RegistryKey is a <RegistryKey> element. Root is omitted on nested keys.
+type RegistryKey struct {
+	XMLName                xml.Name `xml:"RegistryKey"`
+	Root                   string   `xml:"Root,attr,omitempty"`
+	Key                    string   `xml:"Key,attr"`
+	ForceCreateOnInstall   string   `xml:"ForceCreateOnInstall,attr,omitempty"`
+	ForceDeleteOnUninstall string   `xml:"ForceDeleteOnUninstall,attr,omitempty"`
+	Children               []any
+}
+
+// RegistryValue is a <RegistryValue> element. Value is always written
+// because an empty string value is meaningful, except for multi-string
+// values, which carry their strings as child elements.
+type RegistryValue struct {
+	XMLName      xml.Name `xml:"RegistryValue"`
+	Root         string   `xml:"Root,attr,omitempty"`
+	Key          string   `xml:"Key,attr,omitempty"`
+	Name         string   `xml:"Name,attr,omitempty"`
+	Value        *string  `xml:"Value,attr"`
+	Type         string   `xml:"Type,attr"`
+	KeyPath      string   `xml:"KeyPath,attr,omitempty"`
+	MultiStrings []string `xml:"MultiStringValue"`
+}
+
+// RemoveRegistryKey is a <RemoveRegistryKey> element.
+type RemoveRegistryKey struct {
+	XMLName xml.Name `xml:"RemoveRegistryKey"`
+	ID      string   `xml:"Id,attr,omitempty"`
+	Root    string   `xml:"Root,attr"`
+	Key     string   `xml:"Key,attr"`
+	Action  string   `xml:"Action,attr"`
+}
+
+// RemoveRegistryValue is a <RemoveRegistryValue> element.
+type RemoveRegistryValue struct {
+	XMLName xml.Name `xml:"RemoveRegistryValue"`
+	Root    string   `xml:"Root,attr"`
+	Key     string   `xml:"Key,attr"`
+	Name    string   `xml:"Name,attr,omitempty"`
+}
+
+// UtilRemoveFolderEx is a <util:RemoveFolderEx> element (WiX util extension).
+type UtilRemoveFolderEx struct {
+	XMLName  xml.Name `xml:"util:RemoveFolderEx"`
+	On       string   `xml:"On,attr"`
+	Property string   `xml:"Property,attr"`
+}
+
+// Property is a <Property> element.
+type Property struct {
+	XMLName  xml.Name `xml:"Property"`
+	ID       string   `xml:"Id,attr"`
+	Value    string   `xml:"Value,attr,omitempty"`
+	Secure   string   `xml:"Secure,attr,omitempty"`
+	Children []any
+}
+
+// RegistrySearch is a <RegistrySearch> element.
+type RegistrySearch struct {
+	XMLName xml.Name `xml:"RegistrySearch"`
+	ID      string   `xml:"Id,attr"`
+	Type    string   `xml:"Type,attr"`
+	Root    string   `xml:"Root,attr"`
+	Key     string   `xml:"Key,attr"`
+	Name    string   `xml:"Name,attr,omitempty"`
+}
+
+// SetProperty is a <SetProperty> element.
+type SetProperty struct {
+	XMLName   xml.Name `xml:"SetProperty"`
+	ID        string   `xml:"Id,attr"`
+	Value     string   `xml:"Value,attr"`
+	Before    string   `xml:"Before,attr,omitempty"`
+	After     string   `xml:"After,attr,omitempty"`
+	Sequence  string   `xml:"Sequence,attr,omitempty"`
+	Condition string   `xml:"Condition,attr,omitempty"`
+}
+
+// SetDirectory is a <SetDirectory> element.
+type SetDirectory struct {
+	XMLName   xml.Name `xml:"SetDirectory"`
+	ID        string   `xml:"Id,attr"`
+	Value     string   `xml:"Value,attr"`
+	Sequence  string   `xml:"Sequence,attr,omitempty"`
+	Condition string   `xml:"Condition,attr,omitempty"`
+}
+
+// InstanceTransforms is an <InstanceTransforms> element. The transform of
+// each instance sets Property to the ID of the instance.
+type InstanceTransforms struct {
+	XMLName   xml.Name `xml:"InstanceTransforms"`
+	Property  string   `xml:"Property,attr"`
+	Instances []*Instance
+}
+
+// Instance is an <Instance> element, an instance transform.
+type Instance struct {
+	XMLName     xml.Name `xml:"Instance"`
+	ID          string   `xml:"Id,attr"`
+	ProductCode string   `xml:"ProductCode,attr"`
+	ProductName string   `xml:"ProductName,attr,omitempty"`
+	UpgradeCode string   `xml:"UpgradeCode,attr,omitempty"`
+}
+
+// CustomAction is a <CustomAction> element.
+type CustomAction struct {
+	XMLName     xml.Name `xml:"CustomAction"`
+	ID          string   `xml:"Id,attr"`
+	Directory   string   `xml:"Directory,attr"`
+	ExeCommand  string   `xml:"ExeCommand,attr"`
+	Execute     string   `xml:"Execute,attr"`
+	Return      string   `xml:"Return,attr"`
+	Impersonate string   `xml:"Impersonate,attr,omitempty"`
+}
+
+// Custom is a <Custom> element of an execute sequence.
+type Custom struct {
+	XMLName   xml.Name `xml:"Custom"`
+	Action    string   `xml:"Action,attr"`
+	Before    string   `xml:"Before,attr,omitempty"`
+	After     string   `xml:"After,attr,omitempty"`
+	Condition string   `xml:"Condition,attr,omitempty"`
+}
+
+// Dialog is a <Dialog> element of the installer UI.
+type Dialog struct {
+	XMLName  xml.Name `xml:"Dialog"`
+	ID       string   `xml:"Id,attr"`
+	Width    int      `xml:"Width,attr"`
+	Height   int      `xml:"Height,attr"`
+	Title    string   `xml:"Title,attr"`
+	Children []any
+}
+
+// Control is a <Control> element of a dialog.
+type Control struct {
+	XMLName     xml.Name `xml:"Control"`
+	ID          string   `xml:"Id,attr"`
+	Type        string   `xml:"Type,attr"`
+	X           int      `xml:"X,attr"`
+	Y           int      `xml:"Y,attr"`
+	Width       int      `xml:"Width,attr"`
+	Height      int      `xml:"Height,attr"`
+	Default     string   `xml:"Default,attr,omitempty"`
+	Cancel      string   `xml:"Cancel,attr,omitempty"`
+	Disabled    string   `xml:"Disabled,attr,omitempty"`
+	Transparent string   `xml:"Transparent,attr,omitempty"`
+	NoPrefix    string   `xml:"NoPrefix,attr,omitempty"`
+	Text        string   `xml:"Text,attr,omitempty"`
+	Children    []any
+}
+
+// Publish is a <Publish> element: a control event or property change. Dialog
+// and Control are left out inside a <Control>.
+type Publish struct {
+	XMLName   xml.Name `xml:"Publish"`
+	Dialog    string   `xml:"Dialog,attr,omitempty"`
+	Control   string   `xml:"Control,attr,omitempty"`
+	Event     string   `xml:"Event,attr,omitempty"`
+	Property  string   `xml:"Property,attr,omitempty"`
+	Value     string   `xml:"Value,attr"`
+	Order     int      `xml:"Order,attr,omitempty"`
+	Condition string   `xml:"Condition,attr,omitempty"`
+}
+
+// Yes returns "yes" if b is true and "" otherwise, for optional yes/no
+// attributes that are left out when not set.
+func Yes(b bool) string {
+	if b {
+		return "yes"
+	}
+	return ""
+}
+
+// YesNo returns "yes" or "no".
+func YesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// String returns a pointer to s, for attributes that must be written even
+// when empty.
+func String(s string) *string {
+	return &s
+}
+
+// emptyElement matches an element with no content, which encoding/xml
+// writes as an open and close tag pair.
+var emptyElement = regexp.MustCompile(`<([\w:]+)([^<>]*)></([\w:]+)>`)
+
+// Render serializes elements at the given nesting depth, one element per
+// line and each line terminated by a newline. Nil elements are skipped.
+func Render(depth int, elements ...any) (string, error) {
+	var buf bytes.Buffer
+	for _, element := range elements {
+		if element == nil {
+			continue
+		}
+		// A fresh encoder per element keeps the encoder from inserting its
+		// own separator lines between top-level elements
+		enc := xml.NewEncoder(&buf)
+		enc.Indent(strings.Repeat(Indent, depth), Indent)
+		if err := enc.Encode(element); err != nil {
+			return "", fmt.Errorf("encoding %T: %w", element, err)
+		}
+		buf.WriteByte('\n')
+	}
+	return restoreRaw(restyle(buf.String())), nil
+}
+
+// MustRender is like Render but panics on error. The element types of this
+// package always encode, so errors indicate a programming mistake.
+func MustRender(depth int, elements ...any) string {
+	s, err := Render(depth, elements...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// restyle converts encoding/xml output to the msis style: single-quoted
+// attributes and self-closing empty elements. encoding/xml escapes quotes
+// in values, so every remaining double quote delimits an attribute. Escaped
+// double quotes are then restored, as they need no escaping inside single
+// quotes and conditions like REMOVE="ALL" stay readable.
+func restyle(s string) string {
+	s = strings.ReplaceAll(s, `"`, `'`)
+	s = strings.ReplaceAll(s, "&#34;", `"`)
+	return emptyElement.ReplaceAllStringFunc(s, func(m string) string {
+		parts := emptyElement.FindStringSubmatch(m)
+		if parts[1] != parts[3] {
+			return m
+		}
+		return "<" + parts[1] + parts[2] + "/>"
+	})
+}
+
+// restoreRaw replaces the stand-ins of Raw elements by their XML.
+func restoreRaw(s string) string {
+	return rawElement.ReplaceAllStringFunc(s, func(m string) string {
+		data, _ := base64.StdEncoding.DecodeString(rawElement.FindStringSubmatch(m)[1])
+		return strings.TrimSpace(string(data))
+	})
+}
@@ -0,0 +1,112 @@
+package wxs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderSingleQuotesAndSelfClosing(t *testing.T) {
+	got := MustRender(2, &File{ID: "FILE_ID00000", Name: "app.exe", Source: `C:\src\app.exe`, KeyPath: "yes"})
+	want := "        <File Id='FILE_ID00000' Name='app.exe' Source='C:\\src\\app.exe' KeyPath='yes'/>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRenderEscaping(t *testing.T) {
+	tests := []struct {
+		name    string
+		element any
+		want    string
+	}{
+		{
+			name:    "ampersand in file name",
+			element: &File{ID: "F", Name: "Tom & Jerry.txt", Source: "x"},
+			want:    "Name='Tom &amp; Jerry.txt'",
+		},
+		{
+			name:    "apostrophe in feature title",
+			element: &Feature{ID: "F", Title: "Joe's App", Level: "1", AllowAbsent: "yes"},
+			want:    "Title='Joe&#39;s App'",
+		},
+		{
+			name:    "double quote in environment value",
+			element: &Environment{ID: "E", Name: "X", Value: `say "hi"`},
+			want:    `Value='say "hi"'`,
+		},
+		{
+			name:    "markup in service description",
+			element: &ServiceInstall{ID: "S", Name: "svc", Description: "<b>fast</b> & 'safe'"},
+			want:    "<Description>&lt;b&gt;fast&lt;/b&gt; &amp; &#39;safe&#39;</Description>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MustRender(0, tt.element)
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("expected %q in:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderNesting(t *testing.T) {
+	dir := &Directory{ID: "INSTALLDIR", Name: "My App", Children: []any{
+		&Component{ID: "C1", GUID: "G1", Content: []any{
+			&CreateFolder{Permissions: []UtilPermissionEx{{User: "Users", GenericAll: "yes"}}},
+		}},
+		&Directory{ID: "DIR_ID00001", Name: "empty"},
+	}}
+	got := MustRender(1, dir)
+	want := "" +
+		"    <Directory Id='INSTALLDIR' Name='My App'>\n" +
+		"        <Component Id='C1' Guid='G1'>\n" +
+		"            <CreateFolder>\n" +
+		"                <util:PermissionEx User='Users' GenericAll='yes'/>\n" +
+		"            </CreateFolder>\n" +
+		"        </Component>\n" +
+		"        <Directory Id='DIR_ID00001' Name='empty'/>\n" +
+		"    </Directory>\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderMultipleElements(t *testing.T) {
+	got := MustRender(0, &ComponentRef{ID: "A"}, nil, &ComponentRef{ID: "B"})
+	want := "<ComponentRef Id='A'/>\n<ComponentRef Id='B'/>\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRegistryValueEmptyValue(t *testing.T) {
+	got := MustRender(0, &RegistryValue{Name: "n", Value: String(""), Type: "string"})
+	if got != "<RegistryValue Name='n' Value='' Type='string'/>\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+	multi := MustRender(0, &RegistryValue{Name: "m", Type: "multiString", MultiStrings: []string{"a", "b&c"}})
+	want := "<RegistryValue Name='m' Type='multiString'>\n" +
+		"    <MultiStringValue>a</MultiStringValue>\n" +
+		"    <MultiStringValue>b&amp;c</MultiStringValue>\n" +
+		"</RegistryValue>\n"
+	if multi != want {
+		t.Errorf("got:\n%s\nwant:\n%s", multi, want)
+	}
+}
+
+func TestRenderRaw(t *testing.T) {
+	feature := &Feature{ID: "F", Title: "Main", Level: "1", AllowAbsent: "yes", Children: []any{
+		&ComponentRef{ID: "C1"},
+		&Raw{XML: `<MergeRef Id="It's" />`},
+	}}
+	got := MustRender(0, feature)
+	want := "" +
+		"<Feature Id='F' Title='Main' Level='1' AllowAbsent='yes'>\n" +
+		"    <ComponentRef Id='C1'/>\n" +
+		"    <MergeRef Id=\"It's\" />\n" +
+		"</Feature>\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
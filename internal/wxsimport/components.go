@@ -0,0 +1,280 @@
+package wxsimport
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// component is a WiX component and the msis items it translates to.
+type component struct {
+	elem      *element
+	dir       string // WiX directory ID
+	permanent bool
+	items     []ir.Item
+	registry  []regValue
+	owner     *owner // Feature that installs the component
+}
+
+// component registers a <Component>; it is translated once the directory
+// tree is known.
+func (imp *importer) component(e *element, s scope) {
+	dir := s.dir
+	if d := e.attr("Directory"); d != "" {
+		dir = d
+	}
+	if sub := e.attr("Subdirectory"); sub != "" {
+		dir = imp.subdirectory(dir, sub)
+	}
+	id := e.attr("Id")
+	if id == "" {
+		id = fmt.Sprintf("component@%d", e.line)
+	}
+	comp := &component{elem: e, dir: dir, permanent: e.attr("Permanent") == "yes"}
+	imp.components[id] = comp
+	imp.byElement[e] = comp
+	imp.order = append(imp.order, comp)
+	if s.group != nil {
+		ref := &element{name: "ComponentRef", attrs: map[string]string{"Id": id}, line: e.line}
+		s.group.refs = append(s.group.refs, ref)
+	}
+}
+
+// buildComponents translates every component. The installed paths of all
+// files are known first, so [#FileId] references resolve in any order.
+func (imp *importer) buildComponents() {
+	for _, comp := range imp.order {
+		target, ok := imp.target(comp.dir)
+		if !ok {
+			continue
+		}
+		for _, c := range comp.elem.children {
+			if c.name == "File" {
+				imp.files[c.attr("Id")] = joinTarget(target, fileName(c))
+			}
+		}
+	}
+	for _, comp := range imp.order {
+		imp.translateComponent(comp)
+	}
+}
+
+func (imp *importer) translateComponent(comp *component) {
+	e := comp.elem
+	target, ok := imp.target(comp.dir)
+	if !ok {
+		if _, _, isShortcutFolder := imp.shortcutFolder(comp.dir); !isShortcutFolder {
+			imp.report(e.line, describe(e), fmt.Sprintf("is in directory %s, which is not below a standard directory msis knows; its files were not translated", comp.dir))
+		}
+	}
+	if e.attr("Condition") != "" {
+		imp.report(e.line, describe(e), "has a condition, which msis supports on <registry> items only; it was dropped")
+	}
+	hasFiles := false
+	for _, c := range e.children {
+		hasFiles = hasFiles || c.name == "File"
+	}
+
+	for _, c := range e.children {
+		switch c.name {
+		case "File":
+			if ok {
+				imp.file(comp, c, target)
+			}
+		case "RegistryValue", "RegistryKey":
+			imp.registry(comp, c, "", "")
+		case "Shortcut":
+			imp.shortcut(comp, c, "")
+		case "ServiceInstall":
+			imp.service(comp, c)
+		case "ServiceControl":
+			// Read with the ServiceInstall of the same name
+		case "Environment":
+			imp.environment(comp, c)
+		case "CreateFolder":
+			imp.createFolder(comp, c, target, ok && !hasFiles)
+		case "RemoveFolder":
+			// msis removes the folders it creates
+		case "Condition":
+			imp.report(c.line, describe(e), "has a condition, which msis supports on <registry> items only; it was dropped")
+		default:
+			imp.notTranslated(c)
+		}
+	}
+}
+
+// fileName returns the installed name of a <File>.
+func fileName(e *element) string {
+	if name := e.attr("Name"); name != "" {
+		return name
+	}
+	return baseName(fileSource(e))
+}
+
+func fileSource(e *element) string {
+	if source := e.attr("Source"); source != "" {
+		return source
+	}
+	return e.attr("src") // WiX 3 alias
+}
+
+// joinTarget appends a name to an msis target like [INSTALLDIR]bin.
+func joinTarget(target, name string) string {
+	if strings.HasSuffix(target, "]") {
+		return target + name
+	}
+	return target + `\` + name
+}
+
+func (imp *importer) file(comp *component, e *element, target string) {
+	source := fileSource(e)
+	if source == "" {
+		imp.report(e.line, describe(e), "has no Source; it was not translated")
+		return
+	}
+	// A file installed under another name is a rename in msis
+	if name := e.attr("Name"); name != "" && !strings.EqualFold(name, baseName(source)) {
+		if filepath.Ext(name) == "" {
+			imp.report(e.line, describe(e), fmt.Sprintf("renames %s to %s; msis renames only to names with an extension, so the original name was kept", baseName(source), name))
+		} else {
+			target = joinTarget(target, name)
+		}
+	}
+	comp.items = append(comp.items, ir.Files{
+		Source:         source,
+		Target:         target,
+		DoNotOverwrite: comp.elem.attr("NeverOverwrite") == "yes",
+	})
+	for _, c := range e.children {
+		if c.name == "Shortcut" {
+			imp.shortcut(comp, c, imp.files[e.attr("Id")])
+		} else {
+			imp.notTranslated(c)
+		}
+	}
+}
+
+// shortcut translates a <Shortcut>; file is the installed path of the
+// <File> an advertised shortcut is declared in.
+func (imp *importer) shortcut(comp *component, e *element, file string) {
+	dir := e.attr("Directory")
+	if dir == "" {
+		dir = comp.dir
+	}
+	folder, subfolder, ok := imp.shortcutFolder(dir)
+	if !ok {
+		imp.report(e.line, describe(e), fmt.Sprintf("is in directory %s; msis creates shortcuts on the desktop and in the start menu only", dir))
+		return
+	}
+	if subfolder {
+		imp.report(e.line, describe(e), fmt.Sprintf("is in a subfolder of %s; msis creates shortcuts directly in %s", dir, folder))
+	}
+	if file == "" {
+		file = imp.formatted(e.attr("Target"))
+	}
+	if file == "" {
+		imp.report(e.line, describe(e), "has no target; it was not translated")
+		return
+	}
+	sc := ir.Shortcut{Name: e.attr("Name"), Target: folder, File: file, Description: e.attr("Description")}
+	if icon := e.attr("Icon"); icon != "" {
+		if sc.Icon, ok = imp.icons[icon]; !ok {
+			imp.report(e.line, describe(e), "refers to an unknown <Icon> "+icon)
+		}
+	}
+	for _, attr := range []string{"Arguments", "WorkingDirectory", "Hotkey", "Show"} {
+		if e.attr(attr) != "" {
+			imp.report(e.line, describe(e), fmt.Sprintf("has %s, which msis shortcuts do not support", attr))
+		}
+	}
+	comp.items = append(comp.items, sc)
+}
+
+func (imp *importer) service(comp *component, e *element) {
+	var exe *element
+	for _, c := range comp.elem.children {
+		if c.name == "File" && (exe == nil || c.attr("KeyPath") == "yes") {
+			exe = c
+		}
+	}
+	if exe == nil {
+		imp.report(e.line, describe(e), "is in a component without a <File>; it was not translated")
+		return
+	}
+	svc := ir.Service{
+		FileName:           fileName(exe),
+		ServiceName:        e.attr("Name"),
+		ServiceDisplayName: e.attr("DisplayName"),
+		Start:              e.attr("Start"),
+		Description:        e.attr("Description"),
+		ServiceType:        e.attr("Type"),
+		ErrorControl:       e.attr("ErrorControl"),
+		StartAfterInstall:  "no",
+	}
+	switch svc.Start {
+	case "boot", "system":
+		imp.report(e.line, describe(e), fmt.Sprintf("starts at %s, which msis does not support; it starts automatically", svc.Start))
+		svc.Start = "auto"
+	}
+	switch svc.ServiceType {
+	case "kernelDriver", "systemDriver":
+		imp.report(e.line, describe(e), "installs a driver, which msis does not support; it was imported as a service")
+		svc.ServiceType = "ownProcess"
+	}
+	for _, c := range comp.elem.children {
+		if c.name == "ServiceControl" && c.attr("Name") == svc.ServiceName && strings.Contains(c.attr("Start"), "install") {
+			svc.StartAfterInstall = ""
+		}
+	}
+	for _, attr := range []string{"Account", "Password", "Arguments", "Interactive", "LoadOrderGroup"} {
+		if value := e.attr(attr); value != "" && !(attr == "Account" && strings.EqualFold(value, "LocalSystem")) {
+			imp.report(e.line, describe(e), fmt.Sprintf("has %s, which msis services do not support", attr))
+		}
+	}
+	for _, c := range e.children {
+		imp.notTranslated(c)
+	}
+	comp.items = append(comp.items, svc)
+}
+
+func (imp *importer) environment(comp *component, e *element) {
+	name, value := e.attr("Name"), imp.formatted(e.attr("Value"))
+	if action := e.attr("Action"); action != "" && action != "set" && action != "create" {
+		imp.report(e.line, describe(e), fmt.Sprintf("has Action %s; msis only sets variables", action))
+		return
+	}
+	if e.attr("System") != "yes" {
+		imp.report(e.line, describe(e), "is a user variable; msis sets system variables")
+	}
+	if part := e.attr("Part"); part == "first" || part == "last" {
+		// Appending the install folder to PATH is a switch in msis
+		if strings.EqualFold(name, "PATH") && value == "[INSTALLDIR]" {
+			imp.res.Setup.SetVariable("ADD_TO_PATH", "true")
+			return
+		}
+		imp.report(e.line, describe(e), fmt.Sprintf("adds to the %s of %s; msis replaces the whole value", part, name))
+	}
+	comp.items = append(comp.items, ir.SetEnv{Name: name, Value: value, Permanent: e.attr("Permanent") == "yes"})
+}
+
+// createFolder translates the <CreateFolder> of a component. msis creates
+// the folders of installed files itself, so only empty folders need an
+// item.
+func (imp *importer) createFolder(comp *component, e *element, target string, empty bool) {
+	for _, c := range e.children {
+		imp.report(c.line, c.name, "sets folder permissions, which msis does not support")
+	}
+	if dir := e.attr("Directory"); dir != "" {
+		var ok bool
+		if target, ok = imp.target(dir); !ok {
+			imp.report(e.line, describe(e), fmt.Sprintf("creates %s, which is not below a standard directory msis knows", dir))
+			return
+		}
+		empty = true
+	}
+	if empty {
+		comp.items = append(comp.items, ir.CreateFolder{Target: target})
+	}
+}
@@ -0,0 +1,247 @@
+package wxsimport
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// directory is a WiX directory. Directories may be declared in any order
+// and extended by <DirectoryRef>, so the tree is linked by ID.
+type directory struct {
+	id            string
+	name          string
+	parent        string
+	subdirs       []string
+	hasComponents bool
+	line          int
+}
+
+// standardRoots maps the WiX standard directories msis knows to msis root
+// keys, in the order roots are resolved.
+var standardRoots = []struct{ dir, key string }{
+	{"ProgramFiles64Folder", "INSTALLDIR"},
+	{"ProgramFiles6432Folder", "INSTALLDIR"},
+	{"ProgramFilesFolder", "INSTALLDIR"},
+	{"CommonAppDataFolder", "APPDATADIR"},
+	{"AppDataFolder", "ROAMINGAPPDATADIR"},
+	{"LocalAppDataFolder", "LOCALAPPDATADIR"},
+	{"CommonFiles64Folder", "COMMONFILESDIR"},
+	{"CommonFiles6432Folder", "COMMONFILESDIR"},
+	{"CommonFilesFolder", "COMMONFILESDIR"},
+	{"WindowsFolder", "WINDOWSDIR"},
+	{"System64Folder", "SYSTEMDIR"},
+	{"System6432Folder", "SYSTEMDIR"},
+	{"SystemFolder", "SYSTEMDIR"},
+}
+
+// shortcutFolders maps WiX shortcut folders to <shortcut> targets.
+var shortcutFolders = map[string]string{
+	"DesktopFolder":     "DESKTOP",
+	"ProgramMenuFolder": "STARTMENU",
+}
+
+// installDirIDs are the IDs WiX projects commonly give the install folder.
+var installDirIDs = []string{"INSTALLDIR", "INSTALLFOLDER", "INSTALLLOCATION", "APPLICATIONFOLDER", "APPLICATIONROOTDIRECTORY"}
+
+// root is an msis root key and the WiX directory it stands for.
+type root struct {
+	key   string
+	dir   string // WiX directory ID
+	value string // Folder names below the standard directory, e.g. Acme\App
+}
+
+func (imp *importer) dir(id string) *directory {
+	d, ok := imp.dirs[id]
+	if !ok {
+		d = &directory{id: id}
+		imp.dirs[id] = d
+	}
+	return d
+}
+
+// directory reads a <Directory>, <StandardDirectory> or <DirectoryRef>
+// and everything declared in it.
+func (imp *importer) directory(e *element, parent string) {
+	id := e.attr("Id")
+	if id == "" {
+		id = fmt.Sprintf("directory@%d", e.line)
+	}
+	d := imp.dir(id)
+	if e.name != "DirectoryRef" {
+		d.name = e.attr("Name")
+		d.line = e.line
+		if parent != "" {
+			d.parent = parent
+			p := imp.dir(parent)
+			p.subdirs = append(p.subdirs, id)
+		}
+	}
+	for _, c := range e.children {
+		switch c.name {
+		case "Directory":
+			imp.directory(c, id)
+		case "Component":
+			imp.component(c, scope{dir: id})
+		default:
+			imp.notTranslated(c)
+		}
+	}
+}
+
+// subdirectory returns the ID of a directory below another, creating it
+// for the Subdirectory attribute of WiX 4 components.
+func (imp *importer) subdirectory(parent, path string) string {
+	id := parent
+	for _, name := range strings.FieldsFunc(path, isPathSeparator) {
+		child := id + `\` + name
+		if _, ok := imp.dirs[child]; !ok {
+			d := imp.dir(child)
+			d.name = name
+			d.parent = id
+			p := imp.dir(id)
+			p.subdirs = append(p.subdirs, child)
+		}
+		id = child
+	}
+	return id
+}
+
+// resolveRoots picks the WiX directory each msis root key stands for: the
+// standard directory, or the chain of single folders below it down to the
+// install folder or the first folder with components. The names of the
+// chain become the value of the root variable, e.g. INSTALLDIR=Acme\App.
+func (imp *importer) resolveRoots() {
+	for _, comp := range imp.order {
+		imp.dir(comp.dir).hasComponents = true
+	}
+	imp.roots = make(map[string]*root)
+	for _, std := range standardRoots {
+		d, ok := imp.dirs[std.dir]
+		if !ok || !imp.hasContent(d) {
+			continue
+		}
+		if r, ok := imp.roots[std.key]; ok {
+			imp.report(d.line, std.dir, fmt.Sprintf("is not translated: [%s] already stands for %s", std.key, r.dir))
+			continue
+		}
+		if std.dir == "ProgramFilesFolder" && imp.platform == "" {
+			imp.platform = "x86"
+		}
+		base := d
+		var names []string
+		for !base.hasComponents && len(base.subdirs) == 1 && (base == d || !slices.Contains(installDirIDs, base.id)) {
+			base = imp.dirs[base.subdirs[0]]
+			if base.name != "" && base.name != "." {
+				names = append(names, base.name)
+			}
+		}
+		r := &root{key: std.key, dir: base.id, value: strings.Join(names, `\`)}
+		imp.roots[std.key] = r
+		if r.value == "" {
+			switch std.key {
+			case "INSTALLDIR":
+				imp.report(d.line, std.dir, "has files directly inside; msis installs them below a folder named after INSTALLDIR")
+			case "APPDATADIR", "ROAMINGAPPDATADIR", "LOCALAPPDATADIR":
+				imp.report(d.line, std.dir, fmt.Sprintf("has files directly inside; msis installs them below a folder named after INSTALLDIR unless %s is set", std.key))
+			}
+		}
+	}
+}
+
+// sortedRoots returns the roots in the order of standardRoots.
+func (imp *importer) sortedRoots() []*root {
+	var roots []*root
+	for _, std := range standardRoots {
+		if r, ok := imp.roots[std.key]; ok && !slices.Contains(roots, r) {
+			roots = append(roots, r)
+		}
+	}
+	return roots
+}
+
+func (imp *importer) hasContent(d *directory) bool {
+	if d.hasComponents {
+		return true
+	}
+	for _, id := range d.subdirs {
+		if imp.hasContent(imp.dirs[id]) {
+			return true
+		}
+	}
+	return false
+}
+
+// target returns the msis target of a WiX directory, e.g. [INSTALLDIR]bin.
+func (imp *importer) target(id string) (string, bool) {
+	var names []string
+	for id != "" {
+		for _, r := range imp.roots {
+			if r.dir == id {
+				slices.Reverse(names)
+				return "[" + r.key + "]" + strings.Join(names, `\`), true
+			}
+		}
+		d, ok := imp.dirs[id]
+		if !ok {
+			break
+		}
+		if d.name != "" && d.name != "." {
+			names = append(names, d.name)
+		}
+		id = d.parent
+	}
+	return "", false
+}
+
+// shortcutFolder returns the <shortcut> target of a WiX directory, and
+// whether the directory is a folder below the desktop or start menu.
+func (imp *importer) shortcutFolder(id string) (target string, subfolder, ok bool) {
+	for id != "" {
+		if target, ok := shortcutFolders[id]; ok {
+			return target, subfolder, true
+		}
+		d, ok := imp.dirs[id]
+		if !ok {
+			break
+		}
+		subfolder = true
+		id = d.parent
+	}
+	return "", false, false
+}
+
+// formattedRef matches a directory or file reference in a WiX formatted
+// string: [INSTALLFOLDER] or [#AppExe].
+var formattedRef = regexp.MustCompile(`\[(#?)([A-Za-z_][A-Za-z0-9_.]*)\]`)
+
+// formatted translates the directory and file references of a WiX
+// formatted string to msis targets. Other properties are kept.
+func (imp *importer) formatted(value string) string {
+	return formattedRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := formattedRef.FindStringSubmatch(ref)
+		if m[1] == "#" {
+			if path, ok := imp.files[m[2]]; ok {
+				return path
+			}
+			return ref
+		}
+		if target, ok := imp.target(m[2]); ok {
+			if !strings.HasSuffix(target, "]") {
+				target += `\`
+			}
+			return target
+		}
+		return ref
+	})
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '\\' || r == '/'
+}
+
+// baseName returns the file name of a WiX source path.
+func baseName(path string) string {
+	return path[strings.LastIndexFunc(path, isPathSeparator)+1:]
+}
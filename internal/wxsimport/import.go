@@ -0,0 +1,528 @@
+// Package wxsimport translates hand-written WiX 3/4 source into .msis.
+//
+// Directory/Component/File trees become <files> items, RegistryValue
+// elements a generated .reg file, Shortcut, ServiceInstall and Environment
+// their msis elements, and Feature trees <feature> elements. Everything the
+// importer cannot express in .msis is listed as a Finding.
+package wxsimport
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// Result is a translated WiX project.
+type Result struct {
+	Setup    *ir.Setup
+	RegFiles []RegFile // .reg files the <registry> items of Setup refer to
+	Findings []Finding // Constructs that were not translated
+}
+
+// RegFile is a generated .reg file, named relative to the .msis file.
+type RegFile struct {
+	Name string
+	Data []byte
+}
+
+// Finding is a WiX construct the importer could not translate, or could
+// translate only in part.
+type Finding struct {
+	Line    int
+	Element string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("line %d: <%s> %s", f.Line, f.Element, f.Message)
+}
+
+// Report returns the findings as text, for the file next to the imported
+// .msis.
+func (r *Result) Report(source string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "msis /IMPORT report for %s\n\n", source)
+	if len(r.Findings) == 0 {
+		b.WriteString("Everything was translated.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d construct(s) were not translated or only in part:\n\n", len(r.Findings))
+	for _, f := range r.Findings {
+		fmt.Fprintf(&b, "%s:%s\n", source, f)
+	}
+	return b.String()
+}
+
+// element is a WiX source element. Namespaces are ignored, so WiX 3 and
+// WiX 4 sources read alike.
+type element struct {
+	name     string
+	attrs    map[string]string
+	children []*element
+	text     string
+	line     int
+}
+
+func (e *element) attr(name string) string {
+	return e.attrs[name]
+}
+
+// Import translates WiX source. base is the file name of the .msis without
+// extension; generated .reg files are named after it.
+func Import(data []byte, base string) (*Result, error) {
+	imp := &importer{
+		base:       base,
+		res:        &Result{Setup: &ir.Setup{}},
+		dirs:       make(map[string]*directory),
+		components: make(map[string]*component),
+		byElement:  make(map[*element]*component),
+		groups:     make(map[string]*componentGroup),
+		files:      make(map[string]string),
+		icons:      make(map[string]string),
+	}
+	root, err := imp.read(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.name != "Wix" && root.name != "Include" {
+		return nil, fmt.Errorf("not WiX source: root element is <%s>", root.name)
+	}
+	imp.collect(root, scope{})
+	imp.resolveRoots()
+	imp.buildComponents()
+	imp.translate()
+	sort.SliceStable(imp.res.Findings, func(i, j int) bool {
+		return imp.res.Findings[i].Line < imp.res.Findings[j].Line
+	})
+	return imp.res, nil
+}
+
+// varRef matches a preprocessor variable reference like $(var.Version).
+var varRef = regexp.MustCompile(`\$\((var|env|sys)\.([A-Za-z_][A-Za-z0-9_.]*)\)`)
+
+// defineInst matches the instruction of <?define Name = "Value"?>.
+var defineInst = regexp.MustCompile(`^\s*([A-Za-z_][A-Za-z0-9_.]*)\s*=\s*"?(.*?)"?\s*$`)
+
+// read parses WiX source into an element tree. <?define?> instructions
+// become <set> variables and $(var.X) references {{X}}, with the name in
+// upper case like every msis variable.
+func (imp *importer) read(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*element
+	var root *element
+	for {
+		line, _ := d.InputPos()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing WiX source: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{name: t.Name.Local, attrs: make(map[string]string), line: line}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+					continue
+				}
+				e.attrs[a.Name.Local] = imp.expand(a.Value, e)
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		case xml.ProcInst:
+			imp.procInst(t, line)
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("parsing WiX source: no root element")
+	}
+	return root, nil
+}
+
+func (imp *importer) procInst(pi xml.ProcInst, line int) {
+	inst := strings.TrimSpace(string(pi.Inst))
+	switch pi.Target {
+	case "xml":
+	case "define":
+		if m := defineInst.FindStringSubmatch(inst); m != nil {
+			imp.res.Setup.Sets = append(imp.res.Setup.Sets, ir.Set{Name: variableName(m[1]), Value: m[2]})
+			return
+		}
+		imp.report(line, "?define", "could not be read: "+inst)
+	case "if", "ifdef", "ifndef", "elseif":
+		imp.report(line, "?"+pi.Target, "was not evaluated; the elements of every branch were imported")
+	case "else", "endif":
+	default:
+		imp.report(line, "?"+pi.Target, "not translated")
+	}
+}
+
+// expand turns preprocessor variable references into msis variables.
+func (imp *importer) expand(value string, e *element) string {
+	return varRef.ReplaceAllStringFunc(value, func(ref string) string {
+		m := varRef.FindStringSubmatch(ref)
+		if m[1] != "var" {
+			imp.report(e.line, e.name, fmt.Sprintf("references %s, which msis cannot resolve", ref))
+			return ref
+		}
+		return "{{" + variableName(m[2]) + "}}"
+	})
+}
+
+// variableName returns the msis variable for a preprocessor variable:
+// Product.Version becomes PRODUCT_VERSION. Handlebars resolves neither
+// dotted nor mixed-case names from the variable dictionary.
+func variableName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, ".", "_"))
+}
+
+func (imp *importer) report(line int, element, message string) {
+	imp.res.Findings = append(imp.res.Findings, Finding{Line: line, Element: element, Message: message})
+}
+
+func (imp *importer) notTranslated(e *element) {
+	imp.report(e.line, describe(e), "not translated")
+}
+
+// describe returns an element name with its Id, for findings.
+func describe(e *element) string {
+	if id := e.attr("Id"); id != "" {
+		return fmt.Sprintf("%s Id=%q", e.name, id)
+	}
+	return e.name
+}
+
+// importer holds the state of one import.
+type importer struct {
+	base        string
+	res         *Result
+	dirs        map[string]*directory
+	components  map[string]*component
+	byElement   map[*element]*component
+	order       []*component // In document order
+	groups      map[string]*componentGroup
+	features    []*element
+	files       map[string]string // File ID to installed path, e.g. [INSTALLDIR]bin\app.exe
+	icons       map[string]string // Icon ID to source file
+	roots       map[string]*root  // msis root key to its WiX directory
+	regGroups   []*regGroup
+	hasUI       bool
+	productIcon *element // ARPPRODUCTICON property
+	platform    string
+}
+
+// scope is the context an element is read in.
+type scope struct {
+	dir   string // Directory ID
+	group *componentGroup
+}
+
+type componentGroup struct {
+	refs []*element // ComponentRef and ComponentGroupRef elements
+}
+
+// collect reads the product attributes, directories, components and
+// component groups; features are translated after all of them are known.
+func (imp *importer) collect(e *element, s scope) {
+	for _, c := range e.children {
+		switch c.name {
+		case "Fragment", "Module":
+			if c.name == "Module" {
+				imp.report(c.line, describe(c), "is a merge module; its contents were imported as a product")
+			}
+			imp.collect(c, s)
+		case "Product":
+			imp.product(c)
+			imp.collect(c, s)
+		case "Package":
+			if e.name == "Product" {
+				imp.packageV3(c) // WiX 3 package metadata
+			} else {
+				imp.product(c) // WiX 4 product
+				imp.collect(c, s)
+			}
+		case "Directory", "StandardDirectory", "DirectoryRef":
+			imp.directory(c, s.dir)
+		case "Component":
+			imp.component(c, s)
+		case "ComponentGroup":
+			g := imp.group(c.attr("Id"))
+			gs := scope{dir: s.dir, group: g}
+			if dir := c.attr("Directory"); dir != "" {
+				gs.dir = dir
+			}
+			imp.collect(c, gs)
+		case "ComponentRef", "ComponentGroupRef":
+			if s.group != nil {
+				s.group.refs = append(s.group.refs, c)
+			} else {
+				imp.notTranslated(c)
+			}
+		case "Feature":
+			imp.features = append(imp.features, c)
+			imp.collectFeature(c)
+		case "Icon":
+			imp.icons[c.attr("Id")] = c.attr("SourceFile")
+		case "Property":
+			imp.property(c)
+		case "WixVariable":
+			imp.wixVariable(c)
+		case "UIRef", "WixUI":
+			imp.ui(c)
+		case "MajorUpgrade", "MediaTemplate", "Media", "SummaryInformation":
+			// msis generates these
+		default:
+			imp.notTranslated(c)
+		}
+	}
+}
+
+// collectFeature registers the components declared inside features.
+func (imp *importer) collectFeature(f *element) {
+	for _, c := range f.children {
+		switch c.name {
+		case "Component":
+			imp.component(c, scope{})
+		case "Feature":
+			imp.collectFeature(c)
+		}
+	}
+}
+
+func (imp *importer) group(id string) *componentGroup {
+	g, ok := imp.groups[id]
+	if !ok {
+		g = &componentGroup{}
+		imp.groups[id] = g
+	}
+	return g
+}
+
+// product reads the attributes of a WiX 3 <Product> or WiX 4 <Package>.
+func (imp *importer) product(e *element) {
+	vars := []struct{ attr, name, skip string }{
+		{"Name", "PRODUCT_NAME", ""},
+		{"Version", "PRODUCT_VERSION", ""},
+		{"Manufacturer", "MANUFACTURER", ""},
+		{"UpgradeCode", "UPGRADE_CODE", ""},
+		{"Language", "LCID", "1033"},
+		{"Codepage", "CODEPAGE", "1252"},
+	}
+	for _, v := range vars {
+		if value := e.attr(v.attr); value != "" && value != v.skip {
+			imp.res.Setup.SetVariable(v.name, value)
+		}
+	}
+	if id := e.attr("Id"); id != "" && id != "*" {
+		imp.report(e.line, e.name, "has a fixed product code; msis generates a new one for every build")
+	}
+	if e.attr("Scope") == "perUser" {
+		imp.report(e.line, e.name, "is a per-user package; msis builds per-machine packages")
+	}
+}
+
+// packageV3 reads the <Package> element of a WiX 3 <Product>.
+func (imp *importer) packageV3(e *element) {
+	switch strings.ToLower(e.attr("Platform")) {
+	case "x86", "intel":
+		imp.platform = "x86"
+	case "arm64":
+		imp.platform = "arm64"
+	case "x64":
+		imp.platform = "x64"
+	}
+	if e.attr("InstallScope") == "perUser" {
+		imp.report(e.line, e.name, "is a per-user package; msis builds per-machine packages")
+	}
+}
+
+func (imp *importer) property(e *element) {
+	switch e.attr("Id") {
+	case "ARPPRODUCTICON":
+		imp.productIcon = e // <Icon> may follow
+	case "WIXUI_INSTALLDIR":
+		// Set by msis when INSTALL_DIR_DIALOG is true
+	default:
+		imp.notTranslated(e)
+	}
+}
+
+// wixVariables maps WiX UI variables to msis variables.
+var wixVariables = map[string]string{
+	"WixUILicenseRtf": "LICENSE_FILE",
+	"WixUIBannerBmp":  "LOGO_BANNER",
+	"WixUIDialogBmp":  "LOGO_DIALOG",
+}
+
+func (imp *importer) wixVariable(e *element) {
+	if name, ok := wixVariables[e.attr("Id")]; ok {
+		imp.res.Setup.SetVariable(name, e.attr("Value"))
+		return
+	}
+	imp.notTranslated(e)
+}
+
+func (imp *importer) ui(e *element) {
+	imp.hasUI = true
+	switch e.attr("Id") {
+	case "WixUI_InstallDir":
+		imp.res.Setup.SetVariable("INSTALL_DIR_DIALOG", "true")
+	case "WixUI_Minimal", "WixUI_ErrorProgressText":
+	default:
+		imp.report(e.line, describe(e), "uses a dialog set msis does not provide; the msis default UI is used")
+	}
+}
+
+// translate builds the features and items of the setup.
+func (imp *importer) translate() {
+	setup := imp.res.Setup
+	if imp.platform != "" && imp.platform != "x64" {
+		setup.SetVariable("PLATFORM", imp.platform)
+	}
+	if !imp.hasUI {
+		setup.Silent = true
+	}
+	if e := imp.productIcon; e != nil {
+		if icon, ok := imp.icons[e.attr("Value")]; ok {
+			setup.SetVariable("SETUP_ICON", icon)
+		} else {
+			imp.report(e.line, describe(e), "refers to an unknown <Icon>")
+		}
+	}
+	for _, r := range imp.sortedRoots() {
+		if r.value != "" {
+			setup.SetVariable(r.key, r.value)
+		}
+	}
+
+	top := &owner{label: "setup"}
+	for _, f := range imp.features {
+		feature := imp.feature(f)
+		setup.Features = append(setup.Features, *feature)
+	}
+	// Components no feature installs still belong to the package
+	for _, comp := range imp.order {
+		if comp.owner == nil {
+			imp.report(comp.elem.line, describe(comp.elem), "is not part of a feature; its items were placed in <setup>")
+			imp.addComponent(comp, top)
+		}
+	}
+	setup.Items = top.items
+	imp.writeRegistry()
+}
+
+// owner is a feature or the setup, collecting the items of its components.
+type owner struct {
+	label    string
+	items    []ir.Item
+	registry map[bool]*regGroup // By Permanent
+}
+
+func (imp *importer) feature(e *element) *ir.Feature {
+	f := &ir.Feature{Name: e.attr("Title"), Enabled: true, Allowed: true, Description: e.attr("Description")}
+	if f.Name == "" {
+		f.Name = e.attr("Id")
+	}
+	// The level is kept as is; 1 is the default
+	if level := e.attr("Level"); level != "" && level != "1" {
+		if n, err := strconv.Atoi(level); err == nil && n >= 0 && n <= 32767 {
+			f.Level = level
+		} else {
+			imp.report(e.line, describe(e), fmt.Sprintf("has Level %q, which is not a number from 0 to 32767; it was imported with level 1", level))
+		}
+	}
+	if e.attr("Absent") == "disallow" {
+		f.Allowed = false
+	}
+	switch display := e.attr("Display"); display {
+	case "", "expand", "collapse", "hidden":
+		f.Display = display
+	default:
+		imp.report(e.line, describe(e), "has a Display order, which msis features do not support")
+	}
+	o := &owner{label: e.attr("Id")}
+	for _, c := range e.children {
+		switch c.name {
+		case "ComponentRef":
+			imp.addRef(c.attr("Id"), c, o)
+		case "ComponentGroupRef":
+			imp.addGroup(c.attr("Id"), c, o, nil)
+		case "Component":
+			imp.addComponent(imp.byElement[c], o)
+		case "Feature":
+			f.SubFeatures = append(f.SubFeatures, *imp.feature(c))
+		default:
+			imp.notTranslated(c)
+		}
+	}
+	f.Items = o.items
+	return f
+}
+
+func (imp *importer) addRef(id string, ref *element, o *owner) {
+	comp, ok := imp.components[id]
+	if !ok {
+		imp.report(ref.line, describe(ref), "refers to an unknown component")
+		return
+	}
+	imp.addComponent(comp, o)
+}
+
+// addGroup adds the components of a group; seen guards against cycles.
+func (imp *importer) addGroup(id string, ref *element, o *owner, seen map[string]bool) {
+	g, ok := imp.groups[id]
+	if !ok {
+		imp.report(ref.line, describe(ref), "refers to an unknown component group")
+		return
+	}
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	if seen[id] {
+		return
+	}
+	seen[id] = true
+	for _, r := range g.refs {
+		if r.name == "ComponentRef" {
+			imp.addRef(r.attr("Id"), r, o)
+		} else {
+			imp.addGroup(r.attr("Id"), r, o, seen)
+		}
+	}
+}
+
+// addComponent adds the items of a component to a feature. A component
+// installed by several features is kept in the first.
+func (imp *importer) addComponent(comp *component, o *owner) {
+	if comp == nil {
+		return
+	}
+	if comp.owner != nil {
+		imp.report(comp.elem.line, describe(comp.elem), fmt.Sprintf("is part of features %s and %s; msis installs it with %s only", comp.owner.label, o.label, comp.owner.label))
+		return
+	}
+	comp.owner = o
+	o.items = append(o.items, comp.items...)
+	for _, v := range comp.registry {
+		imp.addRegistry(o, comp.permanent, v)
+	}
+}
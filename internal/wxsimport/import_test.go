@@ -0,0 +1,277 @@
+package wxsimport
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/parser"
+)
+
+// importFixture imports a .wxs file from testdata and checks that the
+// written .msis parses back.
+func importFixture(t *testing.T, name string) (*Result, string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Import(data, "product")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	var b bytes.Buffer
+	if err := parser.Write(&b, res.Setup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseBytes(b.Bytes()); err != nil {
+		t.Fatalf("imported .msis does not parse: %v\n%s", err, b.String())
+	}
+	return res, b.String()
+}
+
+func variable(setup *ir.Setup, name string) string {
+	for _, s := range setup.Sets {
+		if s.Name == name {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+func TestImportWix3(t *testing.T) {
+	res, msis := importFixture(t, "product-v3.wxs")
+	setup := res.Setup
+
+	vars := map[string]string{
+		"PRODUCTVERSION":     "2.1.0",
+		"PRODUCT_NAME":       "Acme App",
+		"PRODUCT_VERSION":    "{{PRODUCTVERSION}}",
+		"MANUFACTURER":       "Acme Corp",
+		"UPGRADE_CODE":       "{6F3C1E2A-9B4D-4C8E-A1F2-3D5E7B9C0A14}",
+		"INSTALLDIR":         `Acme\App`,
+		"APPDATADIR":         `Acme App\Logs`,
+		"INSTALL_DIR_DIALOG": "true",
+		"LICENSE_FILE":       `res\license.rtf`,
+		"SETUP_ICON":         `res\app.ico`,
+		"ADD_TO_PATH":        "true",
+		"PLATFORM":           "",
+	}
+	for name, want := range vars {
+		if got := variable(setup, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if setup.Silent {
+		t.Error("a package with UI imported as silent")
+	}
+
+	if len(setup.Features) != 1 {
+		t.Fatalf("expected 1 feature, got %d", len(setup.Features))
+	}
+	main := setup.Features[0]
+	if main.Name != "Acme App" || main.Allowed || !main.Enabled {
+		t.Errorf("unexpected main feature %+v", main)
+	}
+	if len(main.SubFeatures) != 1 || main.SubFeatures[0].Level != "2" {
+		t.Fatalf("expected a Documentation sub-feature of level 2, got %+v", main.SubFeatures)
+	}
+
+	want, err := os.ReadFile(filepath.Join("testdata", "product-v3.msis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Git may check the golden file out with CRLF line endings
+	want = bytes.ReplaceAll(want, []byte("\r\n"), []byte("\n"))
+	if msis != string(want) {
+		t.Errorf("imported .msis:\n%s\nwant:\n%s", msis, want)
+	}
+
+	if len(res.RegFiles) != 1 || res.RegFiles[0].Name != "product.reg" {
+		t.Fatalf("expected product.reg, got %+v", res.RegFiles)
+	}
+	wantReg := "Windows Registry Editor Version 5.00\r\n\r\n" +
+		"[HKEY_LOCAL_MACHINE\\Software\\Acme\\App]\r\n" +
+		"\"InstallPath\"=\"[INSTALLDIR]\"\r\n" +
+		"\"Level\"=dword:00000003\r\n" +
+		"\"DataPath\"=hex(2):25,00,50,00,72,00,6f,00,67,00,72,00,61,00,6d,00,44,00,61,00,74,00,61,00,25,00,5c,00,41,00,63,00,6d,00,65,00,00,00\r\n\r\n" +
+		"[HKEY_CURRENT_USER\\Software\\Acme\\App]\r\n" +
+		"\"StartMenu\"=dword:00000001\r\n"
+	if reg := string(res.RegFiles[0].Data); reg != wantReg {
+		t.Errorf("product.reg:\n%q\nwant:\n%q", reg, wantReg)
+	}
+
+	// Account=LocalSystem is the msis default and is not reported
+	findings := []Finding{
+		{72, `Shortcut Id="StartShortcut"`, "is in a subfolder of ProgramMenuDir; msis creates shortcuts directly in STARTMENU"},
+		{72, `Shortcut Id="StartShortcut"`, "has WorkingDirectory, which msis shortcuts do not support"},
+		{96, `CustomAction Id="LaunchApp"`, "not translated"},
+		{97, "InstallExecuteSequence", "not translated"},
+	}
+	if !slices.Equal(res.Findings, findings) {
+		t.Errorf("findings %q, want %q", res.Findings, findings)
+	}
+	if !strings.Contains(res.Report("product.wxs"), "product.wxs:line 96: <CustomAction") {
+		t.Errorf("findings must carry the source line:\n%s", res.Report("product.wxs"))
+	}
+}
+
+func TestImportWix4(t *testing.T) {
+	res, msis := importFixture(t, "product-v4.wxs")
+	setup := res.Setup
+
+	if !setup.Silent {
+		t.Error("a package without UI must be imported as silent")
+	}
+	if got := variable(setup, "PLATFORM"); got != "x86" {
+		t.Errorf("ProgramFilesFolder implies x86, got PLATFORM=%q", got)
+	}
+	if got := variable(setup, "INSTALLDIR"); got != "Tool" {
+		t.Errorf("INSTALLDIR = %q, want Tool", got)
+	}
+
+	// Component groups expand in order; inline components follow
+	want := `  <feature name="Main">
+    <files source="out\tool.exe" target="[INSTALLDIR]"/>
+    <registry file="product.reg"/>
+    <files source="out\orphan.txt" target="[INSTALLDIR]"/>
+    <files source="out\plugins\a.dll" target="[INSTALLDIR]plugins"/>
+  </feature>`
+	if !strings.Contains(msis, want) {
+		t.Errorf("imported .msis lacks\n%s\ngot:\n%s", want, msis)
+	}
+	if len(setup.Items) != 1 || setup.Items[0].(ir.Files).Source != `out\extra.txt` {
+		t.Errorf("the unreferenced component belongs to <setup>, got %+v", setup.Items)
+	}
+	if reg := string(res.RegFiles[0].Data); !strings.Contains(reg, `"Paths"=hex(7):61,00,00,00,62,00,00,00,00,00`) {
+		t.Errorf("multiString value not translated:\n%s", reg)
+	}
+	if len(res.Findings) != 1 || !strings.Contains(res.Findings[0].Message, "not part of a feature") {
+		t.Errorf("unexpected findings %v", res.Findings)
+	}
+}
+
+func TestImportFindings(t *testing.T) {
+	tests := []struct {
+		name string
+		wxs  string
+		want string
+	}{
+		{
+			"preprocessor condition",
+			`<?if $(var.Platform) = x64 ?><?endif?>`,
+			"<?if> was not evaluated",
+		},
+		{
+			"environment reference",
+			`<Package Name="$(env.NAME)" Version="1.0" Manufacturer="A" UpgradeCode="{0B8E4C2D-7A1F-4E3B-9C5D-2F6A8E1B3D70}"/>`,
+			"references $(env.NAME)",
+		},
+		{
+			"unknown directory",
+			`<Package><Directory Id="Elsewhere" Name="x"><Component Id="C"><File Source="a.txt"/></Component></Directory><Feature Id="F"><ComponentRef Id="C"/></Feature></Package>`,
+			"not below a standard directory",
+		},
+		{
+			"shared component",
+			`<Package><StandardDirectory Id="ProgramFiles64Folder"><Directory Id="INSTALLFOLDER" Name="A"><Component Id="C"><File Source="a.txt"/></Component></Directory></StandardDirectory>
+			<Feature Id="F"><ComponentRef Id="C"/></Feature><Feature Id="G"><ComponentRef Id="C"/></Feature></Package>`,
+			"is part of features F and G",
+		},
+		{
+			"unknown component",
+			`<Package><Feature Id="F"><ComponentRef Id="Missing"/></Feature></Package>`,
+			"refers to an unknown component",
+		},
+		{
+			"partial path",
+			`<Package><StandardDirectory Id="ProgramFiles64Folder"><Directory Id="INSTALLFOLDER" Name="A"><Component Id="C">
+			<File Source="a.exe"/><Environment Id="P" Name="PATH" Value="[INSTALLFOLDER]bin" Part="last" System="yes"/></Component></Directory></StandardDirectory>
+			<Feature Id="F"><ComponentRef Id="C"/></Feature></Package>`,
+			"adds to the last of PATH",
+		},
+		{
+			"feature display order",
+			`<Package><Feature Id="F" Display="2"/></Package>`,
+			"has a Display order",
+		},
+		{
+			"feature level",
+			`<Package><Feature Id="F" Level="40000"/></Package>`,
+			`has Level "40000", which is not a number`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wxs := `<Wix xmlns="http://wixtoolset.org/schemas/v4/wxs">` + tt.wxs + `</Wix>`
+			res, err := Import([]byte(wxs), "product")
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			report := res.Report("product.wxs")
+			if !strings.Contains(report, tt.want) {
+				t.Errorf("report lacks %q:\n%s", tt.want, report)
+			}
+		})
+	}
+}
+
+func TestImportFeaturePresentation(t *testing.T) {
+	wxs := `<Wix xmlns="http://wixtoolset.org/schemas/v4/wxs"><Package>
+  <Feature Id="F" Title="Main" Description="Main files" Display="expand" Level="0"/>
+</Package></Wix>`
+	res, err := Import([]byte(wxs), "product")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	f := res.Setup.Features[0]
+	if f.Description != "Main files" || f.Display != "expand" || f.Level != "0" {
+		t.Errorf("unexpected feature %+v", f)
+	}
+	if len(res.Findings) != 0 {
+		t.Errorf("unexpected findings %v", res.Findings)
+	}
+}
+
+func TestImportRejectsOtherXML(t *testing.T) {
+	if _, err := Import([]byte(`<setup/>`), "product"); err == nil || !strings.Contains(err.Error(), "not WiX source") {
+		t.Errorf("expected a not-WiX error, got %v", err)
+	}
+	if _, err := Import([]byte(`<Wix>`), "product"); err == nil {
+		t.Error("expected a syntax error")
+	}
+}
+
+func TestRegistryFilePerFeature(t *testing.T) {
+	wxs := `<Wix><Package>
+  <StandardDirectory Id="ProgramFiles64Folder"><Directory Id="INSTALLFOLDER" Name="A">
+    <Component Id="A"><RegistryValue Root="HKLM" Key="Software\A" Name="x" Value="1"/></Component>
+    <Component Id="B" Permanent="yes"><RegistryValue Root="HKLM" Key="Software\A" Name="y" Value="say &quot;hi&quot;"/></Component>
+    <Component Id="C"><RegistryKey Root="HKCU" Key="Software\C" ForceDeleteOnUninstall="yes"/></Component>
+  </Directory></StandardDirectory>
+  <Feature Id="Main"><ComponentRef Id="A"/><ComponentRef Id="B"/></Feature>
+  <Feature Id="Extra"><ComponentRef Id="C"/></Feature>
+</Package></Wix>`
+	res, err := Import([]byte(wxs), "product")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range res.RegFiles {
+		names = append(names, f.Name)
+	}
+	if got := strings.Join(names, " "); got != "product.reg product-Main-permanent.reg product-Extra.reg" {
+		t.Errorf("registry files: %s", got)
+	}
+	if got := string(res.RegFiles[1].Data); !strings.Contains(got, `"y"="say \"hi\""`) {
+		t.Errorf("string value not escaped:\n%s", got)
+	}
+	extra := res.Setup.Features[1].Items
+	if len(extra) != 2 || extra[0].(ir.RemoveOnUninstall).Registry != `HKCU\Software\C` {
+		t.Errorf("ForceDeleteOnUninstall must become <remove-on-uninstall>, got %+v", extra)
+	}
+}
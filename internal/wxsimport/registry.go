@@ -0,0 +1,225 @@
+package wxsimport
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gersonkurz/msis/internal/ir"
+)
+
+// regValue is a registry value, or an empty key when name and data are
+// both empty.
+type regValue struct {
+	key   string // Full key, e.g. HKEY_LOCAL_MACHINE\Software\Acme
+	name  string // "@" for the default value
+	data  string // .reg syntax, e.g. "text" or dword:00000001
+	empty bool   // Key without values
+}
+
+// regGroup is a generated .reg file: the registry values of a feature's
+// components that share the Permanent setting.
+type regGroup struct {
+	name   string
+	values []regValue
+}
+
+// registryRoots maps WiX registry roots to .reg hive names.
+var registryRoots = map[string]string{
+	"HKLM": "HKEY_LOCAL_MACHINE",
+	"HKCU": "HKEY_CURRENT_USER",
+	"HKCR": "HKEY_CLASSES_ROOT",
+	"HKU":  "HKEY_USERS",
+	"HKMU": "HKEY_LOCAL_MACHINE",
+}
+
+// registry translates a <RegistryKey> or <RegistryValue>; root and key are
+// inherited from an enclosing <RegistryKey>.
+func (imp *importer) registry(comp *component, e *element, root, key string) {
+	if r := e.attr("Root"); r != "" {
+		root = r
+	}
+	if k := e.attr("Key"); k != "" {
+		key = joinKey(key, k)
+	}
+	hive, ok := registryRoots[root]
+	if !ok {
+		imp.report(e.line, describe(e), fmt.Sprintf("has unknown root %q; it was not translated", root))
+		return
+	}
+	if root == "HKMU" {
+		imp.report(e.line, describe(e), "writes to HKMU, which msis translates to HKLM for per-machine packages")
+	}
+	fullKey := hive + `\` + key
+
+	if e.name == "RegistryKey" {
+		if e.attr("ForceDeleteOnUninstall") == "yes" || e.attr("Action") == "createAndRemoveOnUninstall" {
+			comp.items = append(comp.items, ir.RemoveOnUninstall{Registry: root + `\` + key})
+		}
+		if len(e.children) == 0 {
+			comp.registry = append(comp.registry, regValue{key: fullKey, empty: true})
+		}
+		for _, c := range e.children {
+			switch c.name {
+			case "RegistryKey", "RegistryValue":
+				imp.registry(comp, c, root, key)
+			default:
+				imp.notTranslated(c)
+			}
+		}
+		return
+	}
+
+	if action := e.attr("Action"); action == "append" || action == "prepend" {
+		imp.report(e.line, describe(e), fmt.Sprintf("has Action %s; msis writes the whole value", action))
+	}
+	data, err := imp.regData(e)
+	if err != nil {
+		imp.report(e.line, describe(e), err.Error()+"; it was not translated")
+		return
+	}
+	name := `"` + regEscape(e.attr("Name")) + `"`
+	if e.attr("Name") == "" {
+		name = "@"
+	}
+	comp.registry = append(comp.registry, regValue{key: fullKey, name: name, data: data})
+}
+
+// regData returns the value of a <RegistryValue> in .reg syntax.
+func (imp *importer) regData(e *element) (string, error) {
+	value := imp.formatted(e.attr("Value"))
+	switch typ := e.attr("Type"); typ {
+	case "", "string":
+		return `"` + regEscape(value) + `"`, nil
+	case "integer":
+		n, err := strconv.ParseInt(strings.TrimPrefix(value, "#"), 0, 64)
+		if err != nil || n < -1<<31 || n >= 1<<32 {
+			return "", fmt.Errorf("has integer value %q, which is not a number", value)
+		}
+		return fmt.Sprintf("dword:%08x", uint32(n)), nil
+	case "expandable":
+		return "hex(2):" + hexBytes(utf16Bytes(value)), nil
+	case "multiString":
+		var b []byte
+		if value != "" {
+			b = append(b, utf16Bytes(value)...)
+		}
+		for _, c := range e.children {
+			if c.name == "MultiStringValue" {
+				text := c.attr("Value")
+				if text == "" {
+					text = c.text
+				}
+				b = append(b, utf16Bytes(imp.formatted(strings.TrimSpace(text)))...)
+			}
+		}
+		return "hex(7):" + hexBytes(append(b, 0, 0)), nil
+	case "binary":
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return "", fmt.Errorf("has binary value %q, which is not hexadecimal", value)
+		}
+		return "hex:" + hexBytes(b), nil
+	default:
+		return "", fmt.Errorf("has unknown type %q", typ)
+	}
+}
+
+// addRegistry adds a registry value to the .reg file of a feature,
+// creating the file and its <registry> item on first use.
+func (imp *importer) addRegistry(o *owner, permanent bool, v regValue) {
+	if o.registry == nil {
+		o.registry = make(map[bool]*regGroup)
+	}
+	g, ok := o.registry[permanent]
+	if !ok {
+		g = &regGroup{name: imp.regFileName(o.label, permanent)}
+		o.registry[permanent] = g
+		imp.regGroups = append(imp.regGroups, g)
+		o.items = append(o.items, ir.Registry{File: g.name, Permanent: permanent})
+	}
+	g.values = append(g.values, v)
+}
+
+// regFileName names a .reg file after the .msis file; the files of further
+// features get the feature ID as suffix.
+func (imp *importer) regFileName(label string, permanent bool) string {
+	if len(imp.regGroups) == 0 {
+		return imp.base + ".reg"
+	}
+	suffix := "-" + label
+	if permanent {
+		suffix += "-permanent"
+	}
+	name := imp.base + suffix + ".reg"
+	for n := 2; imp.hasRegFile(name); n++ {
+		name = fmt.Sprintf("%s%s-%d.reg", imp.base, suffix, n)
+	}
+	return name
+}
+
+func (imp *importer) hasRegFile(name string) bool {
+	for _, g := range imp.regGroups {
+		if strings.EqualFold(g.name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRegistry renders the .reg files, with the values of each key
+// together in order of first appearance.
+func (imp *importer) writeRegistry() {
+	for _, g := range imp.regGroups {
+		var keys []string
+		values := make(map[string][]regValue)
+		for _, v := range g.values {
+			k := strings.ToLower(v.key)
+			if _, ok := values[k]; !ok {
+				keys = append(keys, k)
+			}
+			values[k] = append(values[k], v)
+		}
+		var b strings.Builder
+		b.WriteString("Windows Registry Editor Version 5.00\r\n")
+		for _, k := range keys {
+			fmt.Fprintf(&b, "\r\n[%s]\r\n", values[k][0].key)
+			for _, v := range values[k] {
+				if !v.empty {
+					fmt.Fprintf(&b, "%s=%s\r\n", v.name, v.data)
+				}
+			}
+		}
+		imp.res.RegFiles = append(imp.res.RegFiles, RegFile{Name: g.name, Data: []byte(b.String())})
+	}
+}
+
+func joinKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return strings.TrimSuffix(parent, `\`) + `\` + strings.TrimPrefix(key, `\`)
+}
+
+func regEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// utf16Bytes returns a string as null-terminated UTF-16LE.
+func utf16Bytes(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return append(b, 0, 0)
+}
+
+func hexBytes(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02x", c)
+	}
+	return strings.Join(parts, ",")
+}
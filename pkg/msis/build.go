@@ -0,0 +1,209 @@
+package msis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/bundle"
+	"github.com/gersonkurz/msis/internal/prereqcache"
+	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wix"
+)
+
+// BuildResult lists the packages WiX built.
+type BuildResult struct {
+	Outputs    []string         `json:"outputs"` // The MSI, merge module or library, then the bundle .exe of an auto-bundle; or the bundle .exe
+	Transforms []BuiltTransform `json:"transforms,omitempty"`
+	Languages  []string         `json:"languages,omitempty"` // Cultures of a multi-language MSI, the package language first
+}
+
+// BuiltTransform is an .mst transform of the MSI.
+type BuiltTransform struct {
+	Name    string `json:"name"`
+	File    string `json:"file"`
+	Command string `json:"command"` // msiexec command line that installs the MSI with the transform
+}
+
+// ErrWixNotFound is returned by Build when the WiX CLI is not installed.
+var ErrWixNotFound = errors.New("wix CLI not found in PATH; install WiX Toolset 6")
+
+// Build runs WiX on a rendered project. An MSI with <requires> is wrapped
+// in a bundle with its prerequisites unless Options.Standalone is set.
+// Prerequisites missing from the cache are downloaded first.
+func Build(ctx context.Context, r *Rendered) (*BuildResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !wix.IsWixAvailable() {
+		return nil, ErrWixNotFound
+	}
+	g := r.Generated
+	p := g.Project
+	if p.Bundle {
+		return buildBundle(ctx, r)
+	}
+
+	builder := wix.NewBuilder(p.vars, r.WxsFile, p.opts.TemplateFolder, p.opts.CustomTemplates, p.workDir(), p.opts.RetainWxs)
+	builder.Stdout, builder.Log = p.opts.Output, p.opts.logCommand
+	builder.Sources = g.output.Sources
+	kind := outputKinds[p.OutputType]
+	if err := builder.Build(ctx); err != nil {
+		return nil, fmt.Errorf("building %s: %w", kind, err)
+	}
+	p.opts.report(Built, kind, r.OutputFile)
+	res := &BuildResult{Outputs: []string{r.OutputFile}}
+
+	for _, t := range r.Transforms {
+		built, err := buildTransform(ctx, r, t)
+		if err != nil {
+			return nil, err
+		}
+		res.Transforms = append(res.Transforms, built)
+	}
+	// The site transforms are made from the MSI as WiX built it, without
+	// the language transforms
+	if len(r.Languages) > 0 {
+		if err := buildLanguages(ctx, r); err != nil {
+			return nil, err
+		}
+		res.Languages = p.Languages
+	}
+
+	if g.AutoBundle {
+		exeFile, err := buildAutoBundle(ctx, p, r.OutputFile)
+		if err != nil {
+			return nil, err
+		}
+		res.Outputs = append(res.Outputs, exeFile)
+	}
+	return res, nil
+}
+
+// buildTransform builds the MSI of a transform, then the .mst from the
+// standard MSI to it. The MSI of the transform is removed again.
+func buildTransform(ctx context.Context, r *Rendered, t RenderedTransform) (BuiltTransform, error) {
+	p := r.Generated.Project
+	builder := wix.NewBuilder(p.vars, t.WxsFile, p.opts.TemplateFolder, p.opts.CustomTemplates, p.workDir(), p.opts.RetainWxs)
+	builder.Stdout, builder.Log = p.opts.Output, p.opts.logCommand
+	builder.Sources = r.Generated.output.Sources
+	builder.OutputFile = strings.TrimSuffix(t.File, filepath.Ext(t.File)) + ".msi"
+	if err := builder.Build(ctx); err != nil {
+		return BuiltTransform{}, fmt.Errorf("building MSI of transform %s: %w", t.Name, err)
+	}
+	defer os.Remove(builder.OutputFile)
+	if err := builder.BuildTransform(ctx, r.OutputFile, builder.OutputFile, t.File, wix.TransformDefault); err != nil {
+		return BuiltTransform{}, fmt.Errorf("building transform %s: %w", t.Name, err)
+	}
+	p.opts.report(Built, "transform", t.File)
+	return BuiltTransform{Name: t.Name, File: t.File, Command: installCommand(r.OutputFile, t.File)}, nil
+}
+
+// installCommand returns the msiexec command line that installs an MSI with
+// a transform, run in the folder of both.
+func installCommand(msiFile, transformFile string) string {
+	quote := func(name string) string {
+		if strings.Contains(name, " ") {
+			return `"` + name + `"`
+		}
+		return name
+	}
+	return fmt.Sprintf("msiexec /i %s TRANSFORMS=%s", quote(filepath.Base(msiFile)), quote(filepath.Base(transformFile)))
+}
+
+// outputKinds names the packages of the output types.
+var outputKinds = map[string]string{
+	variables.OutputMSI:    "MSI",
+	variables.OutputMSM:    "merge module",
+	variables.OutputWixlib: "WiX library",
+}
+
+// prerequisiteCache returns the prerequisite cache, or nil with a warning
+// if it cannot be created; prerequisites are then expected in the local
+// prerequisites folder.
+func (p *Project) prerequisiteCache() *prereqcache.Cache {
+	cache, err := prereqcache.NewCache()
+	if err != nil {
+		p.warn(fmt.Sprintf("could not initialize prerequisite cache: %v; prerequisites will be expected in local 'prerequisites' folder", err))
+		return nil
+	}
+	return cache
+}
+
+// buildBundle downloads the prerequisites of a bundle, renders its chain
+// with the cached files and builds it.
+func buildBundle(ctx context.Context, r *Rendered) (*BuildResult, error) {
+	p := r.Generated.Project
+	if len(p.setup.Bundle.Prerequisites) > 0 {
+		if cache := p.prerequisiteCache(); cache != nil {
+			g, err := generateBundle(p, func(gen *bundle.Generator) error {
+				gen.SetCache(cache)
+				p.opts.report(Step, "Checking prerequisites...", "")
+				if err := gen.EnsurePrerequisites(ctx, p.opts.reportDetail); err != nil {
+					return fmt.Errorf("ensuring prerequisites: %w", err)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := r.writeBundle(g.chain); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	builder := wix.NewBundleBuilder(p.vars, r.WxsFile, p.opts.TemplateFolder, p.opts.CustomTemplates, p.opts.RetainWxs)
+	builder.Stdout, builder.Log = p.opts.Output, p.opts.logCommand
+	if err := builder.Build(ctx); err != nil {
+		return nil, fmt.Errorf("building bundle: %w", err)
+	}
+	p.opts.report(Built, "bundle", builder.OutputFile)
+	return &BuildResult{Outputs: []string{builder.OutputFile}}, nil
+}
+
+// buildAutoBundle wraps a built MSI in a bundle with the prerequisites of
+// its <requires> elements and returns the bundle .exe.
+func buildAutoBundle(ctx context.Context, p *Project, msiPath string) (string, error) {
+	p.opts.report(Step, "Generating auto-bundle wrapper...", "")
+
+	// Convert and validate requirements
+	prereqs, err := bundle.RequirementsToPrerequisites(p.setup.Requires)
+	if err != nil {
+		return "", fmt.Errorf("invalid requirement: %w", err)
+	}
+
+	gen := bundle.NewAutoBundleGenerator(p.vars, p.workDir(), msiPath, prereqs)
+	if cache := p.prerequisiteCache(); cache != nil {
+		gen.SetCache(cache)
+		p.opts.report(Step, "Checking prerequisites...", "")
+		if err := gen.EnsurePrerequisites(ctx, p.opts.reportDetail); err != nil {
+			return "", fmt.Errorf("ensuring prerequisites: %w", err)
+		}
+	}
+
+	chain, err := gen.Generate()
+	if err != nil {
+		return "", fmt.Errorf("generating auto-bundle: %w", err)
+	}
+	p.opts.report(Step, fmt.Sprintf("Auto-bundle: %d prerequisites + MSI", len(prereqs)), "")
+
+	r := &Rendered{
+		Generated: &Generated{Project: p, chain: chain},
+		WxsFile:   strings.TrimSuffix(msiPath, filepath.Ext(msiPath)) + "-bundle.wxs",
+	}
+	if err := r.writeBundle(chain); err != nil {
+		return "", err
+	}
+
+	builder := wix.NewBundleBuilder(p.vars, r.WxsFile, p.opts.TemplateFolder, p.opts.CustomTemplates, p.opts.RetainWxs)
+	builder.Stdout, builder.Log = p.opts.Output, p.opts.logCommand
+	if err := builder.Build(ctx); err != nil {
+		return "", fmt.Errorf("building bundle: %w", err)
+	}
+	p.opts.report(Built, "bundle", builder.OutputFile)
+	return builder.OutputFile, nil
+}
@@ -0,0 +1,52 @@
+package msis
+
+import (
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/parser"
+)
+
+// The types of a custom item element. An ItemHandler describes the element,
+// parses it into an Item and adds the Item to the install model through the
+// generation Context.
+type (
+	Element     = parser.Element
+	Attribute   = parser.Attribute
+	AttrType    = parser.AttrType
+	ItemSource  = parser.ItemSource
+	Item        = ir.Item
+	Pos         = ir.Pos
+	Context     = generator.Context
+	Component   = generator.Component
+	Slot        = generator.Slot
+	ItemHandler = generator.ItemHandler
+)
+
+// Attribute types.
+const (
+	AttrString = parser.String // Free text
+	AttrBool   = parser.Bool   // msis boolean: true/false, yes/no, on/off, 1/0
+	AttrEnum   = parser.Enum   // One of Values
+	AttrPath   = parser.Path   // File or folder, relative to the .msis file
+)
+
+// Template slots for Context.AddXML.
+const (
+	SlotPackage                = generator.SlotPackage                // Children of <Package>
+	SlotUI                     = generator.SlotUI                     // Children of a <UI> element
+	SlotInstallExecuteSequence = generator.SlotInstallExecuteSequence // Children of <InstallExecuteSequence>
+)
+
+// FeatureSlot returns the slot for children of the <Feature> of a feature,
+// by name or by name path like "Main/Tools".
+func FeatureSlot(name string) Slot {
+	return generator.FeatureSlot(name)
+}
+
+// RegisterItem adds a custom item element, such as <our-license-key>, that
+// may then appear in <setup> and <feature> like the built-in ones. Register
+// items once, before the first Parse; RegisterItem is not safe for
+// concurrent use and fails if the element already exists.
+func RegisterItem(h ItemHandler) error {
+	return generator.RegisterItem(h)
+}
@@ -0,0 +1,112 @@
+package msis
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gersonkurz/msis/internal/msi"
+	"github.com/gersonkurz/msis/internal/template"
+	"github.com/gersonkurz/msis/internal/variables"
+	"github.com/gersonkurz/msis/internal/wix"
+)
+
+// checkLanguages checks the cultures of LANGUAGES before anything is built:
+// each needs a language ID of its own and a .wxl in the template folder.
+func (p *Project) checkLanguages() error {
+	if len(p.Languages) == 0 {
+		return nil
+	}
+	if p.OutputType != variables.OutputMSI {
+		return fmt.Errorf("LANGUAGES needs OUTPUT_TYPE msi; merge modules and libraries take the language of their package")
+	}
+	var unknown, missing []string
+	cultures := make(map[string]string) // LCID -> culture
+	for _, culture := range p.Languages {
+		lcid, ok := template.LCID(culture)
+		if !ok {
+			unknown = append(unknown, culture)
+			continue
+		}
+		if other, ok := cultures[lcid]; ok {
+			return fmt.Errorf("LANGUAGES: %s and %s are both language %s", other, culture, lcid)
+		}
+		cultures[lcid] = culture
+		if wix.LocalizationFile(p.opts.TemplateFolder, culture) == "" {
+			missing = append(missing, culture)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("LANGUAGES: unknown culture %s", strings.Join(unknown, ", "))
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("LANGUAGES: no localization for %s in %s", strings.Join(missing, ", "), filepath.Join(p.opts.TemplateFolder, "wixlib"))
+	}
+	// Transforms and languages share the file names
+	for _, t := range p.setup.Transforms {
+		for _, culture := range p.Languages[1:] {
+			if strings.EqualFold(t.Name, culture) {
+				return fmt.Errorf("<transform> %s has the name of a culture of LANGUAGES", t.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// renderLanguage writes the WiX source of the MSI in a further culture of
+// LANGUAGES.
+func (r *Rendered) renderLanguage(culture string) error {
+	p := r.Generated.Project
+	vars := maps.Clone(p.vars)
+	vars.Set("LANGUAGE", culture)
+	wxsContent, err := renderWxs(p, vars, r.Generated.output)
+	if err != nil {
+		return fmt.Errorf("language %s: %w", culture, err)
+	}
+
+	lcid, _ := template.LCID(culture)
+	rl := RenderedLanguage{
+		Culture: culture,
+		LCID:    lcid,
+		WxsFile: strings.TrimSuffix(r.WxsFile, filepath.Ext(r.WxsFile)) + "-" + culture + ".wxs",
+		File:    strings.TrimSuffix(r.OutputFile, filepath.Ext(r.OutputFile)) + "-" + culture + ".mst",
+	}
+	if err := os.WriteFile(rl.WxsFile, []byte(wxsContent), 0644); err != nil {
+		return fmt.Errorf("writing WXS file of language %s: %w", culture, err)
+	}
+	p.opts.report(Written, "WiX source of language "+culture, rl.WxsFile)
+	r.Languages = append(r.Languages, rl)
+	return nil
+}
+
+// buildLanguages builds the MSI of each further culture and the language
+// transform from the MSI to it, then embeds the transforms in the MSI. The
+// MSIs and .mst files of the cultures are removed again.
+func buildLanguages(ctx context.Context, r *Rendered) error {
+	p := r.Generated.Project
+	var transforms []msi.LanguageTransform
+	for _, l := range r.Languages {
+		builder := wix.NewBuilder(p.vars, l.WxsFile, p.opts.TemplateFolder, p.opts.CustomTemplates, p.workDir(), p.opts.RetainWxs)
+		builder.Stdout, builder.Log = p.opts.Output, p.opts.logCommand
+		builder.Sources = r.Generated.output.Sources
+		builder.Language = l.Culture
+		builder.OutputFile = strings.TrimSuffix(l.File, filepath.Ext(l.File)) + ".msi"
+		if err := builder.Build(ctx); err != nil {
+			return fmt.Errorf("building MSI of language %s: %w", l.Culture, err)
+		}
+		defer os.Remove(builder.OutputFile)
+		if err := builder.BuildTransform(ctx, r.OutputFile, builder.OutputFile, l.File, wix.TransformLanguage); err != nil {
+			return fmt.Errorf("building language transform %s: %w", l.Culture, err)
+		}
+		defer os.Remove(l.File)
+		transforms = append(transforms, msi.LanguageTransform{LCID: l.LCID, File: l.File})
+	}
+	if err := msi.EmbedLanguageTransforms(r.OutputFile, transforms); err != nil {
+		return fmt.Errorf("embedding language transforms: %w", err)
+	}
+	p.opts.report(Step, "Embedded language transforms: "+strings.Join(p.Languages[1:], ", "), "")
+	return nil
+}
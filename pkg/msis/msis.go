@@ -0,0 +1,112 @@
+// Package msis is the Go API of msis: it turns .msis files into WiX
+// sources and builds them into MSI packages and bundles.
+//
+// A build runs in four steps; each returns a structured result the next one
+// takes, so a caller can stop after any of them:
+//
+//	project, err := msis.Parse(ctx, "setup.msis", msis.Options{})
+//	generated, err := msis.Generate(ctx, project)
+//	rendered, err := msis.Render(ctx, generated) // writes the .wxs
+//	built, err := msis.Build(ctx, rendered)      // runs WiX
+//
+// Nothing is printed. The steps of Generate, Render and Build, their
+// warnings and the files they write are reported to Options.Progress, and
+// the output of WiX goes to Options.Output. Cancelling ctx kills a running
+// WiX process and aborts prerequisite downloads.
+package msis
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Options configure a build. The zero value uses the installed templates.
+type Options struct {
+	TemplateFolder  string            // Base templates; default: DefaultTemplateFolder()
+	CustomTemplates string            // Overlay of the base templates; default: DefaultCustomTemplates()
+	Template        string            // Template file replacing the standard MSI template
+	Variables       map[string]string // Overrides of <set> variables
+	Standalone      bool              // Check <requires> by launch conditions instead of bundling them
+	RetainWxs       bool              // Keep the .wxs files after Build
+	Validate        bool              // Run the ICE checks in Generate
+	Baseline        string            // Manifest of the previous release to check component rules against
+	SaveBaseline    string            // Where Generate saves the component manifest for the next release
+	Manifest        bool              // Write a build manifest and CycloneDX SBOM next to the MSI in Render
+	Progress        func(Event)       // Receives progress; may be nil
+	Output          io.Writer         // Receives the output of the WiX CLI; nil discards it
+}
+
+// EventKind classifies progress events.
+type EventKind int
+
+const (
+	Step    EventKind = iota // A step of the build, e.g. generating the auto-bundle
+	Detail                   // Progress within a step, e.g. a prerequisite download
+	Warning                  // A problem that does not stop the build
+	Written                  // A file was written to Path
+	Command                  // A WiX command line is run
+	Built                    // WiX built the package at Path
+)
+
+// Event is a progress report.
+type Event struct {
+	Kind    EventKind
+	Message string
+	Path    string // File of Written and Built events
+}
+
+func (o *Options) report(kind EventKind, message, path string) {
+	if o.Progress != nil {
+		o.Progress(Event{Kind: kind, Message: message, Path: path})
+	}
+}
+
+// reportDetail and logCommand adapt the progress callbacks of the internal
+// packages.
+func (o *Options) reportDetail(message string) {
+	o.report(Detail, message, "")
+}
+
+func (o *Options) logCommand(commandLine string) {
+	o.report(Command, commandLine, "")
+}
+
+// DefaultTemplateFolder returns the folder of the standard templates.
+// Search order:
+//  1. %LOCALAPPDATA%\msis\templates (installed location)
+//  2. Executable directory\templates (portable/dev)
+//  3. Current directory\templates (fallback)
+func DefaultTemplateFolder() string {
+	// 1. Check installed location: %LOCALAPPDATA%\msis\templates
+	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+		installedPath := filepath.Join(localAppData, "msis", "templates")
+		if _, err := os.Stat(installedPath); err == nil {
+			return installedPath
+		}
+	}
+
+	// 2. Check executable directory
+	if exePath, err := os.Executable(); err == nil {
+		exeDir := filepath.Dir(exePath)
+		exeTemplates := filepath.Join(exeDir, "templates")
+		if _, err := os.Stat(exeTemplates); err == nil {
+			return exeTemplates
+		}
+	}
+
+	// 3. Fallback to relative path
+	return "templates"
+}
+
+// DefaultCustomTemplates returns the default custom templates folder, or ""
+// if there is none.
+func DefaultCustomTemplates() string {
+	if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+		customPath := filepath.Join(localAppData, "msis", "custom")
+		if _, err := os.Stat(customPath); err == nil {
+			return customPath
+		}
+	}
+	return ""
+}
@@ -0,0 +1,374 @@
+package msis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSetup = `<setup>
+  <set name="PRODUCT_NAME" value="App"/>
+  <set name="PRODUCT_VERSION" value="1.0.0"/>
+  <set name="UPGRADE_CODE" value="{11111111-2222-3333-4444-555555555555}"/>
+  <feature name="Main">
+    <files source="bin" target="[INSTALLDIR]"/>
+  </feature>
+</setup>`
+
+// writeProject writes an .msis file with a bin folder and returns its path.
+func writeProject(t *testing.T, source string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin", "app.exe"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "setup.msis")
+	if err := os.WriteFile(filename, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func testOptions(events *[]Event) Options {
+	return Options{
+		TemplateFolder: filepath.Join("..", "..", "templates"),
+		Progress:       func(e Event) { *events = append(*events, e) },
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	filename := writeProject(t, testSetup)
+	var events []Event
+	opts := testOptions(&events)
+	opts.Validate = true
+	opts.Manifest = true
+	ctx := context.Background()
+
+	p, err := Parse(ctx, filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ProductName != "App" || p.ProductVersion != "1.0.0" || p.Bundle || p.Features != 1 {
+		t.Errorf("unexpected project %+v", p)
+	}
+
+	g, err := Generate(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Directories == 0 || g.Components == 0 {
+		t.Errorf("expected directories and components, got %+v", g)
+	}
+	if g.AutoBundle {
+		t.Error("a setup without <requires> is not auto-bundled")
+	}
+
+	r, err := Render(ctx, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSuffix(filename, ".msis") + ".wxs"; r.WxsFile != want {
+		t.Errorf("WxsFile = %s, want %s", r.WxsFile, want)
+	}
+	if want := strings.TrimSuffix(filename, ".msis") + ".msi"; r.OutputFile != want {
+		t.Errorf("OutputFile = %s, want %s", r.OutputFile, want)
+	}
+	wxs, err := os.ReadFile(r.WxsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(wxs), "app.exe") {
+		t.Errorf("rendered WXS lacks the installed file:\n%s", wxs)
+	}
+
+	var written []string
+	for _, e := range events {
+		if e.Kind == Written {
+			written = append(written, e.Path)
+		}
+	}
+	want := append([]string{r.WxsFile}, r.Files...)
+	if len(r.Files) != 2 || strings.Join(written, ",") != strings.Join(want, ",") {
+		t.Errorf("written events %q, want %q", written, want)
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	filename := writeProject(t, testSetup)
+	var events []Event
+	opts := testOptions(&events)
+	opts.Variables = map[string]string{"PRODUCT_VERSION": "2.0.0", "EXTRA": "{{PRODUCT_NAME}}-x"}
+
+	p, err := Parse(context.Background(), filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ProductVersion != "2.0.0" {
+		t.Errorf("ProductVersion = %s, want the override 2.0.0", p.ProductVersion)
+	}
+	if got := p.Variable("EXTRA"); got != "App-x" {
+		t.Errorf("EXTRA = %s, want App-x", got)
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	filename := writeProject(t, strings.Replace(testSetup, "</setup>", `<set name="INCLUDE_VCREDIST" value="True"/></setup>`, 1))
+	var events []Event
+	p, err := Parse(context.Background(), filename, testOptions(&events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Warnings) != 1 || !strings.Contains(p.Warnings[0], "INCLUDE_VCREDIST") {
+		t.Errorf("expected the deprecation warning, got %q", p.Warnings)
+	}
+	if len(events) != 0 {
+		t.Errorf("Parse returns its warnings instead of reporting them, got %+v", events)
+	}
+}
+
+func TestRequirementsAutoBundle(t *testing.T) {
+	filename := writeProject(t, strings.Replace(testSetup, "</setup>", `<requires type="vcredist" version="2022"/></setup>`, 1))
+	var events []Event
+	opts := testOptions(&events)
+	for _, standalone := range []bool{false, true} {
+		opts.Standalone = standalone
+		p, err := Parse(context.Background(), filename, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := Generate(context.Background(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.AutoBundle == standalone {
+			t.Errorf("Standalone=%v: AutoBundle = %v", standalone, g.AutoBundle)
+		}
+	}
+}
+
+func TestMergeModuleOutput(t *testing.T) {
+	filename := writeProject(t, strings.Replace(testSetup, "</setup>", `<requires type="vcredist" version="2022"/></setup>`, 1))
+	var events []Event
+	opts := testOptions(&events)
+	opts.Variables = map[string]string{"OUTPUT_TYPE": "msm"}
+
+	p, err := Parse(context.Background(), filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := Generate(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.AutoBundle {
+		t.Error("a merge module must not be wrapped in a bundle")
+	}
+	r, err := Render(context.Background(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Ext(r.OutputFile) != ".msm" {
+		t.Errorf("OutputFile = %s", r.OutputFile)
+	}
+	wxs, err := os.ReadFile(r.WxsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(wxs), `<Module Id="App"`) || !strings.Contains(string(wxs), "<ComponentGroup Id='FEATURE_00000'>") {
+		t.Errorf("unexpected merge module source:\n%s", wxs)
+	}
+}
+
+func TestBundleOutputType(t *testing.T) {
+	for _, outputType := range []string{"msm", "wixlib"} {
+		t.Run(outputType, func(t *testing.T) {
+			filename := writeProject(t, `<setup>
+  <set name="PRODUCT_NAME" value="App"/>
+  <set name="PRODUCT_VERSION" value="1.0.0"/>
+  <set name="UPGRADE_CODE" value="{11111111-2222-3333-4444-555555555555}"/>
+  <set name="OUTPUT_TYPE" value="`+outputType+`"/>
+  <bundle>
+    <msi source_64bit="App-1.0.0-x64.msi"/>
+  </bundle>
+</setup>`)
+			var events []Event
+			p, err := Parse(context.Background(), filename, testOptions(&events))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "OUTPUT_TYPE " + outputType + " cannot be used with a <bundle>"
+			if _, err := Generate(context.Background(), p); err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("expected error containing %q, got %v", want, err)
+			}
+		})
+	}
+}
+
+func TestRenderTransforms(t *testing.T) {
+	filename := writeProject(t, strings.Replace(testSetup, "</setup>", `<transform name="site-berlin"><property name="SERVER" value="berlin01"/></transform></setup>`, 1))
+	var events []Event
+	p, err := Parse(context.Background(), filename, testOptions(&events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := Generate(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Render(context.Background(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := strings.TrimSuffix(filename, ".msis")
+	want := RenderedTransform{Name: "site-berlin", WxsFile: base + "-site-berlin.wxs", File: base + "-site-berlin.mst"}
+	if len(r.Transforms) != 1 || r.Transforms[0] != want {
+		t.Fatalf("Transforms = %+v, want %+v", r.Transforms, want)
+	}
+
+	standard, err := os.ReadFile(r.WxsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := os.ReadFile(want.WxsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Both MSIs have the same product code, so the transform leaves it alone
+	productCode := `ProductCode="` + p.Variable("PRODUCT_CODE") + `"`
+	if p.Variable("PRODUCT_CODE") == "" || !strings.Contains(string(standard), productCode) || !strings.Contains(string(berlin), productCode) {
+		t.Errorf("expected %s in both WiX sources", productCode)
+	}
+	if strings.Contains(string(standard), "SERVER") || !strings.Contains(string(berlin), "<Property Id='SERVER' Value='berlin01'/>") {
+		t.Errorf("expected SERVER in the WiX source of the transform only:\n%s", berlin)
+	}
+}
+
+func TestRenderTransformsDefinedProperty(t *testing.T) {
+	// ARPNOREPAIR comes from the template, not from msis
+	filename := writeProject(t, strings.Replace(testSetup, "</setup>", `<transform name="a"><property name="ARPNOREPAIR" value="no"/></transform></setup>`, 1))
+	var events []Event
+	p, err := Parse(context.Background(), filename, testOptions(&events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := Generate(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "transform a: property ARPNOREPAIR is already defined"
+	if _, err := Render(context.Background(), g); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("expected error containing %q, got %v", want, err)
+	}
+}
+
+func TestRenderLanguages(t *testing.T) {
+	filename := writeProject(t, strings.Replace(testSetup, "</setup>", `<set name="LANGUAGES" value="en-us, de-de, fr-fr"/></setup>`, 1))
+	var events []Event
+	p, err := Parse(context.Background(), filename, testOptions(&events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(p.Languages, ",") != "en-us,de-de,fr-fr" || p.Variable("LANGUAGE") != "en-us" {
+		t.Errorf("Languages = %v, LANGUAGE = %s", p.Languages, p.Variable("LANGUAGE"))
+	}
+	g, err := Generate(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Render(context.Background(), g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := strings.TrimSuffix(filename, ".msis")
+	want := []RenderedLanguage{
+		{Culture: "de-de", LCID: "1031", WxsFile: base + "-de-de.wxs", File: base + "-de-de.mst"},
+		{Culture: "fr-fr", LCID: "1036", WxsFile: base + "-fr-fr.wxs", File: base + "-fr-fr.mst"},
+	}
+	if len(r.Languages) != 2 || r.Languages[0] != want[0] || r.Languages[1] != want[1] {
+		t.Fatalf("Languages = %+v, want %+v", r.Languages, want)
+	}
+
+	// The MSIs differ in their language only, so the transforms leave the
+	// product code alone
+	productCode := `ProductCode="` + p.Variable("PRODUCT_CODE") + `"`
+	for wxsFile, language := range map[string]string{r.WxsFile: "1033", want[0].WxsFile: "1031", want[1].WxsFile: "1036"} {
+		source, err := os.ReadFile(wxsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Variable("PRODUCT_CODE") == "" || !strings.Contains(string(source), productCode) {
+			t.Errorf("expected %s in %s", productCode, wxsFile)
+		}
+		if !strings.Contains(string(source), `Language="`+language+`"`) {
+			t.Errorf("expected language %s in %s", language, wxsFile)
+		}
+	}
+}
+
+func TestLanguagesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		want  string
+	}{
+		{"missing localization", `<set name="LANGUAGES" value="en-us,nl-nl,ko-kr"/>`, "no localization for nl-nl, ko-kr in"},
+		{"unknown culture", `<set name="LANGUAGES" value="en-us,xx-yy"/>`, "unknown culture xx-yy"},
+		{"same language", `<set name="LANGUAGES" value="en-us,english"/>`, "en-us and english are both language 1033"},
+		{"merge module", `<set name="LANGUAGES" value="en-us,de-de"/><set name="OUTPUT_TYPE" value="msm"/>`, "needs OUTPUT_TYPE msi"},
+		{"transform name", `<set name="LANGUAGES" value="en-us,de-de"/><transform name="de-de"><property name="SERVER" value="x"/></transform>`, "<transform> de-de has the name of a culture"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeProject(t, strings.Replace(testSetup, "</setup>", tt.extra+"</setup>", 1))
+			var events []Event
+			p, err := Parse(context.Background(), filename, testOptions(&events))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = Generate(context.Background(), p)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestInstallCommand(t *testing.T) {
+	dir := filepath.Join("out", "x64")
+	tests := []struct {
+		msi, mst, want string
+	}{
+		{"App-1.0.msi", "App-1.0-site.mst", "msiexec /i App-1.0.msi TRANSFORMS=App-1.0-site.mst"},
+		{"My App.msi", "My App-site.mst", `msiexec /i "My App.msi" TRANSFORMS="My App-site.mst"`},
+	}
+	for _, tt := range tests {
+		if got := installCommand(filepath.Join(dir, tt.msi), filepath.Join(dir, tt.mst)); got != tt.want {
+			t.Errorf("installCommand = %s, want %s", got, tt.want)
+		}
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	filename := writeProject(t, testSetup)
+	var events []Event
+	opts := testOptions(&events)
+
+	p, err := Parse(context.Background(), filename, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Parse(ctx, filename, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("Parse: expected context.Canceled, got %v", err)
+	}
+	if _, err := Generate(ctx, p); !errors.Is(err, context.Canceled) {
+		t.Errorf("Generate: expected context.Canceled, got %v", err)
+	}
+}
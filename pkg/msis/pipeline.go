@@ -0,0 +1,538 @@
+package msis
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gersonkurz/msis/internal/bundle"
+	"github.com/gersonkurz/msis/internal/generator"
+	"github.com/gersonkurz/msis/internal/ice"
+	"github.com/gersonkurz/msis/internal/ir"
+	"github.com/gersonkurz/msis/internal/manifest"
+	"github.com/gersonkurz/msis/internal/migrate"
+	"github.com/gersonkurz/msis/internal/parser"
+	"github.com/gersonkurz/msis/internal/template"
+	"github.com/gersonkurz/msis/internal/variables"
+)
+
+// Project is a parsed .msis file with its variables resolved.
+type Project struct {
+	File           string   `json:"file"`
+	ProductName    string   `json:"productName"`
+	ProductVersion string   `json:"productVersion"`
+	Platform       string   `json:"platform"`
+	Bundle         bool     `json:"bundle"`     // The setup is a bundle (bootstrapper)
+	OutputType     string   `json:"outputType"` // msi, msm or wixlib, from OUTPUT_TYPE
+	Sets           int      `json:"sets"`
+	Features       int      `json:"features"`
+	Items          int      `json:"items"`               // Top-level items outside features
+	Requirements   int      `json:"requirements"`        // <requires> elements
+	Languages      []string `json:"languages,omitempty"` // Cultures of LANGUAGES; the first is the package language
+	Warnings       []string `json:"warnings,omitempty"`
+
+	opts  Options
+	setup *ir.Setup
+	vars  variables.Dictionary
+}
+
+// Variable returns the resolved value of a variable.
+func (p *Project) Variable(name string) string {
+	return p.vars.Get(name)
+}
+
+// Generated is the WiX model of a project.
+type Generated struct {
+	Project       *Project        `json:"-"`
+	Directories   int             `json:"directories"`
+	Components    int             `json:"components"`
+	Prerequisites int             `json:"prerequisites"` // Bundle prerequisites
+	ExePackages   int             `json:"exePackages"`   // Bundle exe packages
+	AutoBundle    bool            `json:"autoBundle"`    // Build wraps the MSI in a bundle with the <requires>
+	Findings      []Finding       `json:"findings,omitempty"`
+	Baseline      *BaselineReport `json:"baseline,omitempty"`
+
+	ctx    *generator.Context
+	output *generator.GeneratedOutput
+	chain  *bundle.GeneratedBundle
+}
+
+// Finding is an ICE check violation, found with Options.Validate.
+type Finding struct {
+	ICE      string `json:"ice"`      // e.g. ICE30
+	Severity string `json:"severity"` // error or warning
+	Message  string `json:"message"`
+	Line     int    `json:"line,omitempty"` // Position of the .msis element, if known
+	Column   int    `json:"column,omitempty"`
+}
+
+// BaselineReport is the component rules check against Options.Baseline.
+type BaselineReport struct {
+	Version  string            `json:"version"`  // Product version of the baseline
+	Severity string            `json:"severity"` // info, major or unsafe
+	Verdict  string            `json:"verdict"`
+	Findings []BaselineFinding `json:"findings,omitempty"`
+}
+
+// BaselineFinding is a difference from the baseline.
+type BaselineFinding struct {
+	Severity string `json:"severity"` // info, major or unsafe
+	Message  string `json:"message"`
+}
+
+// Rendered is a project rendered to WiX source.
+type Rendered struct {
+	Generated  *Generated          `json:"-"`
+	WxsFile    string              `json:"wxsFile"`
+	OutputFile string              `json:"outputFile"` // The .msi, or .exe of a bundle, that Build creates
+	Files      []string            `json:"files,omitempty"`
+	Transforms []RenderedTransform `json:"transforms,omitempty"`
+	Languages  []RenderedLanguage  `json:"languages,omitempty"`
+}
+
+// RenderedTransform is a <transform> rendered to the WiX source of the MSI
+// with its property defaults. Build creates the transform from the standard
+// MSI to that MSI.
+type RenderedTransform struct {
+	Name    string `json:"name"`
+	WxsFile string `json:"wxsFile"`
+	File    string `json:"file"` // The .mst that Build creates
+}
+
+// RenderedLanguage is a further culture of LANGUAGES rendered to the WiX
+// source of the MSI in that language. Build creates the language transform
+// from the MSI to it and embeds it in the MSI.
+type RenderedLanguage struct {
+	Culture string `json:"culture"`
+	LCID    string `json:"lcid"`
+	WxsFile string `json:"wxsFile"`
+	File    string `json:"file"` // The .mst that Build creates and embeds
+}
+
+// Parse reads an .msis file and resolves its variables, with the overrides
+// of opts.Variables applied. Problems of the file are returned in
+// Project.Warnings rather than reported.
+func Parse(ctx context.Context, filename string, opts Options) (*Project, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.TemplateFolder == "" {
+		opts.TemplateFolder = DefaultTemplateFolder()
+	}
+	if opts.CustomTemplates == "" {
+		opts.CustomTemplates = DefaultCustomTemplates()
+	}
+
+	setup, err := parser.Parse(filename)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	vars := variables.New()
+	vars.LoadFromSetup(setup)
+	names := make([]string, 0, len(opts.Variables))
+	for name := range opts.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vars.Set(name, opts.Variables[name])
+	}
+	if err := vars.ResolveAll(); err != nil {
+		return nil, fmt.Errorf("resolving variables: %w", err)
+	}
+	// The first culture of a multi-language MSI is the package language
+	languages := vars.Languages()
+	if len(languages) > 0 {
+		vars.Set("LANGUAGE", languages[0])
+	}
+
+	p := &Project{
+		File:           filename,
+		ProductName:    vars.ProductName(),
+		ProductVersion: vars.ProductVersion(),
+		Platform:       vars.Platform(),
+		Bundle:         setup.IsSetupBundle(),
+		OutputType:     vars.OutputType(),
+		Sets:           len(setup.Sets),
+		Features:       len(setup.Features),
+		Items:          len(setup.Items),
+		Requirements:   len(setup.Requires),
+		Languages:      languages,
+		opts:           opts,
+		setup:          setup,
+		vars:           vars,
+	}
+
+	// Check for deprecated variables
+	deprecated := vars.CheckDeprecated()
+	p.Warnings = append(p.Warnings, deprecated...)
+
+	// Warn when VC++ runtime files appear to be bundled without <requires>.
+	if len(setup.Requires) == 0 && len(deprecated) == 0 {
+		if migrate.CopiesVCRuntime(setup) || migrate.HasVCRuntimeFolder(p.workDir()) {
+			p.Warnings = append(p.Warnings, "VC++ runtime files detected but no <requires> element. msis-3.x no longer bundles VC runtimes implicitly (msis-2.x did). Add <requires type=\"vcredist\" version=\"2022\"/> or provide prerequisites.")
+		}
+	}
+	return p, nil
+}
+
+// warn records and reports a warning of a later step.
+func (p *Project) warn(message string) {
+	p.Warnings = append(p.Warnings, message)
+	p.opts.report(Warning, message, "")
+}
+
+// workDir is the folder of the .msis file; sources are relative to it.
+func (p *Project) workDir() string {
+	return filepath.Dir(p.File)
+}
+
+// Generate builds the WiX model of a project: the directories, components
+// and features of an MSI, or the chain of a bundle. With Options.Validate
+// and Options.Baseline the component model is checked; a failed check
+// returns the result together with the error, so its findings can be shown.
+func Generate(ctx context.Context, p *Project) (*Generated, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if p.Bundle && p.OutputType != variables.OutputMSI {
+		return nil, fmt.Errorf("OUTPUT_TYPE %s cannot be used with a <bundle>", p.OutputType)
+	}
+	if p.Bundle {
+		return generateBundle(p, nil)
+	}
+
+	if err := p.checkLanguages(); err != nil {
+		return nil, err
+	}
+	// Merge modules and libraries are consumed by other setups, which
+	// handle their own prerequisites
+	autoBundle := p.Requirements > 0 && !p.opts.Standalone && p.OutputType == variables.OutputMSI
+	g := &Generated{Project: p, AutoBundle: autoBundle}
+	g.ctx = generator.NewContext(p.setup, p.vars, p.workDir())
+	output, err := g.ctx.Generate()
+	if err != nil {
+		return nil, fmt.Errorf("generating WXS: %w", err)
+	}
+	g.output = output
+	g.Directories = len(g.ctx.DirectoryTrees)
+	for _, compIDs := range g.ctx.FeatureComponents {
+		g.Components += len(compIDs)
+	}
+
+	// Component rules check against the previous release
+	if p.opts.Baseline != "" || p.opts.SaveBaseline != "" {
+		if err := g.checkBaseline(); err != nil {
+			return g, err
+		}
+	}
+	if p.opts.Validate {
+		if err := g.validate(); err != nil {
+			return g, err
+		}
+	}
+	return g, nil
+}
+
+// generateBundle generates the chain of a bundle; configure may prepare the
+// generator first, e.g. with the prerequisite cache.
+func generateBundle(p *Project, configure func(*bundle.Generator) error) (*Generated, error) {
+	gen := bundle.NewGenerator(p.setup, p.vars, p.workDir())
+	if configure != nil {
+		if err := configure(gen); err != nil {
+			return nil, err
+		}
+	}
+	chain, err := gen.Generate()
+	if err != nil {
+		return nil, fmt.Errorf("generating bundle: %w", err)
+	}
+	return &Generated{
+		Project:       p,
+		Prerequisites: len(p.setup.Bundle.Prerequisites),
+		ExePackages:   len(p.setup.Bundle.ExePackages),
+		chain:         chain,
+	}, nil
+}
+
+// checkBaseline compares the component set with the baseline manifest
+// and/or saves the current component set as the baseline for the next release.
+func (g *Generated) checkBaseline() error {
+	opts := &g.Project.opts
+	current := manifest.Build(g.ctx)
+
+	if opts.Baseline != "" {
+		baseline, err := manifest.Load(opts.Baseline)
+		if err != nil {
+			return fmt.Errorf("loading baseline: %w", err)
+		}
+		report := manifest.CheckBaseline(baseline, current)
+		g.Baseline = &BaselineReport{
+			Version:  baseline.Product.Version,
+			Severity: report.Severity().String(),
+			Verdict:  report.Verdict(),
+		}
+		for _, f := range report.Findings {
+			g.Baseline.Findings = append(g.Baseline.Findings, BaselineFinding{Severity: f.Severity.String(), Message: f.Message})
+		}
+		if report.Severity() == manifest.SeverityUnsafe {
+			return fmt.Errorf("baseline check: %s", report.Verdict())
+		}
+	}
+
+	if opts.SaveBaseline != "" {
+		if err := current.Save(opts.SaveBaseline); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate runs the ICE checks on the component model. Error findings
+// fail the build.
+func (g *Generated) validate() error {
+	errors := 0
+	for _, f := range ice.Validate(g.ctx) {
+		if f.Severity == ice.Error {
+			errors++
+		}
+		g.Findings = append(g.Findings, Finding{
+			ICE:      f.ICE,
+			Severity: string(f.Severity),
+			Message:  f.Message,
+			Line:     f.Pos.Line,
+			Column:   f.Pos.Column,
+		})
+	}
+	if errors > 0 {
+		return fmt.Errorf("validation failed with %d ICE errors", errors)
+	}
+	return nil
+}
+
+// Render fills the WiX template with the generated model and writes the
+// .wxs file. With Options.Manifest, the build manifest and SBOM of an MSI
+// are written too.
+func Render(ctx context.Context, g *Generated) (*Rendered, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p := g.Project
+	r := &Rendered{Generated: g}
+	if p.Bundle {
+		r.WxsFile, r.OutputFile = bundleFiles(p.vars)
+		if err := r.writeBundle(g.chain); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	// The MSIs of the transforms and languages share the product code of
+	// the standard MSI, so that the transforms leave it alone
+	if (len(g.output.Transforms) > 0 || len(p.Languages) > 1) && p.vars.Get("PRODUCT_CODE") == "" {
+		p.vars.Set("PRODUCT_CODE", generator.GenerateGUID(p.vars.UpgradeCode()+"/"+p.ProductVersion+"/"+p.Platform))
+	}
+
+	wxsContent, err := renderWxs(p, p.vars, g.output)
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine output filename
+	r.WxsFile = parser.TrimExt(p.File) + ".wxs"
+	if target := p.vars.BuildTarget(); target != "" {
+		r.WxsFile = strings.TrimSuffix(target, filepath.Ext(target)) + ".wxs"
+	}
+	if err := os.WriteFile(r.WxsFile, []byte(wxsContent), 0644); err != nil {
+		return nil, fmt.Errorf("writing WXS file: %w", err)
+	}
+	p.opts.report(Written, "WiX source", r.WxsFile)
+
+	// Compute actual output path (same logic as wix.NewBuilder)
+	r.OutputFile = p.vars.BuildTarget()
+	if r.OutputFile == "" {
+		r.OutputFile = strings.TrimSuffix(r.WxsFile, filepath.Ext(r.WxsFile)) + "." + p.OutputType
+	}
+
+	if len(g.output.Transforms) > 0 {
+		defined, err := wxsProperties(wxsContent)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range g.output.Transforms {
+			if err := r.renderTransform(t, defined); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(p.Languages) > 1 {
+		for _, culture := range p.Languages[1:] {
+			if err := r.renderLanguage(culture); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.opts.Manifest {
+		if err := r.writeManifest(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// renderTransform writes the WiX source of the MSI of a transform: the
+// standard MSI with the property defaults of the transform. It cannot set
+// the properties the standard MSI defines, as WiX allows one <Property> per
+// ID.
+func (r *Rendered) renderTransform(t generator.Transform, defined map[string]bool) error {
+	p := r.Generated.Project
+	for _, name := range t.Properties {
+		if defined[name] {
+			return fmt.Errorf("transform %s: property %s is already defined by the setup or its template", t.Name, name)
+		}
+	}
+	output := *r.Generated.output
+	if output.PackageXML != "" {
+		output.PackageXML += "\n"
+	}
+	output.PackageXML += t.PackageXML
+	wxsContent, err := renderWxs(p, p.vars, &output)
+	if err != nil {
+		return fmt.Errorf("transform %s: %w", t.Name, err)
+	}
+
+	rt := RenderedTransform{
+		Name:    t.Name,
+		WxsFile: strings.TrimSuffix(r.WxsFile, filepath.Ext(r.WxsFile)) + "-" + t.Name + ".wxs",
+		File:    strings.TrimSuffix(r.OutputFile, filepath.Ext(r.OutputFile)) + "-" + t.Name + ".mst",
+	}
+	if err := os.WriteFile(rt.WxsFile, []byte(wxsContent), 0644); err != nil {
+		return fmt.Errorf("writing WXS file of transform %s: %w", t.Name, err)
+	}
+	p.opts.report(Written, "WiX source of transform "+t.Name, rt.WxsFile)
+	r.Transforms = append(r.Transforms, rt)
+	return nil
+}
+
+// wxsProperties returns the IDs of the <Property> elements of a WiX source.
+func wxsProperties(wxsContent string) (map[string]bool, error) {
+	ids := make(map[string]bool)
+	d := xml.NewDecoder(strings.NewReader(wxsContent))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading properties of the WiX source: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "Property" {
+			for _, a := range start.Attr {
+				if a.Name.Local == "Id" {
+					ids[a.Value] = true
+				}
+			}
+		}
+	}
+}
+
+// renderWxs fills the WiX template with the generated fragments.
+func renderWxs(p *Project, vars variables.Dictionary, output *generator.GeneratedOutput) (string, error) {
+	renderer := template.NewRenderer(vars, p.opts.TemplateFolder, p.opts.CustomTemplates, output)
+
+	// Support custom template override
+	if p.opts.Template != "" {
+		renderer.SetCustomTemplate(p.opts.Template)
+	}
+	return renderer.RenderSetup(p.setup.Silent)
+}
+
+// writeManifest writes the JSON build manifest and a CycloneDX SBOM next to the MSI.
+func (r *Rendered) writeManifest() error {
+	g := r.Generated
+	opts := &g.Project.opts
+	m := manifest.Build(g.ctx)
+	if err := m.AddFileDetails(g.ctx.WorkDir); err != nil {
+		return fmt.Errorf("building manifest: %w", err)
+	}
+
+	base := strings.TrimSuffix(r.OutputFile, filepath.Ext(r.OutputFile))
+	manifestFile := base + ".manifest.json"
+	if err := m.Save(manifestFile); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, manifestFile)
+	opts.report(Written, "build manifest", manifestFile)
+
+	sbomFile := base + ".cdx.json"
+	if err := m.SaveSBOM(sbomFile, time.Now()); err != nil {
+		return err
+	}
+	r.Files = append(r.Files, sbomFile)
+	opts.report(Written, "SBOM", sbomFile)
+	return nil
+}
+
+// bundleFiles returns the .wxs and .exe files of a bundle.
+func bundleFiles(vars variables.Dictionary) (wxsFile, exeFile string) {
+	baseName := vars.BuildTarget()
+	if baseName == "" {
+		baseName = vars.ProductName() + "-" + vars.ProductVersion()
+	}
+	baseName = strings.TrimSuffix(baseName, filepath.Ext(baseName))
+	return baseName + "-bundle.wxs", baseName + ".exe"
+}
+
+// writeBundle renders the bundle template with a chain and writes the .wxs.
+func (r *Rendered) writeBundle(chain *bundle.GeneratedBundle) error {
+	p := r.Generated.Project
+	wxsContent, err := renderBundleTemplate(p, chain)
+	if err != nil {
+		return fmt.Errorf("rendering bundle template: %w", err)
+	}
+	if err := os.WriteFile(r.WxsFile, []byte(wxsContent), 0644); err != nil {
+		return fmt.Errorf("writing bundle WXS file: %w", err)
+	}
+	p.opts.report(Written, "bundle WiX source", r.WxsFile)
+	return nil
+}
+
+// renderBundleTemplate renders the bundle WXS template.
+func renderBundleTemplate(p *Project, chain *bundle.GeneratedBundle) (string, error) {
+	// Read bundle template
+	templateName := "bundle.wxs"
+	if p.setup.Silent {
+		templateName = "bundle-silent.wxs"
+	}
+
+	templatePath := filepath.Join(p.opts.TemplateFolder, templateName)
+	if p.opts.CustomTemplates != "" {
+		customPath := filepath.Join(p.opts.CustomTemplates, templateName)
+		if _, err := os.Stat(customPath); err == nil {
+			templatePath = customPath
+		}
+	}
+
+	tmplContent, err := os.ReadFile(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("reading bundle template: %w", err)
+	}
+
+	// Build context for template
+	ctx := make(map[string]interface{})
+	for k, v := range p.vars {
+		ctx[k] = v
+	}
+	ctx["CHAIN"] = chain.ChainXML
+
+	// Render using raymond (same as MSI templates)
+	return template.RenderString(string(tmplContent), ctx)
+}